@@ -38,6 +38,11 @@ const (
 	// on the reconciled object.
 	PausedAnnotation = "cluster.x-k8s.io/paused"
 
+	// ProxyURLAnnotation is the annotation set on a Cluster to the URL of an HTTP proxy that controllers must use to
+	// reach the cluster's API server, e.g. when the workload cluster is in an isolated network. Changing it drops the
+	// cached client of the cluster, so that the next one uses the new proxy.
+	ProxyURLAnnotation = "cluster.x-k8s.io/proxy-url"
+
 	// TemplateClonedFromNameAnnotation is the infrastructure machine annotation that stores the name of the infrastructure template resource
 	// that was cloned for the machine. This annotation is set only during cloning a template. Older/adopted machines will not have this annotation.
 	TemplateClonedFromNameAnnotation = "cluster.x-k8s.io/cloned-from-name"
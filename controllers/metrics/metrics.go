@@ -93,6 +93,37 @@ var (
 		},
 		[]string{"machine", "namespace", "cluster"},
 	)
+
+	// ClusterResourceSetReconcileDuration is a metric that observes how long
+	// reconciling a ClusterResourceSet takes.
+	ClusterResourceSetReconcileDuration = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "capi_clusterresourceset_reconcile_duration_seconds",
+			Help:    "Duration of ClusterResourceSet reconciles in seconds.",
+			Buckets: prometheus.ExponentialBuckets(0.01, 2, 15),
+		},
+		[]string{"namespace"},
+	)
+
+	// ClusterResourceSetPendingClusters is a metric that is set to the number
+	// of matching clusters the ClusterResourceSet resources are not applied to yet.
+	ClusterResourceSetPendingClusters = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "capi_clusterresourceset_pending_clusters",
+			Help: "Number of clusters the ClusterResourceSet resources are not applied to yet.",
+		},
+		[]string{"clusterresourceset", "namespace"},
+	)
+
+	// ClusterResourceSetAppliedBytes is a metric that is set to the size of the
+	// manifests the ClusterResourceSet applied to a cluster.
+	ClusterResourceSetAppliedBytes = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "capi_clusterresourceset_applied_bytes",
+			Help: "Size in bytes of the manifests the ClusterResourceSet applied to the cluster.",
+		},
+		[]string{"clusterresourceset", "namespace", "cluster"},
+	)
 )
 
 func init() {
@@ -104,5 +135,8 @@ func init() {
 		MachineBootstrapReady,
 		MachineInfrastructureReady,
 		MachineNodeReady,
+		ClusterResourceSetReconcileDuration,
+		ClusterResourceSetPendingClusters,
+		ClusterResourceSetAppliedBytes,
 	)
 }
@@ -18,11 +18,14 @@ package remote
 
 import (
 	"context"
+	"net/http"
+	"net/url"
 
 	"github.com/pkg/errors"
 	"k8s.io/apimachinery/pkg/runtime"
 	restclient "k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/transport"
 	kcfg "sigs.k8s.io/cluster-api/util/kubeconfig"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 )
@@ -57,3 +60,30 @@ func RESTConfig(ctx context.Context, c client.Reader, cluster client.ObjectKey)
 
 	return restConfig, nil
 }
+
+// WithProxy configures restConfig to send requests through the HTTP proxy at proxyURL.
+// It is a no-op if proxyURL is empty, in which case the proxy is taken from the HTTPS_PROXY and NO_PROXY
+// environment variables, if set.
+func WithProxy(restConfig *restclient.Config, proxyURL string) error {
+	if proxyURL == "" {
+		return nil
+	}
+	u, err := url.Parse(proxyURL)
+	if err != nil {
+		return errors.Wrapf(err, "invalid proxy URL %q", proxyURL)
+	}
+
+	proxy := func(rt http.RoundTripper) http.RoundTripper {
+		t, ok := rt.(*http.Transport)
+		if !ok {
+			return rt
+		}
+		// The transport is shared between configurations with the same TLS settings, so it must not be modified.
+		t = t.Clone()
+		t.Proxy = http.ProxyURL(u)
+		return t
+	}
+	// The proxy must be set on the base transport, before any other wrapper is applied.
+	restConfig.WrapTransport = transport.Wrappers(proxy, restConfig.WrapTransport)
+	return nil
+}
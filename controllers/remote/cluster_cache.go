@@ -19,6 +19,7 @@ package remote
 import (
 	"context"
 	"fmt"
+	"net/url"
 	"reflect"
 	"sync"
 	"time"
@@ -27,6 +28,7 @@ import (
 	"github.com/pkg/errors"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/runtime/serializer"
@@ -53,10 +55,15 @@ const (
 	healthCheckUnhealthyThreshold = 10
 )
 
-// clusterCache embeds cache.Cache and combines it with a stop channel.
+// clusterCache embeds cache.Cache and combines it with a stop channel and the RESTMapper of the cluster.
 type clusterCache struct {
 	cache.Cache
 
+	mapper meta.RESTMapper
+
+	// proxyURL is the URL of the HTTP proxy the cache and the client of the cluster send their requests through, if any.
+	proxyURL string
+
 	lock    sync.Mutex
 	stopped bool
 	stop    chan struct{}
@@ -81,30 +88,82 @@ type ClusterCacheTracker struct {
 	client client.Client
 	scheme *runtime.Scheme
 
+	// delegatingClientsLock guards delegatingClients and uncachedClients, the latter being the clients the former
+	// write with, which read from the API server rather than from the cache.
 	delegatingClientsLock sync.RWMutex
 	delegatingClients     map[client.ObjectKey]*client.DelegatingClient
+	uncachedClients       map[client.ObjectKey]client.Client
 
 	clusterCachesLock sync.RWMutex
 	clusterCaches     map[client.ObjectKey]*clusterCache
 
 	watchesLock sync.RWMutex
 	watches     map[client.ObjectKey]map[watchInfo]struct{}
+
+	// capacity is the maximum number of clusters clients are kept for, or 0 if unlimited.
+	capacity int
+
+	// defaultProxyURL is the URL of the HTTP proxy used for clusters without a proxy URL annotation, if any.
+	defaultProxyURL string
+
+	// usageLock guards lastUsed and inUse, which tell the clients to remove to stay within capacity. inUse counts the
+	// acquisitions of each client, which are released by decrementing the counter they incremented, so that releasing
+	// a client acquired before it was removed does not affect the count of the client created to replace it.
+	usageLock sync.Mutex
+	lastUsed  map[client.ObjectKey]time.Time
+	inUse     map[client.ObjectKey]*int
+}
+
+// ClusterCacheTrackerOption configures a ClusterCacheTracker.
+type ClusterCacheTrackerOption func(*ClusterCacheTracker)
+
+// WithCapacity limits the number of workload clusters the ClusterCacheTracker keeps a client and a cache for.
+// When a client is needed for another cluster, the least recently used client of a cluster without watches is
+// removed along with its cache. Clients acquired with AcquireClient are not removed until they are released.
+// A capacity of 0 means unlimited.
+func WithCapacity(capacity int) ClusterCacheTrackerOption {
+	return func(m *ClusterCacheTracker) {
+		m.capacity = capacity
+	}
+}
+
+// WithDefaultProxyURL sends the requests to workload clusters through the HTTP proxy at proxyURL, unless a Cluster
+// sets another one in its proxy URL annotation. An empty proxyURL means clusters are connected to directly.
+func WithDefaultProxyURL(proxyURL string) ClusterCacheTrackerOption {
+	return func(m *ClusterCacheTracker) {
+		m.defaultProxyURL = proxyURL
+	}
 }
 
 // NewClusterCacheTracker creates a new ClusterCacheTracker.
-func NewClusterCacheTracker(log logr.Logger, manager ctrl.Manager) (*ClusterCacheTracker, error) {
+func NewClusterCacheTracker(log logr.Logger, manager ctrl.Manager, opts ...ClusterCacheTrackerOption) (*ClusterCacheTracker, error) {
 	m := &ClusterCacheTracker{
 		log:               log,
 		client:            manager.GetClient(),
 		scheme:            manager.GetScheme(),
 		delegatingClients: make(map[client.ObjectKey]*client.DelegatingClient),
+		uncachedClients:   make(map[client.ObjectKey]client.Client),
 		clusterCaches:     make(map[client.ObjectKey]*clusterCache),
 		watches:           make(map[client.ObjectKey]map[watchInfo]struct{}),
+		lastUsed:          make(map[client.ObjectKey]time.Time),
+		inUse:             make(map[client.ObjectKey]*int),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	if _, err := url.Parse(m.defaultProxyURL); err != nil {
+		return nil, errors.Wrapf(err, "invalid default proxy URL %q", m.defaultProxyURL)
 	}
 
 	return m, nil
 }
 
+// Capacity returns the maximum number of workload clusters the ClusterCacheTracker keeps a client for, or 0 if it
+// is unlimited.
+func (m *ClusterCacheTracker) Capacity() int {
+	return m.capacity
+}
+
 // Watcher is a scoped-down interface from Controller that only knows how to watch.
 type Watcher interface {
 	// Watch watches src for changes, sending events to eventHandler if they pass predicates.
@@ -229,11 +288,85 @@ func (m *ClusterCacheTracker) Watch(ctx context.Context, input WatchInput) error
 	return nil
 }
 
-// GetClient returns a client for the given cluster.
+// GetClient returns a client for the given cluster. With a capacity, the client of a cluster without watches may be
+// removed along with its cache while it is used, use AcquireClient to prevent it.
 func (m *ClusterCacheTracker) GetClient(ctx context.Context, cluster client.ObjectKey) (client.Client, error) {
+	m.usageLock.Lock()
+	m.lastUsed[cluster] = time.Now()
+	m.usageLock.Unlock()
+
 	return m.getOrCreateDelegatingClient(ctx, cluster)
 }
 
+// AcquireClient returns a client for the given cluster, which is not removed to stay within capacity until the
+// returned release function is called.
+func (m *ClusterCacheTracker) AcquireClient(ctx context.Context, cluster client.ObjectKey) (client.Client, func(), error) {
+	release := m.acquire(cluster)
+	c, err := m.getOrCreateDelegatingClient(ctx, cluster)
+	if err != nil {
+		release()
+		return nil, nil, err
+	}
+	return c, release, nil
+}
+
+// AcquireUncachedClient returns a client for the given cluster that reads from the API server rather than from the
+// cache, so that reading objects does not start an informer of their kind in the cluster. It is not removed to stay
+// within capacity until the returned release function is called.
+func (m *ClusterCacheTracker) AcquireUncachedClient(ctx context.Context, cluster client.ObjectKey) (client.Client, func(), error) {
+	release := m.acquire(cluster)
+	if _, err := m.getOrCreateDelegatingClient(ctx, cluster); err != nil {
+		release()
+		return nil, nil, err
+	}
+
+	m.delegatingClientsLock.RLock()
+	defer m.delegatingClientsLock.RUnlock()
+	c, ok := m.uncachedClients[cluster]
+	if !ok {
+		// The client was removed along with its cache since it was created, e.g. by the health check.
+		release()
+		return nil, nil, errors.Errorf("client for Cluster %s/%s was removed", cluster.Namespace, cluster.Name)
+	}
+	return c, release, nil
+}
+
+// acquire marks the client of the cluster in use until the returned release function is called. The client is marked
+// in use before it is created, so that it is not removed by another cluster's client being created concurrently.
+func (m *ClusterCacheTracker) acquire(cluster client.ObjectKey) func() {
+	m.usageLock.Lock()
+	m.lastUsed[cluster] = time.Now()
+	count := m.inUse[cluster]
+	if count == nil {
+		count = new(int)
+		m.inUse[cluster] = count
+	}
+	*count++
+	m.usageLock.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			m.usageLock.Lock()
+			defer m.usageLock.Unlock()
+
+			if *count--; *count <= 0 && m.inUse[cluster] == count {
+				delete(m.inUse, cluster)
+			}
+		})
+	}
+}
+
+// GetRESTMapper returns the RESTMapper of the given cluster, which maps the kinds served by the cluster's API server
+// rather than the management cluster's.
+func (m *ClusterCacheTracker) GetRESTMapper(ctx context.Context, cluster client.ObjectKey) (meta.RESTMapper, error) {
+	cache, err := m.getOrCreateClusterCache(ctx, cluster)
+	if err != nil {
+		return nil, err
+	}
+	return cache.mapper, nil
+}
+
 // getOrCreateClusterClient returns a delegating client for the specified cluster, creating a new one if needed.
 func (m *ClusterCacheTracker) getOrCreateDelegatingClient(ctx context.Context, cluster client.ObjectKey) (client.Client, error) {
 	c := m.getDelegatingClient(cluster)
@@ -263,11 +396,15 @@ func (m *ClusterCacheTracker) newDelegatingClient(ctx context.Context, cluster c
 		return delegatingClient, nil
 	}
 
+	if m.capacity > 0 && len(m.delegatingClients) >= m.capacity {
+		m.evictLeastRecentlyUsed()
+	}
+
 	cache, err := m.getOrCreateClusterCache(ctx, cluster)
 	if err != nil {
 		return nil, err
 	}
-	config, err := RESTConfig(ctx, m.client, cluster)
+	config, _, err := m.restConfig(ctx, cluster)
 	if err != nil {
 		return nil, errors.Wrap(err, "error fetching REST client config for remote cluster")
 	}
@@ -282,14 +419,88 @@ func (m *ClusterCacheTracker) newDelegatingClient(ctx context.Context, cluster c
 		StatusClient: c,
 	}
 	m.delegatingClients[cluster] = delegatingClient
+	m.uncachedClients[cluster] = c
 	return delegatingClient, nil
 }
 
+// restConfig returns the REST configuration for the cluster, and the URL of the HTTP proxy it sends the requests
+// through, if any.
+func (m *ClusterCacheTracker) restConfig(ctx context.Context, cluster client.ObjectKey) (*rest.Config, string, error) {
+	config, err := RESTConfig(ctx, m.client, cluster)
+	if err != nil {
+		return nil, "", err
+	}
+
+	c := &clusterv1.Cluster{}
+	if err := m.client.Get(ctx, cluster, c); err != nil && !apierrors.IsNotFound(err) {
+		return nil, "", errors.Wrapf(err, "failed to get Cluster %s/%s", cluster.Namespace, cluster.Name)
+	}
+	proxyURL := m.proxyURL(c)
+	if err := WithProxy(config, proxyURL); err != nil {
+		return nil, "", errors.Wrapf(err, "failed to configure proxy for Cluster %s/%s", cluster.Namespace, cluster.Name)
+	}
+	return config, proxyURL, nil
+}
+
+// proxyURL returns the URL of the HTTP proxy set in the Cluster's proxy URL annotation, or else the default proxy URL.
+func (m *ClusterCacheTracker) proxyURL(c *clusterv1.Cluster) string {
+	if u, ok := c.Annotations[clusterv1.ProxyURLAnnotation]; ok {
+		return u
+	}
+	return m.defaultProxyURL
+}
+
+// evictLeastRecentlyUsed removes the least recently used client of a cluster without watches, and its cache, to make
+// room for another client. Clients in use are not removed, as stopping their cache would fail the reads in progress.
+// It must be called with the delegatingClientsLock held.
+func (m *ClusterCacheTracker) evictLeastRecentlyUsed() {
+	var candidate *client.ObjectKey
+	var oldest time.Time
+
+	m.watchesLock.RLock()
+	m.usageLock.Lock()
+	for cluster := range m.delegatingClients {
+		if len(m.watches[cluster]) > 0 || m.inUse[cluster] != nil {
+			continue
+		}
+		if used := m.lastUsed[cluster]; candidate == nil || used.Before(oldest) {
+			c := cluster
+			candidate, oldest = &c, used
+		}
+	}
+	if candidate != nil {
+		delete(m.lastUsed, *candidate)
+	}
+	m.usageLock.Unlock()
+	m.watchesLock.RUnlock()
+
+	if candidate == nil {
+		m.log.Info("Exceeding the capacity of the cluster cache tracker, as all the cached clusters have watches or are in use", "capacity", m.capacity)
+		return
+	}
+
+	m.log.V(4).Info("Removing the least recently used client to stay within capacity", "namespace", candidate.Namespace, "cluster", candidate.Name)
+	delete(m.delegatingClients, *candidate)
+	delete(m.uncachedClients, *candidate)
+	if c := m.getClusterCache(*candidate); c != nil {
+		c.Stop()
+		m.deleteClusterCache(*candidate)
+	}
+}
+
+// deleteDelegatingClient removes the client of cluster, along with its usage.
 func (m *ClusterCacheTracker) deleteDelegatingClient(cluster client.ObjectKey) {
 	m.delegatingClientsLock.Lock()
 	defer m.delegatingClientsLock.Unlock()
 
 	delete(m.delegatingClients, cluster)
+	delete(m.uncachedClients, cluster)
+
+	m.usageLock.Lock()
+	defer m.usageLock.Unlock()
+
+	delete(m.lastUsed, cluster)
+	delete(m.inUse, cluster)
 }
 
 // getOrCreateClusterCache returns the clusterCache for cluster, creating a new ClusterCache if needed.
@@ -321,7 +532,7 @@ func (m *ClusterCacheTracker) newClusterCache(ctx context.Context, cluster clien
 		return c, nil
 	}
 
-	config, err := RESTConfig(ctx, m.client, cluster)
+	config, proxyURL, err := m.restConfig(ctx, cluster)
 	if err != nil {
 		return nil, errors.Wrap(err, "error fetching REST client config for remote cluster")
 	}
@@ -342,8 +553,10 @@ func (m *ClusterCacheTracker) newClusterCache(ctx context.Context, cluster clien
 	stop := make(chan struct{})
 
 	cc := &clusterCache{
-		Cache: remoteCache,
-		stop:  stop,
+		Cache:    remoteCache,
+		mapper:   mapper,
+		proxyURL: proxyURL,
+		stop:     stop,
 	}
 	m.clusterCaches[cluster] = cc
 
@@ -483,7 +696,7 @@ func healthCheckPath(sourceCfg *rest.Config, requestTimeout time.Duration, path
 }
 
 // ClusterCacheReconciler is responsible for stopping remote cluster caches when
-// the cluster for the remote cache is being deleted.
+// the cluster for the remote cache is being deleted, or when the proxy to reach it with has changed.
 type ClusterCacheReconciler struct {
 	Log     logr.Logger
 	Client  client.Client
@@ -503,7 +716,8 @@ func (r *ClusterCacheReconciler) SetupWithManager(mgr ctrl.Manager, options cont
 }
 
 // Reconcile reconciles Clusters and removes ClusterCaches for any Cluster that cannot be retrieved from the
-// management cluster.
+// management cluster. The ClusterCache of a Cluster whose proxy URL has changed is removed too, so that the next
+// client and cache of the cluster send their requests through the new proxy.
 func (r *ClusterCacheReconciler) Reconcile(req reconcile.Request) (reconcile.Result, error) {
 	ctx := context.Background()
 
@@ -513,22 +727,27 @@ func (r *ClusterCacheReconciler) Reconcile(req reconcile.Request) (reconcile.Res
 	var cluster clusterv1.Cluster
 
 	err := r.Client.Get(ctx, req.NamespacedName, &cluster)
-	if err == nil {
-		log.V(4).Info("Cluster still exists")
-		return reconcile.Result{}, nil
-	} else if !kerrors.IsNotFound(err) {
+	if err != nil && !kerrors.IsNotFound(err) {
 		log.Error(err, "Error retrieving cluster")
 		return reconcile.Result{}, err
 	}
 
-	log.V(4).Info("Cluster no longer exists")
-
 	c := r.Tracker.getClusterCache(req.NamespacedName)
 	if c == nil {
 		log.V(4).Info("No current cluster cache exists - nothing to do")
 		return reconcile.Result{}, nil
 	}
 
+	if err == nil {
+		if c.proxyURL == r.Tracker.proxyURL(&cluster) {
+			log.V(4).Info("Cluster still exists")
+			return reconcile.Result{}, nil
+		}
+		log.Info("Proxy URL of the cluster has changed")
+	} else {
+		log.V(4).Info("Cluster no longer exists")
+	}
+
 	log.V(4).Info("Stopping cluster cache")
 	c.Stop()
 
@@ -0,0 +1,279 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package remote
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+func TestEvictLeastRecentlyUsed(t *testing.T) {
+	g := NewWithT(t)
+
+	recent := client.ObjectKey{Namespace: "test", Name: "recent"}
+	old := client.ObjectKey{Namespace: "test", Name: "old"}
+	watched := client.ObjectKey{Namespace: "test", Name: "watched"}
+	acquired := client.ObjectKey{Namespace: "test", Name: "acquired"}
+
+	m := &ClusterCacheTracker{
+		log:               log.Log,
+		capacity:          4,
+		delegatingClients: map[client.ObjectKey]*client.DelegatingClient{},
+		clusterCaches:     map[client.ObjectKey]*clusterCache{},
+		watches:           map[client.ObjectKey]map[watchInfo]struct{}{watched: {{eventHandlerSignature: "handler"}: {}}},
+		lastUsed: map[client.ObjectKey]time.Time{
+			recent:   time.Now(),
+			old:      time.Now().Add(-time.Hour),
+			watched:  time.Now().Add(-2 * time.Hour),
+			acquired: time.Now().Add(-3 * time.Hour),
+		},
+		inUse: map[client.ObjectKey]*int{acquired: new(int)},
+	}
+	*m.inUse[acquired] = 1
+	for _, cluster := range []client.ObjectKey{recent, old, watched, acquired} {
+		m.delegatingClients[cluster] = &client.DelegatingClient{}
+		m.clusterCaches[cluster] = &clusterCache{stop: make(chan struct{})}
+	}
+	oldCache := m.clusterCaches[old]
+
+	// The watched and acquired clusters are used less recently, but their caches are needed by their watches and the
+	// reads in progress.
+	m.evictLeastRecentlyUsed()
+	g.Expect(m.delegatingClients).To(HaveLen(3))
+	g.Expect(m.delegatingClients).NotTo(HaveKey(old))
+	g.Expect(m.clusterCaches).NotTo(HaveKey(old))
+	g.Expect(oldCache.stopped).To(BeTrue())
+
+	m.evictLeastRecentlyUsed()
+	g.Expect(m.delegatingClients).To(HaveLen(2))
+	g.Expect(m.delegatingClients).To(HaveKey(watched))
+	g.Expect(m.delegatingClients).To(HaveKey(acquired))
+
+	// Clients of watched and acquired clusters are kept even if the capacity is exceeded.
+	m.evictLeastRecentlyUsed()
+	g.Expect(m.delegatingClients).To(HaveLen(2))
+}
+
+func TestAcquireClient(t *testing.T) {
+	g := NewWithT(t)
+
+	cluster := client.ObjectKey{Namespace: "test", Name: "cluster"}
+	m := &ClusterCacheTracker{
+		log:               log.Log,
+		delegatingClients: map[client.ObjectKey]*client.DelegatingClient{cluster: {}},
+		lastUsed:          map[client.ObjectKey]time.Time{},
+		inUse:             map[client.ObjectKey]*int{},
+	}
+
+	_, release1, err := m.AcquireClient(context.Background(), cluster)
+	g.Expect(err).NotTo(HaveOccurred())
+	_, release2, err := m.AcquireClient(context.Background(), cluster)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(*m.inUse[cluster]).To(Equal(2))
+
+	// Releasing a client more than once has no effect.
+	release1()
+	release1()
+	g.Expect(*m.inUse[cluster]).To(Equal(1))
+	release2()
+	g.Expect(m.inUse).NotTo(HaveKey(cluster))
+}
+
+func TestRESTConfigProxy(t *testing.T) {
+	testScheme := runtime.NewScheme()
+	g := NewWithT(t)
+	g.Expect(scheme.AddToScheme(testScheme)).To(Succeed())
+	g.Expect(clusterv1.AddToScheme(testScheme)).To(Succeed())
+
+	proxyURL := func(g *WithT, m *ClusterCacheTracker, annotations map[string]string) string {
+		cluster := &clusterv1.Cluster{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        clusterWithValidKubeConfig.Name,
+				Namespace:   clusterWithValidKubeConfig.Namespace,
+				Annotations: annotations,
+			},
+		}
+		m.client = fake.NewFakeClientWithScheme(testScheme, validSecret.DeepCopy(), cluster)
+		config, _, err := m.restConfig(context.Background(), clusterWithValidKubeConfig)
+		g.Expect(err).NotTo(HaveOccurred())
+		if config.WrapTransport == nil {
+			return ""
+		}
+		req, err := http.NewRequest(http.MethodGet, config.Host, nil)
+		g.Expect(err).NotTo(HaveOccurred())
+		u, err := config.WrapTransport(&http.Transport{}).(*http.Transport).Proxy(req)
+		g.Expect(err).NotTo(HaveOccurred())
+		return u.String()
+	}
+
+	t.Run("clusters are connected to directly without any proxy", func(t *testing.T) {
+		g := NewWithT(t)
+		g.Expect(proxyURL(g, &ClusterCacheTracker{}, nil)).To(BeEmpty())
+	})
+
+	t.Run("the default proxy is used for clusters without a proxy annotation", func(t *testing.T) {
+		g := NewWithT(t)
+		m := &ClusterCacheTracker{}
+		WithDefaultProxyURL("http://default.example.com:3128")(m)
+		g.Expect(proxyURL(g, m, nil)).To(Equal("http://default.example.com:3128"))
+	})
+
+	t.Run("the proxy annotation overrides the default proxy", func(t *testing.T) {
+		g := NewWithT(t)
+		m := &ClusterCacheTracker{}
+		WithDefaultProxyURL("http://default.example.com:3128")(m)
+		g.Expect(proxyURL(g, m, map[string]string{clusterv1.ProxyURLAnnotation: "http://cluster.example.com:3128"})).To(Equal("http://cluster.example.com:3128"))
+	})
+
+	t.Run("an empty proxy annotation connects to the cluster directly", func(t *testing.T) {
+		g := NewWithT(t)
+		m := &ClusterCacheTracker{}
+		WithDefaultProxyURL("http://default.example.com:3128")(m)
+		g.Expect(proxyURL(g, m, map[string]string{clusterv1.ProxyURLAnnotation: ""})).To(BeEmpty())
+	})
+}
+
+func TestAcquireUncachedClient(t *testing.T) {
+	g := NewWithT(t)
+
+	cluster := client.ObjectKey{Namespace: "test", Name: "cluster"}
+	uncached := fake.NewFakeClientWithScheme(scheme.Scheme)
+	m := &ClusterCacheTracker{
+		log:               log.Log,
+		delegatingClients: map[client.ObjectKey]*client.DelegatingClient{cluster: {}},
+		uncachedClients:   map[client.ObjectKey]client.Client{cluster: uncached},
+		lastUsed:          map[client.ObjectKey]time.Time{},
+		inUse:             map[client.ObjectKey]*int{},
+	}
+
+	c, release, err := m.AcquireUncachedClient(context.Background(), cluster)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(c).To(BeIdenticalTo(uncached))
+	g.Expect(*m.inUse[cluster]).To(Equal(1))
+	release()
+	g.Expect(m.inUse).NotTo(HaveKey(cluster))
+
+	// The uncached client is removed along with the delegating client.
+	m.deleteDelegatingClient(cluster)
+	g.Expect(m.uncachedClients).NotTo(HaveKey(cluster))
+}
+
+func TestDeleteDelegatingClientRemovesUsage(t *testing.T) {
+	g := NewWithT(t)
+
+	cluster := client.ObjectKey{Namespace: "test", Name: "cluster"}
+	m := &ClusterCacheTracker{
+		log:               log.Log,
+		delegatingClients: map[client.ObjectKey]*client.DelegatingClient{cluster: {}},
+		uncachedClients:   map[client.ObjectKey]client.Client{},
+		lastUsed:          map[client.ObjectKey]time.Time{},
+		inUse:             map[client.ObjectKey]*int{},
+	}
+
+	_, releaseRemoved, err := m.AcquireClient(context.Background(), cluster)
+	g.Expect(err).NotTo(HaveOccurred())
+
+	m.deleteDelegatingClient(cluster)
+	g.Expect(m.lastUsed).NotTo(HaveKey(cluster))
+	g.Expect(m.inUse).NotTo(HaveKey(cluster))
+
+	// Releasing the removed client does not release the client created to replace it.
+	m.delegatingClients[cluster] = &client.DelegatingClient{}
+	_, release, err := m.AcquireClient(context.Background(), cluster)
+	g.Expect(err).NotTo(HaveOccurred())
+	releaseRemoved()
+	g.Expect(*m.inUse[cluster]).To(Equal(1))
+	release()
+	g.Expect(m.inUse).NotTo(HaveKey(cluster))
+}
+
+func TestClusterCacheReconcilerProxyURLChanged(t *testing.T) {
+	testScheme := runtime.NewScheme()
+	g := NewWithT(t)
+	g.Expect(clusterv1.AddToScheme(testScheme)).To(Succeed())
+
+	key := client.ObjectKey{Namespace: "test", Name: "cluster"}
+	tests := []struct {
+		name          string
+		annotations   map[string]string
+		expectRemoved bool
+	}{
+		{
+			name:          "should keep the cache when the proxy URL has not changed",
+			annotations:   map[string]string{clusterv1.ProxyURLAnnotation: "http://old.example.com:3128"},
+			expectRemoved: false,
+		},
+		{
+			name:          "should remove the cache when the proxy URL has changed",
+			annotations:   map[string]string{clusterv1.ProxyURLAnnotation: "http://new.example.com:3128"},
+			expectRemoved: true,
+		},
+		{
+			name:          "should remove the cache when the proxy URL annotation was removed",
+			expectRemoved: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			cluster := &clusterv1.Cluster{
+				ObjectMeta: metav1.ObjectMeta{Namespace: key.Namespace, Name: key.Name, Annotations: tt.annotations},
+			}
+			cache := &clusterCache{proxyURL: "http://old.example.com:3128", stop: make(chan struct{})}
+			m := &ClusterCacheTracker{
+				log:               log.Log,
+				delegatingClients: map[client.ObjectKey]*client.DelegatingClient{key: {}},
+				uncachedClients:   map[client.ObjectKey]client.Client{key: fake.NewFakeClientWithScheme(testScheme)},
+				clusterCaches:     map[client.ObjectKey]*clusterCache{key: cache},
+				watches:           map[client.ObjectKey]map[watchInfo]struct{}{key: {{eventHandlerSignature: "handler"}: {}}},
+			}
+			r := &ClusterCacheReconciler{
+				Log:     log.Log,
+				Client:  fake.NewFakeClientWithScheme(testScheme, cluster),
+				Tracker: m,
+			}
+
+			_, err := r.Reconcile(ctrl.Request{NamespacedName: key})
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(cache.stopped).To(Equal(tt.expectRemoved))
+			if tt.expectRemoved {
+				g.Expect(m.clusterCaches).NotTo(HaveKey(key))
+				g.Expect(m.delegatingClients).NotTo(HaveKey(key))
+				g.Expect(m.uncachedClients).NotTo(HaveKey(key))
+				g.Expect(m.watches).NotTo(HaveKey(key))
+				return
+			}
+			g.Expect(m.clusterCaches).To(HaveKey(key))
+			g.Expect(m.delegatingClients).To(HaveKey(key))
+		})
+	}
+}
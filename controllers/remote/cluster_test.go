@@ -18,6 +18,7 @@ package remote
 
 import (
 	"context"
+	"net/http"
 	"testing"
 
 	. "github.com/onsi/gomega"
@@ -124,3 +125,31 @@ func TestNewClusterClient(t *testing.T) {
 		gs.Expect(apierrors.IsNotFound(err)).To(BeFalse())
 	})
 }
+
+func TestWithProxy(t *testing.T) {
+	g := NewWithT(t)
+
+	restConfig, err := RESTConfig(context.Background(), fake.NewFakeClientWithScheme(scheme.Scheme, validSecret), clusterWithValidKubeConfig)
+	g.Expect(err).NotTo(HaveOccurred())
+
+	// Direct connections are not modified.
+	g.Expect(WithProxy(restConfig, "")).To(Succeed())
+	g.Expect(restConfig.WrapTransport).To(BeNil())
+
+	g.Expect(WithProxy(restConfig, "://invalid")).NotTo(Succeed())
+
+	g.Expect(WithProxy(restConfig, "http://proxy.example.com:3128")).To(Succeed())
+	g.Expect(restConfig.WrapTransport).NotTo(BeNil())
+
+	base := &http.Transport{}
+	rt, ok := restConfig.WrapTransport(base).(*http.Transport)
+	g.Expect(ok).To(BeTrue())
+	g.Expect(rt).NotTo(BeIdenticalTo(base))
+	g.Expect(base.Proxy).To(BeNil())
+
+	req, err := http.NewRequest(http.MethodGet, "https://test-cluster-api.nodomain.example.com:6443", nil)
+	g.Expect(err).NotTo(HaveOccurred())
+	proxyURL, err := rt.Proxy(req)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(proxyURL.String()).To(Equal("http://proxy.example.com:3128"))
+}
@@ -17,14 +17,59 @@ limitations under the License.
 package v1alpha3
 
 import (
+	"time"
+
 	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
 )
 
 const (
-	// ClusterResourceSetSecretType is the only accepted type of secret in resources
+	// ClusterResourceSetSecretType is the default accepted type of secret in resources
 	ClusterResourceSetSecretType corev1.SecretType = "addons.cluster.x-k8s.io/resource-set" //nolint:gosec
+
+	// ClusterResourceSetSourceLabel marks a Secret as safe to be used as a resource of ClusterResourceSets.
+	// It is only enforced when the controller is configured to require it.
+	ClusterResourceSetSourceLabel = "addons.cluster.x-k8s.io/source"
+
+	// ClusterResourceSetIgnoreFieldsAnnotation is a comma separated list of dot separated field paths, e.g. "spec.replicas",
+	// that are ignored when comparing the objects of a Secret or ConfigMap resource with the ones applied before.
+	// This allows fields owned by other controllers in the workload cluster, like the replicas managed by an HPA, to differ.
+	ClusterResourceSetIgnoreFieldsAnnotation = "addons.cluster.x-k8s.io/ignore-fields"
+
+	// ClusterResourceSetRemoveFromAnnotation can be set on a ClusterResourceSet to the name of a Cluster to delete the
+	// objects applied by the ClusterResourceSet from that cluster only, e.g. for troubleshooting. The ClusterResourceSet
+	// is removed from the cluster's ClusterResourceSetBinding and the annotation is cleared once the objects are deleted.
+	// The resources are applied again at the next reconcile if the cluster still matches the ClusterResourceSet.
+	ClusterResourceSetRemoveFromAnnotation = "addons.cluster.x-k8s.io/remove-from"
+
+	// ClusterResourceSetDumpManifestsAnnotation can be set on a ClusterResourceSet to the name of a Cluster to write the
+	// objects the ClusterResourceSet applies to that cluster, as rendered by the controller, to the "manifests.yaml" key
+	// of a Secret named "<clusterresourceset-name>-manifests-<cluster-name>" in the ClusterResourceSet's namespace, e.g.
+	// for troubleshooting. A Secret is used as the objects may come from Secrets. The annotation is cleared once the
+	// Secret is written, and the Secret is deleted along with the ClusterResourceSet.
+	ClusterResourceSetDumpManifestsAnnotation = "addons.cluster.x-k8s.io/dump-manifests"
+
+	// ClusterResourceSetForceReapplyResourceAnnotation can be set on a ClusterResourceSet to "<kind>/<name>" of one of
+	// its resources, e.g. "ConfigMap/cni", to apply this resource again to all the clusters it was applied to, without
+	// applying the other resources again. The resource is marked as not applied in the ClusterResourceSetBindings and
+	// the annotation is cleared.
+	ClusterResourceSetForceReapplyResourceAnnotation = "addons.cluster.x-k8s.io/force-reapply-resource"
+
+	// ClusterResourceSetPostApplyHashAnnotation is set on the post-apply Jobs created in workload clusters to the hash
+	// of the Job and of the resources it verifies. A Job with another hash is deleted and created again.
+	ClusterResourceSetPostApplyHashAnnotation = "addons.cluster.x-k8s.io/post-apply-hash"
+
+	// ClusterResourceSetProvenanceLabelPrefix is the prefix of the label added to resources that cannot be owned by a
+	// ClusterResourceSet, e.g. because they are in another namespace. It is followed by the ClusterResourceSet's UID.
+	ClusterResourceSetProvenanceLabelPrefix = "clusterresourceset.addons.cluster.x-k8s.io/"
+
+	// ClusterResourceSetNameLabel is the label added to the objects applied to workload clusters with the name of the
+	// ClusterResourceSet that applied them, unless disabled with spec.addProvenanceLabels.
+	ClusterResourceSetNameLabel = "addons.cluster.x-k8s.io/clusterresourceset-name"
+
+	// ClusterRegionLabel is the label of Clusters matched against the regions of a ClusterResourceSet's RegionSelector.
+	ClusterRegionLabel = corev1.LabelZoneRegionStable
 )
 
 // ANCHOR: ClusterResourceSetSpec
@@ -34,36 +79,503 @@ type ClusterResourceSetSpec struct {
 	// Label selector for Clusters. The Clusters that are
 	// selected by this will be the ones affected by this ClusterResourceSet.
 	// It must match the Cluster labels. This field is immutable.
+	// It must be empty when ClusterName is set.
+	// +optional
 	ClusterSelector metav1.LabelSelector `json:"clusterSelector"`
 
+	// ClusterSelectors are additional label selectors for Clusters. The Clusters matching ClusterSelector or any of
+	// these selectors are affected by this ClusterResourceSet, which allows selecting e.g. the Clusters labeled
+	// env=prod or tier=critical. This field is immutable. It must be empty when ClusterName is set.
+	// +optional
+	ClusterSelectors []metav1.LabelSelector `json:"clusterSelectors,omitempty"`
+
+	// ClusterName targets exactly the Cluster with this name in the ClusterResourceSet's namespace, without relying
+	// on labels. It is a shortcut for testing and cannot be used together with ClusterSelector. This field is immutable.
+	// +optional
+	ClusterName string `json:"clusterName,omitempty"`
+
+	// ClusterAnnotationSelector further restricts the Clusters selected by ClusterSelector to the ones that have all
+	// of these annotations with the given values. This field is immutable.
+	// +optional
+	ClusterAnnotationSelector map[string]string `json:"clusterAnnotationSelector,omitempty"`
+
+	// RequireOptInAnnotation further restricts the selected Clusters to the ones that have this annotation, whatever
+	// its value, e.g. for sensitive addons that must never be applied to a cluster without it explicitly opting in.
+	// It also applies to the Cluster targeted by ClusterName. This field is immutable.
+	// +optional
+	RequireOptInAnnotation string `json:"requireOptInAnnotation,omitempty"`
+
+	// ClusterMaxAge further restricts the selected Clusters to the ones created at most this long ago, e.g. for
+	// resources only needed while bringing up new clusters. Resources already applied to older Clusters are left in place.
+	// Unlike the selectors, this field can be changed: Clusters leaving the selection as they age are never pruned, so
+	// changing it only has the same effect as time passing.
+	// +optional
+	ClusterMaxAge *metav1.Duration `json:"clusterMaxAge,omitempty"`
+
+	// RegionSelector further restricts the selected Clusters to the ones in the given regions or failure domains, e.g.
+	// for region specific storage classes. This field is immutable.
+	// +optional
+	RegionSelector *RegionSelector `json:"regionSelector,omitempty"`
+
+	// AllowManagementCluster allows applying the resources to a selected Cluster that is the management cluster itself,
+	// i.e. whose API server endpoint is the one the controller manages Clusters with. Such Clusters are skipped by
+	// default, to avoid applying resources meant for workload clusters to the management cluster by accident.
+	// It does not apply to resources applied to the management cluster with the Management ApplyTarget.
+	// +optional
+	AllowManagementCluster bool `json:"allowManagementCluster,omitempty"`
+
+	// FreezeNewClusters, if true, stops applying the resources to the clusters newly matching the ClusterResourceSet,
+	// i.e. whose ClusterResourceSetBinding has no entry for it, while the clusters it was already applied to are still
+	// reconciled, e.g. during a change freeze. The skipped clusters are applied once it is unset.
+	// +optional
+	FreezeNewClusters bool `json:"freezeNewClusters,omitempty"`
+
+	// ApplyWindow restricts applying the resources to recurring maintenance windows. Outside of the windows, resources
+	// are neither applied to new clusters nor applied again when they change, and the ClusterResourceSet is reconciled
+	// again when the next window starts. Resources are applied at any time if unset.
+	// +optional
+	ApplyWindow *ApplyWindow `json:"applyWindow,omitempty"`
+
+	// Priority orders the ClusterResourceSets applying resources to the same cluster, e.g. so that one installing the
+	// prerequisites of another is applied first. The resources of a ClusterResourceSet are not applied to a cluster
+	// until all the ClusterResourceSets with a higher priority selecting it have applied all their resources to it.
+	// ClusterResourceSets with the same priority are applied independently of each other, in no particular order.
+	// Defaults to 0.
+	// +optional
+	Priority int32 `json:"priority,omitempty"`
+
+	// ClusterReadyConditions are the types of the conditions that must be true on a selected Cluster before the
+	// resources are applied to it, e.g. ControlPlaneReady. Clusters not meeting them are checked again periodically.
+	// +optional
+	ClusterReadyConditions []string `json:"clusterReadyConditions,omitempty"`
+
+	// WriteInventory, if true, writes the list of the objects applied by the ClusterResourceSet to a ConfigMap named
+	// clusterresourceset-<name> in the kube-system namespace of the workload clusters, so that their operators can
+	// discover what was placed by the management cluster. The inventory is updated at each reconcile and deleted when
+	// the resources are removed from a cluster. It is not written for resources applied to the management cluster.
+	// +optional
+	WriteInventory bool `json:"writeInventory,omitempty"`
+
+	// ValidateSchema, if true, validates the objects of the resources against the OpenAPI schemas of each workload
+	// cluster before applying them, e.g. to catch fields or API versions not supported by the cluster's version.
+	// Resources with invalid objects are not applied. It fetches the schemas from the discovery API of the clusters,
+	// which are then cached for a few minutes. Objects applied in Patch mode or to the management cluster are not validated.
+	// +optional
+	ValidateSchema bool `json:"validateSchema,omitempty"`
+
+	// ReportWorkloadEvents, if true, reads the recent Warning Events of the objects applied by the ClusterResourceSet,
+	// and of the objects they create, e.g. the Pods of a Deployment, from the workload clusters, and summarizes them in
+	// the WorkloadEvents condition. The number of Events read from each cluster is bounded by the controller. It does
+	// not apply to resources applied to the management cluster.
+	// +optional
+	ReportWorkloadEvents bool `json:"reportWorkloadEvents,omitempty"`
+
+	// AllowedKinds restricts the kinds of the objects the ClusterResourceSet can apply, e.g. to prevent a mis-authored
+	// ClusterResourceSet from creating ClusterRoleBindings in multi-tenant management clusters. Entries are either a
+	// kind, e.g. "ConfigMap", or a kind qualified by its API group, e.g. "Deployment.apps". Resources with objects of
+	// other kinds are not applied. All kinds are allowed if empty.
+	// +optional
+	AllowedKinds []string `json:"allowedKinds,omitempty"`
+
+	// RequireNamespace skips the resources with objects of namespaced kinds without a namespace, rather than applying
+	// them to whatever namespace the client of the workload cluster defaults to, and reports them with the
+	// MissingNamespace reason. The scope of the kinds is looked up in the CustomResourceDefinitions of the resource, then
+	// in the workload cluster. Objects without a namespace of kinds the workload cluster does not serve are skipped too,
+	// as their scope is unknown. It does not apply to resources applied to the management cluster.
+	// +optional
+	RequireNamespace bool `json:"requireNamespace,omitempty"`
+
+	// MaxClusterObjects is the maximum number of objects applied by all ClusterResourceSets to each matching cluster, as
+	// recorded in its ClusterResourceSetBinding, to protect small clusters. Resources that would push the count over it
+	// are not applied, and are reported with the ObjectLimitExceeded reason. The lower of this limit and the limit of
+	// the controller applies. Unlimited if unset.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	MaxClusterObjects int32 `json:"maxClusterObjects,omitempty"`
+
 	// Resources is a list of Secrets/ConfigMaps where each contains 1 or more resources to be applied to remote clusters.
 	Resources []ResourceRef `json:"resources,omitempty"`
 
 	// Strategy is the strategy to be used during applying resources. Defaults to ApplyOnce. This field is immutable.
-	// +kubebuilder:validation:Enum=ApplyOnce
+	// The Reconcile strategy requires the ClusterResourceSetReconcileStrategy feature gate, ApplyOnce is used otherwise.
+	// The ApplyOnChange strategy applies resources again when their content changes, but leaves changes made to the
+	// objects in the workload clusters alone.
+	// The Reconcile strategy also applies resources again when their objects in the workload clusters drift.
+	// +kubebuilder:validation:Enum=ApplyOnce;ApplyOnChange;Reconcile
 	// +optional
 	Strategy string `json:"strategy,omitempty"`
+
+	// AuditOnly, if true, prevents resources from being applied to clusters. Instead, the resources that would be applied
+	// are recorded in status.wouldReapply, which shows the impact of a change before it reaches any cluster.
+	// +optional
+	AuditOnly bool `json:"auditOnly,omitempty"`
+
+	// SkipExisting, if true, checks whether the objects of a resource already exist in a cluster before applying it
+	// when the resource is not recorded as applied in the cluster's ClusterResourceSetBinding, e.g. because the binding
+	// was recreated. Resources whose objects all exist are recorded as applied without being applied again.
+	// +optional
+	SkipExisting bool `json:"skipExisting,omitempty"`
+
+	// SortByKind, if true, applies the objects of each resource, across all its keys, in a default order based on their
+	// kinds: Namespaces, CustomResourceDefinitions and RBAC objects first, then the other built-in objects, e.g.
+	// Deployments after the ConfigMaps they use, and custom resources last. Objects of the same kind keep their order.
+	// +optional
+	SortByKind bool `json:"sortByKind,omitempty"`
+
+	// RenderTemplates, if true, renders the values of the resources as Go templates for each cluster before applying
+	// them, e.g. `{{ .Cluster.Name }}` or `{{ .Cluster.Labels.region }}`. Besides the built-in template functions, the
+	// following functions are available: b64enc, b64dec, indent, nindent, default, quote, lower, upper and trim. They
+	// behave like their Sprig counterparts, are deterministic and have no access to files or the network, so that the
+	// same resource is always rendered the same way for a cluster. Unless the strategy is ApplyOnce, resources are
+	// applied again when their rendering for a cluster changes, e.g. because one of its labels changed.
+	// +optional
+	RenderTemplates bool `json:"renderTemplates,omitempty"`
+
+	// TemplateMissingKey is how templates referencing a missing key of a map are rendered, e.g. a label the cluster does
+	// not have. With Error, rendering the resource fails; with Empty, the missing value renders as an empty string.
+	// Defaults to Error.
+	// +kubebuilder:validation:Enum=Error;Empty
+	// +optional
+	TemplateMissingKey string `json:"templateMissingKey,omitempty"`
+
+	// DeletePropagationPolicy is the propagation policy used when objects applied by the ClusterResourceSet are
+	// deleted from clusters, which controls whether their dependents are deleted too. Defaults to Background.
+	// +kubebuilder:validation:Enum=Foreground;Background;Orphan
+	// +optional
+	DeletePropagationPolicy string `json:"deletePropagationPolicy,omitempty"`
+
+	// ReverseDeleteOrder, if true, deletes the objects of all the resources together when the ClusterResourceSet is
+	// removed from a cluster or its resources are pruned, in the reverse of the SortByKind order, like Helm uninstalls
+	// a release: custom resources first, then the other built-in objects, and CustomResourceDefinitions and Namespaces
+	// last. Objects of the same kind are deleted in the reverse order of the resources. By default, the objects of each
+	// resource are deleted separately, in the order of the resources.
+	// +optional
+	ReverseDeleteOrder bool `json:"reverseDeleteOrder,omitempty"`
+
+	// ToleratePendingResources, if true, treats resources that do not exist yet as pending rather than failed.
+	// Applying them is retried until they are created, without reporting a warning in the meantime.
+	// +optional
+	ToleratePendingResources bool `json:"toleratePendingResources,omitempty"`
+
+	// AddProvenanceLabels controls whether the objects applied to workload clusters are labeled with the name of the
+	// ClusterResourceSet that applied them. Defaults to true.
+	// Disabling it avoids admission rejections in clusters with strict label policies, at the cost of not being able to
+	// find, e.g. for pruning, the objects applied by a ClusterResourceSet using a label selector.
+	// Objects applied in Patch mode are never labeled.
+	// +optional
+	AddProvenanceLabels *bool `json:"addProvenanceLabels,omitempty"`
+
+	// PropagateLabels are the keys of the labels of the ClusterResourceSet copied onto every object applied to workload
+	// clusters, e.g. to comply with organization-wide tagging policies. Keys the ClusterResourceSet has no label for are
+	// ignored. Objects applied in Patch mode are never labeled.
+	// Changing the values on the ClusterResourceSet updates the objects the next time their resource is applied.
+	// +optional
+	PropagateLabels []string `json:"propagateLabels,omitempty"`
+
+	// PropagateAnnotations are the keys of the annotations of the ClusterResourceSet copied onto every object applied
+	// to workload clusters, like PropagateLabels.
+	// +optional
+	PropagateAnnotations []string `json:"propagateAnnotations,omitempty"`
+
+	// ApplyTarget is where the resources are applied. Defaults to Workload.
+	// With Management, the resources are applied to the cluster's namespace in the management cluster rather than to
+	// the workload cluster, e.g. next to the pods of a hosted control plane. Objects are moved to the cluster's namespace
+	// and cluster-scoped objects are rejected. The controller must be granted the permissions to manage these objects.
+	// +kubebuilder:validation:Enum=Workload;Management
+	// +optional
+	ApplyTarget string `json:"applyTarget,omitempty"`
+
+	// CheckQuotas, if true, checks before applying a resource that the object count ResourceQuotas of the namespaces
+	// of its objects leave room for the objects that do not exist yet. Resources that do not fit are skipped rather
+	// than partially applied. This is a best-effort check that does not account for compute resource quotas.
+	// +optional
+	CheckQuotas bool `json:"checkQuotas,omitempty"`
+
+	// WaitForReady, if true, only records resources with a readiness check as applied once their objects are ready.
+	// Until then, the resources are applied again and checked periodically, for at most ReadyTimeout.
+	// +optional
+	WaitForReady bool `json:"waitForReady,omitempty"`
+
+	// ReadyTimeout is how long to wait for the objects of a resource to be ready with WaitForReady, after which the
+	// resource is reported as failed. Defaults to 10 minutes.
+	// +optional
+	ReadyTimeout *metav1.Duration `json:"readyTimeout,omitempty"`
+
+	// PruneGracePeriod, if set, enables deleting from the matching clusters the objects of the resources removed from
+	// the ClusterResourceSet. Removed resources are first marked for pruning in the ClusterResourceSetBindings, and their
+	// objects are only deleted once the grace period elapsed, which leaves time to revert accidental removals.
+	// The objects are read from the resource, so the objects of resources whose Secret or ConfigMap was deleted too are
+	// left in the clusters. If unset, the objects of removed resources are never deleted.
+	// +optional
+	PruneGracePeriod *metav1.Duration `json:"pruneGracePeriod,omitempty"`
+
+	// PostApplyJob is a resource with the manifest of a single Job, e.g. a smoke test, that is created in each matching
+	// cluster once all the other resources are applied to it. The rollout to the cluster is only complete once the Job
+	// succeeded, and fails if the Job fails. The Job runs again when it or the resources change.
+	// +optional
+	PostApplyJob *ResourceRef `json:"postApplyJob,omitempty"`
+
+	// ApplyMode is how the objects that already exist in the clusters are updated with the ApplyOnChange and Reconcile
+	// strategies. Defaults to ServerSideApply. With ThreeWayMerge, objects are updated like "kubectl apply" does without
+	// server-side apply, i.e. with a patch computed from the kubectl.kubernetes.io/last-applied-configuration annotation,
+	// which the controller maintains on the objects it applies. This lets the ClusterResourceSet and "kubectl apply"
+	// cooperate on the same objects: fields removed from the resource are removed from the objects, while fields added by
+	// others are kept. Field conflicts are not detected in this mode, so the conflict retries and the forced ownership of
+	// fields only apply to ServerSideApply.
+	// +kubebuilder:validation:Enum=ServerSideApply;ThreeWayMerge
+	// +optional
+	ApplyMode string `json:"applyMode,omitempty"`
 }
 
 // ANCHOR_END: ClusterResourceSetSpec
 
+// RegionSelector selects Clusters by their region or failure domains. If both Regions and FailureDomains are set,
+// Clusters must match both.
+type RegionSelector struct {
+	// Regions selects the Clusters whose topology.kubernetes.io/region label has one of these values.
+	// +optional
+	Regions []string `json:"regions,omitempty"`
+
+	// FailureDomains selects the Clusters that have at least one of these failure domains in their status.
+	// +optional
+	FailureDomains []string `json:"failureDomains,omitempty"`
+}
+
+// ApplyWindow is a recurring window during which the resources of a ClusterResourceSet are applied.
+type ApplyWindow struct {
+	// Schedule is the cron expression of the start of the windows in UTC, with the minute, hour, day of month, month
+	// and day of week fields, e.g. "0 2 * * 6" for windows starting at 2:00 on Saturdays.
+	// +kubebuilder:validation:MinLength=1
+	Schedule string `json:"schedule"`
+
+	// Duration of the windows, e.g. "4h".
+	Duration metav1.Duration `json:"duration"`
+}
+
+// ClusterResourceSetApplyTarget is a string representation of where the resources of a ClusterResourceSet are applied.
+type ClusterResourceSetApplyTarget string
+
+const (
+	// WorkloadClusterResourceSetApplyTarget applies the resources to the workload clusters.
+	WorkloadClusterResourceSetApplyTarget ClusterResourceSetApplyTarget = "Workload"
+
+	// ManagementClusterResourceSetApplyTarget applies the resources to the clusters' namespaces in the management cluster.
+	ManagementClusterResourceSetApplyTarget ClusterResourceSetApplyTarget = "Management"
+)
+
+// ClusterResourceSetApplyMode is a string representation of how the objects of a ClusterResourceSet are updated.
+type ClusterResourceSetApplyMode string
+
+const (
+	// ServerSideApplyClusterResourceSetApplyMode updates the objects using server-side apply.
+	ServerSideApplyClusterResourceSetApplyMode ClusterResourceSetApplyMode = "ServerSideApply"
+
+	// ThreeWayMergeClusterResourceSetApplyMode updates the objects with a three-way merge patch computed from their
+	// last-applied-configuration annotation, like "kubectl apply" does.
+	ThreeWayMergeClusterResourceSetApplyMode ClusterResourceSetApplyMode = "ThreeWayMerge"
+)
+
+// ClusterResourceSetTemplateMissingKey is a string representation of how missing keys are rendered in templates.
+type ClusterResourceSetTemplateMissingKey string
+
+const (
+	// ErrorClusterResourceSetTemplateMissingKey fails rendering templates that reference missing keys.
+	ErrorClusterResourceSetTemplateMissingKey ClusterResourceSetTemplateMissingKey = "Error"
+
+	// EmptyClusterResourceSetTemplateMissingKey renders missing keys as empty values.
+	EmptyClusterResourceSetTemplateMissingKey ClusterResourceSetTemplateMissingKey = "Empty"
+)
+
 // ClusterResourceSetResourceKind is a string representation of a ClusterResourceSet resource kind.
 type ClusterResourceSetResourceKind string
 
 const (
 	SecretClusterResourceSetResourceKind    ClusterResourceSetResourceKind = "Secret"
 	ConfigMapClusterResourceSetResourceKind ClusterResourceSetResourceKind = "ConfigMap"
+
+	// OCIArtifactClusterResourceSetResourceKind is an artifact in an OCI registry whose layers contain the objects
+	// to apply. The resource name is the artifact reference, e.g. "registry.example.com/addons/cni:v1.0.0".
+	OCIArtifactClusterResourceSetResourceKind ClusterResourceSetResourceKind = "OCIArtifact"
+
+	// GitRepositoryClusterResourceSetResourceKind is a directory or a file of a Git repository whose manifests contain
+	// the objects to apply. The repository is described by the git field of the resource.
+	GitRepositoryClusterResourceSetResourceKind ClusterResourceSetResourceKind = "GitRepository"
+)
+
+// ClusterResourceSetResourceMode is a string representation of how a ClusterResourceSet resource is applied.
+type ClusterResourceSetResourceMode string
+
+const (
+	// ApplyClusterResourceSetResourceMode creates the objects of a resource in the workload cluster.
+	ApplyClusterResourceSetResourceMode ClusterResourceSetResourceMode = "Apply"
+
+	// PatchClusterResourceSetResourceMode patches existing objects of the workload cluster with the objects of a resource.
+	PatchClusterResourceSetResourceMode ClusterResourceSetResourceMode = "Patch"
+
+	// ReplaceClusterResourceSetResourceMode creates the objects of a resource like Apply, but deletes and recreates the
+	// existing objects whose update is rejected because it changes immutable fields.
+	ReplaceClusterResourceSetResourceMode ClusterResourceSetResourceMode = "Replace"
+)
+
+// ClusterResourceSetConflictPolicy is a string representation of how conflicts with other field managers are resolved
+// when the objects of a ClusterResourceSet resource are updated.
+type ClusterResourceSetConflictPolicy string
+
+const (
+	// ForceClusterResourceSetConflictPolicy takes the ownership of the fields owned by other field managers.
+	ForceClusterResourceSetConflictPolicy ClusterResourceSetConflictPolicy = "Force"
+
+	// RespectClusterResourceSetConflictPolicy leaves the fields owned by other field managers untouched and reports the conflict.
+	RespectClusterResourceSetConflictPolicy ClusterResourceSetConflictPolicy = "Respect"
 )
 
 // ResourceRef specifies a resource.
 type ResourceRef struct {
 	// Name of the resource that is in the same namespace with ClusterResourceSet object.
+	// For OCI artifacts, this is the reference of the artifact including its registry.
+	// With Selector or for Git repositories, it only identifies the resource in the ClusterResourceSetBindings.
 	// +kubebuilder:validation:MinLength=1
 	Name string `json:"name"`
 
-	// Kind of the resource. Supported kinds are: Secrets and ConfigMaps.
-	// +kubebuilder:validation:Enum=Secret;ConfigMap
+	// Selector selects all the ConfigMaps with matching labels, rather than the one named Name, so that a large addon
+	// can be split in many small ConfigMaps. Their values are applied as a single resource, ordered by the number
+	// prefixing the names of the ConfigMaps, e.g. "10-crds" before "20-operator", then by name and by key.
+	// It is only supported with the ConfigMap kind, and cannot be used with Keys.
+	// +optional
+	Selector *metav1.LabelSelector `json:"selector,omitempty"`
+
+	// Kind of the resource. Supported kinds are: Secrets, ConfigMaps, OCIArtifacts and GitRepositories.
+	// +kubebuilder:validation:Enum=Secret;ConfigMap;OCIArtifact;GitRepository
 	Kind string `json:"kind"`
+
+	// Keys are the keys of the Secret or ConfigMap whose values are applied, in the given order.
+	// Values of other keys are ignored. All values are applied, ordered by key, if empty.
+	// +optional
+	Keys []string `json:"keys,omitempty"`
+
+	// PullSecretName is the name of a Secret of type kubernetes.io/dockerconfigjson, in the cluster's namespace,
+	// with the credentials used to pull an OCI artifact. It is only used with the OCIArtifact kind. It must always
+	// carry the addons.cluster.x-k8s.io/source: "true" label, as its credentials are sent to the artifact's registry.
+	// +optional
+	PullSecretName string `json:"pullSecretName,omitempty"`
+
+	// Git is the Git repository the manifests are fetched from. It is required with the GitRepository kind, and only
+	// used with it.
+	// +optional
+	Git *GitRepositorySource `json:"git,omitempty"`
+
+	// RequiresExisting is an object that must already exist in the workload cluster before this resource is applied.
+	// If the object is not found, the resource is skipped and applying it is retried later.
+	// +optional
+	RequiresExisting *PrerequisiteRef `json:"requiresExisting,omitempty"`
+
+	// EnabledWhen is a feature flag in the workload cluster that enables the resource. The resource is only applied
+	// when the flag has the expected value, and applying it is retried later while the flag cannot be read.
+	// Objects already applied are left untouched when the flag changes to another value.
+	// +optional
+	EnabledWhen *FeatureFlagRef `json:"enabledWhen,omitempty"`
+
+	// Mode is how the objects in the resource are applied to the workload cluster. Defaults to Apply.
+	// In Patch mode, each object is a strategic merge patch applied to the existing object with the same
+	// apiVersion, kind, namespace and name, which allows modifying objects that are not owned by the ClusterResourceSet.
+	// In Replace mode, objects whose update changes immutable fields, e.g. the template of a Job, are deleted and
+	// recreated. Objects are only updated with the ApplyOnChange and Reconcile strategies, and workloads such as
+	// Deployments, as well as Namespaces and CustomResourceDefinitions, are never replaced.
+	// +kubebuilder:validation:Enum=Apply;Patch;Replace
+	// +optional
+	Mode string `json:"mode,omitempty"`
+
+	// ReadyWhen is a readiness check on the objects applied from the resource, used with spec.waitForReady.
+	// +optional
+	ReadyWhen *ReadinessCheck `json:"readyWhen,omitempty"`
+
+	// ConflictPolicy is how conflicts with other field managers are resolved when the objects of the resource are
+	// updated with the "ApplyOnChange" and "Reconcile" strategies. When unset, conflicts are respected unless the
+	// controller is configured to force ownership on conflicts.
+	// +kubebuilder:validation:Enum=Force;Respect
+	// +optional
+	ConflictPolicy string `json:"conflictPolicy,omitempty"`
+
+	// ClusterOverrides enables per-cluster overrides of the resource. The Secret or ConfigMap of the same kind named
+	// "<name>-override-<cluster name>", in the namespace of the resource, is merged over the resource before it is
+	// applied to that cluster: its objects are merged over the objects with the same group, kind, namespace and name,
+	// with a strategic merge patch for built-in kinds and a JSON merge patch for other kinds, and its other objects are
+	// applied too. It is only supported with the Secret and ConfigMap kinds.
+	// +optional
+	ClusterOverrides bool `json:"clusterOverrides,omitempty"`
+}
+
+// GitRepositorySource is a directory or a file in a Git repository served over HTTP(S).
+type GitRepositorySource struct {
+	// URL of the repository, e.g. "https://github.com/example/addons.git".
+	// +kubebuilder:validation:MinLength=1
+	URL string `json:"url"`
+
+	// Ref is the branch, tag or commit SHA the manifests are fetched at. Defaults to the default branch.
+	// The ref is resolved on every reconcile, and the resource is only applied again when it points to a new commit
+	// changing the manifests.
+	// +optional
+	Ref string `json:"ref,omitempty"`
+
+	// Path of the directory, or of the file, holding the manifests in the repository. The YAML and JSON files of a
+	// directory and of its subdirectories are applied ordered by path. Defaults to the root of the repository.
+	// +optional
+	Path string `json:"path,omitempty"`
+
+	// SecretName is the name of a Secret, in the cluster's namespace, with the "username" and "password" keys used to
+	// authenticate to the repository. The password may be an access token. The Secret must be of an accepted type and,
+	// if required, carry the source label, like Secret resources. The URL must use https when set.
+	// +optional
+	SecretName string `json:"secretName,omitempty"`
+}
+
+// ReadinessCheck is a condition on the applied objects of a resource that must be satisfied for them to be ready.
+type ReadinessCheck struct {
+	// Kind of the objects the check applies to, e.g. "Installation". All objects of the resource are checked if empty.
+	// +optional
+	Kind string `json:"kind,omitempty"`
+
+	// Expression is a JSONPath, optionally compared to a quoted value with == or !=, e.g. `.status.state == "Running"`.
+	// Without a comparison, the objects are ready when the JSONPath has a value that is not empty or "false".
+	// +kubebuilder:validation:MinLength=1
+	Expression string `json:"expression"`
+}
+
+// PrerequisiteRef identifies an object in a workload cluster.
+type PrerequisiteRef struct {
+	// APIVersion of the object, e.g. "apiextensions.k8s.io/v1".
+	// +kubebuilder:validation:MinLength=1
+	APIVersion string `json:"apiVersion"`
+
+	// Kind of the object, e.g. "CustomResourceDefinition".
+	// +kubebuilder:validation:MinLength=1
+	Kind string `json:"kind"`
+
+	// Name of the object.
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+
+	// Namespace of the object. Must be empty for cluster-scoped objects.
+	// +optional
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// FeatureFlagRef identifies a key of a ConfigMap in a workload cluster, and the value enabling a resource.
+type FeatureFlagRef struct {
+	// Namespace of the ConfigMap.
+	// +kubebuilder:validation:MinLength=1
+	Namespace string `json:"namespace"`
+
+	// Name of the ConfigMap.
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+
+	// Key of the ConfigMap holding the flag.
+	// +kubebuilder:validation:MinLength=1
+	Key string `json:"key"`
+
+	// Value the flag must have for the resource to be applied.
+	Value string `json:"value"`
 }
 
 // ClusterResourceSetStrategy is a string representation of a ClusterResourceSet Strategy.
@@ -73,8 +585,41 @@ const (
 	// ClusterResourceSetStrategyApplyOnce is the default strategy a ClusterResourceSet strategy is assigned by
 	// ClusterResourceSet controller after being created if not specified by user.
 	ClusterResourceSetStrategyApplyOnce ClusterResourceSetStrategy = "ApplyOnce"
+
+	// ClusterResourceSetStrategyApplyOnChange applies resources again, updating the existing objects, only when the content
+	// of the source Secret or ConfigMap changes. Unlike Reconcile, it never acts on drift in the workload clusters.
+	ClusterResourceSetStrategyApplyOnChange ClusterResourceSetStrategy = "ApplyOnChange"
+
+	// ClusterResourceSetStrategyReconcile applies resources again, updating the existing objects, whenever their content changes.
+	ClusterResourceSetStrategyReconcile ClusterResourceSetStrategy = "Reconcile"
 )
 
+// GetDeletePropagationPolicy returns the propagation policy used when deleting objects applied by the ClusterResourceSet.
+func (c *ClusterResourceSetSpec) GetDeletePropagationPolicy() metav1.DeletionPropagation {
+	if c.DeletePropagationPolicy == "" {
+		return metav1.DeletePropagationBackground
+	}
+	return metav1.DeletionPropagation(c.DeletePropagationPolicy)
+}
+
+// ShouldAddProvenanceLabels returns true if the objects applied to workload clusters are labeled with the name of the ClusterResourceSet.
+func (c *ClusterResourceSetSpec) ShouldAddProvenanceLabels() bool {
+	return c.AddProvenanceLabels == nil || *c.AddProvenanceLabels
+}
+
+// AppliesToManagementCluster returns true if the resources are applied to the management cluster.
+func (c *ClusterResourceSetSpec) AppliesToManagementCluster() bool {
+	return c.ApplyTarget == string(ManagementClusterResourceSetApplyTarget)
+}
+
+// GetReadyTimeout returns how long to wait for the objects of a resource to be ready.
+func (c *ClusterResourceSetSpec) GetReadyTimeout() time.Duration {
+	if c.ReadyTimeout == nil {
+		return 10 * time.Minute
+	}
+	return c.ReadyTimeout.Duration
+}
+
 // SetTypedStrategy sets the Strategy field to the string representation of ClusterResourceSetStrategy.
 func (c *ClusterResourceSetSpec) SetTypedStrategy(p ClusterResourceSetStrategy) {
 	c.Strategy = string(p)
@@ -91,10 +636,61 @@ type ClusterResourceSetStatus struct {
 	// Conditions defines current state of the ClusterResourceSet.
 	// +optional
 	Conditions clusterv1.Conditions `json:"conditions,omitempty"`
+
+	// WouldReapply lists the resources that are not applied to a cluster yet or whose content changed since they were
+	// applied. It is only populated when spec.auditOnly is set.
+	// +optional
+	WouldReapply []ReapplyAuditEntry `json:"wouldReapply,omitempty"`
+
+	// ResourceConditions reports for each resource whether it is applied to all the matching clusters, and why not.
+	// The number of entries is capped to bound the size of the status.
+	// +optional
+	ResourceConditions []ResourceCondition `json:"resourceConditions,omitempty"`
+
+	// AppliedBytes is the total size of the manifests of the resources recorded as applied to the matching clusters.
+	// It is a best-effort estimate of the load the ClusterResourceSet adds to the clusters, e.g. for capacity planning.
+	// +optional
+	AppliedBytes int64 `json:"appliedBytes,omitempty"`
 }
 
 // ANCHOR_END: ClusterResourceSetStatus
 
+// ReapplyAuditEntry identifies a resource that would be applied to a cluster.
+type ReapplyAuditEntry struct {
+	// ClusterName is the name of the cluster the resource would be applied to.
+	ClusterName string `json:"clusterName"`
+
+	// Kind of the resource.
+	Kind string `json:"kind"`
+
+	// Name of the resource.
+	Name string `json:"name"`
+}
+
+// ResourceCondition reports whether a resource of the ClusterResourceSet is applied to all the matching clusters.
+type ResourceCondition struct {
+	// Kind of the resource.
+	Kind string `json:"kind"`
+
+	// Name of the resource.
+	Name string `json:"name"`
+
+	// Status is True if the resource is applied to all the matching clusters, False otherwise.
+	Status corev1.ConditionStatus `json:"status"`
+
+	// Reason is the reason the resource failed to be applied to one of the clusters, in CamelCase.
+	// +optional
+	Reason string `json:"reason,omitempty"`
+
+	// Severity of the failure to apply the resource. It is only set when Status is False.
+	// +optional
+	Severity clusterv1.ConditionSeverity `json:"severity,omitempty"`
+
+	// Message is a human readable description of the failure to apply the resource.
+	// +optional
+	Message string `json:"message,omitempty"`
+}
+
 func (m *ClusterResourceSet) GetConditions() clusterv1.Conditions {
 	return m.Status.Conditions
 }
@@ -18,12 +18,15 @@ package v1alpha3
 
 import (
 	"fmt"
+	"net/url"
 	"reflect"
 
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
 	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/cluster-api/util/cron"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 )
@@ -46,6 +49,11 @@ func (m *ClusterResourceSet) Default() {
 	if m.Spec.Strategy == "" {
 		m.Spec.Strategy = string(ClusterResourceSetStrategyApplyOnce)
 	}
+
+	// ClusterResourceSet DeletePropagationPolicy defaults to Background, like kubectl.
+	if m.Spec.DeletePropagationPolicy == "" {
+		m.Spec.DeletePropagationPolicy = string(metav1.DeletePropagationBackground)
+	}
 }
 
 // ValidateCreate implements webhook.Validator so a webhook will be registered for the type
@@ -67,6 +75,18 @@ func (m *ClusterResourceSet) ValidateDelete() error {
 	return nil
 }
 
+// referencesMoreThanOnce returns true if more than one of the resources of the ClusterResourceSet refer to the source
+// of resource.
+func (m *ClusterResourceSet) referencesMoreThanOnce(resource ResourceRef) bool {
+	count := 0
+	for _, r := range m.Spec.Resources {
+		if r.refersTo(resource) {
+			count++
+		}
+	}
+	return count > 1
+}
+
 func (m *ClusterResourceSet) validate(old *ClusterResourceSet) error {
 	var allErrs field.ErrorList
 
@@ -79,13 +99,142 @@ func (m *ClusterResourceSet) validate(old *ClusterResourceSet) error {
 		)
 	}
 
-	// Validate that the selector isn't empty as null selectors do not select any objects.
-	if selector != nil && selector.Empty() {
+	// Validate the additional selectors parse as Selectors and are not empty.
+	for i := range m.Spec.ClusterSelectors {
+		path := field.NewPath("spec", "clusterSelectors").Index(i)
+		s, err := metav1.LabelSelectorAsSelector(&m.Spec.ClusterSelectors[i])
+		if err != nil {
+			allErrs = append(allErrs, field.Invalid(path, m.Spec.ClusterSelectors[i], err.Error()))
+			continue
+		}
+		if s.Empty() {
+			allErrs = append(allErrs, field.Invalid(path, m.Spec.ClusterSelectors[i], "selector must not be empty"))
+		}
+	}
+
+	// Validate that the opt-in annotation is a valid annotation key.
+	if m.Spec.RequireOptInAnnotation != "" {
+		for _, msg := range validation.IsQualifiedName(m.Spec.RequireOptInAnnotation) {
+			allErrs = append(allErrs, field.Invalid(field.NewPath("spec", "requireOptInAnnotation"), m.Spec.RequireOptInAnnotation, msg))
+		}
+	}
+
+	// Validate that the region selector selects something and that its regions are valid label values.
+	if m.Spec.RegionSelector != nil {
+		path := field.NewPath("spec", "regionSelector")
+		if len(m.Spec.RegionSelector.Regions) == 0 && len(m.Spec.RegionSelector.FailureDomains) == 0 {
+			allErrs = append(allErrs, field.Required(path, "regions or failureDomains must be set"))
+		}
+		for i, region := range m.Spec.RegionSelector.Regions {
+			for _, msg := range validation.IsValidLabelValue(region) {
+				allErrs = append(allErrs, field.Invalid(path.Child("regions").Index(i), region, msg))
+			}
+			if region == "" {
+				allErrs = append(allErrs, field.Invalid(path.Child("regions").Index(i), region, "region must not be empty"))
+			}
+		}
+		for i, failureDomain := range m.Spec.RegionSelector.FailureDomains {
+			if failureDomain == "" {
+				allErrs = append(allErrs, field.Invalid(path.Child("failureDomains").Index(i), failureDomain, "failure domain must not be empty"))
+			}
+		}
+	}
+
+	// Validate that the apply window has a valid schedule and lasts.
+	if m.Spec.ApplyWindow != nil {
+		path := field.NewPath("spec", "applyWindow")
+		if _, err := cron.Parse(m.Spec.ApplyWindow.Schedule); err != nil {
+			allErrs = append(allErrs, field.Invalid(path.Child("schedule"), m.Spec.ApplyWindow.Schedule, err.Error()))
+		}
+		if m.Spec.ApplyWindow.Duration.Duration <= 0 {
+			allErrs = append(allErrs, field.Invalid(path.Child("duration"), m.Spec.ApplyWindow.Duration.Duration.String(), "duration must be positive"))
+		}
+	}
+
+	// Validate that the selector isn't empty as null selectors do not select any objects, unless the ClusterResourceSet
+	// targets a single cluster by name, in which case the selector must not be set, or uses additional selectors.
+	if m.Spec.ClusterName == "" && len(m.Spec.ClusterSelectors) == 0 && selector != nil && selector.Empty() {
 		allErrs = append(
 			allErrs,
 			field.Invalid(field.NewPath("spec", "clusterSelector"), m.Spec.ClusterSelector, "selector must not be empty"),
 		)
 	}
+	if m.Spec.ClusterName != "" && selector != nil && !selector.Empty() {
+		allErrs = append(
+			allErrs,
+			field.Forbidden(field.NewPath("spec", "clusterSelector"), "selector must be empty when clusterName is set"),
+		)
+	}
+	if m.Spec.ClusterName != "" && len(m.Spec.ClusterSelectors) > 0 {
+		allErrs = append(
+			allErrs,
+			field.Forbidden(field.NewPath("spec", "clusterSelectors"), "selectors must be empty when clusterName is set"),
+		)
+	}
+
+	// Validate that each source is referenced only once, as duplicates would be applied repeatedly.
+	// Sources the old object already referenced more than once are allowed on update, so that ClusterResourceSets
+	// created before this was validated can still be updated, e.g. to remove their finalizer when deleted.
+	for i := range m.Spec.Resources {
+		for j := 0; j < i; j++ {
+			if m.Spec.Resources[i].refersTo(m.Spec.Resources[j]) {
+				if old != nil && old.referencesMoreThanOnce(m.Spec.Resources[i]) {
+					break
+				}
+				allErrs = append(
+					allErrs,
+					field.Duplicate(field.NewPath("spec", "resources").Index(i), m.Spec.Resources[i]),
+				)
+				break
+			}
+		}
+	}
+
+	// Validate that the resource selectors are only used with ConfigMaps, without keys, and parse as Selectors.
+	for i, resource := range m.Spec.Resources {
+		if resource.Selector == nil {
+			continue
+		}
+		path := field.NewPath("spec", "resources").Index(i).Child("selector")
+		if resource.Kind != string(ConfigMapClusterResourceSetResourceKind) {
+			allErrs = append(allErrs, field.Forbidden(path, "selector is only supported with the ConfigMap kind"))
+		}
+		if len(resource.Keys) > 0 {
+			allErrs = append(allErrs, field.Forbidden(path, "selector cannot be used with keys"))
+		}
+		if _, err := metav1.LabelSelectorAsSelector(resource.Selector); err != nil {
+			allErrs = append(allErrs, field.Invalid(path, resource.Selector, err.Error()))
+		}
+	}
+
+	// Validate that cluster overrides are only enabled for Secrets and ConfigMaps.
+	for i, resource := range m.Spec.Resources {
+		if resource.ClusterOverrides && resource.Kind != string(SecretClusterResourceSetResourceKind) && resource.Kind != string(ConfigMapClusterResourceSetResourceKind) {
+			allErrs = append(allErrs, field.Forbidden(field.NewPath("spec", "resources").Index(i).Child("clusterOverrides"),
+				"cluster overrides are only supported with the Secret and ConfigMap kinds"))
+		}
+	}
+
+	// Validate that Git repositories are set exactly for the resources of the GitRepository kind, and are fetched over HTTP(S).
+	for i, resource := range m.Spec.Resources {
+		path := field.NewPath("spec", "resources").Index(i).Child("git")
+		isGit := resource.Kind == string(GitRepositoryClusterResourceSetResourceKind)
+		switch {
+		case isGit && resource.Git == nil:
+			allErrs = append(allErrs, field.Required(path, "git is required with the GitRepository kind"))
+		case !isGit && resource.Git != nil:
+			allErrs = append(allErrs, field.Forbidden(path, "git is only supported with the GitRepository kind"))
+		case isGit:
+			u, err := url.Parse(resource.Git.URL)
+			switch {
+			case err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "":
+				allErrs = append(allErrs, field.Invalid(path.Child("url"), resource.Git.URL, "must be an http or https URL"))
+			case u.Scheme == "http" && resource.Git.SecretName != "":
+				// Credentials must not be sent in clear text.
+				allErrs = append(allErrs, field.Invalid(path.Child("url"), resource.Git.URL, "must be an https URL when secretName is set"))
+			}
+		}
+	}
 
 	if old != nil && old.Spec.Strategy != m.Spec.Strategy {
 		allErrs = append(
@@ -94,6 +243,13 @@ func (m *ClusterResourceSet) validate(old *ClusterResourceSet) error {
 		)
 	}
 
+	if old != nil && old.Spec.ClusterName != m.Spec.ClusterName {
+		allErrs = append(
+			allErrs,
+			field.Invalid(field.NewPath("spec", "clusterName"), m.Spec.ClusterName, "field is immutable"),
+		)
+	}
+
 	if old != nil && !reflect.DeepEqual(old.Spec.ClusterSelector, m.Spec.ClusterSelector) {
 		allErrs = append(
 			allErrs,
@@ -101,6 +257,34 @@ func (m *ClusterResourceSet) validate(old *ClusterResourceSet) error {
 		)
 	}
 
+	if old != nil && !reflect.DeepEqual(old.Spec.ClusterSelectors, m.Spec.ClusterSelectors) {
+		allErrs = append(
+			allErrs,
+			field.Invalid(field.NewPath("spec", "clusterSelectors"), m.Spec.ClusterSelectors, "field is immutable"),
+		)
+	}
+
+	if old != nil && !reflect.DeepEqual(old.Spec.ClusterAnnotationSelector, m.Spec.ClusterAnnotationSelector) {
+		allErrs = append(
+			allErrs,
+			field.Invalid(field.NewPath("spec", "clusterAnnotationSelector"), m.Spec.ClusterAnnotationSelector, "field is immutable"),
+		)
+	}
+
+	if old != nil && old.Spec.RequireOptInAnnotation != m.Spec.RequireOptInAnnotation {
+		allErrs = append(
+			allErrs,
+			field.Invalid(field.NewPath("spec", "requireOptInAnnotation"), m.Spec.RequireOptInAnnotation, "field is immutable"),
+		)
+	}
+
+	if old != nil && !reflect.DeepEqual(old.Spec.RegionSelector, m.Spec.RegionSelector) {
+		allErrs = append(
+			allErrs,
+			field.Invalid(field.NewPath("spec", "regionSelector"), m.Spec.RegionSelector, "field is immutable"),
+		)
+	}
+
 	if len(allErrs) == 0 {
 		return nil
 	}
@@ -18,6 +18,7 @@ package v1alpha3
 
 import (
 	"testing"
+	"time"
 
 	. "github.com/onsi/gomega"
 
@@ -31,6 +32,7 @@ func TestClusterResourcesetDefault(t *testing.T) {
 	clusterResourceSet.Default()
 
 	g.Expect(clusterResourceSet.Spec.Strategy).To(Equal(string(ClusterResourceSetStrategyApplyOnce)))
+	g.Expect(clusterResourceSet.Spec.DeletePropagationPolicy).To(Equal(string(metav1.DeletePropagationBackground)))
 }
 
 func TestClusterResourceSetLabelSelectorAsSelectorValidation(t *testing.T) {
@@ -185,3 +187,527 @@ func TestClusterResourceSetSelectorNotEmptyValidation(t *testing.T) {
 	g.Expect(err).ToNot(BeNil())
 	g.Expect(err.Error()).To(ContainSubstring("selector must not be empty"))
 }
+
+func TestClusterResourceSetClusterSelectorsValidation(t *testing.T) {
+	tests := []struct {
+		name        string
+		clusterName string
+		selector    map[string]string
+		selectors   []map[string]string
+		expectErr   bool
+	}{
+		{
+			name:      "should accept additional selectors without a selector",
+			selectors: []map[string]string{{"env": "prod"}, {"tier": "critical"}},
+			expectErr: false,
+		},
+		{
+			name:      "should accept additional selectors with a selector",
+			selector:  map[string]string{"foo": "bar"},
+			selectors: []map[string]string{{"env": "prod"}},
+			expectErr: false,
+		},
+		{
+			name:      "should reject empty additional selectors",
+			selectors: []map[string]string{{"env": "prod"}, {}},
+			expectErr: true,
+		},
+		{
+			name:      "should reject invalid additional selectors",
+			selectors: []map[string]string{{"-123-foo": "bar"}},
+			expectErr: true,
+		},
+		{
+			name:        "should reject additional selectors with a cluster name",
+			clusterName: "foo",
+			selectors:   []map[string]string{{"env": "prod"}},
+			expectErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			clusterResourceSet := &ClusterResourceSet{
+				Spec: ClusterResourceSetSpec{
+					ClusterName:     tt.clusterName,
+					ClusterSelector: metav1.LabelSelector{MatchLabels: tt.selector},
+				},
+			}
+			for _, selector := range tt.selectors {
+				clusterResourceSet.Spec.ClusterSelectors = append(clusterResourceSet.Spec.ClusterSelectors, metav1.LabelSelector{MatchLabels: selector})
+			}
+			if tt.expectErr {
+				g.Expect(clusterResourceSet.ValidateCreate()).NotTo(Succeed())
+				return
+			}
+			g.Expect(clusterResourceSet.ValidateCreate()).To(Succeed())
+		})
+	}
+
+	g := NewWithT(t)
+	oldClusterResourceSet := &ClusterResourceSet{Spec: ClusterResourceSetSpec{ClusterSelectors: []metav1.LabelSelector{{MatchLabels: map[string]string{"env": "prod"}}}}}
+	newClusterResourceSet := &ClusterResourceSet{Spec: ClusterResourceSetSpec{ClusterSelectors: []metav1.LabelSelector{{MatchLabels: map[string]string{"env": "dev"}}}}}
+	g.Expect(newClusterResourceSet.ValidateUpdate(oldClusterResourceSet)).NotTo(Succeed())
+}
+
+func TestClusterResourceSetRegionSelectorValidation(t *testing.T) {
+	tests := []struct {
+		name           string
+		regionSelector *RegionSelector
+		expectErr      bool
+	}{
+		{
+			name:           "should accept regions",
+			regionSelector: &RegionSelector{Regions: []string{"us-east-1", "eu-west-1"}},
+			expectErr:      false,
+		},
+		{
+			name:           "should accept failure domains",
+			regionSelector: &RegionSelector{FailureDomains: []string{"us-east-1a"}},
+			expectErr:      false,
+		},
+		{
+			name:           "should reject a region selector selecting nothing",
+			regionSelector: &RegionSelector{},
+			expectErr:      true,
+		},
+		{
+			name:           "should reject regions that are not label values",
+			regionSelector: &RegionSelector{Regions: []string{"us east"}},
+			expectErr:      true,
+		},
+		{
+			name:           "should reject empty regions",
+			regionSelector: &RegionSelector{Regions: []string{""}},
+			expectErr:      true,
+		},
+		{
+			name:           "should reject empty failure domains",
+			regionSelector: &RegionSelector{FailureDomains: []string{""}},
+			expectErr:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			clusterResourceSet := &ClusterResourceSet{
+				Spec: ClusterResourceSetSpec{
+					ClusterSelector: metav1.LabelSelector{MatchLabels: map[string]string{"foo": "bar"}},
+					RegionSelector:  tt.regionSelector,
+				},
+			}
+			if tt.expectErr {
+				g.Expect(clusterResourceSet.ValidateCreate()).NotTo(Succeed())
+				return
+			}
+			g.Expect(clusterResourceSet.ValidateCreate()).To(Succeed())
+		})
+	}
+}
+
+func TestClusterResourceSetDuplicateResourcesValidation(t *testing.T) {
+	tests := []struct {
+		name      string
+		resources []ResourceRef
+		expectErr bool
+	}{
+		{
+			name: "should accept resources with different kinds or names",
+			resources: []ResourceRef{
+				{Kind: "Secret", Name: "foo"},
+				{Kind: "ConfigMap", Name: "foo"},
+				{Kind: "Secret", Name: "bar"},
+			},
+			expectErr: false,
+		},
+		{
+			name: "should reject resources referencing the same source twice",
+			resources: []ResourceRef{
+				{Kind: "Secret", Name: "foo"},
+				{Kind: "Secret", Name: "foo", Mode: string(PatchClusterResourceSetResourceMode)},
+			},
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			clusterResourceSet := &ClusterResourceSet{
+				Spec: ClusterResourceSetSpec{
+					ClusterSelector: metav1.LabelSelector{
+						MatchLabels: map[string]string{"foo": "bar"},
+					},
+					Resources: tt.resources,
+				},
+			}
+			if tt.expectErr {
+				g.Expect(clusterResourceSet.ValidateCreate()).NotTo(Succeed())
+				return
+			}
+			g.Expect(clusterResourceSet.ValidateCreate()).To(Succeed())
+		})
+	}
+}
+
+func TestClusterResourceSetDuplicateResourcesUpdateValidation(t *testing.T) {
+	tests := []struct {
+		name         string
+		oldResources []ResourceRef
+		resources    []ResourceRef
+		expectErr    bool
+	}{
+		{
+			name: "should accept an update keeping duplicates the old object had",
+			oldResources: []ResourceRef{
+				{Kind: "Secret", Name: "foo"},
+				{Kind: "Secret", Name: "foo"},
+			},
+			resources: []ResourceRef{
+				{Kind: "Secret", Name: "foo"},
+				{Kind: "Secret", Name: "foo"},
+				{Kind: "ConfigMap", Name: "bar"},
+			},
+			expectErr: false,
+		},
+		{
+			name: "should reject an update adding a duplicate the old object did not have",
+			oldResources: []ResourceRef{
+				{Kind: "Secret", Name: "foo"},
+				{Kind: "Secret", Name: "foo"},
+				{Kind: "ConfigMap", Name: "bar"},
+			},
+			resources: []ResourceRef{
+				{Kind: "Secret", Name: "foo"},
+				{Kind: "Secret", Name: "foo"},
+				{Kind: "ConfigMap", Name: "bar"},
+				{Kind: "ConfigMap", Name: "bar"},
+			},
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			newClusterResourceSet := func(resources []ResourceRef) *ClusterResourceSet {
+				return &ClusterResourceSet{
+					Spec: ClusterResourceSetSpec{
+						ClusterSelector: metav1.LabelSelector{
+							MatchLabels: map[string]string{"foo": "bar"},
+						},
+						Resources: resources,
+					},
+				}
+			}
+			old := newClusterResourceSet(tt.oldResources)
+			clusterResourceSet := newClusterResourceSet(tt.resources)
+			if tt.expectErr {
+				g.Expect(clusterResourceSet.ValidateUpdate(old)).NotTo(Succeed())
+				return
+			}
+			g.Expect(clusterResourceSet.ValidateUpdate(old)).To(Succeed())
+		})
+	}
+}
+
+func TestClusterResourceSetClusterNameValidation(t *testing.T) {
+	tests := []struct {
+		name        string
+		clusterName string
+		selectors   map[string]string
+		expectErr   bool
+	}{
+		{
+			name:        "should accept a cluster name without selector",
+			clusterName: "foo",
+			expectErr:   false,
+		},
+		{
+			name:        "should reject a cluster name with a selector",
+			clusterName: "foo",
+			selectors:   map[string]string{"foo": "bar"},
+			expectErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			clusterResourceSet := &ClusterResourceSet{
+				Spec: ClusterResourceSetSpec{
+					ClusterName: tt.clusterName,
+					ClusterSelector: metav1.LabelSelector{
+						MatchLabels: tt.selectors,
+					},
+				},
+			}
+			if tt.expectErr {
+				g.Expect(clusterResourceSet.ValidateCreate()).NotTo(Succeed())
+				return
+			}
+			g.Expect(clusterResourceSet.ValidateCreate()).To(Succeed())
+		})
+	}
+
+	g := NewWithT(t)
+	oldClusterResourceSet := &ClusterResourceSet{Spec: ClusterResourceSetSpec{ClusterName: "foo"}}
+	newClusterResourceSet := &ClusterResourceSet{Spec: ClusterResourceSetSpec{ClusterName: "bar"}}
+	g.Expect(newClusterResourceSet.ValidateUpdate(oldClusterResourceSet)).NotTo(Succeed())
+}
+
+func TestClusterResourceSetRequireOptInAnnotationValidation(t *testing.T) {
+	g := NewWithT(t)
+	clusterResourceSet := &ClusterResourceSet{
+		Spec: ClusterResourceSetSpec{
+			ClusterSelector:        metav1.LabelSelector{MatchLabels: map[string]string{"foo": "bar"}},
+			RequireOptInAnnotation: "addons.example.com/sensitive",
+		},
+	}
+	g.Expect(clusterResourceSet.ValidateCreate()).To(Succeed())
+
+	clusterResourceSet.Spec.RequireOptInAnnotation = "not a valid key"
+	g.Expect(clusterResourceSet.ValidateCreate()).NotTo(Succeed())
+}
+
+func TestClusterResourceSetNarrowingFieldsImmutable(t *testing.T) {
+	tests := []struct {
+		name      string
+		update    func(spec *ClusterResourceSetSpec)
+		expectErr bool
+	}{
+		{
+			name: "when the ClusterAnnotationSelector has changed",
+			update: func(spec *ClusterResourceSetSpec) {
+				spec.ClusterAnnotationSelector = map[string]string{"foo": "different"}
+			},
+			expectErr: true,
+		},
+		{
+			name: "when the RequireOptInAnnotation has changed",
+			update: func(spec *ClusterResourceSetSpec) {
+				spec.RequireOptInAnnotation = "addons.example.com/other"
+			},
+			expectErr: true,
+		},
+		{
+			name: "when the RegionSelector has changed",
+			update: func(spec *ClusterResourceSetSpec) {
+				spec.RegionSelector = &RegionSelector{Regions: []string{"eu-west-1"}}
+			},
+			expectErr: true,
+		},
+		{
+			name: "when the ClusterMaxAge has changed",
+			update: func(spec *ClusterResourceSetSpec) {
+				spec.ClusterMaxAge = &metav1.Duration{Duration: 2 * time.Hour}
+			},
+			expectErr: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			oldClusterResourceSet := &ClusterResourceSet{
+				Spec: ClusterResourceSetSpec{
+					ClusterSelector:           metav1.LabelSelector{MatchLabels: map[string]string{"foo": "bar"}},
+					ClusterAnnotationSelector: map[string]string{"foo": "bar"},
+					RequireOptInAnnotation:    "addons.example.com/sensitive",
+					ClusterMaxAge:             &metav1.Duration{Duration: time.Hour},
+					RegionSelector:            &RegionSelector{Regions: []string{"us-east-1"}},
+				},
+			}
+			newClusterResourceSet := oldClusterResourceSet.DeepCopy()
+			tt.update(&newClusterResourceSet.Spec)
+
+			if tt.expectErr {
+				g.Expect(newClusterResourceSet.ValidateUpdate(oldClusterResourceSet)).NotTo(Succeed())
+				return
+			}
+			g.Expect(newClusterResourceSet.ValidateUpdate(oldClusterResourceSet)).To(Succeed())
+		})
+	}
+}
+
+func TestClusterResourceSetResourceSelectorValidation(t *testing.T) {
+	tests := []struct {
+		name      string
+		resource  ResourceRef
+		expectErr bool
+	}{
+		{
+			name:      "should accept a selector of ConfigMaps",
+			resource:  ResourceRef{Kind: "ConfigMap", Name: "cni", Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"addon": "cni"}}},
+			expectErr: false,
+		},
+		{
+			name:      "should reject a selector of Secrets",
+			resource:  ResourceRef{Kind: "Secret", Name: "cni", Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"addon": "cni"}}},
+			expectErr: true,
+		},
+		{
+			name:      "should reject a selector with keys",
+			resource:  ResourceRef{Kind: "ConfigMap", Name: "cni", Keys: []string{"a"}, Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"addon": "cni"}}},
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			clusterResourceSet := &ClusterResourceSet{
+				Spec: ClusterResourceSetSpec{
+					ClusterSelector: metav1.LabelSelector{MatchLabels: map[string]string{"foo": "bar"}},
+					Resources:       []ResourceRef{tt.resource},
+				},
+			}
+			if tt.expectErr {
+				g.Expect(clusterResourceSet.ValidateCreate()).NotTo(Succeed())
+				return
+			}
+			g.Expect(clusterResourceSet.ValidateCreate()).To(Succeed())
+		})
+	}
+}
+
+func TestClusterResourceSetGitRepositoryValidation(t *testing.T) {
+	tests := []struct {
+		name      string
+		resource  ResourceRef
+		expectErr bool
+	}{
+		{
+			name:      "should accept a Git repository with an https URL",
+			resource:  ResourceRef{Kind: "GitRepository", Name: "cni", Git: &GitRepositorySource{URL: "https://example.com/addons.git", Path: "cni"}},
+			expectErr: false,
+		},
+		{
+			name:      "should reject the GitRepository kind without a repository",
+			resource:  ResourceRef{Kind: "GitRepository", Name: "cni"},
+			expectErr: true,
+		},
+		{
+			name:      "should reject a repository with another kind",
+			resource:  ResourceRef{Kind: "ConfigMap", Name: "cni", Git: &GitRepositorySource{URL: "https://example.com/addons.git"}},
+			expectErr: true,
+		},
+		{
+			name:      "should reject an ssh URL",
+			resource:  ResourceRef{Kind: "GitRepository", Name: "cni", Git: &GitRepositorySource{URL: "ssh://git@example.com/addons.git"}},
+			expectErr: true,
+		},
+		{
+			name:      "should accept an http URL without a secret",
+			resource:  ResourceRef{Kind: "GitRepository", Name: "cni", Git: &GitRepositorySource{URL: "http://example.com/addons.git"}},
+			expectErr: false,
+		},
+		{
+			name:      "should reject an http URL with a secret",
+			resource:  ResourceRef{Kind: "GitRepository", Name: "cni", Git: &GitRepositorySource{URL: "http://example.com/addons.git", SecretName: "git-creds"}},
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			clusterResourceSet := &ClusterResourceSet{
+				Spec: ClusterResourceSetSpec{
+					ClusterSelector: metav1.LabelSelector{MatchLabels: map[string]string{"foo": "bar"}},
+					Resources:       []ResourceRef{tt.resource},
+				},
+			}
+			if tt.expectErr {
+				g.Expect(clusterResourceSet.ValidateCreate()).NotTo(Succeed())
+				return
+			}
+			g.Expect(clusterResourceSet.ValidateCreate()).To(Succeed())
+		})
+	}
+}
+
+func TestClusterResourceSetClusterOverridesValidation(t *testing.T) {
+	tests := []struct {
+		name      string
+		resource  ResourceRef
+		expectErr bool
+	}{
+		{
+			name:      "should accept cluster overrides of a ConfigMap",
+			resource:  ResourceRef{Kind: "ConfigMap", Name: "cni", ClusterOverrides: true},
+			expectErr: false,
+		},
+		{
+			name:      "should accept cluster overrides of a Secret",
+			resource:  ResourceRef{Kind: "Secret", Name: "cni", ClusterOverrides: true},
+			expectErr: false,
+		},
+		{
+			name:      "should reject cluster overrides of an OCI artifact",
+			resource:  ResourceRef{Kind: "OCIArtifact", Name: "registry.example.com/addons/cni:v1", ClusterOverrides: true},
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			clusterResourceSet := &ClusterResourceSet{
+				Spec: ClusterResourceSetSpec{
+					ClusterSelector: metav1.LabelSelector{MatchLabels: map[string]string{"foo": "bar"}},
+					Resources:       []ResourceRef{tt.resource},
+				},
+			}
+			if tt.expectErr {
+				g.Expect(clusterResourceSet.ValidateCreate()).NotTo(Succeed())
+				return
+			}
+			g.Expect(clusterResourceSet.ValidateCreate()).To(Succeed())
+		})
+	}
+}
+
+func TestClusterResourceSetApplyWindowValidation(t *testing.T) {
+	tests := []struct {
+		name        string
+		applyWindow *ApplyWindow
+		expectErr   bool
+	}{
+		{
+			name:        "should accept a window with a valid schedule",
+			applyWindow: &ApplyWindow{Schedule: "0 2 * * 6", Duration: metav1.Duration{Duration: 4 * time.Hour}},
+			expectErr:   false,
+		},
+		{
+			name:        "should reject an invalid schedule",
+			applyWindow: &ApplyWindow{Schedule: "0 2 * *", Duration: metav1.Duration{Duration: 4 * time.Hour}},
+			expectErr:   true,
+		},
+		{
+			name:        "should reject a window without a duration",
+			applyWindow: &ApplyWindow{Schedule: "0 2 * * 6"},
+			expectErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			clusterResourceSet := &ClusterResourceSet{
+				Spec: ClusterResourceSetSpec{
+					ClusterSelector: metav1.LabelSelector{MatchLabels: map[string]string{"foo": "bar"}},
+					ApplyWindow:     tt.applyWindow,
+				},
+			}
+			if tt.expectErr {
+				g.Expect(clusterResourceSet.ValidateCreate()).NotTo(Succeed())
+				return
+			}
+			g.Expect(clusterResourceSet.ValidateCreate()).To(Succeed())
+		})
+	}
+}
@@ -17,9 +17,16 @@ limitations under the License.
 package v1alpha3
 
 import (
-	"reflect"
-
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// ClusterResourceSetBindingCleanupAnnotation can be set on a ClusterResourceSetBinding to request an immediate removal
+	// of the entries of ClusterResourceSets that no longer exist. The binding is deleted if no entries are left,
+	// otherwise the annotation is removed once the cleanup is done.
+	// Orphaned entries are also removed without the annotation when the ClusterResourceSets are deleted.
+	ClusterResourceSetBindingCleanupAnnotation = "addons.cluster.x-k8s.io/cleanup-stale-bindings"
 )
 
 // ANCHOR: ResourceBinding
@@ -29,16 +36,83 @@ type ResourceBinding struct {
 	// ResourceRef specifies a resource.
 	ResourceRef `json:",inline"`
 
+	// SourceNamespace is the namespace the resource was read from. It differs from the cluster's namespace
+	// when the resource was found in the shared namespace.
+	// +optional
+	SourceNamespace string `json:"sourceNamespace,omitempty"`
+
+	// SourceUID is the UID of the Secret or ConfigMap the resource was read from. A resource whose source has a different
+	// UID, i.e. was deleted and recreated with the same name, is considered changed and is applied again.
+	// +optional
+	SourceUID types.UID `json:"sourceUID,omitempty"`
+
 	// Hash is the hash of a resource's data. This can be used to decide if a resource is changed.
 	// For "ApplyOnce" ClusterResourceSet.spec.strategy, this is no-op as that strategy does not act on change.
+	// Hashes are prefixed with their format, e.g. "v1:sha256:". Hashes recorded in the unversioned "sha256:" format
+	// are migrated to the current format without applying unchanged resources again.
 	Hash string `json:"hash,omitempty"`
 
 	// LastAppliedTime identifies when this resource was last applied to the cluster.
 	// +optional
 	LastAppliedTime *metav1.Time `json:"lastAppliedTime,omitempty"`
 
+	// AppliedBytes is the size of the manifests of this resource last applied successfully to the cluster. It is a
+	// best-effort estimate of the space its objects take in the cluster, not counting the fields set by the cluster.
+	// +optional
+	AppliedBytes int64 `json:"appliedBytes,omitempty"`
+
+	// AppliedObjects is the number of objects of this resource last applied successfully to the cluster. They count
+	// towards the object limit of the cluster.
+	// +optional
+	AppliedObjects int32 `json:"appliedObjects,omitempty"`
+
+	// LastApplyDuration is how long the last apply of this resource to the cluster took.
+	// It is a best-effort measurement that helps identifying resources that are slow to apply.
+	// +optional
+	LastApplyDuration *metav1.Duration `json:"lastApplyDuration,omitempty"`
+
+	// FieldConflict is true if the last apply of this resource failed because fields of its objects are owned by
+	// another field manager in the cluster.
+	// +optional
+	FieldConflict bool `json:"fieldConflict,omitempty"`
+
+	// NotReadySince is when the objects of the resource were first found not ready while waiting for them to be ready.
+	// +optional
+	NotReadySince *metav1.Time `json:"notReadySince,omitempty"`
+
+	// LastReplacedTime is when objects of the resource were last deleted and recreated because of changes to their
+	// immutable fields.
+	// +optional
+	LastReplacedTime *metav1.Time `json:"lastReplacedTime,omitempty"`
+
+	// PruneRequestedTime is when the resource was found removed from the ClusterResourceSet with a PruneGracePeriod.
+	// Its objects are deleted from the cluster once the grace period elapsed, unless the resource is added back.
+	// +optional
+	PruneRequestedTime *metav1.Time `json:"pruneRequestedTime,omitempty"`
+
+	// LastApplyChanges is a short summary of what the last apply changed in the cluster, i.e. the objects that were
+	// created, updated, with their changed top-level fields, or replaced. It is truncated to keep the binding compact.
+	// +optional
+	LastApplyChanges string `json:"lastApplyChanges,omitempty"`
+
+	// DriftCount is the number of consecutive times the resource was applied again with the Reconcile strategy because
+	// its objects changed shortly after being applied, which hints at another controller managing them.
+	// +optional
+	DriftCount int32 `json:"driftCount,omitempty"`
+
+	// Disabled is true if the resource is not applied because its EnabledWhen feature flag does not have the expected
+	// value in the cluster. A disabled resource is not considered pending.
+	// +optional
+	Disabled bool `json:"disabled,omitempty"`
+
 	// Applied is to track if a resource is applied to the cluster or not.
 	Applied bool `json:"applied"`
+
+	// AppliedGeneration is the metadata.generation of the ClusterResourceSet when this resource was last applied
+	// successfully. Comparing it with the ClusterResourceSet's current generation shows whether the applied resource
+	// corresponds to the latest spec.
+	// +optional
+	AppliedGeneration int64 `json:"appliedGeneration,omitempty"`
 }
 
 // ANCHOR_END: ResourceBinding
@@ -50,12 +124,23 @@ type ResourceSetBinding struct {
 
 	// Resources is a list of resources that the ClusterResourceSet has.
 	Resources []ResourceBinding `json:"resources,omitempty"`
+
+	// PostApplyJobHash is the hash of the post-apply Job and of the resources it verified, recorded when the Job
+	// succeeded in the cluster.
+	// +optional
+	PostApplyJobHash string `json:"postApplyJobHash,omitempty"`
+}
+
+// refersTo returns true if both references point to the same source resource.
+// Only the kind and name identify a resource; the other fields only affect how it is applied.
+func (r ResourceRef) refersTo(other ResourceRef) bool {
+	return r.Kind == other.Kind && r.Name == other.Name
 }
 
 // IsApplied returns true if the resource is applied to the cluster by checking the cluster's binding.
 func (r *ResourceSetBinding) IsApplied(resourceRef ResourceRef) bool {
 	for _, resource := range r.Resources {
-		if reflect.DeepEqual(resource.ResourceRef, resourceRef) {
+		if resource.ResourceRef.refersTo(resourceRef) {
 			if resource.Applied {
 				return true
 			}
@@ -64,11 +149,31 @@ func (r *ResourceSetBinding) IsApplied(resourceRef ResourceRef) bool {
 	return false
 }
 
+// GetResourceBinding returns the ResourceBinding of a resource if it exists, otherwise returns nil.
+func (r *ResourceSetBinding) GetResourceBinding(resourceRef ResourceRef) *ResourceBinding {
+	for i := range r.Resources {
+		if r.Resources[i].ResourceRef.refersTo(resourceRef) {
+			return &r.Resources[i]
+		}
+	}
+	return nil
+}
+
+// DeleteResourceBinding removes the ResourceBinding of a resource if it exists.
+func (r *ResourceSetBinding) DeleteResourceBinding(resourceRef ResourceRef) {
+	for i := range r.Resources {
+		if r.Resources[i].ResourceRef.refersTo(resourceRef) {
+			r.Resources = append(r.Resources[:i], r.Resources[i+1:]...)
+			return
+		}
+	}
+}
+
 // SetBinding sets resourceBinding for a resource in resourceSetbinding either by updating the existing one or
 // creating a new one.
 func (r *ResourceSetBinding) SetBinding(resourceBinding ResourceBinding) {
 	for i := range r.Resources {
-		if reflect.DeepEqual(r.Resources[i].ResourceRef, resourceBinding.ResourceRef) {
+		if r.Resources[i].ResourceRef.refersTo(resourceBinding.ResourceRef) {
 			r.Resources[i] = resourceBinding
 			return
 		}
@@ -89,6 +194,16 @@ func (c *ClusterResourceSetBinding) GetOrCreateBinding(clusterResourceSet *Clust
 	return binding
 }
 
+// DeleteBinding removes the ResourceSetBinding of a given ClusterResourceSet if it exists.
+func (c *ClusterResourceSetBinding) DeleteBinding(clusterResourceSet *ClusterResourceSet) {
+	for i, binding := range c.Spec.Bindings {
+		if binding.ClusterResourceSetName == clusterResourceSet.Name {
+			c.Spec.Bindings = append(c.Spec.Bindings[:i], c.Spec.Bindings[i+1:]...)
+			return
+		}
+	}
+}
+
 // +kubebuilder:object:root=true
 // +kubebuilder:resource:path=clusterresourcesetbindings,scope=Namespaced,categories=cluster-api
 // +kubebuilder:subresource:status
@@ -87,6 +87,16 @@ func TestIsResourceApplied(t *testing.T) {
 			resourceRef:        resourceRefNotExist,
 			isApplied:          false,
 		},
+		{
+			name:               "should return true if the resource is applied successfully and its options changed",
+			resourceSetBinding: CRSBinding,
+			resourceRef: ResourceRef{
+				Name:             resourceRefApplySucceeded.Name,
+				Kind:             resourceRefApplySucceeded.Kind,
+				RequiresExisting: &PrerequisiteRef{APIVersion: "v1", Kind: "Namespace", Name: "kube-system"},
+			},
+			isApplied: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -168,3 +178,48 @@ func TestSetResourceBinding(t *testing.T) {
 		})
 	}
 }
+
+func TestGetResourceBinding(t *testing.T) {
+	g := NewWithT(t)
+
+	resourceRef := ResourceRef{
+		Name: "mySecret",
+		Kind: "Secret",
+	}
+	CRSBinding := &ResourceSetBinding{
+		ClusterResourceSetName: "test-clusterResourceSet",
+		Resources: []ResourceBinding{
+			{
+				ResourceRef: resourceRef,
+				Applied:     true,
+				Hash:        "xyz",
+			},
+		},
+	}
+
+	resourceBinding := CRSBinding.GetResourceBinding(resourceRef)
+	g.Expect(resourceBinding).NotTo(BeNil())
+	g.Expect(resourceBinding.Hash).To(Equal("xyz"))
+
+	g.Expect(CRSBinding.GetResourceBinding(ResourceRef{Name: "mySecret", Kind: "ConfigMap"})).To(BeNil())
+}
+
+func TestDeleteBinding(t *testing.T) {
+	g := NewWithT(t)
+
+	clusterResourceSetBinding := &ClusterResourceSetBinding{
+		Spec: ClusterResourceSetBindingSpec{
+			Bindings: []*ResourceSetBinding{
+				{ClusterResourceSetName: "foo"},
+				{ClusterResourceSetName: "bar"},
+			},
+		},
+	}
+
+	clusterResourceSetBinding.DeleteBinding(&ClusterResourceSet{ObjectMeta: metav1.ObjectMeta{Name: "foo"}})
+	g.Expect(clusterResourceSetBinding.Spec.Bindings).To(HaveLen(1))
+	g.Expect(clusterResourceSetBinding.Spec.Bindings[0].ClusterResourceSetName).To(Equal("bar"))
+
+	clusterResourceSetBinding.DeleteBinding(&ClusterResourceSet{ObjectMeta: metav1.ObjectMeta{Name: "missing"}})
+	g.Expect(clusterResourceSetBinding.Spec.Bindings).To(HaveLen(1))
+}
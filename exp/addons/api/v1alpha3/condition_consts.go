@@ -21,22 +21,186 @@ import clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
 // Conditions and condition Reasons for the ClusterResourceSet object
 
 const (
+	// EmptyCondition documents that the ClusterResourceSet has no resources, hence nothing is applied to the matching
+	// clusters and no ClusterResourceSetBindings are created for them.
+	EmptyCondition clusterv1.ConditionType = "Empty"
+
 	// ResourcesAppliedCondition documents that all resources in the ClusterResourceSet object are applied to
 	// all matching clusters. This indicates all resources exist, and no errors during applying them to all clusters.
 	ResourcesAppliedCondition clusterv1.ConditionType = "ResourcesApplied"
 
+	// ClusterReachableCondition documents that the controller could connect to all the clusters matching the
+	// ClusterResourceSet during the last reconcile. It distinguishes connectivity issues from failures applying resources.
+	ClusterReachableCondition clusterv1.ConditionType = "ClusterReachable"
+
+	// AllClustersAppliedCondition documents that all the resources of the ClusterResourceSet are recorded as applied in
+	// the ClusterResourceSetBindings of all the currently matching clusters, i.e. that the rollout is complete.
+	AllClustersAppliedCondition clusterv1.ConditionType = "AllClustersApplied"
+
+	// BindingsWithinLimitCondition documents that the ClusterResourceSetBindings of all the matching clusters have at most
+	// the maximum number of ClusterResourceSet entries configured on the controller.
+	BindingsWithinLimitCondition clusterv1.ConditionType = "BindingsWithinLimit"
+
+	// ClustersMatchedCondition documents that the ClusterResourceSet matches at least one cluster. A ClusterResourceSet
+	// matching no cluster for a long time is likely misconfigured, e.g. because of a typo in its selector.
+	ClustersMatchedCondition clusterv1.ConditionType = "ClustersMatched"
+
+	// ReconcilingCondition documents that the ClusterResourceSet is still being applied, following the conventions of
+	// kstatus, so that generic tools can wait for ClusterResourceSets. It is only set while the Ready condition, which
+	// summarizes the other conditions, is false with a severity lower than Error, and has the same reason and message.
+	ReconcilingCondition clusterv1.ConditionType = "Reconciling"
+
+	// StalledCondition documents that applying the ClusterResourceSet failed with an error that retrying does not fix,
+	// following the conventions of kstatus. It is only set while the Ready condition is false with the Error severity,
+	// and has the same reason and message.
+	StalledCondition clusterv1.ConditionType = "Stalled"
+
+	// WorkloadEventsCondition documents that no Warning Events were recently recorded in the workload clusters for the
+	// objects applied by the ClusterResourceSet. It is only set when the ClusterResourceSet reports workload events.
+	WorkloadEventsCondition clusterv1.ConditionType = "WorkloadEvents"
+
+	// WorkloadWarningEventsReason (Severity=Warning) documents that Warning Events were recently recorded in at least
+	// one of the matching clusters for objects applied by the ClusterResourceSet, e.g. Pods failing to be scheduled.
+	WorkloadWarningEventsReason = "WorkloadWarningEvents"
+
+	// NoMatchingClustersReason (Severity=Info) documents that the ClusterResourceSet does not match any cluster.
+	// The severity is Warning once no cluster matched for longer than the threshold configured on the controller.
+	NoMatchingClustersReason = "NoMatchingClusters"
+
+	// PostApplyJobSucceededCondition documents that the post-apply Job of the ClusterResourceSet succeeded in the
+	// matching clusters after all the resources were applied to them.
+	PostApplyJobSucceededCondition clusterv1.ConditionType = "PostApplyJobSucceeded"
+
+	// PostApplyJobRunningReason (Severity=Info) documents that the post-apply Job is running in at least one of the
+	// matching clusters.
+	PostApplyJobRunningReason = "PostApplyJobRunning"
+
+	// PostApplyJobFailedReason (Severity=Error) documents that the post-apply Job failed in at least one of the matching
+	// clusters, or could not be created. The Job is not run again until it or the resources change.
+	PostApplyJobFailedReason = "PostApplyJobFailed"
+
+	// TooManyBindingsReason (Severity=Warning) documents that the ClusterResourceSetBinding of at least one of the
+	// matching clusters has more ClusterResourceSet entries than expected, which is likely caused by a misconfiguration.
+	TooManyBindingsReason = "TooManyBindings"
+
+	// ClustersPendingReason (Severity=Info) documents that the resources of the ClusterResourceSet are not applied to
+	// some of the matching clusters yet.
+	ClustersPendingReason = "ClustersPending"
+
 	// RemoteClusterClientFailedReason (Severity=Error) documents failure during getting the remote cluster client.
 	RemoteClusterClientFailedReason = "RemoteClusterClientFailed"
 
+	// ClusterDeletingReason (Severity=Info) documents resources are not applied to at least one of the matching clusters
+	// because it started being deleted after it was selected.
+	ClusterDeletingReason = "ClusterDeleting"
+
+	// ManagementClusterReason (Severity=Warning) documents resources are not applied to at least one of the matching
+	// clusters because it is the management cluster itself, and the ClusterResourceSet does not allow it.
+	ManagementClusterReason = "ManagementCluster"
+
+	// WaitingForHigherPriorityReason (Severity=Info) documents resources are not applied to at least one of the matching
+	// clusters yet because ClusterResourceSets with a higher priority did not apply all their resources to it.
+	WaitingForHigherPriorityReason = "WaitingForHigherPriority"
+
+	// OutsideApplyWindowReason (Severity=Info) documents resources are not applied to at least one of the matching
+	// clusters because it is outside of the apply window of the ClusterResourceSet.
+	OutsideApplyWindowReason = "OutsideApplyWindow"
+
+	// WaitingForClusterConditionsReason (Severity=Info) documents resources are not applied to at least one of the
+	// matching clusters yet because some of the ClusterReadyConditions are not true on it.
+	WaitingForClusterConditionsReason = "WaitingForClusterConditions"
+
+	// ReconcileTimeoutReason (Severity=Warning) documents resources are not applied to at least one of the matching
+	// clusters because the reconcile deadline of the controller was reached, e.g. because a cluster hangs.
+	ReconcileTimeoutReason = "ReconcileTimeout"
+
 	// ClusterMatchFailedReason (Severity=Warning) documents failure getting clusters that match the clusterSelector.
+	// Deprecated: the controller sets InvalidSelectorReason or ClusterListFailedReason instead.
 	ClusterMatchFailedReason = "ClusterMatchFailed"
 
+	// InvalidSelectorReason (Severity=Error) documents that one of the cluster selectors of the ClusterResourceSet cannot
+	// be converted to a label selector. The ClusterResourceSet needs to be changed.
+	InvalidSelectorReason = "InvalidSelector"
+
+	// ClusterListFailedReason (Severity=Warning) documents failure listing or getting the clusters matching the
+	// ClusterResourceSet from the API server.
+	ClusterListFailedReason = "ClusterListFailed"
+
 	// ApplyFailedReason (Severity=Warning) documents applying at least one of the resources to one of the matching clusters is failed.
 	ApplyFailedReason = "ApplyFailed"
 
+	// TransientApplyFailedReason (Severity=Warning) documents applying at least one of the resources failed with an error
+	// that is likely to go away, e.g. a timeout or an unavailable API server. Applying it is retried with a backoff.
+	TransientApplyFailedReason = "TransientApplyFailed"
+
+	// PermanentApplyFailedReason (Severity=Error) documents applying at least one of the resources failed with an error
+	// that retrying does not fix, e.g. an invalid object or missing permissions. The resource needs to be changed.
+	PermanentApplyFailedReason = "PermanentApplyFailed"
+
+	// QuotaInsufficientReason (Severity=Warning) documents at least one of the resources is not applied because the
+	// ResourceQuotas of the cluster do not leave room for its objects.
+	QuotaInsufficientReason = "QuotaInsufficient"
+
+	// SchemaValidationFailedReason (Severity=Warning) documents at least one of the resources is not applied because its
+	// objects do not match the OpenAPI schemas of the cluster, e.g. because of fields or API versions it does not support.
+	SchemaValidationFailedReason = "SchemaValidationFailed"
+
+	// PossibleControllerConflictReason (Severity=Warning) documents the objects of at least one of the resources keep
+	// changing right after being applied with the Reconcile strategy, likely because another controller or a mutating
+	// webhook manages them too. Applying the resource again is delayed rather than fighting over the objects.
+	PossibleControllerConflictReason = "PossibleControllerConflict"
+
+	// KindNotAllowedReason (Severity=Error) documents at least one of the resources is not applied because it has
+	// objects of kinds that are not in the AllowedKinds of the ClusterResourceSet.
+	KindNotAllowedReason = "KindNotAllowed"
+
+	// MissingNamespaceReason (Severity=Warning) documents at least one of the resources is not applied because it has
+	// objects of namespaced kinds without a namespace while the ClusterResourceSet requires namespaces.
+	MissingNamespaceReason = "MissingNamespace"
+
+	// ObjectLimitExceededReason (Severity=Warning) documents at least one of the resources is not applied because its
+	// objects would push the number of objects applied by ClusterResourceSets to one of the clusters over the limit.
+	ObjectLimitExceededReason = "ObjectLimitExceeded"
+
+	// FieldConflictReason (Severity=Warning) documents at least one of the resources could not be applied because
+	// fields of its objects are owned by another field manager in the cluster.
+	FieldConflictReason = "FieldConflict"
+
 	// RetrievingResourceFailedReason (Severity=Warning) documents at least one of the resources are not successfully retrieved.
 	RetrievingResourceFailedReason = "RetrievingResourceFailed"
 
+	// ResourcePendingReason (Severity=Info) documents at least one of the resources does not exist yet while the
+	// ClusterResourceSet tolerates pending resources.
+	ResourcePendingReason = "ResourcePending"
+
+	// ResourceNotReadyReason (Severity=Info) documents at least one of the resources is applied but its objects are not
+	// ready yet while the ClusterResourceSet waits for them. The severity is Warning once the ready timeout elapsed.
+	ResourceNotReadyReason = "ResourceNotReady"
+
+	// OCIPullFailedReason (Severity=Warning) documents at least one of the OCI artifacts in the resource list could not
+	// be pulled from its registry.
+	OCIPullFailedReason = "OCIPullFailed"
+
+	// GitFetchFailedReason (Severity=Warning) documents at least one of the Git repositories in the resource list could
+	// not be fetched, e.g. because the repository is unreachable or the ref does not exist.
+	GitFetchFailedReason = "GitFetchFailed"
+
+	// GitAuthFailedReason (Severity=Error) documents at least one of the Git repositories in the resource list rejected
+	// the credentials of its Secret, or requires credentials while the resource has none.
+	GitAuthFailedReason = "GitAuthFailed"
+
 	// WrongSecretType (Severity=Warning) documents at least one of the Secret's type in the resource list is not supported.
 	WrongSecretTypeReason = "WrongSecretType"
+
+	// SecretSourceLabelMissingReason (Severity=Warning) documents at least one of the Secrets in the resource list is not
+	// labeled as a ClusterResourceSet source while the controller requires it.
+	SecretSourceLabelMissingReason = "SecretSourceLabelMissing"
+
+	// PrerequisiteMissingReason (Severity=Info) documents at least one of the resources is waiting for an object it
+	// requires to exist in the workload cluster.
+	PrerequisiteMissingReason = "PrerequisiteMissing"
+
+	// FeatureFlagUnavailableReason (Severity=Info) documents at least one of the resources is waiting for the feature
+	// flag enabling it to be readable in the workload cluster.
+	FeatureFlagUnavailableReason = "FeatureFlagUnavailable"
 )
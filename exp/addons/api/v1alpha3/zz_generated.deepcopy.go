@@ -21,10 +21,27 @@ limitations under the License.
 package v1alpha3
 
 import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	apiv1alpha3 "sigs.k8s.io/cluster-api/api/v1alpha3"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ApplyWindow) DeepCopyInto(out *ApplyWindow) {
+	*out = *in
+	out.Duration = in.Duration
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ApplyWindow.
+func (in *ApplyWindow) DeepCopy() *ApplyWindow {
+	if in == nil {
+		return nil
+	}
+	out := new(ApplyWindow)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ClusterResourceSet) DeepCopyInto(out *ClusterResourceSet) {
 	*out = *in
@@ -172,11 +189,82 @@ func (in *ClusterResourceSetList) DeepCopyObject() runtime.Object {
 func (in *ClusterResourceSetSpec) DeepCopyInto(out *ClusterResourceSetSpec) {
 	*out = *in
 	in.ClusterSelector.DeepCopyInto(&out.ClusterSelector)
+	if in.ClusterSelectors != nil {
+		in, out := &in.ClusterSelectors, &out.ClusterSelectors
+		*out = make([]metav1.LabelSelector, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.ClusterAnnotationSelector != nil {
+		in, out := &in.ClusterAnnotationSelector, &out.ClusterAnnotationSelector
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.ClusterMaxAge != nil {
+		in, out := &in.ClusterMaxAge, &out.ClusterMaxAge
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.RegionSelector != nil {
+		in, out := &in.RegionSelector, &out.RegionSelector
+		*out = new(RegionSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ApplyWindow != nil {
+		in, out := &in.ApplyWindow, &out.ApplyWindow
+		*out = new(ApplyWindow)
+		**out = **in
+	}
+	if in.ClusterReadyConditions != nil {
+		in, out := &in.ClusterReadyConditions, &out.ClusterReadyConditions
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
 	if in.Resources != nil {
 		in, out := &in.Resources, &out.Resources
 		*out = make([]ResourceRef, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.AddProvenanceLabels != nil {
+		in, out := &in.AddProvenanceLabels, &out.AddProvenanceLabels
+		*out = new(bool)
+		**out = **in
+	}
+	if in.PropagateLabels != nil {
+		in, out := &in.PropagateLabels, &out.PropagateLabels
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.PropagateAnnotations != nil {
+		in, out := &in.PropagateAnnotations, &out.PropagateAnnotations
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.ReadyTimeout != nil {
+		in, out := &in.ReadyTimeout, &out.ReadyTimeout
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.PruneGracePeriod != nil {
+		in, out := &in.PruneGracePeriod, &out.PruneGracePeriod
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.AllowedKinds != nil {
+		in, out := &in.AllowedKinds, &out.AllowedKinds
+		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.PostApplyJob != nil {
+		in, out := &in.PostApplyJob, &out.PostApplyJob
+		*out = new(ResourceRef)
+		(*in).DeepCopyInto(*out)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterResourceSetSpec.
@@ -199,6 +287,16 @@ func (in *ClusterResourceSetStatus) DeepCopyInto(out *ClusterResourceSetStatus)
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.WouldReapply != nil {
+		in, out := &in.WouldReapply, &out.WouldReapply
+		*out = make([]ReapplyAuditEntry, len(*in))
+		copy(*out, *in)
+	}
+	if in.ResourceConditions != nil {
+		in, out := &in.ResourceConditions, &out.ResourceConditions
+		*out = make([]ResourceCondition, len(*in))
+		copy(*out, *in)
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterResourceSetStatus.
@@ -211,14 +309,131 @@ func (in *ClusterResourceSetStatus) DeepCopy() *ClusterResourceSetStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *FeatureFlagRef) DeepCopyInto(out *FeatureFlagRef) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new FeatureFlagRef.
+func (in *FeatureFlagRef) DeepCopy() *FeatureFlagRef {
+	if in == nil {
+		return nil
+	}
+	out := new(FeatureFlagRef)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *GitRepositorySource) DeepCopyInto(out *GitRepositorySource) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new GitRepositorySource.
+func (in *GitRepositorySource) DeepCopy() *GitRepositorySource {
+	if in == nil {
+		return nil
+	}
+	out := new(GitRepositorySource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PrerequisiteRef) DeepCopyInto(out *PrerequisiteRef) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PrerequisiteRef.
+func (in *PrerequisiteRef) DeepCopy() *PrerequisiteRef {
+	if in == nil {
+		return nil
+	}
+	out := new(PrerequisiteRef)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ReapplyAuditEntry) DeepCopyInto(out *ReapplyAuditEntry) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ReapplyAuditEntry.
+func (in *ReapplyAuditEntry) DeepCopy() *ReapplyAuditEntry {
+	if in == nil {
+		return nil
+	}
+	out := new(ReapplyAuditEntry)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ReadinessCheck) DeepCopyInto(out *ReadinessCheck) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ReadinessCheck.
+func (in *ReadinessCheck) DeepCopy() *ReadinessCheck {
+	if in == nil {
+		return nil
+	}
+	out := new(ReadinessCheck)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RegionSelector) DeepCopyInto(out *RegionSelector) {
+	*out = *in
+	if in.Regions != nil {
+		in, out := &in.Regions, &out.Regions
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.FailureDomains != nil {
+		in, out := &in.FailureDomains, &out.FailureDomains
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RegionSelector.
+func (in *RegionSelector) DeepCopy() *RegionSelector {
+	if in == nil {
+		return nil
+	}
+	out := new(RegionSelector)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ResourceBinding) DeepCopyInto(out *ResourceBinding) {
 	*out = *in
-	out.ResourceRef = in.ResourceRef
+	in.ResourceRef.DeepCopyInto(&out.ResourceRef)
 	if in.LastAppliedTime != nil {
 		in, out := &in.LastAppliedTime, &out.LastAppliedTime
 		*out = (*in).DeepCopy()
 	}
+	if in.LastApplyDuration != nil {
+		in, out := &in.LastApplyDuration, &out.LastApplyDuration
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+	if in.NotReadySince != nil {
+		in, out := &in.NotReadySince, &out.NotReadySince
+		*out = (*in).DeepCopy()
+	}
+	if in.LastReplacedTime != nil {
+		in, out := &in.LastReplacedTime, &out.LastReplacedTime
+		*out = (*in).DeepCopy()
+	}
+	if in.PruneRequestedTime != nil {
+		in, out := &in.PruneRequestedTime, &out.PruneRequestedTime
+		*out = (*in).DeepCopy()
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ResourceBinding.
@@ -231,9 +446,54 @@ func (in *ResourceBinding) DeepCopy() *ResourceBinding {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ResourceCondition) DeepCopyInto(out *ResourceCondition) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ResourceCondition.
+func (in *ResourceCondition) DeepCopy() *ResourceCondition {
+	if in == nil {
+		return nil
+	}
+	out := new(ResourceCondition)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ResourceRef) DeepCopyInto(out *ResourceRef) {
 	*out = *in
+	if in.Selector != nil {
+		in, out := &in.Selector, &out.Selector
+		*out = new(metav1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Keys != nil {
+		in, out := &in.Keys, &out.Keys
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Git != nil {
+		in, out := &in.Git, &out.Git
+		*out = new(GitRepositorySource)
+		**out = **in
+	}
+	if in.RequiresExisting != nil {
+		in, out := &in.RequiresExisting, &out.RequiresExisting
+		*out = new(PrerequisiteRef)
+		**out = **in
+	}
+	if in.EnabledWhen != nil {
+		in, out := &in.EnabledWhen, &out.EnabledWhen
+		*out = new(FeatureFlagRef)
+		**out = **in
+	}
+	if in.ReadyWhen != nil {
+		in, out := &in.ReadyWhen, &out.ReadyWhen
+		*out = new(ReadinessCheck)
+		**out = **in
+	}
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ResourceRef.
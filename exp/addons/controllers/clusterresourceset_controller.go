@@ -18,23 +18,33 @@ package controllers
 
 import (
 	"context"
-	"encoding/base64"
 	"fmt"
-	"sort"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-logr/logr"
 	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	kerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/kube-openapi/pkg/util/proto"
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
+	"sigs.k8s.io/cluster-api/controllers/metrics"
 	"sigs.k8s.io/cluster-api/controllers/remote"
+	capierrors "sigs.k8s.io/cluster-api/errors"
 	addonsv1 "sigs.k8s.io/cluster-api/exp/addons/api/v1alpha3"
+	"sigs.k8s.io/cluster-api/feature"
 	"sigs.k8s.io/cluster-api/util"
 	"sigs.k8s.io/cluster-api/util/conditions"
 	"sigs.k8s.io/cluster-api/util/patch"
@@ -42,30 +52,227 @@ import (
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
 	"sigs.k8s.io/controller-runtime/pkg/source"
 )
 
 var (
-	ErrSecretTypeNotSupported = errors.New("unsupported secret type")
+	ErrSecretTypeNotSupported   = errors.New("unsupported secret type")
+	ErrSecretSourceLabelMissing = errors.Errorf("secret is not labeled with %s=true", addonsv1.ClusterResourceSetSourceLabel)
+
+	// errClusterDeleting is returned when resources are not applied to a cluster because it is being deleted.
+	errClusterDeleting = errors.New("cluster is being deleted")
+
+	// errManagementCluster is returned when resources are not applied to a cluster because it is the management cluster.
+	errManagementCluster = errors.New("cluster is the management cluster")
+
+	// errClusterFrozen is returned when resources are not applied to a cluster because it newly matches a
+	// ClusterResourceSet that freezes new clusters.
+	errClusterFrozen = errors.New("cluster is new while the ClusterResourceSet freezes new clusters")
+)
+
+// Keys of the structured values of the log lines of the ClusterResourceSet controller. They are the same in all the log
+// lines, so that the log lines of a ClusterResourceSet, cluster or resource can be queried reliably.
+const (
+	logKeyCRSName      = "crsName"
+	logKeyCRSNamespace = "crsNamespace"
+	logKeyClusterName  = "clusterName"
+	logKeyResourceKind = "resourceKind"
+	logKeyResourceName = "resourceName"
+	logKeyOutcome      = "outcome"
+)
+
+// Values of the outcome key of the log lines, telling what happened to a cluster or a resource.
+const (
+	outcomeApplied  = "applied"
+	outcomeSkipped  = "skipped"
+	outcomeRequeued = "requeued"
+	outcomeFailed   = "failed"
+)
+
+const (
+	// prerequisiteRequeueAfter is how long to wait before checking again for objects required by resources,
+	// or for pending resources to be created.
+	prerequisiteRequeueAfter = 30 * time.Second
+
+	// readyRequeueAfter is how long to wait before checking again whether the objects of a resource are ready.
+	readyRequeueAfter = 10 * time.Second
+
+	// gitPollInterval is how often the refs of the Git repositories of ClusterResourceSets are resolved again to
+	// pick up new commits.
+	gitPollInterval = 5 * time.Minute
+
+	// remoteSourceTimeout bounds the requests made to pull OCI artifacts and fetch Git repositories, so that
+	// unresponsive registries and Git servers do not block reconciles.
+	remoteSourceTimeout = time.Minute
+
+	// controllerConflictWindow is how soon after being applied objects must drift for the drift to hint at another
+	// controller managing them. After controllerConflictThreshold such consecutive drifts, applying the resource again
+	// is delayed by controllerConflictBackoff.
+	controllerConflictWindow    = 5 * time.Minute
+	controllerConflictThreshold = 3
+	controllerConflictBackoff   = 10 * time.Minute
+
+	// clusterListPageSize is the maximum number of clusters fetched by a single list call.
+	clusterListPageSize = 500
+
+	// maxResourceConditions is the maximum number of per-resource conditions reported in the ClusterResourceSet's status.
+	maxResourceConditions = 100
 )
 
-// +kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch;patch
+// +kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch;create;patch
 // +kubebuilder:rbac:groups=core,resources=configmaps,verbs=get;list;watch;patch
+// +kubebuilder:rbac:groups=core,resources=endpoints,verbs=get
 // +kubebuilder:rbac:groups=addons.cluster.x-k8s.io,resources=*,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=addons.cluster.x-k8s.io,resources=clusterresourcesets/status,verbs=get;update;patch
 
+// clusterUnreachableError is returned when the client for a workload cluster cannot be created, which tells
+// connectivity issues apart from failures to apply resources.
+type clusterUnreachableError struct {
+	err error
+}
+
+func (e *clusterUnreachableError) Error() string {
+	return e.err.Error()
+}
+
 // ClusterResourceSetReconciler reconciles a ClusterResourceSet object
 type ClusterResourceSetReconciler struct {
 	Client  client.Client
 	Log     logr.Logger
 	Tracker *remote.ClusterCacheTracker
 
-	scheme *runtime.Scheme
+	// RemoteClientGetter returns the client of a workload cluster. It defaults to getting the client from the Tracker,
+	// and can be set e.g. to apply resources to fake workload clusters in tests.
+	RemoteClientGetter func(ctx context.Context, cluster client.ObjectKey) (client.Client, error)
+
+	// RemoteRESTMapperGetter returns the RESTMapper of a workload cluster. It defaults to getting the RESTMapper from
+	// the Tracker, and can be set e.g. to map the kinds of fake workload clusters in tests.
+	RemoteRESTMapperGetter func(ctx context.Context, cluster client.ObjectKey) (meta.RESTMapper, error)
+
+	// SharedNamespace is a namespace that resources are looked up in when they do not exist in the cluster's namespace.
+	// This allows fleet-wide default resources to be overridden by resources with the same name in the cluster's namespace.
+	SharedNamespace string
+
+	// RequireSecretSourceLabel restricts the Secrets that can be used as resources to the ones labeled with
+	// addons.cluster.x-k8s.io/source: "true". This prevents arbitrary Secrets from being copied to workload clusters
+	// in management clusters shared by multiple tenants.
+	RequireSecretSourceLabel bool
+
+	// MinApplyInterval is the minimum interval between applying resources to the same cluster, shared by all
+	// ClusterResourceSets targeting it. Applies attempted before the interval has elapsed are requeued.
+	// The last apply times are only kept in memory, so this is an advisory throttle rather than a hard guarantee:
+	// it is reset on restarts and not shared between multiple controller instances.
+	MinApplyInterval time.Duration
+
+	// AcceptedSecretTypes are the types of the Secrets that can be used as resources, which allows using Secrets
+	// generated by external tools. Defaults to addons.cluster.x-k8s.io/resource-set.
+	AcceptedSecretTypes []string
+
+	// ApplyConflictRetries is how many times updating an object of a resource is retried when it fails because
+	// fields are owned by another field manager. It only applies to resources updated with the "ApplyOnChange" and
+	// "Reconcile" strategies.
+	ApplyConflictRetries int
+
+	// ForceOwnershipOnConflict takes the ownership of the conflicting fields once ApplyConflictRetries are exhausted,
+	// overwriting the changes of the other field managers. It applies to resources without a conflict policy.
+	ForceOwnershipOnConflict bool
+
+	// RetryableStatusCodes are the HTTP status codes of workload API server responses for which applying an object is
+	// retried a few times with a backoff before giving up, e.g. 504 returned by a load balancer in front of the API
+	// server. Objects still failing with these codes are reported as transient failures. Other 4xx responses are not
+	// retried. Defaults to 429, 500 and 503 when nil.
+	RetryableStatusCodes []int
+
+	// ResourceTransformer is an optional function invoked for each object of a resource before it is applied to a
+	// cluster, e.g. to rewrite image registries for air-gapped clusters. Objects are applied unchanged when it is nil.
+	ResourceTransformer func(*unstructured.Unstructured, *clusterv1.Cluster) error
+
+	// MaxBindingsPerCluster is the number of ClusterResourceSet entries in a cluster's ClusterResourceSetBinding above
+	// which a warning is reported, as it likely signals runaway ClusterResourceSet creation. Disabled when 0.
+	MaxBindingsPerCluster int
+
+	// ManagementClusterEndpoints are additional API server endpoints of the management cluster, e.g. the address of a
+	// load balancer in front of it. Clusters whose kubeconfig or control plane endpoint points at the management
+	// cluster are skipped, unless their ClusterResourceSet allows it. The endpoint the controller connects to and the
+	// endpoints advertised by the API server of the management cluster are always included.
+	ManagementClusterEndpoints []string
+
+	// ReconcileTimeout bounds how long a reconcile spends applying resources, so that hung workload clusters do not tie
+	// up a worker indefinitely. The clusters not applied in time are retried at the next reconcile. Disabled when 0.
+	ReconcileTimeout time.Duration
+
+	// NoMatchingClustersThreshold is how long a ClusterResourceSet can match no cluster before it is reported with a
+	// Warning, as it is likely misconfigured. It is reported with an Info severity before. Never escalated when 0.
+	NoMatchingClustersThreshold time.Duration
+
+	// ExistenceCheckInterval is how often the objects of the resources recorded as applied to a cluster are checked for
+	// existence, so that objects deleted from the cluster, e.g. by accident, are applied again, including with the
+	// ApplyOnce strategy. Each check gets the objects from the cluster, hence the interval bounds the cost of the checks.
+	// Disabled when 0.
+	ExistenceCheckInterval time.Duration
+
+	// MaxWorkloadEvents is the maximum number of Events read from each workload cluster for the ClusterResourceSets
+	// reporting workload events, which bounds the load on the workload API servers. Defaults to 50 when 0.
+	MaxWorkloadEvents int
+
+	// MaxClusterObjects is the maximum number of objects applied by all ClusterResourceSets to each cluster, as recorded
+	// in its ClusterResourceSetBinding. ClusterResourceSets can set a lower limit. Unlimited when 0.
+	MaxClusterObjects int
+
+	// ApplyWorkers is the number of resources of a ClusterResourceSet applied concurrently to a cluster. Resources
+	// requiring an existing object are applied after the resources before them, and before the resources after them.
+	// Resources are applied one at a time, in order, when it is at most 1.
+	ApplyWorkers int
+
+	// OpenAPIModelsGetter returns the OpenAPI models of a workload cluster, used to validate the objects of
+	// ClusterResourceSets with ValidateSchema. It defaults to getting them from the discovery API of the cluster.
+	OpenAPIModelsGetter func(ctx context.Context, cluster client.ObjectKey) (proto.Models, error)
+
+	scheme     *runtime.Scheme
+	recorder   record.EventRecorder
+	restMapper meta.RESTMapper
+
+	lastAppliedLock sync.Mutex
+	lastApplied     map[types.NamespacedName]time.Time
+
+	appliedBytesLock     sync.Mutex
+	appliedBytesClusters map[types.NamespacedName][]string
+
+	objectReservationsLock sync.Mutex
+	objectReservations     map[objectReservationKey]map[string]int
+
+	ociOnce sync.Once
+	oci     *ociClient
+
+	gitOnce sync.Once
+	git     *gitClient
+
+	schemasLock sync.Mutex
+	schemas     map[types.NamespacedName]clusterSchemas
+
+	lastExistenceCheckLock sync.Mutex
+	lastExistenceCheck     map[existenceCheckKey]time.Time
+
+	// apiReader reads objects of the management cluster without caching them, i.e. the objects advertising its
+	// endpoints, and the objects applied to it.
+	apiReader client.Reader
+
+	advertisedEndpointsLock sync.Mutex
+	advertisedEndpoints     []string
+
+	managementChecksLock sync.Mutex
+	managementChecks     map[types.NamespacedName]managementClusterCheck
 }
 
 func (r *ClusterResourceSetReconciler) SetupWithManager(mgr ctrl.Manager, options controller.Options) error {
-	_, err := ctrl.NewControllerManagedBy(mgr).
+	if r.Tracker != nil {
+		options.MaxConcurrentReconciles = limitConcurrency(r.Log, options.MaxConcurrentReconciles, r.Tracker.Capacity())
+	}
+
+	c, err := ctrl.NewControllerManagedBy(mgr).
 		For(&addonsv1.ClusterResourceSet{}).
 		Watches(
 			&source.Kind{Type: &clusterv1.Cluster{}},
@@ -78,17 +285,68 @@ func (r *ClusterResourceSetReconciler) SetupWithManager(mgr ctrl.Manager, option
 		return errors.Wrap(err, "failed setting up with a controller manager")
 	}
 
+	// Secrets used as resources are watched so that ClusterResourceSets are reconciled as soon as a Secret is created,
+	// e.g. recreated with a supported type.
+	err = c.Watch(
+		&source.Kind{Type: &corev1.Secret{}},
+		&handler.EnqueueRequestsFromMapFunc{ToRequests: handler.ToRequestsFunc(r.secretToClusterResourceSet)},
+		secretCreated,
+	)
+	if err != nil {
+		return errors.Wrap(err, "failed adding Watch for Secrets to controller manager")
+	}
+
+	// ClusterResourceSets waiting for ClusterResourceSets with a higher priority are reconciled as soon as one of them
+	// applied all its resources or is deleted, rather than when they requeue.
+	err = c.Watch(
+		&source.Kind{Type: &addonsv1.ClusterResourceSet{}},
+		&handler.EnqueueRequestsFromMapFunc{ToRequests: handler.ToRequestsFunc(r.clusterResourceSetToLowerPriority)},
+		predicate.Funcs{
+			CreateFunc:  func(event.CreateEvent) bool { return false },
+			UpdateFunc:  resourcesAppliedBecameTrue,
+			GenericFunc: func(event.GenericEvent) bool { return false },
+		},
+	)
+	if err != nil {
+		return errors.Wrap(err, "failed adding Watch for ClusterResourceSet priorities to controller manager")
+	}
+
 	r.scheme = mgr.GetScheme()
+	r.recorder = mgr.GetEventRecorderFor("clusterresourceset-controller")
+	r.restMapper = mgr.GetRESTMapper()
+	r.apiReader = mgr.GetAPIReader()
+	r.ManagementClusterEndpoints = append(r.ManagementClusterEndpoints, mgr.GetConfig().Host)
 	return nil
 }
 
+// limitConcurrency returns the number of concurrent reconciles, limited to the capacity of the Tracker. Each reconcile
+// gets the clients of the clusters it applies resources to, so more concurrent reconciles than the Tracker keeps
+// clients for would evict each other's clients, which are then recreated over and over, slowing all reconciles down.
+func limitConcurrency(log logr.Logger, concurrency, capacity int) int {
+	if capacity == 0 || concurrency <= capacity {
+		return concurrency
+	}
+	log.Info(fmt.Sprintf("Concurrent reconciles exceed the capacity of the cluster cache, limiting them to %d. "+
+		"Set --clusterresourceset-concurrency to at most --cluster-cache-capacity, and keep the capacity above the number "+
+		"of clusters matched by ClusterResourceSets to avoid recreating clients", capacity),
+		"concurrency", concurrency, "capacity", capacity)
+	return capacity
+}
+
 func (r *ClusterResourceSetReconciler) Reconcile(req ctrl.Request) (_ ctrl.Result, reterr error) {
 	ctx := context.Background()
 
+	start := time.Now()
+	defer func() {
+		metrics.ClusterResourceSetReconcileDuration.WithLabelValues(req.Namespace).Observe(time.Since(start).Seconds())
+	}()
+
 	// Fetch the ClusterResourceSet instance.
 	clusterResourceSet := &addonsv1.ClusterResourceSet{}
 	if err := r.Client.Get(ctx, req.NamespacedName, clusterResourceSet); err != nil {
 		if apierrors.IsNotFound(err) {
+			metrics.ClusterResourceSetPendingClusters.DeleteLabelValues(req.Name, req.Namespace)
+			r.setAppliedBytesMetric(req.NamespacedName, nil)
 			// Object not found, return.  Created objects are automatically garbage collected.
 			// For additional cleanup logic use finalizers.
 			return ctrl.Result{}, nil
@@ -104,220 +362,2046 @@ func (r *ClusterResourceSetReconciler) Reconcile(req ctrl.Request) (_ ctrl.Resul
 	}
 
 	defer func() {
+		setKStatusConditions(clusterResourceSet)
+
 		// Always attempt to Patch the ClusterResourceSet object and status after each reconciliation.
 		if err := patchHelper.Patch(ctx, clusterResourceSet, patch.WithStatusObservedGeneration{}); err != nil {
 			reterr = kerrors.NewAggregate([]error{reterr, err})
 		}
 	}()
 
-	logger := r.Log.WithValues("clusterresourceset", clusterResourceSet.Name, "namespace", clusterResourceSet.Namespace)
+	logger := r.Log.WithValues(logKeyCRSName, clusterResourceSet.Name, logKeyCRSNamespace, clusterResourceSet.Namespace)
+
+	// Handle requests to remove the applied objects from a single cluster before applying resources.
+	if clusterName, ok := clusterResourceSet.Annotations[addonsv1.ClusterResourceSetRemoveFromAnnotation]; ok {
+		if err := r.removeFromCluster(ctx, clusterResourceSet, clusterName); err != nil {
+			logger.Error(err, "Failed removing resources from cluster", logKeyClusterName, clusterName, logKeyOutcome, outcomeFailed)
+			return ctrl.Result{}, err
+		}
+		r.recorder.Eventf(clusterResourceSet, corev1.EventTypeNormal, "ResourcesRemoved", "Removed resources from cluster %s", clusterName)
+		delete(clusterResourceSet.Annotations, addonsv1.ClusterResourceSetRemoveFromAnnotation)
+		return ctrl.Result{}, nil
+	}
+
+	// Handle requests to dump the manifests applied to a single cluster, which does not prevent applying resources.
+	if clusterName, ok := clusterResourceSet.Annotations[addonsv1.ClusterResourceSetDumpManifestsAnnotation]; ok {
+		if err := r.dumpManifests(ctx, clusterResourceSet, clusterName); err != nil {
+			logger.Error(err, "Failed dumping manifests of cluster", logKeyClusterName, clusterName, logKeyOutcome, outcomeFailed)
+			r.recorder.Eventf(clusterResourceSet, corev1.EventTypeWarning, "ManifestsDumpFailed", "Failed to dump manifests of cluster %s: %v", clusterName, err)
+		} else {
+			r.recorder.Eventf(clusterResourceSet, corev1.EventTypeNormal, "ManifestsDumped", "Dumped manifests of cluster %s to Secret %s", clusterName, manifestsSecretName(clusterResourceSet, clusterName))
+		}
+		delete(clusterResourceSet.Annotations, addonsv1.ClusterResourceSetDumpManifestsAnnotation)
+	}
+
+	// Handle requests to apply a single resource again, which is then applied below like any pending resource.
+	if value, ok := clusterResourceSet.Annotations[addonsv1.ClusterResourceSetForceReapplyResourceAnnotation]; ok {
+		count, err := r.forceReapplyResource(ctx, clusterResourceSet, value)
+		if err != nil {
+			logger.Error(err, "Failed marking resource to be applied again", "resource", value, logKeyOutcome, outcomeFailed)
+			r.recorder.Eventf(clusterResourceSet, corev1.EventTypeWarning, "ForceReapplyFailed", "Failed to apply %s again: %v", value, err)
+			if !isInvalidResourceKeyError(err) {
+				return ctrl.Result{}, err
+			}
+		} else {
+			r.recorder.Eventf(clusterResourceSet, corev1.EventTypeNormal, "ForceReapply", "Applying %s again to %d clusters", value, count)
+		}
+		delete(clusterResourceSet.Annotations, addonsv1.ClusterResourceSetForceReapplyResourceAnnotation)
+	}
+
+	// A ClusterResourceSet without resources has nothing to apply, so there is no need to look for clusters and create bindings,
+	// unless resources removed from it are still recorded in bindings, e.g. for their objects to be pruned.
+	if len(clusterResourceSet.Spec.Resources) == 0 {
+		conditions.MarkTrue(clusterResourceSet, addonsv1.EmptyCondition)
+		recorded, err := r.hasRecordedResources(ctx, clusterResourceSet)
+		if err != nil {
+			return ctrl.Result{}, err
+		}
+		if !recorded {
+			logger.V(4).Info("ClusterResourceSet has no resources, skipping")
+			return ctrl.Result{}, nil
+		}
+	} else {
+		conditions.Delete(clusterResourceSet, addonsv1.EmptyCondition)
+	}
+
+	// The fallback to the ApplyOnce strategy is only reported once per generation, rather than at every reconcile.
+	if clusterResourceSet.Spec.Strategy == string(addonsv1.ClusterResourceSetStrategyReconcile) && !reconcileStrategyEnabled(clusterResourceSet) &&
+		clusterResourceSet.Status.ObservedGeneration != clusterResourceSet.Generation {
+		r.recorder.Eventf(clusterResourceSet, corev1.EventTypeWarning, "ReconcileStrategyDisabled",
+			"The %s feature gate is disabled, resources are applied using the %s strategy", feature.ClusterResourceSetReconcileStrategy, addonsv1.ClusterResourceSetStrategyApplyOnce)
+	}
+
+	clusters, err := r.getClustersByClusterResourceSetSelector(ctx, clusterResourceSet)
+	if err != nil {
+		// A malformed selector is not fixed by retrying, so it is only reported until the ClusterResourceSet is changed.
+		if isInvalidSelectorError(err) {
+			logger.Error(err, "Invalid ClusterResourceSet selector", logKeyOutcome, outcomeFailed)
+			conditions.MarkFalse(clusterResourceSet, addonsv1.ResourcesAppliedCondition, addonsv1.InvalidSelectorReason, clusterv1.ConditionSeverityError, err.Error())
+			return ctrl.Result{}, nil
+		}
+		logger.Error(err, "Failed fetching clusters that matches ClusterResourceSet labels", logKeyOutcome, outcomeFailed)
+		conditions.MarkFalse(clusterResourceSet, addonsv1.ResourcesAppliedCondition, addonsv1.ClusterListFailedReason, clusterv1.ConditionSeverityWarning, err.Error())
+		return ctrl.Result{}, err
+	}
+
+	// The rollout events are only emitted when the outcome differs from the one of the previous reconcile.
+	previousApplied := conditions.Get(clusterResourceSet, addonsv1.ResourcesAppliedCondition).DeepCopy()
+
+	// The audit results and the per-resource conditions are recomputed at each reconcile.
+	clusterResourceSet.Status.WouldReapply = nil
+	clusterResourceSet.Status.ResourceConditions = nil
+
+	// Resources are applied under the reconcile deadline, while the ClusterResourceSet and its bindings are patched
+	// without it, so that the progress made until the deadline is kept.
+	applyCtx := ctx
+	if r.ReconcileTimeout > 0 {
+		var cancel context.CancelFunc
+		applyCtx, cancel = context.WithTimeout(ctx, r.ReconcileTimeout)
+		defer cancel()
+	}
+
+	res := ctrl.Result{}
+	if delay := r.checkMatchingClusters(clusterResourceSet, clusters); delay > 0 {
+		res.RequeueAfter = delay
+	}
+	appliedClusters, pendingClusters := 0, 0
+	failedClusters := []string{}
+	unreachableClusters := []string{}
+	timedOutClusters := []string{}
+	managementClusters := []string{}
+	transientErrs := []error{}
+	for _, cluster := range clusters {
+		if applyCtx.Err() != nil {
+			timedOutClusters = append(timedOutClusters, cluster.Name)
+			pendingClusters++
+			continue
+		}
+		if err := r.ApplyClusterResourceSet(applyCtx, cluster, clusterResourceSet); err != nil {
+			// Clusters that started being deleted after they were selected are neither applied nor failed.
+			if errors.Cause(err) == errClusterDeleting {
+				continue
+			}
+			// Clusters skipped because of the freeze are applied once it is lifted.
+			if errors.Cause(err) == errClusterFrozen {
+				pendingClusters++
+				continue
+			}
+			// Blocking the management cluster is a steady state, not a failure to retry.
+			if errors.Cause(err) == errManagementCluster {
+				managementClusters = append(managementClusters, cluster.Name)
+				continue
+			}
+			// Clusters interrupted by the reconcile deadline are retried at the next reconcile.
+			if applyCtx.Err() != nil {
+				logger.Info("Reconcile timed out while applying resources to cluster", logKeyClusterName, cluster.Name, logKeyOutcome, outcomeRequeued)
+				timedOutClusters = append(timedOutClusters, cluster.Name)
+				pendingClusters++
+				continue
+			}
+			if _, ok := errors.Cause(err).(*clusterUnreachableError); ok {
+				unreachableClusters = append(unreachableClusters, cluster.Name)
+			}
+			if requeueErr, ok := errors.Cause(err).(capierrors.HasRequeueAfterError); ok {
+				// Only record the first RequeueAfterError.
+				if !res.Requeue {
+					res.Requeue = true
+					res.RequeueAfter = requeueErr.GetRequeueAfter()
+				}
+				logger.Info("Applying resources to cluster asked to requeue", logKeyClusterName, cluster.Name, logKeyOutcome, outcomeRequeued, "reason", err.Error())
+				pendingClusters++
+				continue
+			}
+			// The reason of not requeuing in case of errors if applying resources are failed is to avoid retries in case resources are missing.
+			// In the next reconcile, failed resources will be retried.
+			// Transient failures are the exception, they are retried with a backoff.
+			logger.Error(err, "Failed applying resources to cluster", logKeyClusterName, cluster.Name, logKeyOutcome, outcomeFailed)
+			failedClusters = append(failedClusters, cluster.Name)
+			if isTransientError(err) {
+				transientErrs = append(transientErrs, errors.Wrapf(err, "cluster %s", cluster.Name))
+			}
+			continue
+		}
+		appliedClusters++
+	}
+	// The clusters applied after the management cluster must not hide that it is skipped.
+	if len(managementClusters) > 0 && conditions.IsTrue(clusterResourceSet, addonsv1.ResourcesAppliedCondition) {
+		conditions.MarkFalse(clusterResourceSet, addonsv1.ResourcesAppliedCondition, addonsv1.ManagementClusterReason, clusterv1.ConditionSeverityWarning,
+			"Clusters %s are the management cluster, set allowManagementCluster to apply resources to them", strings.Join(managementClusters, ", "))
+	}
+	if len(timedOutClusters) > 0 {
+		conditions.MarkFalse(clusterResourceSet, addonsv1.ResourcesAppliedCondition, addonsv1.ReconcileTimeoutReason, clusterv1.ConditionSeverityWarning,
+			"Reconcile timed out after %s, resources are not applied to clusters: %s", r.ReconcileTimeout, strings.Join(timedOutClusters, ", "))
+		res = ctrl.Result{Requeue: true}
+	}
+
+	if !clusterResourceSet.Spec.AuditOnly {
+		// Reachability is only known when the controller connected to the clusters.
+		if len(unreachableClusters) > 0 {
+			conditions.MarkFalse(clusterResourceSet, addonsv1.ClusterReachableCondition, addonsv1.RemoteClusterClientFailedReason, clusterv1.ConditionSeverityWarning,
+				"Failed to connect to clusters: %s", strings.Join(unreachableClusters, ", "))
+		} else {
+			conditions.MarkTrue(clusterResourceSet, addonsv1.ClusterReachableCondition)
+		}
+		r.recordRolloutEvent(clusterResourceSet, previousApplied, appliedClusters, pendingClusters, failedClusters)
+	}
+
+	if err := r.checkBindingsLimit(ctx, clusterResourceSet, clusters); err != nil {
+		return ctrl.Result{}, err
+	}
+	if !clusterResourceSet.Spec.AuditOnly {
+		r.checkWorkloadEvents(ctx, clusterResourceSet, clusters)
+	}
+
+	pending, err := r.clustersPendingApply(ctx, clusterResourceSet, clusters)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	if err := r.updateAppliedBytes(ctx, clusterResourceSet, clusters); err != nil {
+		return ctrl.Result{}, err
+	}
+	metrics.ClusterResourceSetPendingClusters.WithLabelValues(clusterResourceSet.Name, clusterResourceSet.Namespace).Set(float64(len(pending)))
+	if len(pending) > 0 {
+		conditions.MarkFalse(clusterResourceSet, addonsv1.AllClustersAppliedCondition, addonsv1.ClustersPendingReason, clusterv1.ConditionSeverityInfo,
+			"Resources are not applied to %d of %d clusters: %s", len(pending), len(clusters), strings.Join(pending, ", "))
+	} else {
+		conditions.MarkTrue(clusterResourceSet, addonsv1.AllClustersAppliedCondition)
+	}
+
+	if len(transientErrs) > 0 {
+		return ctrl.Result{}, kerrors.NewAggregate(transientErrs)
+	}
+	// Without watches on the workload clusters, deleted objects are only noticed by checking them periodically.
+	if r.ExistenceCheckInterval > 0 && len(clusters) > 0 && !res.Requeue && (res.RequeueAfter == 0 || res.RequeueAfter > r.ExistenceCheckInterval) {
+		res.RequeueAfter = r.ExistenceCheckInterval
+	}
+	// Git repositories are not watched either, hence new commits are only noticed by resolving their refs periodically.
+	if hasGitResources(clusterResourceSet) && len(clusters) > 0 && !res.Requeue && (res.RequeueAfter == 0 || res.RequeueAfter > gitPollInterval) {
+		res.RequeueAfter = gitPollInterval
+	}
+	// Events are not watched either, hence they are read again periodically.
+	if clusterResourceSet.Spec.ReportWorkloadEvents && len(clusters) > 0 && !res.Requeue && (res.RequeueAfter == 0 || res.RequeueAfter > workloadEventsPollInterval) {
+		res.RequeueAfter = workloadEventsPollInterval
+	}
+	return res, nil
+}
+
+// updateAppliedBytes records the size of the manifests applied to each of the clusters in the applied bytes metric,
+// and their total in the status of the ClusterResourceSet.
+func (r *ClusterResourceSetReconciler) updateAppliedBytes(ctx context.Context, clusterResourceSet *addonsv1.ClusterResourceSet, clusters []*clusterv1.Cluster) error {
+	var total int64
+	appliedBytes := map[string]int64{}
+	for _, cluster := range clusters {
+		clusterResourceSetBinding := &addonsv1.ClusterResourceSetBinding{}
+		if err := r.Client.Get(ctx, client.ObjectKey{Namespace: cluster.Namespace, Name: cluster.Name}, clusterResourceSetBinding); err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			return errors.Wrapf(err, "failed to get ClusterResourceSetBinding for cluster %s", cluster.Name)
+		}
+		resourceSetBinding := findResourceSetBinding(clusterResourceSetBinding, clusterResourceSet.Name)
+		if resourceSetBinding == nil {
+			continue
+		}
+		var clusterBytes int64
+		for _, resource := range resourceSetBinding.Resources {
+			if resource.Applied {
+				clusterBytes += resource.AppliedBytes
+			}
+		}
+		appliedBytes[cluster.Name] = clusterBytes
+		total += clusterBytes
+	}
+	clusterResourceSet.Status.AppliedBytes = total
+	r.setAppliedBytesMetric(types.NamespacedName{Namespace: clusterResourceSet.Namespace, Name: clusterResourceSet.Name}, appliedBytes)
+	return nil
+}
+
+// setAppliedBytesMetric sets the applied bytes metric of the ClusterResourceSet for each cluster, and deletes it for
+// the clusters it was previously set for, e.g. because they no longer match.
+func (r *ClusterResourceSetReconciler) setAppliedBytesMetric(key types.NamespacedName, appliedBytes map[string]int64) {
+	r.appliedBytesLock.Lock()
+	defer r.appliedBytesLock.Unlock()
+
+	for _, clusterName := range r.appliedBytesClusters[key] {
+		if _, ok := appliedBytes[clusterName]; !ok {
+			metrics.ClusterResourceSetAppliedBytes.DeleteLabelValues(key.Name, key.Namespace, clusterName)
+		}
+	}
+	if len(appliedBytes) == 0 {
+		delete(r.appliedBytesClusters, key)
+		return
+	}
+
+	clusterNames := make([]string, 0, len(appliedBytes))
+	for clusterName, bytes := range appliedBytes {
+		metrics.ClusterResourceSetAppliedBytes.WithLabelValues(key.Name, key.Namespace, clusterName).Set(float64(bytes))
+		clusterNames = append(clusterNames, clusterName)
+	}
+	if r.appliedBytesClusters == nil {
+		r.appliedBytesClusters = map[types.NamespacedName][]string{}
+	}
+	r.appliedBytesClusters[key] = clusterNames
+}
+
+// hasBindingEntry returns true if the ClusterResourceSetBinding of the cluster has an entry for the ClusterResourceSet,
+// i.e. the ClusterResourceSet started being applied to the cluster.
+func (r *ClusterResourceSetReconciler) hasBindingEntry(ctx context.Context, cluster *clusterv1.Cluster, clusterResourceSet *addonsv1.ClusterResourceSet) (bool, error) {
+	clusterResourceSetBinding := &addonsv1.ClusterResourceSetBinding{}
+	if err := r.Client.Get(ctx, client.ObjectKey{Namespace: cluster.Namespace, Name: cluster.Name}, clusterResourceSetBinding); err != nil {
+		if apierrors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, errors.Wrapf(err, "failed to get ClusterResourceSetBinding for cluster %s", cluster.Name)
+	}
+	return findResourceSetBinding(clusterResourceSetBinding, clusterResourceSet.Name) != nil, nil
+}
+
+// clustersPendingApply returns the names of the clusters whose ClusterResourceSetBinding does not record all the
+// resources of the ClusterResourceSet as applied.
+func (r *ClusterResourceSetReconciler) clustersPendingApply(ctx context.Context, clusterResourceSet *addonsv1.ClusterResourceSet, clusters []*clusterv1.Cluster) ([]string, error) {
+	pending := []string{}
+	for _, cluster := range clusters {
+		clusterResourceSetBinding := &addonsv1.ClusterResourceSetBinding{}
+		if err := r.Client.Get(ctx, client.ObjectKey{Namespace: cluster.Namespace, Name: cluster.Name}, clusterResourceSetBinding); err != nil {
+			if apierrors.IsNotFound(err) {
+				pending = append(pending, cluster.Name)
+				continue
+			}
+			return nil, errors.Wrapf(err, "failed to get ClusterResourceSetBinding for cluster %s", cluster.Name)
+		}
+
+		if resourceSetBinding := findResourceSetBinding(clusterResourceSetBinding, clusterResourceSet.Name); resourceSetBinding == nil || hasPendingResources(clusterResourceSet, resourceSetBinding) {
+			pending = append(pending, cluster.Name)
+		}
+	}
+	return pending, nil
+}
+
+// checkMatchingClusters reports, with a condition, a ClusterResourceSet that does not match any cluster. The severity of
+// the condition is escalated to Warning, with an event, once no cluster matched for NoMatchingClustersThreshold.
+// It returns when the severity is due to be escalated.
+func (r *ClusterResourceSetReconciler) checkMatchingClusters(clusterResourceSet *addonsv1.ClusterResourceSet, clusters []*clusterv1.Cluster) time.Duration {
+	if len(clusters) > 0 {
+		conditions.MarkTrue(clusterResourceSet, addonsv1.ClustersMatchedCondition)
+		return 0
+	}
+
+	// The condition is only set when it changes, so that its last transition time tells since when no cluster matched.
+	condition := conditions.Get(clusterResourceSet, addonsv1.ClustersMatchedCondition)
+	if condition == nil || condition.Status != corev1.ConditionFalse {
+		conditions.MarkFalse(clusterResourceSet, addonsv1.ClustersMatchedCondition, addonsv1.NoMatchingClustersReason, clusterv1.ConditionSeverityInfo,
+			"ClusterResourceSet does not match any cluster")
+		return r.NoMatchingClustersThreshold
+	}
+	if condition.Severity == clusterv1.ConditionSeverityWarning || r.NoMatchingClustersThreshold <= 0 {
+		return 0
+	}
+
+	if remaining := r.NoMatchingClustersThreshold - time.Since(condition.LastTransitionTime.Time); remaining > 0 {
+		return remaining
+	}
+	conditions.MarkFalse(clusterResourceSet, addonsv1.ClustersMatchedCondition, addonsv1.NoMatchingClustersReason, clusterv1.ConditionSeverityWarning,
+		"ClusterResourceSet did not match any cluster for more than %s", r.NoMatchingClustersThreshold)
+	r.recorder.Eventf(clusterResourceSet, corev1.EventTypeWarning, addonsv1.NoMatchingClustersReason,
+		"ClusterResourceSet did not match any cluster for more than %s, check its cluster selector", r.NoMatchingClustersThreshold)
+	return 0
+}
+
+// checkBindingsLimit warns, with a condition and an event, about the clusters whose ClusterResourceSetBinding has more
+// entries than MaxBindingsPerCluster.
+func (r *ClusterResourceSetReconciler) checkBindingsLimit(ctx context.Context, clusterResourceSet *addonsv1.ClusterResourceSet, clusters []*clusterv1.Cluster) error {
+	if r.MaxBindingsPerCluster <= 0 {
+		conditions.Delete(clusterResourceSet, addonsv1.BindingsWithinLimitCondition)
+		return nil
+	}
+
+	exceeding := []string{}
+	for _, cluster := range clusters {
+		clusterResourceSetBinding := &addonsv1.ClusterResourceSetBinding{}
+		if err := r.Client.Get(ctx, client.ObjectKey{Namespace: cluster.Namespace, Name: cluster.Name}, clusterResourceSetBinding); err != nil {
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			return errors.Wrapf(err, "failed to get ClusterResourceSetBinding for cluster %s", cluster.Name)
+		}
+		if len(clusterResourceSetBinding.Spec.Bindings) > r.MaxBindingsPerCluster {
+			exceeding = append(exceeding, fmt.Sprintf("%s (%d)", cluster.Name, len(clusterResourceSetBinding.Spec.Bindings)))
+		}
+	}
+
+	if len(exceeding) == 0 {
+		conditions.MarkTrue(clusterResourceSet, addonsv1.BindingsWithinLimitCondition)
+		return nil
+	}
+	conditions.MarkFalse(clusterResourceSet, addonsv1.BindingsWithinLimitCondition, addonsv1.TooManyBindingsReason, clusterv1.ConditionSeverityWarning,
+		"ClusterResourceSetBindings have more than %d entries: %s", r.MaxBindingsPerCluster, strings.Join(exceeding, ", "))
+	r.recorder.Eventf(clusterResourceSet, corev1.EventTypeWarning, "TooManyBindings",
+		"ClusterResourceSetBindings have more than %d entries, check for misconfigured ClusterResourceSets: %s", r.MaxBindingsPerCluster, strings.Join(exceeding, ", "))
+	return nil
+}
+
+// recordRolloutEvent emits a single event summarizing the outcome of applying a ClusterResourceSet to all matching clusters.
+// The event is only emitted when the ResourcesApplied condition of the previous reconcile does not already report the
+// outcome, i.e. when the rollout becomes degraded or complete, so that steady states do not emit an event per reconcile.
+func (r *ClusterResourceSetReconciler) recordRolloutEvent(clusterResourceSet *addonsv1.ClusterResourceSet, previousApplied *clusterv1.Condition, appliedClusters, pendingClusters int, failedClusters []string) {
+	total := appliedClusters + pendingClusters + len(failedClusters)
+	switch {
+	case len(failedClusters) > 0:
+		if previousApplied != nil && previousApplied.Status == corev1.ConditionFalse {
+			return
+		}
+		r.recorder.Eventf(clusterResourceSet, corev1.EventTypeWarning, "RolloutDegraded", "Failed to apply resources to %d of %d clusters: %s",
+			len(failedClusters), total, strings.Join(failedClusters, ", "))
+	case total > 0 && pendingClusters == 0:
+		if previousApplied != nil && previousApplied.Status == corev1.ConditionTrue {
+			return
+		}
+		r.recorder.Eventf(clusterResourceSet, corev1.EventTypeNormal, "RolloutComplete", "Applied %d resources to %d clusters",
+			appliedResources(clusterResourceSet), appliedClusters)
+	}
+}
+
+// appliedResources returns the number of resources reported as applied to all the matching clusters.
+func appliedResources(clusterResourceSet *addonsv1.ClusterResourceSet) int {
+	count := 0
+	for _, condition := range clusterResourceSet.Status.ResourceConditions {
+		if condition.Status == corev1.ConditionTrue {
+			count++
+		}
+	}
+	return count
+}
+
+// getClustersByClusterResourceSetSelector fetches Clusters matched by the ClusterResourceSet's label selector that are in the same namespace as the ClusterResourceSet object.
+func (r *ClusterResourceSetReconciler) getClustersByClusterResourceSetSelector(ctx context.Context, clusterResourceSet *addonsv1.ClusterResourceSet) ([]*clusterv1.Cluster, error) {
+	logger := r.Log.WithValues(logKeyCRSName, clusterResourceSet.Name, logKeyCRSNamespace, clusterResourceSet.Namespace)
+	return selectClusters(ctx, r.Client, logger, clusterResourceSet)
+}
+
+// selectClusters returns the Clusters selected by the ClusterResourceSet.
+func selectClusters(ctx context.Context, reader client.Reader, logger logr.Logger, clusterResourceSet *addonsv1.ClusterResourceSet) ([]*clusterv1.Cluster, error) {
+	// A ClusterResourceSet targeting a single cluster by name bypasses the selectors.
+	if clusterResourceSet.Spec.ClusterName != "" {
+		cluster := &clusterv1.Cluster{}
+		key := client.ObjectKey{Namespace: clusterResourceSet.Namespace, Name: clusterResourceSet.Spec.ClusterName}
+		if err := reader.Get(ctx, key, cluster); err != nil {
+			if apierrors.IsNotFound(err) {
+				logger.V(4).Info("Cluster targeted by ClusterResourceSet not found", logKeyClusterName, key.Name)
+				return nil, nil
+			}
+			return nil, errors.Wrapf(err, "failed to get cluster %s", key.Name)
+		}
+		if reason := clusterNotSelectedReason(clusterResourceSet, cluster); reason != "" {
+			logger.V(4).Info("Cluster is not selected by ClusterResourceSet", logKeyClusterName, cluster.Name, "reason", reason)
+			return nil, nil
+		}
+		return []*clusterv1.Cluster{cluster}, nil
+	}
+
+	selectors, err := clusterSelectors(clusterResourceSet)
+	if err != nil {
+		return nil, err
+	}
+
+	// If a ClusterResourceSet has a nil or empty selector, it should match nothing, not everything.
+	if len(selectors) == 0 {
+		logger.Info("Empty ClusterResourceSet selector: No clusters are selected.")
+		return nil, nil
+	}
+
+	// Clusters are listed for each selector, and the Clusters matching more than one selector are only returned once.
+	clusters := []*clusterv1.Cluster{}
+	seen := map[string]bool{}
+	for _, selector := range selectors {
+		// Clusters are listed in pages to bound the memory used in management clusters with many clusters.
+		continueToken := ""
+		for {
+			clusterList := &clusterv1.ClusterList{}
+			if err := reader.List(ctx, clusterList, client.InNamespace(clusterResourceSet.Namespace), client.MatchingLabelsSelector{Selector: selector},
+				client.Limit(clusterListPageSize), client.Continue(continueToken)); err != nil {
+				return nil, errors.Wrap(err, "failed to list clusters")
+			}
+
+			for i := range clusterList.Items {
+				c := &clusterList.Items[i]
+				if seen[c.Name] {
+					continue
+				}
+				seen[c.Name] = true
+				if reason := clusterNotSelectedReason(clusterResourceSet, c); reason != "" {
+					logger.V(4).Info("Cluster is not selected by ClusterResourceSet", logKeyClusterName, c.Name, "reason", reason)
+					continue
+				}
+				clusters = append(clusters, c)
+			}
+
+			if continueToken = clusterList.Continue; continueToken == "" {
+				break
+			}
+		}
+	}
+	return clusters, nil
+}
+
+// clusterSelectors returns the selectors of the ClusterResourceSet's ClusterSelector and ClusterSelectors. A Cluster is
+// selected if it matches any of them. Empty selectors match nothing, hence they are not returned.
+func clusterSelectors(clusterResourceSet *addonsv1.ClusterResourceSet) ([]labels.Selector, error) {
+	labelSelectors := append([]metav1.LabelSelector{clusterResourceSet.Spec.ClusterSelector}, clusterResourceSet.Spec.ClusterSelectors...)
+	selectors := []labels.Selector{}
+	for i := range labelSelectors {
+		selector, err := metav1.LabelSelectorAsSelector(&labelSelectors[i])
+		if err != nil {
+			return nil, &invalidSelectorError{err: errors.Wrap(err, "unable to convert selector")}
+		}
+		if !selector.Empty() {
+			selectors = append(selectors, selector)
+		}
+	}
+	return selectors, nil
+}
+
+// clusterNotSelectedReason returns a human readable reason why the Cluster is not selected by the ClusterResourceSet,
+// or an empty string if it is selected. It is used to answer why resources are not applied to a given cluster.
+func clusterNotSelectedReason(clusterResourceSet *addonsv1.ClusterResourceSet, cluster *clusterv1.Cluster) string {
+	if clusterResourceSet.Spec.ClusterName != "" {
+		if cluster.Name != clusterResourceSet.Spec.ClusterName {
+			return fmt.Sprintf("ClusterResourceSet targets cluster %q", clusterResourceSet.Spec.ClusterName)
+		}
+		if reason := clusterNotOptedInReason(clusterResourceSet, cluster); reason != "" {
+			return reason
+		}
+		if !cluster.DeletionTimestamp.IsZero() {
+			return "cluster is being deleted"
+		}
+		return clusterTooOldReason(clusterResourceSet, cluster)
+	}
+
+	selectors, err := clusterSelectors(clusterResourceSet)
+	if err != nil {
+		return fmt.Sprintf("invalid cluster selector: %v", err)
+	}
+	// If a ClusterResourceSet has a nil or empty selector, it should match nothing, not everything.
+	if len(selectors) == 0 {
+		return "cluster selector is empty"
+	}
+	matched := false
+	selectorStrings := make([]string, 0, len(selectors))
+	for _, selector := range selectors {
+		if selector.Matches(labels.Set(cluster.GetLabels())) {
+			matched = true
+			break
+		}
+		selectorStrings = append(selectorStrings, strconv.Quote(selector.String()))
+	}
+	if !matched {
+		return fmt.Sprintf("cluster labels do not match selector %s", strings.Join(selectorStrings, " or "))
+	}
+	if !matchesClusterAnnotations(clusterResourceSet, cluster) {
+		return "cluster annotations do not match the cluster annotation selector"
+	}
+	if reason := clusterNotOptedInReason(clusterResourceSet, cluster); reason != "" {
+		return reason
+	}
+	if reason := clusterRegionNotSelectedReason(clusterResourceSet, cluster); reason != "" {
+		return reason
+	}
+	if !cluster.DeletionTimestamp.IsZero() {
+		return "cluster is being deleted"
+	}
+	return clusterTooOldReason(clusterResourceSet, cluster)
+}
+
+// clusterTooOldReason returns why the Cluster is older than the ClusterResourceSet's ClusterMaxAge, or an empty string
+// if it is not.
+func clusterTooOldReason(clusterResourceSet *addonsv1.ClusterResourceSet, cluster *clusterv1.Cluster) string {
+	if clusterResourceSet.Spec.ClusterMaxAge == nil {
+		return ""
+	}
+	if age := time.Since(cluster.CreationTimestamp.Time); age > clusterResourceSet.Spec.ClusterMaxAge.Duration {
+		return fmt.Sprintf("cluster was created %s ago, more than the maximum age %s", age.Round(time.Second), clusterResourceSet.Spec.ClusterMaxAge.Duration)
+	}
+	return ""
+}
+
+// clusterConditionsNotTrue returns the ClusterReadyConditions of the ClusterResourceSet that are not true on the Cluster.
+func clusterConditionsNotTrue(clusterResourceSet *addonsv1.ClusterResourceSet, cluster *clusterv1.Cluster) []string {
+	notTrue := []string{}
+	for _, conditionType := range clusterResourceSet.Spec.ClusterReadyConditions {
+		if !conditions.IsTrue(cluster, clusterv1.ConditionType(conditionType)) {
+			notTrue = append(notTrue, conditionType)
+		}
+	}
+	return notTrue
+}
+
+// clusterNotOptedInReason returns why the Cluster did not opt in to the ClusterResourceSet's RequireOptInAnnotation,
+// or an empty string if it did or no opt-in is required.
+func clusterNotOptedInReason(clusterResourceSet *addonsv1.ClusterResourceSet, cluster *clusterv1.Cluster) string {
+	key := clusterResourceSet.Spec.RequireOptInAnnotation
+	if key == "" {
+		return ""
+	}
+	if _, ok := cluster.GetAnnotations()[key]; !ok {
+		return fmt.Sprintf("cluster does not have the opt-in annotation %s", key)
+	}
+	return ""
+}
+
+// clusterRegionNotSelectedReason returns why the Cluster is not in the regions or failure domains of the
+// ClusterResourceSet's RegionSelector, or an empty string if it is.
+func clusterRegionNotSelectedReason(clusterResourceSet *addonsv1.ClusterResourceSet, cluster *clusterv1.Cluster) string {
+	regionSelector := clusterResourceSet.Spec.RegionSelector
+	if regionSelector == nil {
+		return ""
+	}
+	if len(regionSelector.Regions) > 0 {
+		region, ok := cluster.GetLabels()[addonsv1.ClusterRegionLabel]
+		if !ok {
+			return fmt.Sprintf("cluster has no %s label", addonsv1.ClusterRegionLabel)
+		}
+		matched := false
+		for _, r := range regionSelector.Regions {
+			if r == region {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return fmt.Sprintf("cluster region %q is not one of %s", region, strings.Join(regionSelector.Regions, ", "))
+		}
+	}
+	if len(regionSelector.FailureDomains) > 0 {
+		matched := false
+		for _, failureDomain := range regionSelector.FailureDomains {
+			if _, ok := cluster.Status.FailureDomains[failureDomain]; ok {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return fmt.Sprintf("cluster has none of the failure domains %s", strings.Join(regionSelector.FailureDomains, ", "))
+		}
+	}
+	return ""
+}
+
+// matchesClusterAnnotations returns true if the Cluster has all the annotations of the ClusterResourceSet's annotation selector.
+func matchesClusterAnnotations(clusterResourceSet *addonsv1.ClusterResourceSet, cluster *clusterv1.Cluster) bool {
+	annotations := cluster.GetAnnotations()
+	for key, value := range clusterResourceSet.Spec.ClusterAnnotationSelector {
+		if v, ok := annotations[key]; !ok || v != value {
+			return false
+		}
+	}
+	return true
+}
+
+// ApplyClusterResourceSet applies resources in a ClusterResourceSet to a Cluster. Once applied, a record will be added to the
+// cluster's ClusterResourceSetBinding.
+// In ApplyOnce strategy, resources are applied only once to a particular cluster. ClusterResourceSetBinding is used to check if a resource is applied before.
+// It applies resources best effort and continue on scenarios like: unsupported resource types, failure during creation, missing resources.
+// TODO: If a resource already exists in the cluster but not applied by ClusterResourceSet, the resource will be updated ?
+func (r *ClusterResourceSetReconciler) ApplyClusterResourceSet(ctx context.Context, cluster *clusterv1.Cluster, clusterResourceSet *addonsv1.ClusterResourceSet) error {
+	logger := r.Log.WithValues(logKeyCRSName, clusterResourceSet.Name, logKeyCRSNamespace, clusterResourceSet.Namespace, logKeyClusterName, cluster.Name)
+
+	// The cluster may have started being deleted since it was selected, applying resources to it would be futile.
+	deleting, err := r.clusterDeleting(ctx, cluster)
+	if err != nil {
+		return err
+	}
+	if deleting {
+		logger.Info("Cluster is being deleted, skipping", logKeyOutcome, outcomeSkipped)
+		conditions.MarkFalse(clusterResourceSet, addonsv1.ResourcesAppliedCondition, addonsv1.ClusterDeletingReason, clusterv1.ConditionSeverityInfo,
+			"Cluster %s is being deleted", cluster.Name)
+		return errClusterDeleting
+	}
+
+	if clusterResourceSet.Spec.AuditOnly {
+		return r.auditClusterResourceSet(ctx, cluster, clusterResourceSet)
+	}
+
+	// A Cluster registered for the management cluster itself and matching a broad selector must not get the resources
+	// meant for workload clusters by accident.
+	if !clusterResourceSet.Spec.AllowManagementCluster && !clusterResourceSet.Spec.AppliesToManagementCluster() {
+		isManagementCluster, err := r.isManagementCluster(ctx, cluster)
+		if err != nil {
+			return err
+		}
+		if isManagementCluster {
+			logger.Info("Cluster is the management cluster, skipping", logKeyOutcome, outcomeSkipped)
+			conditions.MarkFalse(clusterResourceSet, addonsv1.ResourcesAppliedCondition, addonsv1.ManagementClusterReason, clusterv1.ConditionSeverityWarning,
+				"Cluster %s is the management cluster, set allowManagementCluster to apply resources to it", cluster.Name)
+			return errManagementCluster
+		}
+	}
+
+	if clusterResourceSet.Spec.FreezeNewClusters {
+		applied, err := r.hasBindingEntry(ctx, cluster, clusterResourceSet)
+		if err != nil {
+			return err
+		}
+		if !applied {
+			logger.Info("Cluster newly matches ClusterResourceSet while new clusters are frozen, skipping", logKeyOutcome, outcomeSkipped)
+			r.recorder.Eventf(clusterResourceSet, corev1.EventTypeNormal, "NewClusterFrozen",
+				"Resources are not applied to new cluster %s while new clusters are frozen", cluster.Name)
+			return errClusterFrozen
+		}
+	}
+
+	if clusterResourceSet.Spec.ApplyWindow != nil {
+		wait, err := applyWindowWait(clusterResourceSet.Spec.ApplyWindow, time.Now())
+		if err != nil {
+			return err
+		}
+		if wait > 0 {
+			nextWindow := time.Now().Add(wait).UTC().Format(time.RFC3339)
+			logger.V(4).Info("Outside of the apply window, skipping", logKeyOutcome, outcomeRequeued, "nextWindow", nextWindow)
+			conditions.MarkFalse(clusterResourceSet, addonsv1.ResourcesAppliedCondition, addonsv1.OutsideApplyWindowReason, clusterv1.ConditionSeverityInfo,
+				"Resources are applied to cluster %s in the next apply window, starting at %s", cluster.Name, nextWindow)
+			return &capierrors.RequeueAfterError{RequeueAfter: wait}
+		}
+	}
+
+	if notReady := clusterConditionsNotTrue(clusterResourceSet, cluster); len(notReady) > 0 {
+		logger.V(4).Info("Waiting for conditions of cluster to be true", logKeyOutcome, outcomeRequeued, "conditions", notReady)
+		conditions.MarkFalse(clusterResourceSet, addonsv1.ResourcesAppliedCondition, addonsv1.WaitingForClusterConditionsReason, clusterv1.ConditionSeverityInfo,
+			"Waiting for %s to be true on cluster %s", strings.Join(notReady, ", "), cluster.Name)
+		return &capierrors.RequeueAfterError{RequeueAfter: prerequisiteRequeueAfter}
+	}
+
+	// ClusterResourceSets with a higher priority, e.g. installing prerequisites, are applied first.
+	waitingFor, err := r.higherPriorityPending(ctx, cluster, clusterResourceSet)
+	if err != nil {
+		return err
+	}
+	if len(waitingFor) > 0 {
+		logger.V(4).Info("Waiting for ClusterResourceSets with a higher priority to be applied to cluster", logKeyOutcome, outcomeRequeued, "clusterresourcesets", waitingFor)
+		conditions.MarkFalse(clusterResourceSet, addonsv1.ResourcesAppliedCondition, addonsv1.WaitingForHigherPriorityReason, clusterv1.ConditionSeverityInfo,
+			"Waiting for %s to be applied to cluster %s", strings.Join(waitingFor, ", "), cluster.Name)
+		return &capierrors.RequeueAfterError{RequeueAfter: prerequisiteRequeueAfter}
+	}
+
+	logger.Info("Applying ClusterResourceSet to cluster")
+
+	remoteClient, release, err := r.targetClient(ctx, cluster, clusterResourceSet)
+	if err != nil {
+		conditions.MarkFalse(clusterResourceSet, addonsv1.ResourcesAppliedCondition, addonsv1.RemoteClusterClientFailedReason, clusterv1.ConditionSeverityError, err.Error())
+		return &clusterUnreachableError{err: err}
+	}
+	defer release()
+
+	// Get ClusterResourceSetBinding object for the cluster.
+	clusterResourceSetBinding, err := r.getOrCreateClusterResourceSetBinding(ctx, cluster, clusterResourceSet)
+	if err != nil {
+		return err
+	}
+
+	// Initialize the patch helper.
+	patchHelper, err := patch.NewHelper(clusterResourceSetBinding, r.Client)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		// Always attempt to Patch the ClusterResourceSetBinding object after each reconciliation.
+		// The patch does not use ctx, so that the progress is kept when ctx is done, e.g. because of the reconcile deadline.
+		if err := patchHelper.Patch(context.Background(), clusterResourceSetBinding); err != nil {
+			logger.Error(err, "failed to patch config")
+		}
+	}()
+
+	errList := []error{}
+	var requeueAfter time.Duration
+	resourceSetBinding := clusterResourceSetBinding.GetOrCreateBinding(clusterResourceSet)
+
+	// Resources whose objects were deleted from the cluster are applied again.
+	if r.reserveExistenceCheck(cluster, clusterResourceSet) {
+		if err := r.markMissingResources(ctx, remoteClient, cluster, clusterResourceSet, resourceSetBinding); err != nil {
+			logger.Error(err, "Failed to check if objects of resources exist in cluster")
+		}
+	}
+
+	if hasPendingResources(clusterResourceSet, resourceSetBinding) {
+		if delay := r.reserveApply(cluster); delay > 0 {
+			logger.V(4).Info("Resources were applied to cluster recently, requeuing", logKeyOutcome, outcomeRequeued, "requeueAfter", delay)
+			return &capierrors.RequeueAfterError{RequeueAfter: delay}
+		}
+	}
+
+	// applied records the result of applying a resource.
+	applied := func(resource addonsv1.ResourceRef, err error) {
+		setResourceCondition(clusterResourceSet, resource, errors.Wrapf(err, "cluster %s", cluster.Name))
+		if err != nil {
+			if requeueErr, ok := errors.Cause(err).(capierrors.HasRequeueAfterError); ok {
+				if requeueAfter == 0 || requeueErr.GetRequeueAfter() < requeueAfter {
+					requeueAfter = requeueErr.GetRequeueAfter()
+				}
+				return
+			}
+			errList = append(errList, err)
+		}
+	}
+
+	// Iterate all resources and apply them to the cluster and update the resource status in the ClusterResourceSetBinding object.
+	// Resources that failed at the previous reconcile are retried first.
+	if r.ApplyWorkers > 1 {
+		for _, stage := range applyStages(uniqueResources(clusterResourceSet.Spec.Resources)) {
+			r.applyResourcesConcurrently(ctx, remoteClient, cluster, clusterResourceSet, resourceSetBinding, failedFirst(stage, resourceSetBinding), applied)
+		}
+	} else {
+		for _, resource := range retryOrder(uniqueResources(clusterResourceSet.Spec.Resources), resourceSetBinding) {
+			// If resource is already applied successfully and clusterResourceSet mode is "ApplyOnce", continue. (No need to check hash changes here)
+			// With the "ApplyOnChange" and "Reconcile" strategies, applyResource checks whether the resource changed since it was applied.
+			if !reappliesOnChange(clusterResourceSet) && resourceSetBinding.IsApplied(resource) {
+				setResourceCondition(clusterResourceSet, resource, nil)
+				continue
+			}
+
+			applied(resource, r.applyResource(ctx, remoteClient, cluster, clusterResourceSet, resourceSetBinding, resource))
+		}
+	}
+
+	if clusterResourceSet.Spec.PruneGracePeriod != nil {
+		delay, err := r.pruneRemovedResources(ctx, remoteClient, cluster, clusterResourceSet, resourceSetBinding)
+		if err != nil {
+			errList = append(errList, err)
+		}
+		if delay > 0 && (requeueAfter == 0 || delay < requeueAfter) {
+			requeueAfter = delay
+		}
+	}
+
+	// The post-apply Job verifies the resources once they are all applied.
+	if clusterResourceSet.Spec.PostApplyJob != nil && len(errList) == 0 && requeueAfter == 0 && !hasPendingResources(clusterResourceSet, resourceSetBinding) {
+		if err := r.runPostApplyJob(ctx, remoteClient, cluster, clusterResourceSet, resourceSetBinding); err != nil {
+			if requeueErr, ok := errors.Cause(err).(capierrors.HasRequeueAfterError); ok {
+				requeueAfter = requeueErr.GetRequeueAfter()
+			} else {
+				errList = append(errList, err)
+			}
+		}
+	}
+
+	// The inventory lists the objects of all the resources applied so far, including in previous reconciles.
+	if clusterResourceSet.Spec.WriteInventory && !clusterResourceSet.Spec.AppliesToManagementCluster() {
+		if err := r.updateInventory(ctx, remoteClient, cluster, clusterResourceSet, resourceSetBinding); err != nil {
+			logger.Error(err, "Failed to write inventory to cluster")
+			errList = append(errList, err)
+		}
+	}
+
+	if len(errList) > 0 {
+		return kerrors.NewAggregate(errList)
+	}
+
+	if requeueAfter > 0 {
+		return &capierrors.RequeueAfterError{RequeueAfter: requeueAfter}
+	}
+
+	conditions.MarkTrue(clusterResourceSet, addonsv1.ResourcesAppliedCondition)
+
+	return nil
+}
+
+// updateInventory writes the objects of the resources recorded as applied in the ResourceSetBinding to the inventory
+// ConfigMap of the ClusterResourceSet in the cluster. Patched objects are not listed, as they are not created by the
+// ClusterResourceSet.
+func (r *ClusterResourceSetReconciler) updateInventory(ctx context.Context, remoteClient client.Client, cluster *clusterv1.Cluster, clusterResourceSet *addonsv1.ClusterResourceSet, resourceSetBinding *addonsv1.ResourceSetBinding) error {
+	entries := []inventoryEntry{}
+	for _, resource := range uniqueResources(clusterResourceSet.Spec.Resources) {
+		resourceBinding := resourceSetBinding.GetResourceBinding(resource)
+		if resource.Mode == string(addonsv1.PatchClusterResourceSetResourceMode) || resourceBinding == nil || !resourceBinding.Applied {
+			continue
+		}
+
+		unstructuredObj, err := r.getResource(ctx, resource, cluster.Namespace)
+		if err != nil {
+			return errors.Wrapf(err, "failed to get %s %s", resource.Kind, resource.Name)
+		}
+		dataList, err := r.targetData(ctx, unstructuredObj, cluster, clusterResourceSet, resource)
+		if err != nil {
+			return err
+		}
+		objects, err := inventoryObjects(dataList)
+		if err != nil {
+			return errors.Wrapf(err, "failed to parse objects of %s %s", resource.Kind, resource.Name)
+		}
+		entries = append(entries, inventoryEntry{
+			Resource:        resource.Kind + "/" + resource.Name,
+			Hash:            resourceBinding.Hash,
+			LastAppliedTime: resourceBinding.LastAppliedTime,
+			Objects:         objects,
+		})
+	}
+	return writeInventory(ctx, remoteClient, clusterResourceSet, entries)
+}
+
+// pruneRemovedResources deletes from the cluster the objects of the resources recorded in the ResourceSetBinding that
+// were removed from the ClusterResourceSet more than PruneGracePeriod ago. Resources found removed are marked for
+// pruning, and resources added back are unmarked. It returns when resources marked for pruning are due.
+func (r *ClusterResourceSetReconciler) pruneRemovedResources(ctx context.Context, remoteClient client.Client, cluster *clusterv1.Cluster, clusterResourceSet *addonsv1.ClusterResourceSet, resourceSetBinding *addonsv1.ResourceSetBinding) (time.Duration, error) {
+	logger := r.Log.WithValues(logKeyCRSName, clusterResourceSet.Name, logKeyCRSNamespace, clusterResourceSet.Namespace, logKeyClusterName, cluster.Name)
+	gracePeriod := clusterResourceSet.Spec.PruneGracePeriod.Duration
+
+	inSpec := map[string]bool{}
+	for _, resource := range clusterResourceSet.Spec.Resources {
+		inSpec[resource.Kind+"/"+resource.Name] = true
+	}
+
+	// With ReverseDeleteOrder, the resources applied last are pruned first.
+	resourceBindings := append([]addonsv1.ResourceBinding{}, resourceSetBinding.Resources...)
+	if clusterResourceSet.Spec.ReverseDeleteOrder {
+		for i, j := 0, len(resourceBindings)-1; i < j; i, j = i+1, j-1 {
+			resourceBindings[i], resourceBindings[j] = resourceBindings[j], resourceBindings[i]
+		}
+	}
+
+	var requeueAfter time.Duration
+	errList := []error{}
+	for _, resourceBinding := range resourceBindings {
+		resource := resourceBinding.ResourceRef
+		key := resource.Kind + "/" + resource.Name
+		if inSpec[key] {
+			if resourceBinding.PruneRequestedTime != nil {
+				logger.Info("Resource was added back to ClusterResourceSet, cancelling pruning", logKeyResourceKind, resource.Kind, logKeyResourceName, resource.Name)
+				resourceBinding.PruneRequestedTime = nil
+				resourceSetBinding.SetBinding(resourceBinding)
+			}
+			continue
+		}
+
+		if resourceBinding.PruneRequestedTime == nil {
+			now := metav1.Now()
+			resourceBinding.PruneRequestedTime = &now
+			resourceSetBinding.SetBinding(resourceBinding)
+			r.recorder.Eventf(clusterResourceSet, corev1.EventTypeNormal, "PruningPending",
+				"Resource %s was removed, its objects will be deleted from cluster %s after %s", key, cluster.Name, gracePeriod)
+		}
+		if remaining := gracePeriod - time.Since(resourceBinding.PruneRequestedTime.Time); remaining > 0 {
+			if requeueAfter == 0 || remaining < requeueAfter {
+				requeueAfter = remaining
+			}
+			continue
+		}
+
+		// Patches target objects that are not created by the ClusterResourceSet, hence they are never deleted.
+		if resource.Mode != string(addonsv1.PatchClusterResourceSetResourceMode) {
+			unstructuredObj, err := r.getResource(ctx, resource, cluster.Namespace)
+			if apierrors.IsNotFound(errors.Cause(err)) {
+				logger.Info("Resource removed from ClusterResourceSet no longer exists, leaving its objects in the cluster", logKeyResourceKind, resource.Kind, logKeyResourceName, resource.Name, logKeyOutcome, outcomeSkipped)
+				resourceSetBinding.DeleteResourceBinding(resource)
+				continue
+			}
+			if err != nil {
+				errList = append(errList, errors.Wrapf(err, "failed to get %s %s", resource.Kind, resource.Name))
+				continue
+			}
+			dataList, err := r.targetData(ctx, unstructuredObj, cluster, clusterResourceSet, resource)
+			if err != nil {
+				errList = append(errList, err)
+				continue
+			}
+			deleteErrs := []error{}
+			if clusterResourceSet.Spec.ReverseDeleteOrder {
+				if err := deleteObjectsInReverseOrder(ctx, remoteClient, dataList, clusterResourceSet.Spec.GetDeletePropagationPolicy()); err != nil {
+					deleteErrs = append(deleteErrs, err)
+				}
+			} else {
+				for _, data := range dataList {
+					if err := deleteObjects(ctx, remoteClient, data, clusterResourceSet.Spec.GetDeletePropagationPolicy()); err != nil {
+						deleteErrs = append(deleteErrs, err)
+					}
+				}
+			}
+			if len(deleteErrs) > 0 {
+				errList = append(errList, deleteErrs...)
+				continue
+			}
+			r.recorder.Eventf(clusterResourceSet, corev1.EventTypeNormal, "ResourcePruned", "Deleted the objects of removed resource %s from cluster %s", key, cluster.Name)
+		}
+		logger.Info("Pruned resource removed from ClusterResourceSet", logKeyResourceKind, resource.Kind, logKeyResourceName, resource.Name)
+		resourceSetBinding.DeleteResourceBinding(resource)
+	}
+	return requeueAfter, kerrors.NewAggregate(errList)
+}
+
+// setResourceCondition records whether the resource was applied to a cluster in the ClusterResourceSet's per-resource
+// conditions. A failure on any cluster takes precedence over successes on the other clusters.
+// New entries are dropped once maxResourceConditions is reached.
+func setResourceCondition(clusterResourceSet *addonsv1.ClusterResourceSet, resource addonsv1.ResourceRef, err error) {
+	var condition *addonsv1.ResourceCondition
+	for i := range clusterResourceSet.Status.ResourceConditions {
+		c := &clusterResourceSet.Status.ResourceConditions[i]
+		if c.Kind == resource.Kind && c.Name == resource.Name {
+			condition = c
+			break
+		}
+	}
+	if condition == nil {
+		if len(clusterResourceSet.Status.ResourceConditions) >= maxResourceConditions {
+			return
+		}
+		clusterResourceSet.Status.ResourceConditions = append(clusterResourceSet.Status.ResourceConditions,
+			addonsv1.ResourceCondition{Kind: resource.Kind, Name: resource.Name, Status: corev1.ConditionTrue})
+		condition = &clusterResourceSet.Status.ResourceConditions[len(clusterResourceSet.Status.ResourceConditions)-1]
+	}
+
+	if err == nil || condition.Status == corev1.ConditionFalse {
+		return
+	}
+
+	// applyResource reports the reason of the failure in the aggregate condition.
+	condition.Status = corev1.ConditionFalse
+	condition.Reason = addonsv1.ApplyFailedReason
+	condition.Severity = clusterv1.ConditionSeverityWarning
+	if c := conditions.Get(clusterResourceSet, addonsv1.ResourcesAppliedCondition); c != nil && c.Status == corev1.ConditionFalse {
+		condition.Reason = c.Reason
+		condition.Severity = c.Severity
+	}
+	condition.Message = err.Error()
+}
+
+// uniqueResources returns the resources without the entries that refer to the same source as a previous one.
+// Duplicates are rejected by the webhook, this guards against ClusterResourceSets created before the validation existed.
+func uniqueResources(resources []addonsv1.ResourceRef) []addonsv1.ResourceRef {
+	seen := map[string]bool{}
+	unique := make([]addonsv1.ResourceRef, 0, len(resources))
+	for _, resource := range resources {
+		key := resource.Kind + "/" + resource.Name
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		unique = append(unique, resource)
+	}
+	return unique
+}
+
+// clusterDeleting returns true if the Cluster has been deleted or is being deleted, according to its latest version.
+func (r *ClusterResourceSetReconciler) clusterDeleting(ctx context.Context, cluster *clusterv1.Cluster) (bool, error) {
+	if !cluster.DeletionTimestamp.IsZero() {
+		return true, nil
+	}
+	latest := &clusterv1.Cluster{}
+	if err := r.Client.Get(ctx, util.ObjectKey(cluster), latest); err != nil {
+		if apierrors.IsNotFound(err) {
+			return true, nil
+		}
+		return false, errors.Wrapf(err, "failed to get cluster %s", cluster.Name)
+	}
+	return !latest.DeletionTimestamp.IsZero(), nil
+}
+
+// targetClient returns the client of the cluster the ClusterResourceSet's resources are applied to, i.e. the workload
+// cluster or the management cluster. The client of a workload cluster is kept by the Tracker until the returned
+// release function is called.
+// The client reads from the API server rather than from a cache, as the objects read are of arbitrary kinds and
+// reading them through a cache would start an informer watching all the objects of each kind in the cluster.
+func (r *ClusterResourceSetReconciler) targetClient(ctx context.Context, cluster *clusterv1.Cluster, clusterResourceSet *addonsv1.ClusterResourceSet) (client.Client, func(), error) {
+	if clusterResourceSet.Spec.AppliesToManagementCluster() {
+		if r.apiReader == nil {
+			return r.Client, func() {}, nil
+		}
+		return &client.DelegatingClient{Reader: r.apiReader, Writer: r.Client, StatusClient: r.Client}, func() {}, nil
+	}
+	if r.RemoteClientGetter != nil {
+		c, err := r.RemoteClientGetter(ctx, util.ObjectKey(cluster))
+		return c, func() {}, err
+	}
+	return r.Tracker.AcquireUncachedClient(ctx, util.ObjectKey(cluster))
+}
+
+// targetRESTMapper returns the RESTMapper of the workload cluster the ClusterResourceSet's resources are applied to,
+// which knows the kinds only defined in that cluster and their scope in it.
+func (r *ClusterResourceSetReconciler) targetRESTMapper(ctx context.Context, cluster *clusterv1.Cluster) (meta.RESTMapper, error) {
+	if r.RemoteRESTMapperGetter != nil {
+		return r.RemoteRESTMapperGetter(ctx, util.ObjectKey(cluster))
+	}
+	return r.Tracker.GetRESTMapper(ctx, util.ObjectKey(cluster))
+}
+
+// targetData returns the values of the resource as applied to the target cluster, rendered for the cluster if the
+// ClusterResourceSet renders templates, and merged with the override of the resource for the cluster if any.
+// When applied to the management cluster, objects are moved to the cluster's namespace.
+func (r *ClusterResourceSetReconciler) targetData(ctx context.Context, resource *unstructured.Unstructured, cluster *clusterv1.Cluster, clusterResourceSet *addonsv1.ClusterResourceSet, resourceRef addonsv1.ResourceRef) ([][]byte, error) {
+	dataList, err := normalizeData(resource, resourceRef.Kind, resourceRef.Keys)
+	if err != nil {
+		return nil, err
+	}
+	overrideList, err := r.clusterOverrideData(ctx, resource, cluster, resourceRef)
+	if err != nil {
+		return nil, err
+	}
+	if clusterResourceSet.Spec.RenderTemplates {
+		emptyMissingKeys := clusterResourceSet.Spec.TemplateMissingKey == string(addonsv1.EmptyClusterResourceSetTemplateMissingKey)
+		for i := range dataList {
+			if dataList[i], err = renderTemplate(dataList[i], cluster, emptyMissingKeys); err != nil {
+				return nil, errors.Wrapf(err, "failed to render %s %s for cluster %s", resourceRef.Kind, resourceRef.Name, cluster.Name)
+			}
+		}
+		for i := range overrideList {
+			if overrideList[i], err = renderTemplate(overrideList[i], cluster, emptyMissingKeys); err != nil {
+				return nil, errors.Wrapf(err, "failed to render override of %s %s for cluster %s", resourceRef.Kind, resourceRef.Name, cluster.Name)
+			}
+		}
+	}
+	// The hash of the resource is computed over the merged values, hence a change of the override is a change of the
+	// resource for the cluster only.
+	if len(overrideList) > 0 {
+		if dataList, err = mergeOverrides(dataList, overrideList); err != nil {
+			return nil, errors.Wrapf(err, "failed to merge override of %s %s for cluster %s", resourceRef.Kind, resourceRef.Name, cluster.Name)
+		}
+	}
+	if !clusterResourceSet.Spec.AppliesToManagementCluster() {
+		return dataList, nil
+	}
+	for i := range dataList {
+		if dataList[i], err = transformObjects(dataList[i], cluster, namespacer(r.restMapper)); err != nil {
+			return nil, err
+		}
+	}
+	return dataList, nil
+}
+
+// renderObjects returns the objects in data as they are applied to the cluster, i.e. transformed by the
+// ResourceTransformer and with the metadata added by the ClusterResourceSet.
+func (r *ClusterResourceSetReconciler) renderObjects(data []byte, cluster *clusterv1.Cluster, clusterResourceSet *addonsv1.ClusterResourceSet, resource addonsv1.ResourceRef) ([]byte, error) {
+	var err error
+	if r.ResourceTransformer != nil {
+		if data, err = transformObjects(data, cluster, r.ResourceTransformer); err != nil {
+			return nil, err
+		}
+	}
+
+	// Objects that are patched are not owned by the ClusterResourceSet, hence they are not labeled.
+	if resource.Mode == string(addonsv1.PatchClusterResourceSetResourceMode) {
+		return data, nil
+	}
+	if clusterResourceSet.Spec.ShouldAddProvenanceLabels() {
+		if data, err = transformObjects(data, cluster, provenanceLabeler(clusterResourceSet)); err != nil {
+			return nil, err
+		}
+	}
+	if len(clusterResourceSet.Spec.PropagateLabels) > 0 || len(clusterResourceSet.Spec.PropagateAnnotations) > 0 {
+		if data, err = transformObjects(data, cluster, metadataPropagator(clusterResourceSet)); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// removeFromCluster deletes the objects of the ClusterResourceSet's resources from the named cluster and removes the
+// ClusterResourceSet from the cluster's ClusterResourceSetBinding. Other clusters are left untouched.
+func (r *ClusterResourceSetReconciler) removeFromCluster(ctx context.Context, clusterResourceSet *addonsv1.ClusterResourceSet, clusterName string) error {
+	logger := r.Log.WithValues(logKeyCRSName, clusterResourceSet.Name, logKeyCRSNamespace, clusterResourceSet.Namespace, logKeyClusterName, clusterName)
+
+	cluster := &clusterv1.Cluster{}
+	if err := r.Client.Get(ctx, client.ObjectKey{Namespace: clusterResourceSet.Namespace, Name: clusterName}, cluster); err != nil {
+		if apierrors.IsNotFound(err) {
+			logger.Info("Cluster to remove resources from not found, skipping", logKeyOutcome, outcomeSkipped)
+			return nil
+		}
+		return err
+	}
+
+	remoteClient, release, err := r.targetClient(ctx, cluster, clusterResourceSet)
+	if err != nil {
+		return &clusterUnreachableError{err: err}
+	}
+	defer release()
+
+	errList := []error{}
+	// With ReverseDeleteOrder, the objects of all the resources are collected and deleted together.
+	reverseDeleteList := [][]byte{}
+	for _, resource := range uniqueResources(clusterResourceSet.Spec.Resources) {
+		// Patches target objects that are not created by the ClusterResourceSet, hence they are never deleted.
+		if resource.Mode == string(addonsv1.PatchClusterResourceSetResourceMode) {
+			continue
+		}
+
+		unstructuredObj, err := r.getResource(ctx, resource, cluster.Namespace)
+		if err != nil {
+			errList = append(errList, errors.Wrapf(err, "failed to get %s %s", resource.Kind, resource.Name))
+			continue
+		}
+		dataList, err := r.targetData(ctx, unstructuredObj, cluster, clusterResourceSet, resource)
+		if err != nil {
+			errList = append(errList, err)
+			continue
+		}
+		if clusterResourceSet.Spec.ReverseDeleteOrder {
+			reverseDeleteList = append(reverseDeleteList, dataList...)
+			continue
+		}
+		for _, data := range dataList {
+			if err := deleteObjects(ctx, remoteClient, data, clusterResourceSet.Spec.GetDeletePropagationPolicy()); err != nil {
+				errList = append(errList, err)
+			}
+		}
+	}
+	if len(reverseDeleteList) > 0 {
+		if err := deleteObjectsInReverseOrder(ctx, remoteClient, reverseDeleteList, clusterResourceSet.Spec.GetDeletePropagationPolicy()); err != nil {
+			errList = append(errList, err)
+		}
+	}
+	// The inventory is deleted even if it is no longer written, so that it does not outlive the objects.
+	if !clusterResourceSet.Spec.AppliesToManagementCluster() {
+		if err := deleteInventory(ctx, remoteClient, clusterResourceSet); err != nil {
+			errList = append(errList, err)
+		}
+	}
+	if len(errList) > 0 {
+		return kerrors.NewAggregate(errList)
+	}
+
+	clusterResourceSetBinding := &addonsv1.ClusterResourceSetBinding{}
+	if err := r.Client.Get(ctx, client.ObjectKey{Namespace: cluster.Namespace, Name: cluster.Name}, clusterResourceSetBinding); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+
+	patchHelper, err := patch.NewHelper(clusterResourceSetBinding, r.Client)
+	if err != nil {
+		return err
+	}
+	clusterResourceSetBinding.DeleteBinding(clusterResourceSet)
+	return patchHelper.Patch(ctx, clusterResourceSetBinding)
+}
+
+// invalidResourceKeyError is returned when a resource is referred to with a malformed "<kind>/<name>" key, or a key
+// that is not one of the resources of the ClusterResourceSet. Retrying does not fix it.
+type invalidResourceKeyError struct {
+	key string
+}
+
+func (e *invalidResourceKeyError) Error() string {
+	return fmt.Sprintf("%q is not a resource of the ClusterResourceSet, expected <kind>/<name>", e.key)
+}
+
+func isInvalidResourceKeyError(err error) bool {
+	_, ok := errors.Cause(err).(*invalidResourceKeyError)
+	return ok
+}
+
+// forceReapplyResource marks the resource of the ClusterResourceSet with the given "<kind>/<name>" key as not applied
+// in all the ClusterResourceSetBindings recording it, so that only this resource is applied again. It returns the
+// number of bindings changed.
+func (r *ClusterResourceSetReconciler) forceReapplyResource(ctx context.Context, clusterResourceSet *addonsv1.ClusterResourceSet, key string) (int, error) {
+	parts := strings.SplitN(key, "/", 2)
+	if len(parts) != 2 {
+		return 0, &invalidResourceKeyError{key: key}
+	}
+	ref := addonsv1.ResourceRef{Kind: parts[0], Name: parts[1]}
+	found := false
+	for _, resource := range clusterResourceSet.Spec.Resources {
+		if resource.Kind == ref.Kind && resource.Name == ref.Name {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return 0, &invalidResourceKeyError{key: key}
+	}
+
+	bindings := &addonsv1.ClusterResourceSetBindingList{}
+	if err := r.Client.List(ctx, bindings, client.InNamespace(clusterResourceSet.Namespace)); err != nil {
+		return 0, errors.Wrap(err, "failed to list ClusterResourceSetBindings")
+	}
+
+	count := 0
+	errList := []error{}
+	for i := range bindings.Items {
+		clusterResourceSetBinding := &bindings.Items[i]
+		resourceSetBinding := findResourceSetBinding(clusterResourceSetBinding, clusterResourceSet.Name)
+		if resourceSetBinding == nil {
+			continue
+		}
+		resourceBinding := resourceSetBinding.GetResourceBinding(ref)
+		if resourceBinding == nil || !resourceBinding.Applied {
+			continue
+		}
+
+		patchHelper, err := patch.NewHelper(clusterResourceSetBinding, r.Client)
+		if err != nil {
+			errList = append(errList, err)
+			continue
+		}
+		resourceBinding.Applied = false
+		if err := patchHelper.Patch(ctx, clusterResourceSetBinding); err != nil {
+			errList = append(errList, errors.Wrapf(err, "failed to patch ClusterResourceSetBinding %s", clusterResourceSetBinding.Name))
+			continue
+		}
+		count++
+	}
+	return count, kerrors.NewAggregate(errList)
+}
+
+// reconcileStrategyEnabled returns true if resources of the ClusterResourceSet are applied again when they change.
+// The "Reconcile" strategy is only honored when the ClusterResourceSetReconcileStrategy feature gate is enabled,
+// otherwise resources are applied using the "ApplyOnce" strategy.
+func reconcileStrategyEnabled(clusterResourceSet *addonsv1.ClusterResourceSet) bool {
+	return clusterResourceSet.Spec.Strategy == string(addonsv1.ClusterResourceSetStrategyReconcile) &&
+		feature.Gates.Enabled(feature.ClusterResourceSetReconcileStrategy)
+}
+
+// reappliesOnChange returns true if resources of the ClusterResourceSet that changed since they were applied are applied
+// again, updating the existing objects. This is the case for the "ApplyOnChange" and the "Reconcile" strategies.
+func reappliesOnChange(clusterResourceSet *addonsv1.ClusterResourceSet) bool {
+	return clusterResourceSet.Spec.Strategy == string(addonsv1.ClusterResourceSetStrategyApplyOnChange) ||
+		reconcileStrategyEnabled(clusterResourceSet)
+}
+
+// sourceReplaced returns true if the source of the resource has a different UID than the one recorded in the binding,
+// i.e. it was deleted and recreated with the same name since it was applied. Bindings recorded without a UID, and
+// sources without one like OCI artifacts, are never considered replaced.
+func sourceReplaced(resourceBinding *addonsv1.ResourceBinding, source *unstructured.Unstructured) bool {
+	return resourceBinding.SourceUID != "" && source.GetUID() != "" && resourceBinding.SourceUID != source.GetUID()
+}
+
+// maxClusterObjects returns the maximum number of objects applied to each cluster matching the ClusterResourceSet, i.e.
+// the lower of the limits of the ClusterResourceSet and of the controller, or 0 if neither is set.
+func (r *ClusterResourceSetReconciler) maxClusterObjects(clusterResourceSet *addonsv1.ClusterResourceSet) int {
+	limit := int(clusterResourceSet.Spec.MaxClusterObjects)
+	if r.MaxClusterObjects > 0 && (limit == 0 || r.MaxClusterObjects < limit) {
+		limit = r.MaxClusterObjects
+	}
+	return limit
+}
+
+// clusterObjectCount returns the number of objects recorded as applied to the cluster by all the ClusterResourceSets,
+// except the objects of the given resource. The records of the ClusterResourceSet are taken from resourceSetBinding,
+// which may not be saved yet.
+func (r *ClusterResourceSetReconciler) clusterObjectCount(ctx context.Context, cluster *clusterv1.Cluster, clusterResourceSet *addonsv1.ClusterResourceSet, resourceSetBinding *addonsv1.ResourceSetBinding, resource addonsv1.ResourceRef) (int, error) {
+	clusterResourceSetBinding := &addonsv1.ClusterResourceSetBinding{}
+	if err := r.Client.Get(ctx, util.ObjectKey(cluster), clusterResourceSetBinding); err != nil && !apierrors.IsNotFound(err) {
+		return 0, errors.Wrapf(err, "failed to get ClusterResourceSetBinding for cluster %s", cluster.Name)
+	}
+
+	count := 0
+	for _, binding := range clusterResourceSetBinding.Spec.Bindings {
+		if binding.ClusterResourceSetName == clusterResourceSet.Name {
+			continue
+		}
+		for _, resourceBinding := range binding.Resources {
+			count += int(resourceBinding.AppliedObjects)
+		}
+	}
+	current := resourceSetBinding.GetResourceBinding(resource)
+	for i := range resourceSetBinding.Resources {
+		if &resourceSetBinding.Resources[i] != current {
+			count += int(resourceSetBinding.Resources[i].AppliedObjects)
+		}
+	}
+	return count, nil
+}
+
+// higherPriorityPending returns the names of the ClusterResourceSets selecting the Cluster with a higher priority than
+// the ClusterResourceSet that did not apply all their resources to it yet. ClusterResourceSets that already applied all
+// their resources to the Cluster do not wait for ClusterResourceSets created later with a higher priority.
+func (r *ClusterResourceSetReconciler) higherPriorityPending(ctx context.Context, cluster *clusterv1.Cluster, clusterResourceSet *addonsv1.ClusterResourceSet) ([]string, error) {
+	clusterResourceSetBinding := &addonsv1.ClusterResourceSetBinding{}
+	if err := r.Client.Get(ctx, util.ObjectKey(cluster), clusterResourceSetBinding); err != nil && !apierrors.IsNotFound(err) {
+		return nil, errors.Wrapf(err, "failed to get ClusterResourceSetBinding for cluster %s", cluster.Name)
+	}
+	if resourceSetBinding := findResourceSetBinding(clusterResourceSetBinding, clusterResourceSet.Name); resourceSetBinding != nil && !hasPendingResources(clusterResourceSet, resourceSetBinding) {
+		return nil, nil
+	}
+
+	clusterResourceSets := &addonsv1.ClusterResourceSetList{}
+	if err := r.Client.List(ctx, clusterResourceSets, client.InNamespace(clusterResourceSet.Namespace)); err != nil {
+		return nil, errors.Wrap(err, "failed to list ClusterResourceSets")
+	}
+	pending := []string{}
+	for i := range clusterResourceSets.Items {
+		other := &clusterResourceSets.Items[i]
+		if other.Spec.Priority <= clusterResourceSet.Spec.Priority || !other.DeletionTimestamp.IsZero() ||
+			other.Spec.AuditOnly || len(other.Spec.Resources) == 0 || clusterNotSelectedReason(other, cluster) != "" {
+			continue
+		}
+		if resourceSetBinding := findResourceSetBinding(clusterResourceSetBinding, other.Name); resourceSetBinding == nil || hasPendingResources(other, resourceSetBinding) {
+			pending = append(pending, other.Name)
+		}
+	}
+	return pending, nil
+}
+
+// findResourceSetBinding returns the entry of the ClusterResourceSet with the given name in the ClusterResourceSetBinding,
+// or nil if there is none.
+func findResourceSetBinding(clusterResourceSetBinding *addonsv1.ClusterResourceSetBinding, clusterResourceSetName string) *addonsv1.ResourceSetBinding {
+	for _, b := range clusterResourceSetBinding.Spec.Bindings {
+		if b.ClusterResourceSetName == clusterResourceSetName {
+			return b
+		}
+	}
+	return nil
+}
+
+// hasRecordedResources returns true if resources of the ClusterResourceSet are recorded in any ClusterResourceSetBinding.
+func (r *ClusterResourceSetReconciler) hasRecordedResources(ctx context.Context, clusterResourceSet *addonsv1.ClusterResourceSet) (bool, error) {
+	bindings := &addonsv1.ClusterResourceSetBindingList{}
+	if err := r.Client.List(ctx, bindings, client.InNamespace(clusterResourceSet.Namespace)); err != nil {
+		return false, errors.Wrap(err, "failed to list ClusterResourceSetBindings")
+	}
+	for i := range bindings.Items {
+		if resourceSetBinding := findResourceSetBinding(&bindings.Items[i], clusterResourceSet.Name); resourceSetBinding != nil && len(resourceSetBinding.Resources) > 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// hasPendingResources returns true if any of the ClusterResourceSet's resources has not been applied successfully yet.
+// Resources disabled by their feature flag are not pending.
+func hasPendingResources(clusterResourceSet *addonsv1.ClusterResourceSet, resourceSetBinding *addonsv1.ResourceSetBinding) bool {
+	for _, resource := range clusterResourceSet.Spec.Resources {
+		if resourceSetBinding.IsApplied(resource) {
+			continue
+		}
+		if binding := resourceSetBinding.GetResourceBinding(resource); binding != nil && binding.Disabled {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+// reserveApply records an apply to the cluster if at least MinApplyInterval has elapsed since the previous one.
+// Otherwise, it returns how long to wait before resources can be applied to the cluster again.
+func (r *ClusterResourceSetReconciler) reserveApply(cluster *clusterv1.Cluster) time.Duration {
+	if r.MinApplyInterval <= 0 {
+		return 0
+	}
+
+	r.lastAppliedLock.Lock()
+	defer r.lastAppliedLock.Unlock()
+
+	if r.lastApplied == nil {
+		r.lastApplied = map[types.NamespacedName]time.Time{}
+	}
+
+	key := util.ObjectKey(cluster)
+	if last, ok := r.lastApplied[key]; ok {
+		if elapsed := time.Since(last); elapsed < r.MinApplyInterval {
+			return r.MinApplyInterval - elapsed
+		}
+	}
+	r.lastApplied[key] = time.Now()
+	return 0
+}
+
+// auditClusterResourceSet records the resources of a ClusterResourceSet that would be applied to a Cluster in the
+// ClusterResourceSet's status. Neither the workload cluster nor the cluster's ClusterResourceSetBinding is modified.
+func (r *ClusterResourceSetReconciler) auditClusterResourceSet(ctx context.Context, cluster *clusterv1.Cluster, clusterResourceSet *addonsv1.ClusterResourceSet) error {
+	clusterResourceSetBinding := &addonsv1.ClusterResourceSetBinding{}
+	if err := r.Client.Get(ctx, util.ObjectKey(cluster), clusterResourceSetBinding); err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	resourceSetBinding := clusterResourceSetBinding.GetOrCreateBinding(clusterResourceSet)
+
+	errList := []error{}
+	for _, resource := range clusterResourceSet.Spec.Resources {
+		unstructuredObj, err := r.getResource(ctx, resource, cluster.GetNamespace())
+		if err != nil {
+			errList = append(errList, err)
+			continue
+		}
+
+		dataList, err := r.targetData(ctx, unstructuredObj, cluster, clusterResourceSet, resource)
+		if err != nil {
+			errList = append(errList, err)
+			continue
+		}
+
+		hash, err := computeResourceHash(unstructuredObj, dataList)
+		if err != nil {
+			errList = append(errList, err)
+			continue
+		}
+
+		resourceBinding := resourceSetBinding.GetResourceBinding(resource)
+		if resourceBinding != nil && resourceBinding.Applied && resourceHashMatches(resourceBinding.Hash, hash, unstructuredObj, dataList) {
+			continue
+		}
+
+		clusterResourceSet.Status.WouldReapply = append(clusterResourceSet.Status.WouldReapply, addonsv1.ReapplyAuditEntry{
+			ClusterName: cluster.Name,
+			Kind:        resource.Kind,
+			Name:        resource.Name,
+		})
+	}
+	return kerrors.NewAggregate(errList)
+}
+
+// applyResource applies a single resource of a ClusterResourceSet to a Cluster and records the result in the ResourceSetBinding.
+// A panic while processing the resource, e.g. caused by a malformed resource, is recovered and returned as an error
+// so that the remaining resources are still applied.
+func (r *ClusterResourceSetReconciler) applyResource(ctx context.Context, remoteClient client.Client, cluster *clusterv1.Cluster, clusterResourceSet *addonsv1.ClusterResourceSet, resourceSetBinding *addonsv1.ResourceSetBinding, resource addonsv1.ResourceRef) (reterr error) {
+	logger := r.Log.WithValues(logKeyCRSName, clusterResourceSet.Name, logKeyCRSNamespace, clusterResourceSet.Namespace, logKeyClusterName, cluster.Name,
+		logKeyResourceKind, resource.Kind, logKeyResourceName, resource.Name)
+
+	defer func() {
+		if rec := recover(); rec != nil {
+			reterr = errors.Errorf("recovered from panic while applying %s %s: %v", resource.Kind, resource.Name, rec)
+			logger.Error(reterr, "Failed to apply ClusterResourceSet resource", logKeyOutcome, outcomeFailed)
+			conditions.MarkFalse(clusterResourceSet, addonsv1.ResourcesAppliedCondition, addonsv1.ApplyFailedReason, clusterv1.ConditionSeverityWarning, reterr.Error())
+		}
+	}()
+
+	// If the resource requires an object to exist in the cluster, skip it until that object shows up.
+	if resource.RequiresExisting != nil {
+		exists, err := prerequisiteExists(ctx, remoteClient, resource.RequiresExisting)
+		if err != nil {
+			conditions.MarkFalse(clusterResourceSet, addonsv1.ResourcesAppliedCondition, addonsv1.PrerequisiteMissingReason, clusterv1.ConditionSeverityWarning, err.Error())
+			return err
+		}
+		if !exists {
+			logger.Info("Prerequisite of resource not found in cluster, skipping", logKeyOutcome, outcomeSkipped)
+			conditions.MarkFalse(clusterResourceSet, addonsv1.ResourcesAppliedCondition, addonsv1.PrerequisiteMissingReason, clusterv1.ConditionSeverityInfo,
+				"%s %s required by %s %s does not exist", resource.RequiresExisting.Kind, resource.RequiresExisting.Name, resource.Kind, resource.Name)
+			return errors.Wrapf(&capierrors.RequeueAfterError{RequeueAfter: prerequisiteRequeueAfter}, "prerequisite of %s %s does not exist", resource.Kind, resource.Name)
+		}
+	}
+
+	// If the resource is enabled by a feature flag in the cluster, skip it unless the flag has the expected value.
+	if resource.EnabledWhen != nil {
+		flag := resource.EnabledWhen
+		value, found, err := featureFlagValue(ctx, remoteClient, flag)
+		if err != nil {
+			conditions.MarkFalse(clusterResourceSet, addonsv1.ResourcesAppliedCondition, addonsv1.FeatureFlagUnavailableReason, clusterv1.ConditionSeverityWarning, err.Error())
+			return err
+		}
+		if !found {
+			logger.Info("Feature flag of resource not found in cluster, skipping", logKeyOutcome, outcomeSkipped)
+			conditions.MarkFalse(clusterResourceSet, addonsv1.ResourcesAppliedCondition, addonsv1.FeatureFlagUnavailableReason, clusterv1.ConditionSeverityInfo,
+				"key %s of ConfigMap %s/%s enabling %s %s does not exist", flag.Key, flag.Namespace, flag.Name, resource.Kind, resource.Name)
+			return errors.Wrapf(&capierrors.RequeueAfterError{RequeueAfter: prerequisiteRequeueAfter}, "feature flag of %s %s does not exist", resource.Kind, resource.Name)
+		}
+		binding := resourceSetBinding.GetResourceBinding(resource)
+		if value != flag.Value {
+			logger.V(4).Info("Resource is disabled by its feature flag, skipping", logKeyOutcome, outcomeSkipped, "value", value)
+			if binding == nil {
+				resourceSetBinding.SetBinding(addonsv1.ResourceBinding{ResourceRef: resource, Disabled: true})
+			} else {
+				binding.Disabled = true
+			}
+			return nil
+		}
+		if binding != nil {
+			binding.Disabled = false
+		}
+	}
+
+	unstructuredObj, err := r.getResource(ctx, resource, cluster.GetNamespace())
+	if err != nil {
+		if apierrors.IsNotFound(err) && clusterResourceSet.Spec.ToleratePendingResources {
+			logger.V(4).Info("Resource does not exist yet, waiting for it to be created", logKeyOutcome, outcomeRequeued)
+			conditions.MarkFalse(clusterResourceSet, addonsv1.ResourcesAppliedCondition, addonsv1.ResourcePendingReason, clusterv1.ConditionSeverityInfo,
+				"%s %s does not exist yet", resource.Kind, resource.Name)
+			return errors.Wrapf(&capierrors.RequeueAfterError{RequeueAfter: prerequisiteRequeueAfter}, "%s %s does not exist yet", resource.Kind, resource.Name)
+		}
+		if _, ok := err.(*ociPullError); ok {
+			conditions.MarkFalse(clusterResourceSet, addonsv1.ResourcesAppliedCondition, addonsv1.OCIPullFailedReason, clusterv1.ConditionSeverityWarning, err.Error())
+			return err
+		}
+		if gitErr, ok := err.(*gitFetchError); ok {
+			if gitErr.auth {
+				conditions.MarkFalse(clusterResourceSet, addonsv1.ResourcesAppliedCondition, addonsv1.GitAuthFailedReason, clusterv1.ConditionSeverityError, err.Error())
+			} else {
+				conditions.MarkFalse(clusterResourceSet, addonsv1.ResourcesAppliedCondition, addonsv1.GitFetchFailedReason, clusterv1.ConditionSeverityWarning, err.Error())
+			}
+			return err
+		}
+		switch err {
+		case ErrSecretTypeNotSupported:
+			conditions.MarkFalse(clusterResourceSet, addonsv1.ResourcesAppliedCondition, addonsv1.WrongSecretTypeReason, clusterv1.ConditionSeverityWarning, err.Error())
+		case ErrSecretSourceLabelMissing:
+			conditions.MarkFalse(clusterResourceSet, addonsv1.ResourcesAppliedCondition, addonsv1.SecretSourceLabelMissingReason, clusterv1.ConditionSeverityWarning, err.Error())
+		default:
+			conditions.MarkFalse(clusterResourceSet, addonsv1.ResourcesAppliedCondition, addonsv1.RetrievingResourceFailedReason, clusterv1.ConditionSeverityWarning, err.Error())
+		}
+		return err
+	}
+
+	// Keep a copy of the current binding to detect if the resource changed since it was last applied.
+	var previousBinding *addonsv1.ResourceBinding
+	if b := resourceSetBinding.GetResourceBinding(resource); b != nil {
+		previousBinding = b.DeepCopy()
+	}
+
+	// Set status in ClusterResourceSetBinding in case of early return due to a failure.
+	// Set only when resource is retrieved successfully.
+	// The objects applied previously are still in the cluster, hence they keep counting towards its object limit.
+	var previousObjects int32
+	if previousBinding != nil {
+		previousObjects = previousBinding.AppliedObjects
+	}
+	resourceSetBinding.SetBinding(addonsv1.ResourceBinding{
+		ResourceRef:     resource,
+		SourceNamespace: unstructuredObj.GetNamespace(),
+		SourceUID:       unstructuredObj.GetUID(),
+		Hash:            "",
+		Applied:         false,
+		LastAppliedTime: &metav1.Time{Time: time.Now().UTC()},
+		AppliedObjects:  previousObjects,
+	})
+
+	errList := []error{}
+
+	// OCI artifacts and Git repositories are not objects in the management cluster, hence they cannot be owned by the
+	// ClusterResourceSet. Neither can the ConfigMaps selected by a resource, which are merged in a single object.
+	if resource.Kind != string(addonsv1.OCIArtifactClusterResourceSetResourceKind) &&
+		resource.Kind != string(addonsv1.GitRepositoryClusterResourceSetResourceKind) && resource.Selector == nil {
+		if err := r.patchOwnerRefToResource(ctx, clusterResourceSet, unstructuredObj); err != nil {
+			logger.Error(err, "Failed to patch ClusterResourceSet as resource owner reference")
+			errList = append(errList, err)
+		}
+	}
 
-	clusters, err := r.getClustersByClusterResourceSetSelector(ctx, clusterResourceSet)
+	dataList, err := r.targetData(ctx, unstructuredObj, cluster, clusterResourceSet, resource)
 	if err != nil {
-		logger.Error(err, "Failed fetching clusters that matches ClusterResourceSet labels", "ClusterResourceSet", clusterResourceSet.Name)
-		conditions.MarkFalse(clusterResourceSet, addonsv1.ResourcesAppliedCondition, addonsv1.ClusterMatchFailedReason, clusterv1.ConditionSeverityWarning, err.Error())
-		return ctrl.Result{}, err
+		conditions.MarkFalse(clusterResourceSet, addonsv1.ResourcesAppliedCondition, addonsv1.RetrievingResourceFailedReason, clusterv1.ConditionSeverityWarning, err.Error())
+		errList = append(errList, err)
+		return kerrors.NewAggregate(errList)
 	}
 
-	for _, cluster := range clusters {
-		if err := r.ApplyClusterResourceSet(ctx, cluster, clusterResourceSet); err != nil {
-			// The reason of not requeuing in case of errors if applying resources are failed is to avoid retries in case resources are missing.
-			// In the next reconcile, failed resources will be retried.
-			logger.Error(err, "Failed applying resources to cluster", "Cluster", cluster.Name)
-		}
+	hash, err := computeResourceHash(unstructuredObj, dataList)
+	if err != nil {
+		conditions.MarkFalse(clusterResourceSet, addonsv1.ResourcesAppliedCondition, addonsv1.RetrievingResourceFailedReason, clusterv1.ConditionSeverityWarning, err.Error())
+		errList = append(errList, err)
+		return kerrors.NewAggregate(errList)
 	}
 
-	return ctrl.Result{}, nil
-}
+	// Resources that did not change since they were applied successfully are not applied again, unless their objects
+	// drifted with the Reconcile strategy.
+	// A source recreated with the same name is considered changed, even if its content did not change.
+	var driftCount int32
+	if previousBinding != nil && previousBinding.Applied && resourceHashMatches(previousBinding.Hash, hash, unstructuredObj, dataList) && !sourceReplaced(previousBinding, unstructuredObj) {
+		// Hashes recorded in a previous format are migrated to the current one.
+		previousBinding.Hash = hash
 
-// getClustersByClusterResourceSetSelector fetches Clusters matched by the ClusterResourceSet's label selector that are in the same namespace as the ClusterResourceSet object.
-func (r *ClusterResourceSetReconciler) getClustersByClusterResourceSetSelector(ctx context.Context, clusterResourceSet *addonsv1.ClusterResourceSet) ([]*clusterv1.Cluster, error) {
-	logger := r.Log.WithValues("clusterresourceset", clusterResourceSet.Name, "namespace", clusterResourceSet.Namespace)
+		drifted, err := r.resourceDrift(ctx, remoteClient, cluster, clusterResourceSet, resource, dataList, ignoredFields(unstructuredObj))
+		if err != nil {
+			logger.Error(err, "Failed to check objects of resource for drift")
+		}
+		if len(drifted) == 0 {
+			resourceSetBinding.SetBinding(*previousBinding)
+			return kerrors.NewAggregate(errList)
+		}
 
-	clusterList := &clusterv1.ClusterList{}
-	selector, err := metav1.LabelSelectorAsSelector(&clusterResourceSet.Spec.ClusterSelector)
-	if err != nil {
-		return nil, errors.Wrap(err, "unable to convert selector")
+		// Objects drifting again and again right after being applied are likely changed by another controller or
+		// a mutating webhook, so back off instead of fighting over them.
+		driftCount = 1
+		if previousBinding.LastAppliedTime != nil && time.Since(previousBinding.LastAppliedTime.Time) < controllerConflictWindow {
+			driftCount = previousBinding.DriftCount + 1
+		}
+		if driftCount > controllerConflictThreshold {
+			logger.Info("Objects of resource keep drifting right after being applied, backing off", logKeyOutcome, outcomeRequeued, "objects", drifted)
+			conditions.MarkFalse(clusterResourceSet, addonsv1.ResourcesAppliedCondition, addonsv1.PossibleControllerConflictReason, clusterv1.ConditionSeverityWarning,
+				"%s of %s %s changed right after being applied %d times, they may be managed by another controller", strings.Join(drifted, ", "), resource.Kind, resource.Name, driftCount)
+			r.recorder.Eventf(clusterResourceSet, corev1.EventTypeWarning, "PossibleControllerConflict",
+				"Objects of %s %s in cluster %s keep changing right after being applied: %s", resource.Kind, resource.Name, cluster.Name, strings.Join(drifted, ", "))
+			resourceSetBinding.SetBinding(*previousBinding)
+			if len(errList) > 0 {
+				return kerrors.NewAggregate(errList)
+			}
+			return errors.Wrapf(&capierrors.RequeueAfterError{RequeueAfter: controllerConflictBackoff}, "objects of %s %s keep drifting", resource.Kind, resource.Name)
+		}
+		logger.Info("Objects of resource drifted, applying it again", "objects", drifted)
 	}
 
-	// If a ClusterResourceSet has a nil or empty selector, it should match nothing, not everything.
-	if selector.Empty() {
-		logger.Info("Empty ClusterResourceSet selector: No clusters are selected.")
-		return nil, nil
+	// If the resource is not recorded as applied but all of its objects exist, e.g. because the ClusterResourceSetBinding
+	// was recreated, record it as applied without applying it again.
+	// Patches always target existing objects, hence they are never skipped.
+	if clusterResourceSet.Spec.SkipExisting && resource.Mode != string(addonsv1.PatchClusterResourceSetResourceMode) {
+		exist, err := objectsExist(ctx, remoteClient, dataList)
+		if err != nil {
+			logger.Error(err, "Failed to check if objects of resource exist in cluster")
+		}
+		if exist {
+			logger.V(4).Info("Objects of resource exist in cluster, skipping apply", logKeyOutcome, outcomeSkipped)
+			count, _ := objectCount(dataList)
+			resourceSetBinding.SetBinding(addonsv1.ResourceBinding{
+				ResourceRef:       resource,
+				SourceNamespace:   unstructuredObj.GetNamespace(),
+				SourceUID:         unstructuredObj.GetUID(),
+				Hash:              hash,
+				Applied:           true,
+				LastAppliedTime:   &metav1.Time{Time: time.Now().UTC()},
+				AppliedGeneration: clusterResourceSet.Generation,
+				AppliedObjects:    int32(count),
+			})
+			return kerrors.NewAggregate(errList)
+		}
 	}
 
-	if err := r.Client.List(ctx, clusterList, client.InNamespace(clusterResourceSet.Namespace), client.MatchingLabelsSelector{Selector: selector}); err != nil {
-		return nil, errors.Wrap(err, "failed to list clusters")
+	// Reject resources with objects of kinds the ClusterResourceSet is not allowed to apply, before applying any of them.
+	if len(clusterResourceSet.Spec.AllowedKinds) > 0 {
+		disallowed, err := disallowedObjects(clusterResourceSet.Spec.AllowedKinds, dataList)
+		if err != nil {
+			conditions.MarkFalse(clusterResourceSet, addonsv1.ResourcesAppliedCondition, addonsv1.KindNotAllowedReason, clusterv1.ConditionSeverityError, err.Error())
+			errList = append(errList, err)
+			return kerrors.NewAggregate(errList)
+		}
+		if len(disallowed) > 0 {
+			err := errors.Errorf("%s %s has objects of kinds the ClusterResourceSet is not allowed to apply: %s", resource.Kind, resource.Name, strings.Join(disallowed, ", "))
+			conditions.MarkFalse(clusterResourceSet, addonsv1.ResourcesAppliedCondition, addonsv1.KindNotAllowedReason, clusterv1.ConditionSeverityError, err.Error())
+			errList = append(errList, err)
+			return kerrors.NewAggregate(errList)
+		}
 	}
 
-	clusters := []*clusterv1.Cluster{}
-	for i := range clusterList.Items {
-		c := &clusterList.Items[i]
-		if c.DeletionTimestamp.IsZero() {
-			clusters = append(clusters, c)
+	// Skip resources with namespaced objects without a namespace, rather than applying them to an ambiguous default.
+	if clusterResourceSet.Spec.RequireNamespace && !clusterResourceSet.Spec.AppliesToManagementCluster() {
+		mapper, err := r.targetRESTMapper(ctx, cluster)
+		if err != nil {
+			conditions.MarkFalse(clusterResourceSet, addonsv1.ResourcesAppliedCondition, addonsv1.MissingNamespaceReason, clusterv1.ConditionSeverityWarning, err.Error())
+			errList = append(errList, err)
+			return kerrors.NewAggregate(errList)
+		}
+		missing, unknown, err := objectsWithoutNamespace(mapper, dataList)
+		if err != nil {
+			conditions.MarkFalse(clusterResourceSet, addonsv1.ResourcesAppliedCondition, addonsv1.MissingNamespaceReason, clusterv1.ConditionSeverityWarning, err.Error())
+			errList = append(errList, err)
+			return kerrors.NewAggregate(errList)
+		}
+		// Objects of kinds unknown to the cluster might be namespaced, hence they are not applied either.
+		if len(unknown) > 0 {
+			err := errors.Errorf("%s %s has objects without a namespace of kinds unknown to the cluster: %s", resource.Kind, resource.Name, strings.Join(unknown, ", "))
+			logger.Info("Skipping resource with objects of unknown kinds without a namespace", logKeyOutcome, outcomeSkipped, "objects", unknown)
+			conditions.MarkFalse(clusterResourceSet, addonsv1.ResourcesAppliedCondition, addonsv1.MissingNamespaceReason, clusterv1.ConditionSeverityWarning, err.Error())
+			errList = append(errList, err)
+			return kerrors.NewAggregate(errList)
+		}
+		if len(missing) > 0 {
+			err := errors.Errorf("%s %s has namespaced objects without a namespace: %s", resource.Kind, resource.Name, strings.Join(missing, ", "))
+			logger.Info("Skipping resource with namespaced objects without a namespace", logKeyOutcome, outcomeSkipped, "objects", missing)
+			conditions.MarkFalse(clusterResourceSet, addonsv1.ResourcesAppliedCondition, addonsv1.MissingNamespaceReason, clusterv1.ConditionSeverityWarning, err.Error())
+			errList = append(errList, err)
+			return kerrors.NewAggregate(errList)
 		}
 	}
-	return clusters, nil
-}
-
-// ApplyClusterResourceSet applies resources in a ClusterResourceSet to a Cluster. Once applied, a record will be added to the
-// cluster's ClusterResourceSetBinding.
-// In ApplyOnce strategy, resources are applied only once to a particular cluster. ClusterResourceSetBinding is used to check if a resource is applied before.
-// It applies resources best effort and continue on scenarios like: unsupported resource types, failure during creation, missing resources.
-// TODO: If a resource already exists in the cluster but not applied by ClusterResourceSet, the resource will be updated ?
-func (r *ClusterResourceSetReconciler) ApplyClusterResourceSet(ctx context.Context, cluster *clusterv1.Cluster, clusterResourceSet *addonsv1.ClusterResourceSet) error {
-	logger := r.Log.WithValues("clusterresourceset", clusterResourceSet.Name, "namespace", clusterResourceSet.Namespace, "cluster-name", cluster.Name)
-
-	logger.Info("Applying ClusterResourceSet to cluster")
 
-	remoteClient, err := r.Tracker.GetClient(ctx, util.ObjectKey(cluster))
-	if err != nil {
-		conditions.MarkFalse(clusterResourceSet, addonsv1.ResourcesAppliedCondition, addonsv1.RemoteClusterClientFailedReason, clusterv1.ConditionSeverityError, err.Error())
-		return err
+	// Refuse resources whose objects would push the number of objects applied to the cluster over its limit.
+	if limit := r.maxClusterObjects(clusterResourceSet); limit > 0 && resource.Mode != string(addonsv1.PatchClusterResourceSetResourceMode) {
+		count, err := objectCount(dataList)
+		if err != nil {
+			conditions.MarkFalse(clusterResourceSet, addonsv1.ResourcesAppliedCondition, addonsv1.ObjectLimitExceededReason, clusterv1.ConditionSeverityWarning, err.Error())
+			errList = append(errList, err)
+			return kerrors.NewAggregate(errList)
+		}
+		otherCount, err := r.clusterObjectCount(ctx, cluster, clusterResourceSet, resourceSetBinding, resource)
+		if err != nil {
+			errList = append(errList, err)
+			return kerrors.NewAggregate(errList)
+		}
+		if total := r.reserveClusterObjects(cluster, clusterResourceSet, resourceSetBinding, resource, otherCount, count, limit); total > limit {
+			err := errors.Errorf("applying the %d objects of %s %s would push the number of objects applied to cluster %s to %d, over the limit of %d",
+				count, resource.Kind, resource.Name, cluster.Name, total, limit)
+			logger.Info("Skipping resource exceeding the object limit of the cluster", logKeyOutcome, outcomeSkipped, "objects", total, "limit", limit)
+			conditions.MarkFalse(clusterResourceSet, addonsv1.ResourcesAppliedCondition, addonsv1.ObjectLimitExceededReason, clusterv1.ConditionSeverityWarning, err.Error())
+			errList = append(errList, err)
+			return kerrors.NewAggregate(errList)
+		}
 	}
 
-	// Get ClusterResourceSetBinding object for the cluster.
-	clusterResourceSetBinding, err := r.getOrCreateClusterResourceSetBinding(ctx, cluster, clusterResourceSet)
-	if err != nil {
-		return err
+	// Skip resources whose objects do not match the schemas of the cluster, rather than failing halfway through applying them.
+	if clusterResourceSet.Spec.ValidateSchema && resource.Mode != string(addonsv1.PatchClusterResourceSetResourceMode) && !clusterResourceSet.Spec.AppliesToManagementCluster() {
+		models, err := r.clusterSchemas(ctx, cluster)
+		if err != nil {
+			conditions.MarkFalse(clusterResourceSet, addonsv1.ResourcesAppliedCondition, addonsv1.SchemaValidationFailedReason, clusterv1.ConditionSeverityWarning, err.Error())
+			errList = append(errList, &transientError{err: err})
+			return kerrors.NewAggregate(errList)
+		}
+		violations, err := schemaViolations(models, dataList)
+		if err != nil {
+			logger.Error(err, "Failed to validate objects of resource")
+		}
+		if len(violations) > 0 {
+			err := errors.Errorf("objects of %s %s do not match the schemas of the cluster: %s", resource.Kind, resource.Name, strings.Join(violations, "; "))
+			conditions.MarkFalse(clusterResourceSet, addonsv1.ResourcesAppliedCondition, addonsv1.SchemaValidationFailedReason, clusterv1.ConditionSeverityWarning, err.Error())
+			errList = append(errList, err)
+			return kerrors.NewAggregate(errList)
+		}
 	}
 
-	// Initialize the patch helper.
-	patchHelper, err := patch.NewHelper(clusterResourceSetBinding, r.Client)
-	if err != nil {
-		return err
+	// Skip resources whose objects do not fit in the ResourceQuotas of the cluster, rather than creating only some of them.
+	if clusterResourceSet.Spec.CheckQuotas && resource.Mode != string(addonsv1.PatchClusterResourceSetResourceMode) {
+		shortages, err := quotaShortages(ctx, remoteClient, dataList)
+		if err != nil {
+			logger.Error(err, "Failed to check ResourceQuotas for objects of resource")
+		}
+		if len(shortages) > 0 {
+			err := errors.Errorf("insufficient quota to apply %s %s: %s", resource.Kind, resource.Name, strings.Join(shortages, ", "))
+			conditions.MarkFalse(clusterResourceSet, addonsv1.ResourcesAppliedCondition, addonsv1.QuotaInsufficientReason, clusterv1.ConditionSeverityWarning, err.Error())
+			errList = append(errList, err)
+			return kerrors.NewAggregate(errList)
+		}
 	}
 
-	defer func() {
-		// Always attempt to Patch the ClusterResourceSetBinding object after each reconciliation.
-		if err := patchHelper.Patch(ctx, clusterResourceSetBinding); err != nil {
-			r.Log.Error(err, "failed to patch config")
+	// Apply all values in the key-value pair of the resource to the cluster.
+	// As there can be multiple key-value pairs in a resource, each value may have multiple objects in it.
+	isSuccessful, fieldConflict := true, false
+	var lastReplacedTime *metav1.Time
+	if previousBinding != nil {
+		lastReplacedTime = previousBinding.LastReplacedTime
+	}
+	onReplace := func(obj *unstructured.Unstructured) {
+		lastReplacedTime = &metav1.Time{Time: time.Now().UTC()}
+		logger.Info("Replaced object with changed immutable fields", "kind", obj.GetKind(), "namespace", obj.GetNamespace(), "name", obj.GetName())
+		r.recorder.Eventf(clusterResourceSet, corev1.EventTypeNormal, "ObjectReplaced", "Replaced %s %s/%s in cluster %s because immutable fields changed",
+			obj.GetKind(), obj.GetNamespace(), obj.GetName(), cluster.Name)
+	}
+	changes := []objectChange{}
+	onChange := func(change objectChange) {
+		changes = append(changes, change)
+	}
+	// With SortByKind, the objects of all the values are applied together, in the order of their kinds.
+	applyList := dataList
+	sortByKind := clusterResourceSet.Spec.SortByKind && resource.Mode != string(addonsv1.PatchClusterResourceSetResourceMode)
+	if sortByKind {
+		if applyList, err = sortDataByKind(dataList); err != nil {
+			conditions.MarkFalse(clusterResourceSet, addonsv1.ResourcesAppliedCondition, addonsv1.ApplyFailedReason, clusterv1.ConditionSeverityWarning, err.Error())
+			errList = append(errList, err)
+			return kerrors.NewAggregate(errList)
 		}
-	}()
+	}
 
-	errList := []error{}
-	resourceSetBinding := clusterResourceSetBinding.GetOrCreateBinding(clusterResourceSet)
+	applyStart := time.Now()
+	for i := range applyList {
+		data := applyList[i]
 
-	// Iterate all resources and apply them to the cluster and update the resource status in the ClusterResourceSetBinding object.
-	for _, resource := range clusterResourceSet.Spec.Resources {
-		// If resource is already applied successfully and clusterResourceSet mode is "ApplyOnce", continue. (No need to check hash changes here)
-		if resourceSetBinding.IsApplied(resource) {
+		if data, err = r.renderObjects(data, cluster, clusterResourceSet, resource); err != nil {
+			isSuccessful = false
+			logger.Error(err, "failed to render ClusterResourceSet resource", logKeyOutcome, outcomeFailed)
+			conditions.MarkFalse(clusterResourceSet, addonsv1.ResourcesAppliedCondition, addonsv1.ApplyFailedReason, clusterv1.ConditionSeverityWarning, err.Error())
+			errList = append(errList, err)
 			continue
 		}
 
-		unstructuredObj, err := r.getResource(resource, cluster.GetNamespace())
+		if resource.Mode == string(addonsv1.PatchClusterResourceSetResourceMode) {
+			err = patchObjects(ctx, remoteClient, data)
+		} else {
+			err = apply(ctx, remoteClient, data, applyOptions{
+				updateExisting:          reappliesOnChange(clusterResourceSet),
+				conflictRetries:         r.ApplyConflictRetries,
+				forceOwnership:          r.forcesOwnership(resource),
+				threeWayMerge:           clusterResourceSet.Spec.ApplyMode == string(addonsv1.ThreeWayMergeClusterResourceSetApplyMode),
+				sortByKind:              sortByKind,
+				replaceImmutable:        resource.Mode == string(addonsv1.ReplaceClusterResourceSetResourceMode),
+				deletePropagationPolicy: clusterResourceSet.Spec.GetDeletePropagationPolicy(),
+				onReplace:               onReplace,
+				onChange:                onChange,
+				retryableStatusCodes:    r.retryableStatusCodes(),
+			})
+		}
 		if err != nil {
-			if err == ErrSecretTypeNotSupported {
-				conditions.MarkFalse(clusterResourceSet, addonsv1.ResourcesAppliedCondition, addonsv1.WrongSecretTypeReason, clusterv1.ConditionSeverityWarning, err.Error())
+			isSuccessful = false
+			logger.Error(err, "failed to apply ClusterResourceSet resource", logKeyOutcome, outcomeFailed)
+			if isFieldConflict(err) {
+				fieldConflict = true
+				conditions.MarkFalse(clusterResourceSet, addonsv1.ResourcesAppliedCondition, addonsv1.FieldConflictReason, clusterv1.ConditionSeverityWarning, applyErrorMessage(err))
 			} else {
-				conditions.MarkFalse(clusterResourceSet, addonsv1.ResourcesAppliedCondition, addonsv1.RetrievingResourceFailedReason, clusterv1.ConditionSeverityWarning, err.Error())
+				switch classifyApplyError(err) {
+				case transientApplyError:
+					conditions.MarkFalse(clusterResourceSet, addonsv1.ResourcesAppliedCondition, addonsv1.TransientApplyFailedReason, clusterv1.ConditionSeverityWarning, applyErrorMessage(err))
+					err = &transientError{err: err}
+				case permanentApplyError:
+					conditions.MarkFalse(clusterResourceSet, addonsv1.ResourcesAppliedCondition, addonsv1.PermanentApplyFailedReason, clusterv1.ConditionSeverityError, applyErrorMessage(err))
+				default:
+					conditions.MarkFalse(clusterResourceSet, addonsv1.ResourcesAppliedCondition, addonsv1.ApplyFailedReason, clusterv1.ConditionSeverityWarning, applyErrorMessage(err))
+				}
 			}
 			errList = append(errList, err)
-			continue
 		}
+	}
 
-		// Set status in ClusterResourceSetBinding in case of early continue due to a failure.
-		// Set only when resource is retrieved successfully.
-		resourceSetBinding.SetBinding(addonsv1.ResourceBinding{
-			ResourceRef:     resource,
-			Hash:            "",
-			Applied:         false,
-			LastAppliedTime: &metav1.Time{Time: time.Now().UTC()},
-		})
-
-		if err := r.patchOwnerRefToResource(ctx, clusterResourceSet, unstructuredObj); err != nil {
-			logger.Error(err, "Failed to patch ClusterResourceSet as resource owner reference",
-				"Resource type", unstructuredObj.GetKind(), "Resource name", unstructuredObj.GetName())
+	// With WaitForReady, resources are only recorded as applied once their objects are ready.
+	var notReadySince *metav1.Time
+	var requeueErr error
+	if isSuccessful && clusterResourceSet.Spec.WaitForReady && resource.ReadyWhen != nil {
+		notReady, err := objectsNotReady(ctx, remoteClient, dataList, resource.ReadyWhen)
+		switch {
+		case err != nil:
+			isSuccessful = false
+			logger.Error(err, "failed to check readiness of ClusterResourceSet resource", logKeyOutcome, outcomeFailed)
+			conditions.MarkFalse(clusterResourceSet, addonsv1.ResourcesAppliedCondition, addonsv1.ResourceNotReadyReason, clusterv1.ConditionSeverityWarning, err.Error())
 			errList = append(errList, err)
+		case len(notReady) > 0:
+			isSuccessful = false
+			notReadySince = &metav1.Time{Time: time.Now().UTC()}
+			if previousBinding != nil && previousBinding.NotReadySince != nil {
+				notReadySince = previousBinding.NotReadySince
+			}
+			if timeout := clusterResourceSet.Spec.GetReadyTimeout(); time.Since(notReadySince.Time) < timeout {
+				logger.V(4).Info("Objects of resource are not ready yet", logKeyOutcome, outcomeRequeued, "objects", notReady)
+				conditions.MarkFalse(clusterResourceSet, addonsv1.ResourcesAppliedCondition, addonsv1.ResourceNotReadyReason, clusterv1.ConditionSeverityInfo,
+					"Waiting for %s of %s %s to be ready", strings.Join(notReady, ", "), resource.Kind, resource.Name)
+				requeueErr = errors.Wrapf(&capierrors.RequeueAfterError{RequeueAfter: readyRequeueAfter}, "%s %s is not ready", resource.Kind, resource.Name)
+			} else {
+				err := errors.Errorf("%s of %s %s not ready after %s", strings.Join(notReady, ", "), resource.Kind, resource.Name, timeout)
+				conditions.MarkFalse(clusterResourceSet, addonsv1.ResourcesAppliedCondition, addonsv1.ResourceNotReadyReason, clusterv1.ConditionSeverityWarning, err.Error())
+				errList = append(errList, err)
+			}
 		}
+	}
 
-		// Since maps are not ordered, we need to order them to get the same hash at each reconcile.
-		keys := make([]string, 0)
-		data, ok := unstructuredObj.UnstructuredContent()["data"]
-		if !ok {
-			errList = append(errList, errors.New("failed to get data field from the resource"))
-			continue
-		}
-
-		unstructuredData := data.(map[string]interface{})
-		for key := range unstructuredData {
-			keys = append(keys, key)
+	resourceBinding := addonsv1.ResourceBinding{
+		ResourceRef:       resource,
+		SourceNamespace:   unstructuredObj.GetNamespace(),
+		SourceUID:         unstructuredObj.GetUID(),
+		Hash:              hash,
+		Applied:           isSuccessful,
+		LastAppliedTime:   &metav1.Time{Time: time.Now().UTC()},
+		LastApplyDuration: &metav1.Duration{Duration: time.Since(applyStart)},
+		FieldConflict:     fieldConflict,
+		NotReadySince:     notReadySince,
+		LastReplacedTime:  lastReplacedTime,
+		DriftCount:        driftCount,
+	}
+	// Patches do not report their changes.
+	if resource.Mode != string(addonsv1.PatchClusterResourceSetResourceMode) {
+		resourceBinding.LastApplyChanges = summarizeChanges(changes)
+	}
+	if isSuccessful {
+		resourceBinding.AppliedGeneration = clusterResourceSet.Generation
+	}
+	// The objects applied previously are still in the cluster when applying the resource again fails.
+	switch {
+	case resource.Mode == string(addonsv1.PatchClusterResourceSetResourceMode):
+		// Patches do not create objects.
+	case isSuccessful:
+		resourceBinding.AppliedBytes = dataSize(dataList)
+		if count, err := objectCount(dataList); err == nil {
+			resourceBinding.AppliedObjects = int32(count)
 		}
-		sort.Strings(keys)
+	case previousBinding != nil:
+		resourceBinding.AppliedBytes = previousBinding.AppliedBytes
+		resourceBinding.AppliedObjects = previousBinding.AppliedObjects
+	}
+	resourceSetBinding.SetBinding(resourceBinding)
 
-		dataList := make([][]byte, 0)
-		for _, key := range keys {
-			val, ok, err := unstructured.NestedString(unstructuredData, key)
-			if !ok || err != nil {
-				errList = append(errList, errors.New("failed to get value field from the resource"))
-				continue
-			}
+	if requeueErr != nil && len(errList) == 0 {
+		return requeueErr
+	}
 
-			byteArr := []byte(val)
-			// If the resource is a Secret, data needs to be decoded.
-			if unstructuredObj.GetKind() == string(addonsv1.SecretClusterResourceSetResourceKind) {
-				byteArr, _ = base64.StdEncoding.DecodeString(val)
-			}
+	if isSuccessful {
+		r.Log.V(4).Info("Applied resource to cluster", logKeyCRSName, clusterResourceSet.Name, logKeyCRSNamespace, clusterResourceSet.Namespace,
+			logKeyClusterName, cluster.Name, logKeyResourceKind, resource.Kind, logKeyResourceName, resource.Name, logKeyOutcome, outcomeApplied)
+	}
 
-			dataList = append(dataList, byteArr)
+	// Per-resource events are only emitted at higher verbosity to keep the ClusterResourceSet's event stream concise.
+	if isSuccessful && r.Log.V(4).Enabled() {
+		message := fmt.Sprintf("Applied %s %s to cluster %s", resource.Kind, resource.Name, cluster.Name)
+		if resourceBinding.LastApplyChanges != "" {
+			message += ": " + resourceBinding.LastApplyChanges
 		}
+		r.recorder.Event(clusterResourceSet, corev1.EventTypeNormal, "ResourceApplied", message)
+	}
 
-		// Apply all values in the key-value pair of the resource to the cluster.
-		// As there can be multiple key-value pairs in a resource, each value may have multiple objects in it.
-		isSuccessful := true
-		for i := range dataList {
-			data := dataList[i]
+	return kerrors.NewAggregate(errList)
+}
 
-			if err := apply(ctx, remoteClient, data); err != nil {
-				isSuccessful = false
-				logger.Error(err, "failed to apply ClusterResourceSet resource", "Resource kind", resource.Kind, "Resource name", resource.Name)
-				conditions.MarkFalse(clusterResourceSet, addonsv1.ResourcesAppliedCondition, addonsv1.ApplyFailedReason, clusterv1.ConditionSeverityWarning, err.Error())
-				errList = append(errList, err)
+// resourceDrift returns the objects of the resource that drifted in the cluster since they were applied. Drift is only
+// corrected with the Reconcile strategy, and never for patches, which do not own the objects they modify.
+// The ignored fields of the resource, e.g. replicas managed by an autoscaler, are not considered drift.
+func (r *ClusterResourceSetReconciler) resourceDrift(ctx context.Context, remoteClient client.Client, cluster *clusterv1.Cluster, clusterResourceSet *addonsv1.ClusterResourceSet, resource addonsv1.ResourceRef, dataList [][]byte, ignored []string) ([]string, error) {
+	if !reconcileStrategyEnabled(clusterResourceSet) || resource.Mode == string(addonsv1.PatchClusterResourceSetResourceMode) {
+		return nil, nil
+	}
+
+	// The objects are compared with the objects as they are applied.
+	if r.ResourceTransformer != nil {
+		transformed := make([][]byte, 0, len(dataList))
+		for _, data := range dataList {
+			data, err := transformObjects(data, cluster, r.ResourceTransformer)
+			if err != nil {
+				return nil, err
 			}
+			transformed = append(transformed, data)
 		}
-
-		resourceSetBinding.SetBinding(addonsv1.ResourceBinding{
-			ResourceRef:     resource,
-			Hash:            computeHash(dataList),
-			Applied:         isSuccessful,
-			LastAppliedTime: &metav1.Time{Time: time.Now().UTC()},
-		})
-	}
-	if len(errList) > 0 {
-		return kerrors.NewAggregate(errList)
+		dataList = transformed
 	}
+	return driftedObjects(ctx, remoteClient, dataList, ignored)
+}
 
-	conditions.MarkTrue(clusterResourceSet, addonsv1.ResourcesAppliedCondition)
-
-	return nil
+// forcesOwnership returns true if conflicts with other field managers are resolved by taking the ownership of the fields
+// when updating the objects of the resource. Resources without a conflict policy use the controller's configuration.
+func (r *ClusterResourceSetReconciler) forcesOwnership(resource addonsv1.ResourceRef) bool {
+	switch addonsv1.ClusterResourceSetConflictPolicy(resource.ConflictPolicy) {
+	case addonsv1.ForceClusterResourceSetConflictPolicy:
+		return true
+	case addonsv1.RespectClusterResourceSetConflictPolicy:
+		return false
+	default:
+		return r.ForceOwnershipOnConflict
+	}
 }
 
 // getResource retrieves the requested resource and convert it to unstructured type.
+// The resource is looked up in the cluster's namespace first and, if it is not found there, in the shared namespace if configured.
+func (r *ClusterResourceSetReconciler) getResource(ctx context.Context, resourceRef addonsv1.ResourceRef, namespace string) (*unstructured.Unstructured, error) {
+	obj, err := r.getResourceFromNamespace(ctx, resourceRef, namespace)
+	if apierrors.IsNotFound(err) && r.SharedNamespace != "" && r.SharedNamespace != namespace {
+		return r.getResourceFromNamespace(ctx, resourceRef, r.SharedNamespace)
+	}
+	return obj, err
+}
+
+// getResourceFromNamespace retrieves the requested resource from the given namespace and convert it to unstructured type.
 // Unsupported resource kinds are not denied by validation webhook, hence no need to check here.
-// Only supports Secrets/Configmaps as resource types and allow using resources in the same namespace with the cluster.
-func (r *ClusterResourceSetReconciler) getResource(resourceRef addonsv1.ResourceRef, namespace string) (*unstructured.Unstructured, error) {
+// Supports Secrets, ConfigMaps, OCI artifacts and Git repositories as resource types. The content of OCI artifacts and
+// the files of Git repositories are returned as the data of an unstructured object, so that they are processed like the
+// data of Secrets and ConfigMaps.
+func (r *ClusterResourceSetReconciler) getResourceFromNamespace(ctx context.Context, resourceRef addonsv1.ResourceRef, namespace string) (*unstructured.Unstructured, error) {
 	resourceName := types.NamespacedName{Name: resourceRef.Name, Namespace: namespace}
 
 	var resourceInterface interface{}
 	switch resourceRef.Kind {
 	case string(addonsv1.ConfigMapClusterResourceSetResourceKind):
-		resourceConfigMap, err := getConfigMap(context.Background(), r.Client, resourceName)
+		if resourceRef.Selector != nil {
+			return getSelectedConfigMaps(ctx, r.Client, resourceRef, namespace)
+		}
+		resourceConfigMap, err := getConfigMap(ctx, r.Client, resourceName)
 		if err != nil {
 			return nil, err
 		}
 
 		resourceInterface = resourceConfigMap.DeepCopyObject()
 	case string(addonsv1.SecretClusterResourceSetResourceKind):
-		resourceSecret, err := getSecret(context.Background(), r.Client, resourceName)
+		resourceSecret, err := getSecret(ctx, r.Client, resourceName)
 		if err != nil {
 			return nil, err
 		}
 
-		if resourceSecret.Type != addonsv1.ClusterResourceSetSecretType {
-			return nil, ErrSecretTypeNotSupported
+		if err := r.checkSourceSecret(resourceSecret); err != nil {
+			return nil, err
 		}
 
 		resourceInterface = resourceSecret.DeepCopyObject()
+	case string(addonsv1.OCIArtifactClusterResourceSetResourceKind):
+		bundle, err := r.pullOCIArtifact(ctx, resourceRef, namespace)
+		if err != nil {
+			return nil, &ociPullError{err: err}
+		}
+
+		return &unstructured.Unstructured{Object: map[string]interface{}{
+			"data": map[string]interface{}{"bundle": string(bundle)},
+		}}, nil
+	case string(addonsv1.GitRepositoryClusterResourceSetResourceKind):
+		files, err := r.fetchGitRepository(ctx, resourceRef, namespace)
+		if err != nil {
+			gitErr, ok := errors.Cause(err).(*gitFetchError)
+			return nil, &gitFetchError{err: err, auth: ok && gitErr.auth}
+		}
+
+		data := make(map[string]interface{}, len(files))
+		for name, content := range files {
+			data[name] = string(content)
+		}
+		return &unstructured.Unstructured{Object: map[string]interface{}{"data": data}}, nil
 	}
 
 	raw, err := runtime.DefaultUnstructuredConverter.ToUnstructured(resourceInterface)
@@ -328,8 +2412,117 @@ func (r *ClusterResourceSetReconciler) getResource(resourceRef addonsv1.Resource
 	return &unstructured.Unstructured{Object: raw}, nil
 }
 
+// pullOCIArtifact pulls the manifest bundle of an OCI artifact resource, using the credentials of its pull secret
+// in the given namespace if set.
+func (r *ClusterResourceSetReconciler) pullOCIArtifact(ctx context.Context, resourceRef addonsv1.ResourceRef, namespace string) ([]byte, error) {
+	ref, err := parseOCIReference(resourceRef.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	var creds *ociCredentials
+	if resourceRef.PullSecretName != "" {
+		secret, err := getSecret(ctx, r.Client, types.NamespacedName{Name: resourceRef.PullSecretName, Namespace: namespace})
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to get pull secret for %s", resourceRef.Name)
+		}
+		// Pull secrets must be of the kubernetes.io/dockerconfigjson type, and always carry the source label, as their
+		// credentials are sent to the registry named by the ClusterResourceSet, which is not necessarily the one they
+		// are meant for.
+		if secret.Labels[addonsv1.ClusterResourceSetSourceLabel] != "true" {
+			return nil, ErrSecretSourceLabelMissing
+		}
+		if creds, err = ociCredentialsFromSecret(secret, ref.registry); err != nil {
+			return nil, err
+		}
+	}
+
+	r.ociOnce.Do(func() {
+		if r.oci == nil {
+			r.oci = newOCIClient(&http.Client{Timeout: remoteSourceTimeout})
+		}
+	})
+	return r.oci.pull(ctx, resourceRef.Name, creds)
+}
+
+// fetchGitRepository fetches the files of a Git repository resource, using the credentials of its Secret in the given
+// namespace if set.
+func (r *ClusterResourceSetReconciler) fetchGitRepository(ctx context.Context, resourceRef addonsv1.ResourceRef, namespace string) (map[string][]byte, error) {
+	source := resourceRef.Git
+	if source == nil {
+		return nil, errors.Errorf("GitRepository %s has no repository", resourceRef.Name)
+	}
+
+	var creds *gitCredentials
+	if source.SecretName != "" {
+		secret, err := getSecret(ctx, r.Client, types.NamespacedName{Name: source.SecretName, Namespace: namespace})
+		if err != nil {
+			return nil, &gitFetchError{err: errors.Wrapf(err, "failed to get Git secret for %s", resourceRef.Name), auth: true}
+		}
+		// The credentials Secret is subject to the same restrictions as Secret resources, otherwise any Secret in the
+		// namespace could be sent to an arbitrary Git server.
+		if err := r.checkSourceSecret(secret); err != nil {
+			return nil, err
+		}
+		if creds, err = gitCredentialsFromSecret(secret); err != nil {
+			return nil, &gitFetchError{err: err, auth: true}
+		}
+	}
+
+	r.gitOnce.Do(func() {
+		if r.git == nil {
+			r.git = newGitClient(&http.Client{Timeout: remoteSourceTimeout})
+		}
+	})
+	commit, files, err := r.git.fetch(ctx, source.URL, source.Ref, source.Path, creds)
+	if err != nil {
+		return nil, err
+	}
+	r.Log.V(4).Info("Fetched Git repository", logKeyResourceKind, resourceRef.Kind, logKeyResourceName, resourceRef.Name, "url", source.URL, "commit", commit)
+	return files, nil
+}
+
+// retryableStatusCodes returns the status codes applying an object is retried for.
+func (r *ClusterResourceSetReconciler) retryableStatusCodes() []int {
+	if r.RetryableStatusCodes == nil {
+		return defaultRetryableStatusCodes
+	}
+	return r.RetryableStatusCodes
+}
+
+// checkSourceSecret returns an error if the Secret is not allowed to be read as a source of a ClusterResourceSet because
+// of its type or a missing source label.
+func (r *ClusterResourceSetReconciler) checkSourceSecret(secret *corev1.Secret) error {
+	if !r.isAcceptedSecretType(secret.Type) {
+		return ErrSecretTypeNotSupported
+	}
+	if r.RequireSecretSourceLabel && secret.Labels[addonsv1.ClusterResourceSetSourceLabel] != "true" {
+		return ErrSecretSourceLabelMissing
+	}
+	return nil
+}
+
+// isAcceptedSecretType returns true if Secrets of the given type can be used as resources.
+func (r *ClusterResourceSetReconciler) isAcceptedSecretType(secretType corev1.SecretType) bool {
+	if len(r.AcceptedSecretTypes) == 0 {
+		return secretType == addonsv1.ClusterResourceSetSecretType
+	}
+	for _, t := range r.AcceptedSecretTypes {
+		if string(secretType) == t {
+			return true
+		}
+	}
+	return false
+}
+
 // patchOwnerRefToResource adds the ClusterResourceSet as a OwnerReference to the resource.
+// Owner references cannot point across namespaces or from cluster-scoped objects to namespaced ones, hence resources
+// that are not in the ClusterResourceSet's namespace, e.g. the ones from the shared namespace, get a provenance label instead.
 func (r *ClusterResourceSetReconciler) patchOwnerRefToResource(ctx context.Context, clusterResourceSet *addonsv1.ClusterResourceSet, resource *unstructured.Unstructured) error {
+	if resource.GetNamespace() != clusterResourceSet.Namespace {
+		return r.patchProvenanceLabelToResource(ctx, clusterResourceSet, resource)
+	}
+
 	newRef := metav1.OwnerReference{
 		APIVersion: clusterResourceSet.GroupVersionKind().GroupVersion().String(),
 		Kind:       clusterResourceSet.GroupVersionKind().Kind,
@@ -347,6 +2540,30 @@ func (r *ClusterResourceSetReconciler) patchOwnerRefToResource(ctx context.Conte
 	return nil
 }
 
+// patchProvenanceLabelToResource adds a label identifying the ClusterResourceSet to the resource.
+// The label key contains the ClusterResourceSet's UID, so that a resource can be labeled by multiple ClusterResourceSets,
+// and the value is the ClusterResourceSet's name when it is a valid label value.
+func (r *ClusterResourceSetReconciler) patchProvenanceLabelToResource(ctx context.Context, clusterResourceSet *addonsv1.ClusterResourceSet, resource *unstructured.Unstructured) error {
+	key := addonsv1.ClusterResourceSetProvenanceLabelPrefix + string(clusterResourceSet.GetUID())
+	value := clusterResourceSet.GetName()
+	if len(validation.IsValidLabelValue(value)) > 0 {
+		value = ""
+	}
+
+	labels := resource.GetLabels()
+	if current, ok := labels[key]; ok && current == value {
+		return nil
+	}
+
+	patch := client.MergeFrom(resource.DeepCopy())
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	labels[key] = value
+	resource.SetLabels(labels)
+	return r.Client.Patch(ctx, resource, patch)
+}
+
 // clusterToClusterResourceSet is mapper function that maps clusters to ClusterResourceSet
 func (r *ClusterResourceSetReconciler) clusterToClusterResourceSet(o handler.MapObject) []ctrl.Request {
 	result := []ctrl.Request{}
@@ -363,27 +2580,103 @@ func (r *ClusterResourceSetReconciler) clusterToClusterResourceSet(o handler.Map
 		return nil
 	}
 
-	labels := labels.Set(cluster.GetLabels())
 	for i := range resourceList.Items {
 		rs := &resourceList.Items[i]
 
-		selector, err := metav1.LabelSelectorAsSelector(&rs.Spec.ClusterSelector)
-		if err != nil {
-			r.Log.Error(err, "unable to convert ClusterSelector to selector")
-			return nil
+		if reason := clusterNotSelectedReason(rs, cluster); reason != "" {
+			r.Log.V(4).Info("Cluster is not selected by ClusterResourceSet", logKeyClusterName, cluster.Name, logKeyCRSNamespace, cluster.Namespace,
+				logKeyCRSName, rs.Name, "reason", reason)
+			continue
 		}
 
-		// If a ClusterResourceSet has a nil or empty selector, it should match nothing, not everything.
-		if selector.Empty() {
-			return nil
+		name := client.ObjectKey{Namespace: rs.Namespace, Name: rs.Name}
+		result = append(result, ctrl.Request{NamespacedName: name})
+	}
+	return result
+}
+
+// secretToClusterResourceSet is mapper function that maps a Secret to the ClusterResourceSets using it as a resource,
+// or as the override of a resource.
+// Secrets in the shared namespace can be used by ClusterResourceSets in every namespace.
+func (r *ClusterResourceSetReconciler) secretToClusterResourceSet(o handler.MapObject) []ctrl.Request {
+	result := []ctrl.Request{}
+
+	secret, ok := o.Object.(*corev1.Secret)
+	if !ok {
+		r.Log.Error(nil, fmt.Sprintf("Expected a Secret but got a %T", o.Object))
+		return nil
+	}
+
+	listOpts := []client.ListOption{}
+	if r.SharedNamespace == "" || secret.Namespace != r.SharedNamespace {
+		listOpts = append(listOpts, client.InNamespace(secret.Namespace))
+	}
+	resourceList := &addonsv1.ClusterResourceSetList{}
+	if err := r.Client.List(context.Background(), resourceList, listOpts...); err != nil {
+		r.Log.Error(err, "failed to list ClusterResourceSet")
+		return nil
+	}
+
+	for i := range resourceList.Items {
+		rs := &resourceList.Items[i]
+		for _, resource := range rs.Spec.Resources {
+			if resource.Kind != string(addonsv1.SecretClusterResourceSetResourceKind) {
+				continue
+			}
+			if resource.Name == secret.Name || (resource.ClusterOverrides && strings.HasPrefix(secret.Name, resource.Name+"-override-")) {
+				result = append(result, ctrl.Request{NamespacedName: client.ObjectKey{Namespace: rs.Namespace, Name: rs.Name}})
+				break
+			}
 		}
+	}
+	return result
+}
+
+// clusterResourceSetToLowerPriority is mapper function that maps a ClusterResourceSet to the ClusterResourceSets in
+// its namespace with a lower priority, which may be waiting for it.
+func (r *ClusterResourceSetReconciler) clusterResourceSetToLowerPriority(o handler.MapObject) []ctrl.Request {
+	result := []ctrl.Request{}
+
+	clusterResourceSet, ok := o.Object.(*addonsv1.ClusterResourceSet)
+	if !ok {
+		r.Log.Error(nil, fmt.Sprintf("Expected a ClusterResourceSet but got a %T", o.Object))
+		return nil
+	}
+
+	resourceList := &addonsv1.ClusterResourceSetList{}
+	if err := r.Client.List(context.Background(), resourceList, client.InNamespace(clusterResourceSet.Namespace)); err != nil {
+		r.Log.Error(err, "failed to list ClusterResourceSet")
+		return nil
+	}
 
-		if !selector.Matches(labels) {
+	for i := range resourceList.Items {
+		rs := &resourceList.Items[i]
+		if rs.Spec.Priority >= clusterResourceSet.Spec.Priority || len(rs.Spec.Resources) == 0 {
 			continue
 		}
-
-		name := client.ObjectKey{Namespace: rs.Namespace, Name: rs.Name}
-		result = append(result, ctrl.Request{NamespacedName: name})
+		result = append(result, ctrl.Request{NamespacedName: client.ObjectKey{Namespace: rs.Namespace, Name: rs.Name}})
 	}
 	return result
 }
+
+// resourcesAppliedBecameTrue returns true if the ResourcesApplied condition of the updated ClusterResourceSet became
+// true, i.e. if it applied all its resources to all the matching clusters.
+func resourcesAppliedBecameTrue(e event.UpdateEvent) bool {
+	oldClusterResourceSet, ok := e.ObjectOld.(*addonsv1.ClusterResourceSet)
+	if !ok {
+		return false
+	}
+	newClusterResourceSet, ok := e.ObjectNew.(*addonsv1.ClusterResourceSet)
+	if !ok {
+		return false
+	}
+	return !conditions.IsTrue(oldClusterResourceSet, addonsv1.ResourcesAppliedCondition) &&
+		conditions.IsTrue(newClusterResourceSet, addonsv1.ResourcesAppliedCondition)
+}
+
+// secretCreated passes the events of created Secrets. The type of a Secret is immutable, hence a Secret whose type is
+// fixed is deleted and created again rather than updated, and updates are filtered out.
+var secretCreated = predicate.Funcs{
+	CreateFunc: func(event.CreateEvent) bool { return true },
+	UpdateFunc: func(event.UpdateEvent) bool { return false },
+}
@@ -26,9 +26,11 @@ import (
 	. "github.com/onsi/gomega"
 
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
 	addonsv1 "sigs.k8s.io/cluster-api/exp/addons/api/v1alpha3"
+	"sigs.k8s.io/cluster-api/util/conditions"
 )
 
 const (
@@ -113,6 +115,8 @@ apiVersion: v1`,
 					MatchLabels: labels,
 				},
 				Resources: []addonsv1.ResourceRef{{Name: configmapName, Kind: "ConfigMap"}},
+				// The test cluster's kubeconfig points at the test environment, which is also the management cluster.
+				AllowManagementCluster: true,
 			},
 		}
 		// Create the ClusterResourceSet.
@@ -162,6 +166,9 @@ apiVersion: v1`,
 				ClusterSelector: metav1.LabelSelector{
 					MatchLabels: labels,
 				},
+				Resources: []addonsv1.ResourceRef{{Name: "test-configmap", Kind: "ConfigMap"}},
+				// The test cluster's kubeconfig points at the test environment, which is also the management cluster.
+				AllowManagementCluster: true,
 			},
 		}
 		// Create the ClusterResourceSet.
@@ -194,4 +201,43 @@ apiVersion: v1`,
 		}, timeout).Should(BeTrue())
 	})
 
+	It("Should not create a ClusterResourceSetBinding for a ClusterResourceSet without resources", func() {
+		labels := map[string]string{"foo": "bar"}
+		testCluster.SetLabels(labels)
+		Expect(testEnv.Update(ctx, testCluster)).To(Succeed())
+
+		clusterResourceSetInstance := &addonsv1.ClusterResourceSet{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "test-clusterresourceset",
+				Namespace: defaultNamespaceName,
+			},
+			Spec: addonsv1.ClusterResourceSetSpec{
+				ClusterSelector: metav1.LabelSelector{
+					MatchLabels: labels,
+				},
+				// The test cluster's kubeconfig points at the test environment, which is also the management cluster.
+				AllowManagementCluster: true,
+			},
+		}
+		// Create the ClusterResourceSet.
+		Expect(testEnv.Create(ctx, clusterResourceSetInstance)).To(Succeed())
+		defer func() {
+			Expect(testEnv.Delete(ctx, clusterResourceSetInstance)).To(Succeed())
+		}()
+
+		By("Verifying the ClusterResourceSet is marked as empty")
+		Eventually(func() bool {
+			crs := &addonsv1.ClusterResourceSet{}
+			if err := testEnv.Get(ctx, util.ObjectKey(clusterResourceSetInstance), crs); err != nil {
+				return false
+			}
+			return conditions.IsTrue(crs, addonsv1.EmptyCondition)
+		}, timeout).Should(BeTrue())
+
+		By("Verifying no ClusterResourceSetBinding is created")
+		binding := &addonsv1.ClusterResourceSetBinding{}
+		err := testEnv.Get(ctx, util.ObjectKey(testCluster), binding)
+		Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	})
+
 })
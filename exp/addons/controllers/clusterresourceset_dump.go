@@ -0,0 +1,115 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
+	addonsv1 "sigs.k8s.io/cluster-api/exp/addons/api/v1alpha3"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+)
+
+// manifestsKey is the key of the Secrets holding the manifests dumped for a cluster.
+const manifestsKey = "manifests.yaml"
+
+// manifestsSecretName returns the name of the Secret the manifests of the ClusterResourceSet for a cluster are dumped to.
+func manifestsSecretName(clusterResourceSet *addonsv1.ClusterResourceSet, clusterName string) string {
+	return fmt.Sprintf("%s-manifests-%s", clusterResourceSet.Name, clusterName)
+}
+
+// renderManifests returns the objects of the ClusterResourceSet's resources as they are applied to the cluster, as a
+// multi-document YAML. Each object is preceded by a comment naming the resource it comes from.
+func (r *ClusterResourceSetReconciler) renderManifests(ctx context.Context, cluster *clusterv1.Cluster, clusterResourceSet *addonsv1.ClusterResourceSet) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	for _, resource := range uniqueResources(clusterResourceSet.Spec.Resources) {
+		unstructuredObj, err := r.getResource(ctx, resource, cluster.Namespace)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to get %s %s", resource.Kind, resource.Name)
+		}
+		dataList, err := r.targetData(ctx, unstructuredObj, cluster, clusterResourceSet, resource)
+		if err != nil {
+			return nil, err
+		}
+		for _, data := range dataList {
+			rendered, err := r.renderObjects(data, cluster, clusterResourceSet, resource)
+			if err != nil {
+				return nil, err
+			}
+			objs, err := parseObjects(rendered)
+			if err != nil {
+				return nil, err
+			}
+			for i := range objs {
+				out, err := yaml.Marshal(objs[i].Object)
+				if err != nil {
+					return nil, errors.Wrapf(err, "failed to marshal object of %s %s", resource.Kind, resource.Name)
+				}
+				fmt.Fprintf(buf, "---\n# %s/%s\n%s", resource.Kind, resource.Name, out)
+			}
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// dumpManifests writes the manifests the ClusterResourceSet applies to the named cluster to a Secret owned by the
+// ClusterResourceSet.
+func (r *ClusterResourceSetReconciler) dumpManifests(ctx context.Context, clusterResourceSet *addonsv1.ClusterResourceSet, clusterName string) error {
+	cluster := &clusterv1.Cluster{}
+	if err := r.Client.Get(ctx, client.ObjectKey{Namespace: clusterResourceSet.Namespace, Name: clusterName}, cluster); err != nil {
+		return errors.Wrapf(err, "failed to get cluster %s", clusterName)
+	}
+	manifests, err := r.renderManifests(ctx, cluster, clusterResourceSet)
+	if err != nil {
+		return err
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      manifestsSecretName(clusterResourceSet, clusterName),
+			Namespace: clusterResourceSet.Namespace,
+			Labels:    map[string]string{addonsv1.ClusterResourceSetNameLabel: clusterResourceSet.Name},
+			OwnerReferences: []metav1.OwnerReference{{
+				APIVersion: addonsv1.GroupVersion.String(),
+				Kind:       "ClusterResourceSet",
+				Name:       clusterResourceSet.Name,
+				UID:        clusterResourceSet.UID,
+			}},
+		},
+		Data: map[string][]byte{manifestsKey: manifests},
+	}
+	if err := r.Client.Create(ctx, secret); err != nil {
+		if !apierrors.IsAlreadyExists(err) {
+			return errors.Wrapf(err, "failed to create Secret %s", secret.Name)
+		}
+		existing := &corev1.Secret{}
+		if err := r.Client.Get(ctx, client.ObjectKey{Namespace: secret.Namespace, Name: secret.Name}, existing); err != nil {
+			return errors.Wrapf(err, "failed to get Secret %s", secret.Name)
+		}
+		patch := client.MergeFrom(existing.DeepCopy())
+		existing.Data = secret.Data
+		return errors.Wrapf(r.Client.Patch(ctx, existing, patch), "failed to patch Secret %s", secret.Name)
+	}
+	return nil
+}
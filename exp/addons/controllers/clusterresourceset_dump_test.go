@@ -0,0 +1,90 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
+	addonsv1 "sigs.k8s.io/cluster-api/exp/addons/api/v1alpha3"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+func TestReconcileDumpsManifests(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(corev1.AddToScheme(scheme)).To(Succeed())
+	g.Expect(clusterv1.AddToScheme(scheme)).To(Succeed())
+	g.Expect(addonsv1.AddToScheme(scheme)).To(Succeed())
+
+	cluster := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "cluster", Namespace: "default"}}
+	source := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "resource", Namespace: "default"},
+		Data: map[string]string{"cm": `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: applied
+  namespace: default
+`},
+	}
+	clusterResourceSet := &addonsv1.ClusterResourceSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "crs",
+			Namespace:   "default",
+			Labels:      map[string]string{"team": "a"},
+			Annotations: map[string]string{addonsv1.ClusterResourceSetDumpManifestsAnnotation: "cluster"},
+		},
+		Spec: addonsv1.ClusterResourceSetSpec{
+			ClusterSelector: metav1.LabelSelector{MatchLabels: map[string]string{"foo": "bar"}},
+			Resources:       []addonsv1.ResourceRef{{Kind: "ConfigMap", Name: "resource"}},
+			PropagateLabels: []string{"team"},
+		},
+	}
+	r := &ClusterResourceSetReconciler{
+		Client:   fake.NewFakeClientWithScheme(scheme, cluster, source, clusterResourceSet),
+		Log:      log.Log,
+		scheme:   scheme,
+		recorder: record.NewFakeRecorder(10),
+	}
+
+	_, err := r.Reconcile(ctrl.Request{NamespacedName: client.ObjectKey{Namespace: "default", Name: "crs"}})
+	g.Expect(err).NotTo(HaveOccurred())
+
+	secret := &corev1.Secret{}
+	g.Expect(r.Client.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: "crs-manifests-cluster"}, secret)).To(Succeed())
+	manifests := string(secret.Data[manifestsKey])
+	g.Expect(manifests).To(HavePrefix("---\n# ConfigMap/resource\n"))
+	g.Expect(manifests).To(ContainSubstring("name: applied"))
+	g.Expect(manifests).To(ContainSubstring("team: a"))
+	g.Expect(manifests).To(ContainSubstring(addonsv1.ClusterResourceSetNameLabel + ": crs"))
+
+	// The annotation is cleared once the manifests are dumped.
+	clusterResourceSet = &addonsv1.ClusterResourceSet{}
+	g.Expect(r.Client.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: "crs"}, clusterResourceSet)).To(Succeed())
+	g.Expect(clusterResourceSet.Annotations).NotTo(HaveKey(addonsv1.ClusterResourceSetDumpManifestsAnnotation))
+}
@@ -0,0 +1,222 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
+	addonsv1 "sigs.k8s.io/cluster-api/exp/addons/api/v1alpha3"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// defaultMaxWorkloadEvents is the number of Events read from each workload cluster when MaxWorkloadEvents is not set.
+	defaultMaxWorkloadEvents = 50
+
+	// maxWorkloadEventsInCondition is the number of Events summarized in the message of the WorkloadEvents condition.
+	maxWorkloadEventsInCondition = 5
+
+	// workloadEventsPollInterval is how often the Events of the workload clusters are read again, as they are not watched.
+	workloadEventsPollInterval = 5 * time.Minute
+)
+
+// workloadEvent is a Warning Event of an object applied to a workload cluster.
+type workloadEvent struct {
+	cluster string
+	event   corev1.Event
+}
+
+// String returns a one-line summary of the Event.
+func (e workloadEvent) String() string {
+	object := e.event.InvolvedObject.Kind + " " + e.event.InvolvedObject.Name
+	if e.event.InvolvedObject.Namespace != "" {
+		object = e.event.InvolvedObject.Kind + " " + e.event.InvolvedObject.Namespace + "/" + e.event.InvolvedObject.Name
+	}
+	summary := fmt.Sprintf("%s: %s: %s: %s", e.cluster, object, e.event.Reason, strings.TrimSpace(e.event.Message))
+	if e.event.Count > 1 {
+		summary = fmt.Sprintf("%s (x%d)", summary, e.event.Count)
+	}
+	return summary
+}
+
+// lastSeen returns when the Event was last recorded.
+func (e workloadEvent) lastSeen() time.Time {
+	if !e.event.LastTimestamp.IsZero() {
+		return e.event.LastTimestamp.Time
+	}
+	if !e.event.EventTime.IsZero() {
+		return e.event.EventTime.Time
+	}
+	return e.event.CreationTimestamp.Time
+}
+
+// maxWorkloadEvents returns the number of Events read from each workload cluster.
+func (r *ClusterResourceSetReconciler) maxWorkloadEvents() int {
+	if r.MaxWorkloadEvents > 0 {
+		return r.MaxWorkloadEvents
+	}
+	return defaultMaxWorkloadEvents
+}
+
+// checkWorkloadEvents summarizes the recent Warning Events of the objects applied to the clusters in the WorkloadEvents
+// condition. Reading the Events is best effort: clusters whose Events cannot be read are skipped, as failing to
+// connect to them is already reported by the ClusterReachable condition.
+func (r *ClusterResourceSetReconciler) checkWorkloadEvents(ctx context.Context, clusterResourceSet *addonsv1.ClusterResourceSet, clusters []*clusterv1.Cluster) {
+	if !clusterResourceSet.Spec.ReportWorkloadEvents || clusterResourceSet.Spec.AppliesToManagementCluster() {
+		conditions.Delete(clusterResourceSet, addonsv1.WorkloadEventsCondition)
+		return
+	}
+	logger := r.Log.WithValues(logKeyCRSName, clusterResourceSet.Name, logKeyCRSNamespace, clusterResourceSet.Namespace)
+
+	events := []workloadEvent{}
+	for _, cluster := range clusters {
+		clusterEvents, err := r.clusterWorkloadEvents(ctx, cluster, clusterResourceSet)
+		if err != nil {
+			logger.Error(err, "Failed to read Events of applied objects from cluster", logKeyClusterName, cluster.Name)
+			continue
+		}
+		events = append(events, clusterEvents...)
+	}
+
+	if len(events) == 0 {
+		conditions.MarkTrue(clusterResourceSet, addonsv1.WorkloadEventsCondition)
+		return
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].lastSeen().After(events[j].lastSeen())
+	})
+	summaries := []string{}
+	for i := 0; i < len(events) && i < maxWorkloadEventsInCondition; i++ {
+		summaries = append(summaries, events[i].String())
+	}
+	if len(events) > maxWorkloadEventsInCondition {
+		summaries = append(summaries, fmt.Sprintf("and %d more", len(events)-maxWorkloadEventsInCondition))
+	}
+	conditions.MarkFalse(clusterResourceSet, addonsv1.WorkloadEventsCondition, addonsv1.WorkloadWarningEventsReason, clusterv1.ConditionSeverityWarning,
+		"%d Warning Events recorded for applied objects: %s", len(events), strings.Join(summaries, "; "))
+}
+
+// clusterWorkloadEvents returns the Warning Events of the cluster involving the objects of the resources recorded as
+// applied in its ClusterResourceSetBinding, or objects whose name starts with the name of one of them in the same
+// namespace, e.g. the ReplicaSets and Pods of a Deployment. At most maxWorkloadEvents Events are read from the cluster.
+func (r *ClusterResourceSetReconciler) clusterWorkloadEvents(ctx context.Context, cluster *clusterv1.Cluster, clusterResourceSet *addonsv1.ClusterResourceSet) ([]workloadEvent, error) {
+	clusterResourceSetBinding := &addonsv1.ClusterResourceSetBinding{}
+	if err := r.Client.Get(ctx, client.ObjectKey{Namespace: cluster.Namespace, Name: cluster.Name}, clusterResourceSetBinding); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "failed to get ClusterResourceSetBinding for cluster %s", cluster.Name)
+	}
+	resourceSetBinding := findResourceSetBinding(clusterResourceSetBinding, clusterResourceSet.Name)
+	if resourceSetBinding == nil {
+		return nil, nil
+	}
+
+	// The names of the applied objects, by namespace. Cluster-scoped objects are recorded in the "" namespace.
+	namesByNamespace := map[string][]string{}
+	for _, resource := range uniqueResources(clusterResourceSet.Spec.Resources) {
+		if !resourceSetBinding.IsApplied(resource) {
+			continue
+		}
+		unstructuredObj, err := r.getResource(ctx, resource, cluster.Namespace)
+		if err != nil {
+			// Resources that cannot be read are reported by the ResourcesApplied condition.
+			continue
+		}
+		dataList, err := r.targetData(ctx, unstructuredObj, cluster, clusterResourceSet, resource)
+		if err != nil {
+			continue
+		}
+		for _, data := range dataList {
+			objs, err := parseObjects(data)
+			if err != nil {
+				continue
+			}
+			for i := range objs {
+				namesByNamespace[objs[i].GetNamespace()] = append(namesByNamespace[objs[i].GetNamespace()], objs[i].GetName())
+			}
+		}
+	}
+	if len(namesByNamespace) == 0 {
+		return nil, nil
+	}
+
+	remoteClient, release, err := r.targetClient(ctx, cluster, clusterResourceSet)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	namespaces := make([]string, 0, len(namesByNamespace))
+	for namespace := range namesByNamespace {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+
+	events := []workloadEvent{}
+	remaining := r.maxWorkloadEvents()
+	for _, namespace := range namespaces {
+		if remaining <= 0 {
+			break
+		}
+		// Events of cluster-scoped objects are recorded in the default namespace.
+		eventNamespace := namespace
+		if eventNamespace == "" {
+			eventNamespace = corev1.NamespaceDefault
+		}
+		// The client reads from the API server, which filters the Events by type and limits their number, rather than
+		// from a cache, which would watch all the Events of the cluster.
+		eventList := &corev1.EventList{}
+		if err := remoteClient.List(ctx, eventList, client.InNamespace(eventNamespace), client.MatchingFields{"type": corev1.EventTypeWarning}, client.Limit(int64(remaining))); err != nil {
+			return nil, errors.Wrapf(err, "failed to list Events in namespace %s", eventNamespace)
+		}
+		for i := range eventList.Items {
+			if remaining <= 0 {
+				break
+			}
+			remaining--
+			event := eventList.Items[i]
+			if event.Type == corev1.EventTypeWarning && involvesObject(event.InvolvedObject, namespace, namesByNamespace[namespace]) {
+				events = append(events, workloadEvent{cluster: cluster.Name, event: event})
+			}
+		}
+	}
+	return events, nil
+}
+
+// involvesObject returns true if the object involved in an Event is one of the named objects of the namespace, or is
+// named after one of them, e.g. the Pod "coredns-5d78c9869d-xk7vq" of the Deployment "coredns".
+func involvesObject(involved corev1.ObjectReference, namespace string, names []string) bool {
+	if involved.Namespace != namespace {
+		return false
+	}
+	for _, name := range names {
+		if involved.Name == name || strings.HasPrefix(involved.Name, name+"-") {
+			return true
+		}
+	}
+	return false
+}
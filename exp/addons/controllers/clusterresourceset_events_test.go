@@ -0,0 +1,162 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
+	addonsv1 "sigs.k8s.io/cluster-api/exp/addons/api/v1alpha3"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+func TestCheckWorkloadEvents(t *testing.T) {
+	scheme := runtime.NewScheme()
+	NewWithT(t).Expect(corev1.AddToScheme(scheme)).To(Succeed())
+	NewWithT(t).Expect(clusterv1.AddToScheme(scheme)).To(Succeed())
+	NewWithT(t).Expect(addonsv1.AddToScheme(scheme)).To(Succeed())
+
+	cluster := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "cluster", Namespace: "default"}}
+	source := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "resource", Namespace: "default"},
+		Data: map[string]string{"dns": `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: coredns
+  namespace: kube-system
+`},
+	}
+	binding := &addonsv1.ClusterResourceSetBinding{
+		ObjectMeta: metav1.ObjectMeta{Name: "cluster", Namespace: "default"},
+		Spec: addonsv1.ClusterResourceSetBindingSpec{
+			Bindings: []*addonsv1.ResourceSetBinding{{
+				ClusterResourceSetName: "crs",
+				Resources: []addonsv1.ResourceBinding{{
+					ResourceRef: addonsv1.ResourceRef{Kind: "ConfigMap", Name: "resource"},
+					Applied:     true,
+				}},
+			}},
+		},
+	}
+	event := func(name, eventType, objectKind, objectName, reason string, count int32) *corev1.Event {
+		return &corev1.Event{
+			ObjectMeta:     metav1.ObjectMeta{Name: name, Namespace: "kube-system"},
+			InvolvedObject: corev1.ObjectReference{Kind: objectKind, Namespace: "kube-system", Name: objectName},
+			Type:           eventType,
+			Reason:         reason,
+			Message:        "0/3 nodes are available",
+			Count:          count,
+		}
+	}
+
+	tests := []struct {
+		name              string
+		reportEvents      bool
+		maxEvents         int
+		remoteObjects     []runtime.Object
+		expectedStatus    corev1.ConditionStatus
+		expectedMessage   string
+		unexpectedMessage string
+	}{
+		{
+			name:          "should not set the condition when not reporting events",
+			remoteObjects: []runtime.Object{event("a", corev1.EventTypeWarning, "Pod", "coredns-5d78c9869d-xk7vq", "FailedScheduling", 3)},
+		},
+		{
+			name:         "should summarize Warning Events of the applied objects and the objects named after them",
+			reportEvents: true,
+			remoteObjects: []runtime.Object{
+				event("a", corev1.EventTypeWarning, "Pod", "coredns-5d78c9869d-xk7vq", "FailedScheduling", 3),
+				event("b", corev1.EventTypeNormal, "Deployment", "coredns", "ScalingReplicaSet", 1),
+				event("c", corev1.EventTypeWarning, "Pod", "other", "BackOff", 1),
+			},
+			expectedStatus:    corev1.ConditionFalse,
+			expectedMessage:   "1 Warning Events recorded for applied objects: cluster: Pod kube-system/coredns-5d78c9869d-xk7vq: FailedScheduling: 0/3 nodes are available (x3)",
+			unexpectedMessage: "other",
+		},
+		{
+			name:         "should read at most MaxWorkloadEvents Events",
+			reportEvents: true,
+			maxEvents:    1,
+			remoteObjects: []runtime.Object{
+				event("a", corev1.EventTypeWarning, "Pod", "coredns-5d78c9869d-xk7vq", "FailedScheduling", 1),
+				event("b", corev1.EventTypeWarning, "Deployment", "coredns", "FailedCreate", 1),
+			},
+			expectedStatus:  corev1.ConditionFalse,
+			expectedMessage: "1 Warning Events recorded",
+		},
+		{
+			name:           "should be true without Warning Events",
+			reportEvents:   true,
+			remoteObjects:  []runtime.Object{event("b", corev1.EventTypeNormal, "Deployment", "coredns", "ScalingReplicaSet", 1)},
+			expectedStatus: corev1.ConditionTrue,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			clusterResourceSet := &addonsv1.ClusterResourceSet{
+				ObjectMeta: metav1.ObjectMeta{Name: "crs", Namespace: "default"},
+				Spec: addonsv1.ClusterResourceSetSpec{
+					Resources:            []addonsv1.ResourceRef{{Kind: "ConfigMap", Name: "resource"}},
+					ReportWorkloadEvents: tt.reportEvents,
+				},
+			}
+			remoteClient := fake.NewFakeClientWithScheme(scheme, tt.remoteObjects...)
+			r := &ClusterResourceSetReconciler{
+				Client: fake.NewFakeClientWithScheme(scheme, cluster.DeepCopy(), source.DeepCopy(), binding.DeepCopy()),
+				Log:    log.Log,
+				RemoteClientGetter: func(ctx context.Context, key client.ObjectKey) (client.Client, error) {
+					return remoteClient, nil
+				},
+				MaxWorkloadEvents: tt.maxEvents,
+				scheme:            scheme,
+				recorder:          record.NewFakeRecorder(10),
+			}
+
+			r.checkWorkloadEvents(context.Background(), clusterResourceSet, []*clusterv1.Cluster{cluster})
+
+			condition := conditions.Get(clusterResourceSet, addonsv1.WorkloadEventsCondition)
+			if tt.expectedStatus == "" {
+				g.Expect(condition).To(BeNil())
+				return
+			}
+			g.Expect(condition).NotTo(BeNil())
+			g.Expect(condition.Status).To(Equal(tt.expectedStatus))
+			if tt.expectedStatus == corev1.ConditionFalse {
+				g.Expect(condition.Reason).To(Equal(addonsv1.WorkloadWarningEventsReason))
+				g.Expect(condition.Severity).To(Equal(clusterv1.ConditionSeverityWarning))
+			}
+			g.Expect(condition.Message).To(ContainSubstring(tt.expectedMessage))
+			if tt.unexpectedMessage != "" {
+				g.Expect(condition.Message).NotTo(ContainSubstring(tt.unexpectedMessage))
+			}
+		})
+	}
+}
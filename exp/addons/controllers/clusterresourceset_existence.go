@@ -0,0 +1,95 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	kerrors "k8s.io/apimachinery/pkg/util/errors"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
+	addonsv1 "sigs.k8s.io/cluster-api/exp/addons/api/v1alpha3"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// existenceCheckKey identifies the objects applied by a ClusterResourceSet to a cluster.
+type existenceCheckKey struct {
+	cluster            types.NamespacedName
+	clusterResourceSet string
+}
+
+// reserveExistenceCheck records a check of the objects applied by the ClusterResourceSet to the cluster if at least
+// ExistenceCheckInterval has elapsed since the previous one, and returns whether the check is due.
+func (r *ClusterResourceSetReconciler) reserveExistenceCheck(cluster *clusterv1.Cluster, clusterResourceSet *addonsv1.ClusterResourceSet) bool {
+	if r.ExistenceCheckInterval <= 0 {
+		return false
+	}
+
+	r.lastExistenceCheckLock.Lock()
+	defer r.lastExistenceCheckLock.Unlock()
+
+	if r.lastExistenceCheck == nil {
+		r.lastExistenceCheck = map[existenceCheckKey]time.Time{}
+	}
+
+	key := existenceCheckKey{cluster: types.NamespacedName{Namespace: cluster.Namespace, Name: cluster.Name}, clusterResourceSet: clusterResourceSet.Name}
+	if last, ok := r.lastExistenceCheck[key]; ok && time.Since(last) < r.ExistenceCheckInterval {
+		return false
+	}
+	r.lastExistenceCheck[key] = time.Now()
+	return true
+}
+
+// markMissingResources marks the resources recorded as applied in the ResourceSetBinding whose objects no longer exist
+// in the cluster, e.g. because they were deleted by accident, as not applied, so that they are applied again.
+// Patched resources are not checked, as their objects are not created by the ClusterResourceSet, and neither are
+// resources whose source does not exist anymore, as they cannot be applied again.
+func (r *ClusterResourceSetReconciler) markMissingResources(ctx context.Context, remoteClient client.Client, cluster *clusterv1.Cluster, clusterResourceSet *addonsv1.ClusterResourceSet, resourceSetBinding *addonsv1.ResourceSetBinding) error {
+	logger := r.Log.WithValues(logKeyCRSName, clusterResourceSet.Name, logKeyCRSNamespace, clusterResourceSet.Namespace, logKeyClusterName, cluster.Name)
+
+	errList := []error{}
+	for _, resource := range uniqueResources(clusterResourceSet.Spec.Resources) {
+		resourceBinding := resourceSetBinding.GetResourceBinding(resource)
+		if resourceBinding == nil || !resourceBinding.Applied || resource.Mode == string(addonsv1.PatchClusterResourceSetResourceMode) {
+			continue
+		}
+
+		unstructuredObj, err := r.getResource(ctx, resource, cluster.Namespace)
+		if err != nil {
+			continue
+		}
+		dataList, err := r.targetData(ctx, unstructuredObj, cluster, clusterResourceSet, resource)
+		if err != nil {
+			errList = append(errList, err)
+			continue
+		}
+		exist, err := objectsExist(ctx, remoteClient, dataList)
+		if err != nil {
+			errList = append(errList, err)
+			continue
+		}
+		if !exist {
+			logger.Info("Objects of resource are missing from cluster, marking it as not applied", logKeyResourceKind, resource.Kind, logKeyResourceName, resource.Name)
+			r.recorder.Eventf(clusterResourceSet, corev1.EventTypeWarning, "ObjectsMissing",
+				"Objects of %s %s are missing from cluster %s, applying it again", resource.Kind, resource.Name, cluster.Name)
+			resourceBinding.Applied = false
+		}
+	}
+	return kerrors.NewAggregate(errList)
+}
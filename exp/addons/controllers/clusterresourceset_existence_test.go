@@ -0,0 +1,86 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
+	addonsv1 "sigs.k8s.io/cluster-api/exp/addons/api/v1alpha3"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+func TestApplyClusterResourceSetReappliesMissingObjects(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(corev1.AddToScheme(scheme)).To(Succeed())
+	g.Expect(clusterv1.AddToScheme(scheme)).To(Succeed())
+	g.Expect(addonsv1.AddToScheme(scheme)).To(Succeed())
+
+	cluster := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "cluster", Namespace: "default"}}
+	source := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "resource", Namespace: "default"},
+		Data:       map[string]string{"cm": "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: applied\n  namespace: default\n"},
+	}
+	clusterResourceSet := &addonsv1.ClusterResourceSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "crs", Namespace: "default"},
+		Spec: addonsv1.ClusterResourceSetSpec{
+			ClusterSelector: metav1.LabelSelector{MatchLabels: map[string]string{"foo": "bar"}},
+			Resources:       []addonsv1.ResourceRef{{Kind: "ConfigMap", Name: "resource"}},
+		},
+	}
+
+	remoteClient := fake.NewFakeClientWithScheme(scheme)
+	recorder := record.NewFakeRecorder(10)
+	r := &ClusterResourceSetReconciler{
+		Client: fake.NewFakeClientWithScheme(scheme, cluster, source, clusterResourceSet),
+		Log:    log.Log,
+		RemoteClientGetter: func(ctx context.Context, key client.ObjectKey) (client.Client, error) {
+			return remoteClient, nil
+		},
+		ExistenceCheckInterval: time.Hour,
+		scheme:                 scheme,
+		recorder:               recorder,
+	}
+	applied := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "applied", Namespace: "default"}}
+	key := client.ObjectKey{Namespace: "default", Name: "applied"}
+
+	g.Expect(r.ApplyClusterResourceSet(context.Background(), cluster, clusterResourceSet)).To(Succeed())
+	g.Expect(remoteClient.Delete(context.Background(), applied)).To(Succeed())
+
+	// Deleted objects are not noticed before the next check.
+	g.Expect(r.ApplyClusterResourceSet(context.Background(), cluster, clusterResourceSet)).To(Succeed())
+	g.Expect(apierrors.IsNotFound(remoteClient.Get(context.Background(), key, &corev1.ConfigMap{}))).To(BeTrue())
+
+	// Once the check is due, the resource is applied again.
+	r.lastExistenceCheck = nil
+	g.Expect(r.ApplyClusterResourceSet(context.Background(), cluster, clusterResourceSet)).To(Succeed())
+	g.Expect(remoteClient.Get(context.Background(), key, &corev1.ConfigMap{})).To(Succeed())
+	g.Expect(recorder.Events).To(Receive(ContainSubstring("ObjectsMissing")))
+}
@@ -0,0 +1,708 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"context"
+	"crypto/sha1" //nolint:gosec
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	addonsv1 "sigs.k8s.io/cluster-api/exp/addons/api/v1alpha3"
+)
+
+const (
+	// maxGitPackSize is the maximum size of the packfiles fetched from Git repositories.
+	maxGitPackSize = 50 << 20
+
+	// maxGitPackObjects is the maximum number of objects in the packfiles fetched from Git repositories.
+	maxGitPackObjects = 100000
+
+	// maxCachedGitTrees is the maximum number of fetched manifests kept in memory. The cache is reset when it is exceeded.
+	maxCachedGitTrees = 100
+
+	gitObjectCommit   = 1
+	gitObjectTree     = 2
+	gitObjectBlob     = 3
+	gitObjectTag      = 4
+	gitObjectOfsDelta = 6
+	gitObjectRefDelta = 7
+)
+
+var commitSHA = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+// maxGitObjectsSize is the maximum total size of the objects of a packfile once decompressed and their deltas
+// resolved, which bounds the memory used by packfiles of highly compressible or deltified objects.
+var maxGitObjectsSize = 200 << 20
+
+// gitFetchError is returned when the manifests of a Git repository cannot be fetched.
+type gitFetchError struct {
+	err error
+	// auth is true if the repository rejected the credentials, or requires some.
+	auth bool
+}
+
+func (e *gitFetchError) Error() string {
+	return e.err.Error()
+}
+
+// gitCredentials are the credentials used to authenticate to a Git repository.
+type gitCredentials struct {
+	username string
+	password string
+}
+
+// gitCredentialsFromSecret returns the credentials in the "username" and "password" keys of the Secret.
+// The username is optional, as tokens are accepted with any username by most Git servers.
+func gitCredentialsFromSecret(secret *corev1.Secret) (*gitCredentials, error) {
+	password := string(secret.Data["password"])
+	if password == "" {
+		return nil, errors.Errorf("Git secret %s has no password", secret.Name)
+	}
+	username := string(secret.Data["username"])
+	if username == "" {
+		username = "git"
+	}
+	return &gitCredentials{username: username, password: password}, nil
+}
+
+// cacheKey identifies the credentials in the keys of the cached manifests, so that manifests fetched with credentials
+// are only served to fetches with the same credentials.
+func (c *gitCredentials) cacheKey() string {
+	if c == nil {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(c.username + "\x00" + c.password))
+	return hex.EncodeToString(sum[:])
+}
+
+// gitClient fetches manifests from Git repositories using the smart HTTP protocol. Only the commit a ref points to is
+// fetched, and the manifests are cached by commit, so an unchanged ref only costs a request listing the refs.
+type gitClient struct {
+	httpClient *http.Client
+
+	lock  sync.Mutex
+	trees map[string]map[string][]byte
+}
+
+func newGitClient(httpClient *http.Client) *gitClient {
+	return &gitClient{
+		httpClient: httpClient,
+		trees:      map[string]map[string][]byte{},
+	}
+}
+
+// fetch returns the commit ref points to in the repository, and the content of the YAML and JSON files under filePath
+// at this commit, by path relative to filePath. Commit SHAs are not resolved, hence the cached manifests are keyed by
+// credentials too, otherwise a fetch without credentials could read the manifests of a private repository fetched
+// by another ClusterResourceSet.
+func (g *gitClient) fetch(ctx context.Context, repoURL, ref, filePath string, creds *gitCredentials) (string, map[string][]byte, error) {
+	repoURL = strings.TrimSuffix(repoURL, "/")
+	commit, err := g.resolve(ctx, repoURL, ref, creds)
+	if err != nil {
+		return "", nil, err
+	}
+
+	key := fmt.Sprintf("%s@%s:%s#%s", repoURL, commit, filePath, creds.cacheKey())
+	g.lock.Lock()
+	cached, ok := g.trees[key]
+	g.lock.Unlock()
+	if ok {
+		return commit, cached, nil
+	}
+
+	pack, err := g.uploadPack(ctx, repoURL, commit, creds)
+	if err != nil {
+		return "", nil, errors.Wrapf(err, "failed to fetch commit %s of %s", commit, repoURL)
+	}
+	objects, err := parsePack(pack)
+	if err != nil {
+		return "", nil, errors.Wrapf(err, "failed to read commit %s of %s", commit, repoURL)
+	}
+	files, err := objects.files(commit, filePath)
+	if err != nil {
+		return "", nil, errors.Wrapf(err, "failed to read commit %s of %s", commit, repoURL)
+	}
+
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if len(g.trees) >= maxCachedGitTrees {
+		g.trees = map[string]map[string][]byte{}
+	}
+	g.trees[key] = files
+	return commit, files, nil
+}
+
+// resolve returns the commit a branch, tag or HEAD points to, using the refs advertised by the repository.
+// Commit SHAs are returned as is.
+func (g *gitClient) resolve(ctx context.Context, repoURL, ref string, creds *gitCredentials) (string, error) {
+	if commitSHA.MatchString(ref) {
+		return ref, nil
+	}
+
+	resp, err := g.do(ctx, http.MethodGet, repoURL+"/info/refs?service=git-upload-pack", "", nil, creds)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	refs := map[string]string{}
+	reader := bufio.NewReader(io.LimitReader(resp.Body, maxGitPackSize))
+	for {
+		line, flush, err := readPktLine(reader)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", errors.Wrapf(err, "failed to list the refs of %s", repoURL)
+		}
+		if flush || strings.HasPrefix(string(line), "#") {
+			continue
+		}
+		// The first ref is followed by the capabilities of the server, separated by a NUL byte.
+		if i := bytes.IndexByte(line, 0); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(string(line))
+		if len(fields) == 2 {
+			refs[fields[1]] = fields[0]
+		}
+	}
+
+	if ref == "" {
+		ref = "HEAD"
+	}
+	// Annotated tags are peeled to the commit they point to.
+	for _, name := range []string{ref, "refs/heads/" + ref, "refs/tags/" + ref} {
+		if commit, ok := refs[name+"^{}"]; ok {
+			return commit, nil
+		}
+		if commit, ok := refs[name]; ok {
+			return commit, nil
+		}
+	}
+	return "", errors.Errorf("ref %q not found in %s", ref, repoURL)
+}
+
+// uploadPack returns the packfile of a shallow fetch of the commit, i.e. with the commit, its trees and its blobs.
+func (g *gitClient) uploadPack(ctx context.Context, repoURL, commit string, creds *gitCredentials) ([]byte, error) {
+	request := &bytes.Buffer{}
+	writePktLine(request, fmt.Sprintf("want %s side-band-64k ofs-delta shallow no-progress\n", commit))
+	writePktLine(request, "deepen 1\n")
+	request.WriteString("0000")
+	writePktLine(request, "done\n")
+
+	resp, err := g.do(ctx, http.MethodPost, repoURL+"/git-upload-pack", "application/x-git-upload-pack-request", request, creds)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// The shallow and acknowledgment lines precede the packfile, which is sent in band 1 of the side-band.
+	pack := &bytes.Buffer{}
+	inPack := false
+	reader := bufio.NewReader(io.LimitReader(resp.Body, maxGitPackSize))
+	for {
+		line, flush, err := readPktLine(reader)
+		if err == io.EOF || (flush && inPack) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if flush || len(line) == 0 {
+			continue
+		}
+		if !inPack {
+			text := string(line)
+			if strings.HasPrefix(text, "shallow ") || strings.HasPrefix(text, "unshallow ") || strings.HasPrefix(text, "ACK ") {
+				continue
+			}
+			if strings.HasPrefix(text, "NAK") {
+				inPack = true
+				continue
+			}
+			if strings.HasPrefix(text, "ERR ") {
+				return nil, errors.New(strings.TrimSpace(text[4:]))
+			}
+		}
+		inPack = true
+		switch line[0] {
+		case 1:
+			pack.Write(line[1:])
+		case 2:
+			// Progress messages.
+		case 3:
+			return nil, errors.Errorf("remote error: %s", strings.TrimSpace(string(line[1:])))
+		default:
+			return nil, errors.Errorf("unexpected side-band %d", line[0])
+		}
+	}
+	if pack.Len() == 0 {
+		return nil, errors.New("no packfile received")
+	}
+	return pack.Bytes(), nil
+}
+
+func (g *gitClient) do(ctx context.Context, method, target, contentType string, body io.Reader, creds *gitCredentials) (*http.Response, error) {
+	req, err := http.NewRequest(method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set("Accept", "application/x-git-upload-pack-result")
+	}
+	if creds != nil {
+		req.SetBasicAuth(creds.username, creds.password)
+	}
+	resp, err := g.httpClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		resp.Body.Close()
+		if creds == nil {
+			return nil, &gitFetchError{err: errors.Errorf("%s requires credentials", target), auth: true}
+		}
+		return nil, &gitFetchError{err: errors.Errorf("credentials rejected by %s", target), auth: true}
+	case resp.StatusCode != http.StatusOK:
+		resp.Body.Close()
+		return nil, errors.Errorf("unexpected status %q fetching %s", resp.Status, target)
+	}
+	return resp, nil
+}
+
+// readPktLine reads a line in the pkt-line format, i.e. prefixed by its length including the prefix in 4 hex digits.
+// flush is true for flush packets, which have a length of 0.
+func readPktLine(reader io.Reader) ([]byte, bool, error) {
+	prefix := make([]byte, 4)
+	if _, err := io.ReadFull(reader, prefix); err != nil {
+		return nil, false, err
+	}
+	length, err := strconv.ParseUint(string(prefix), 16, 16)
+	if err != nil {
+		return nil, false, errors.Errorf("invalid pkt-line length %q", prefix)
+	}
+	if length == 0 {
+		return nil, true, nil
+	}
+	if length < 4 {
+		return nil, false, errors.Errorf("invalid pkt-line length %d", length)
+	}
+	line := make([]byte, length-4)
+	if _, err := io.ReadFull(reader, line); err != nil {
+		return nil, false, err
+	}
+	return line, false, nil
+}
+
+func writePktLine(w *bytes.Buffer, line string) {
+	fmt.Fprintf(w, "%04x%s", len(line)+4, line)
+}
+
+// gitObject is an object of a Git repository.
+type gitObject struct {
+	kind int
+	data []byte
+}
+
+// gitObjects are the objects of a packfile, by SHA.
+type gitObjects map[string]*gitObject
+
+// packEntry is an object of a packfile, possibly stored as a delta of another object.
+type packEntry struct {
+	kind       int
+	data       []byte
+	baseOffset int
+	baseSHA    string
+}
+
+// parsePack returns the objects of a packfile, with the deltas resolved.
+func parsePack(pack []byte) (gitObjects, error) {
+	if len(pack) < 12 || string(pack[:4]) != "PACK" {
+		return nil, errors.New("invalid packfile")
+	}
+	if version := binary.BigEndian.Uint32(pack[4:8]); version != 2 && version != 3 {
+		return nil, errors.Errorf("unsupported packfile version %d", version)
+	}
+	count := int(binary.BigEndian.Uint32(pack[8:12]))
+	if count > maxGitPackObjects {
+		return nil, errors.Errorf("packfile has %d objects, more than %d", count, maxGitPackObjects)
+	}
+	total := 0
+	reserve := func(size int) error {
+		if total += size; total > maxGitObjectsSize {
+			return errors.Errorf("packfile objects are larger than %d bytes", maxGitObjectsSize)
+		}
+		return nil
+	}
+
+	entries := map[int]*packEntry{}
+	offsets := make([]int, 0, count)
+	pos := 12
+	for i := 0; i < count; i++ {
+		offset := pos
+		if pos >= len(pack) {
+			return nil, errors.New("truncated packfile")
+		}
+		c := pack[pos]
+		pos++
+		entry := &packEntry{kind: int(c>>4) & 7}
+		size := int(c & 0x0f)
+		for shift := uint(4); c&0x80 != 0; shift += 7 {
+			if pos >= len(pack) || shift > 56 {
+				return nil, errors.New("truncated packfile")
+			}
+			c = pack[pos]
+			pos++
+			size |= int(c&0x7f) << shift
+		}
+
+		switch entry.kind {
+		case gitObjectOfsDelta:
+			if pos >= len(pack) {
+				return nil, errors.New("truncated packfile")
+			}
+			c = pack[pos]
+			pos++
+			distance := int(c & 0x7f)
+			for c&0x80 != 0 {
+				if pos >= len(pack) {
+					return nil, errors.New("truncated packfile")
+				}
+				c = pack[pos]
+				pos++
+				distance = ((distance + 1) << 7) | int(c&0x7f)
+			}
+			entry.baseOffset = offset - distance
+			if distance <= 0 || entry.baseOffset < 12 {
+				return nil, errors.Errorf("invalid delta base offset at %d", offset)
+			}
+		case gitObjectRefDelta:
+			if pos+20 > len(pack) {
+				return nil, errors.New("truncated packfile")
+			}
+			entry.baseSHA = hex.EncodeToString(pack[pos : pos+20])
+			pos += 20
+		case gitObjectCommit, gitObjectTree, gitObjectBlob, gitObjectTag:
+		default:
+			return nil, errors.Errorf("invalid object type %d at %d", entry.kind, offset)
+		}
+
+		if size > maxGitPackSize {
+			return nil, errors.Errorf("object at %d is too large", offset)
+		}
+		if err := reserve(size); err != nil {
+			return nil, err
+		}
+		compressed := bytes.NewReader(pack[pos:])
+		zr, err := zlib.NewReader(compressed)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read object at %d", offset)
+		}
+		data, err := ioutil.ReadAll(io.LimitReader(zr, int64(size)+1))
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read object at %d", offset)
+		}
+		if len(data) != size {
+			return nil, errors.Errorf("object at %d has size %d, expected %d", offset, len(data), size)
+		}
+		// Read the end of the zlib stream, so that its checksum is consumed too.
+		if _, err := io.Copy(ioutil.Discard, zr); err != nil {
+			return nil, errors.Wrapf(err, "failed to read object at %d", offset)
+		}
+		pos = len(pack) - compressed.Len()
+		entry.data = data
+		entries[offset] = entry
+		offsets = append(offsets, offset)
+	}
+
+	// Resolve the deltas whose base is known until all are resolved, as bases may follow the deltas using them.
+	objects := gitObjects{}
+	resolved := map[int]*gitObject{}
+	for len(resolved) < len(offsets) {
+		progress := false
+		for _, offset := range offsets {
+			if resolved[offset] != nil {
+				continue
+			}
+			entry := entries[offset]
+			var object *gitObject
+			switch entry.kind {
+			case gitObjectOfsDelta, gitObjectRefDelta:
+				base := resolved[entry.baseOffset]
+				if entry.kind == gitObjectRefDelta {
+					base = objects[entry.baseSHA]
+				}
+				if base == nil {
+					continue
+				}
+				data, err := applyDelta(base.data, entry.data)
+				if err != nil {
+					return nil, errors.Wrapf(err, "failed to resolve delta at %d", offset)
+				}
+				if err := reserve(len(data)); err != nil {
+					return nil, err
+				}
+				object = &gitObject{kind: base.kind, data: data}
+			default:
+				object = &gitObject{kind: entry.kind, data: entry.data}
+			}
+			resolved[offset] = object
+			objects[object.sha()] = object
+			progress = true
+		}
+		if !progress {
+			return nil, errors.New("packfile has deltas with missing bases")
+		}
+	}
+	return objects, nil
+}
+
+// applyDelta returns the object described by a delta of the base object.
+func applyDelta(base, delta []byte) ([]byte, error) {
+	pos := 0
+	readSize := func() (int, error) {
+		size := 0
+		for shift := uint(0); ; shift += 7 {
+			if pos >= len(delta) || shift > 56 {
+				return 0, errors.New("truncated delta")
+			}
+			c := delta[pos]
+			pos++
+			size |= int(c&0x7f) << shift
+			if c&0x80 == 0 {
+				return size, nil
+			}
+		}
+	}
+	baseSize, err := readSize()
+	if err != nil {
+		return nil, err
+	}
+	if baseSize != len(base) {
+		return nil, errors.Errorf("delta base has size %d, expected %d", len(base), baseSize)
+	}
+	targetSize, err := readSize()
+	if err != nil {
+		return nil, err
+	}
+	if targetSize > maxGitPackSize {
+		return nil, errors.New("delta target is too large")
+	}
+
+	target := make([]byte, 0, targetSize)
+	for pos < len(delta) {
+		op := delta[pos]
+		pos++
+		switch {
+		case op&0x80 != 0:
+			// Copy a range of the base, whose offset and size are encoded in the bytes flagged by the opcode.
+			offset, size := 0, 0
+			for i := uint(0); i < 4; i++ {
+				if op&(1<<i) != 0 {
+					if pos >= len(delta) {
+						return nil, errors.New("truncated delta")
+					}
+					offset |= int(delta[pos]) << (8 * i)
+					pos++
+				}
+			}
+			for i := uint(0); i < 3; i++ {
+				if op&(0x10<<i) != 0 {
+					if pos >= len(delta) {
+						return nil, errors.New("truncated delta")
+					}
+					size |= int(delta[pos]) << (8 * i)
+					pos++
+				}
+			}
+			if size == 0 {
+				size = 0x10000
+			}
+			if offset+size > len(base) {
+				return nil, errors.New("delta copies beyond its base")
+			}
+			target = append(target, base[offset:offset+size]...)
+		case op != 0:
+			// Insert the op next bytes of the delta.
+			if pos+int(op) > len(delta) {
+				return nil, errors.New("truncated delta")
+			}
+			target = append(target, delta[pos:pos+int(op)]...)
+			pos += int(op)
+		default:
+			return nil, errors.New("invalid delta opcode 0")
+		}
+	}
+	if len(target) != targetSize {
+		return nil, errors.Errorf("delta produced %d bytes, expected %d", len(target), targetSize)
+	}
+	return target, nil
+}
+
+// sha returns the SHA of the object, computed over its type, size and content.
+func (o *gitObject) sha() string {
+	kind := map[int]string{gitObjectCommit: "commit", gitObjectTree: "tree", gitObjectBlob: "blob", gitObjectTag: "tag"}[o.kind]
+	h := sha1.New() //nolint:gosec
+	fmt.Fprintf(h, "%s %d\x00", kind, len(o.data))
+	h.Write(o.data)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// gitTreeEntry is an entry of a tree object.
+type gitTreeEntry struct {
+	mode string
+	name string
+	sha  string
+}
+
+// tree returns the entries of a tree object.
+func (o gitObjects) tree(sha string) ([]gitTreeEntry, error) {
+	object, ok := o[sha]
+	if !ok || object.kind != gitObjectTree {
+		return nil, errors.Errorf("tree %s not found", sha)
+	}
+	entries := []gitTreeEntry{}
+	data := object.data
+	for len(data) > 0 {
+		space := bytes.IndexByte(data, ' ')
+		nul := bytes.IndexByte(data, 0)
+		if space < 0 || nul < space || nul+21 > len(data) {
+			return nil, errors.Errorf("invalid tree %s", sha)
+		}
+		entries = append(entries, gitTreeEntry{
+			mode: string(data[:space]),
+			name: string(data[space+1 : nul]),
+			sha:  hex.EncodeToString(data[nul+1 : nul+21]),
+		})
+		data = data[nul+21:]
+	}
+	return entries, nil
+}
+
+// files returns the YAML and JSON files under filePath at the commit, by path relative to filePath.
+// If filePath is a file, it is returned by its name whatever its extension.
+func (o gitObjects) files(commit, filePath string) (map[string][]byte, error) {
+	object, ok := o[commit]
+	if !ok || object.kind != gitObjectCommit {
+		return nil, errors.Errorf("commit %s not found", commit)
+	}
+	header := strings.SplitN(string(object.data), "\n", 2)[0]
+	if !strings.HasPrefix(header, "tree ") {
+		return nil, errors.Errorf("invalid commit %s", commit)
+	}
+	treeSHA := strings.TrimPrefix(header, "tree ")
+
+	components := strings.FieldsFunc(filePath, func(r rune) bool { return r == '/' })
+	for i, name := range components {
+		entries, err := o.tree(treeSHA)
+		if err != nil {
+			return nil, err
+		}
+		found := false
+		for _, entry := range entries {
+			if entry.name != name {
+				continue
+			}
+			if entry.mode == "40000" {
+				treeSHA, found = entry.sha, true
+				break
+			}
+			if i == len(components)-1 && isGitFile(entry.mode) {
+				blob, ok := o[entry.sha]
+				if !ok || blob.kind != gitObjectBlob {
+					return nil, errors.Errorf("blob %s not found", entry.sha)
+				}
+				return map[string][]byte{name: blob.data}, nil
+			}
+		}
+		if !found {
+			return nil, errors.Errorf("path %q not found", filePath)
+		}
+	}
+
+	files := map[string][]byte{}
+	if err := o.collectFiles(treeSHA, "", files); err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, errors.Errorf("no YAML or JSON files found in %q", filePath)
+	}
+	return files, nil
+}
+
+// collectFiles adds the YAML and JSON files of the tree and of its subtrees to files.
+func (o gitObjects) collectFiles(treeSHA, dir string, files map[string][]byte) error {
+	entries, err := o.tree(treeSHA)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		name := path.Join(dir, entry.name)
+		switch {
+		case entry.mode == "40000":
+			if err := o.collectFiles(entry.sha, name, files); err != nil {
+				return err
+			}
+		case isGitFile(entry.mode):
+			switch path.Ext(name) {
+			case ".yaml", ".yml", ".json":
+			default:
+				continue
+			}
+			blob, ok := o[entry.sha]
+			if !ok || blob.kind != gitObjectBlob {
+				return errors.Errorf("blob %s not found", entry.sha)
+			}
+			files[name] = blob.data
+		}
+	}
+	return nil
+}
+
+// isGitFile returns true if the tree entry mode is a regular file, i.e. not a symlink or a submodule.
+func isGitFile(mode string) bool {
+	return mode == "100644" || mode == "100755"
+}
+
+// hasGitResources returns true if the ClusterResourceSet has resources of the GitRepository kind.
+func hasGitResources(clusterResourceSet *addonsv1.ClusterResourceSet) bool {
+	for _, resource := range clusterResourceSet.Spec.Resources {
+		if resource.Kind == string(addonsv1.GitRepositoryClusterResourceSetResourceKind) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,300 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"crypto/sha1" //nolint:gosec
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	addonsv1 "sigs.k8s.io/cluster-api/exp/addons/api/v1alpha3"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// testGitRepository is a single commit of a Git repository, served with the smart HTTP protocol.
+type testGitRepository struct {
+	objects [][]byte
+	commit  string
+}
+
+func (r *testGitRepository) add(kind int, data []byte) string {
+	object := &gitObject{kind: kind, data: data}
+	r.objects = append(r.objects, append([]byte{byte(kind)}, data...))
+	return object.sha()
+}
+
+func (r *testGitRepository) tree(entries ...string) string {
+	data := &bytes.Buffer{}
+	for i := 0; i < len(entries); i += 3 {
+		sha, _ := hex.DecodeString(entries[i+2])
+		fmt.Fprintf(data, "%s %s\x00", entries[i], entries[i+1])
+		data.Write(sha)
+	}
+	return r.add(gitObjectTree, data.Bytes())
+}
+
+func (r *testGitRepository) pack() []byte {
+	pack := &bytes.Buffer{}
+	pack.WriteString("PACK")
+	_ = binary.Write(pack, binary.BigEndian, uint32(2))
+	_ = binary.Write(pack, binary.BigEndian, uint32(len(r.objects)))
+	for _, object := range r.objects {
+		kind, data := object[0], object[1:]
+		size := len(data)
+		c := kind<<4 | byte(size&0x0f)
+		size >>= 4
+		for size > 0 {
+			pack.WriteByte(c | 0x80)
+			c = byte(size & 0x7f)
+			size >>= 7
+		}
+		pack.WriteByte(c)
+		zw := zlib.NewWriter(pack)
+		_, _ = zw.Write(data)
+		_ = zw.Close()
+	}
+	sum := sha1.Sum(pack.Bytes()) //nolint:gosec
+	pack.Write(sum[:])
+	return pack.Bytes()
+}
+
+func (r *testGitRepository) handler(password string, uploads *int) http.Handler {
+	mux := http.NewServeMux()
+	authorized := func(w http.ResponseWriter, req *http.Request) bool {
+		if _, p, _ := req.BasicAuth(); p != password {
+			w.WriteHeader(http.StatusUnauthorized)
+			return false
+		}
+		return true
+	}
+	mux.HandleFunc("/repo.git/info/refs", func(w http.ResponseWriter, req *http.Request) {
+		if !authorized(w, req) {
+			return
+		}
+		body := &bytes.Buffer{}
+		writePktLine(body, "# service=git-upload-pack\n")
+		body.WriteString("0000")
+		writePktLine(body, r.commit+" HEAD\x00side-band-64k ofs-delta shallow no-progress\n")
+		writePktLine(body, r.commit+" refs/heads/main\n")
+		writePktLine(body, "1111111111111111111111111111111111111111 refs/tags/v1\n")
+		writePktLine(body, r.commit+" refs/tags/v1^{}\n")
+		body.WriteString("0000")
+		_, _ = w.Write(body.Bytes())
+	})
+	mux.HandleFunc("/repo.git/git-upload-pack", func(w http.ResponseWriter, req *http.Request) {
+		if !authorized(w, req) {
+			return
+		}
+		*uploads++
+		body := &bytes.Buffer{}
+		writePktLine(body, "shallow "+r.commit+"\n")
+		body.WriteString("0000")
+		writePktLine(body, "NAK\n")
+		pack := r.pack()
+		for len(pack) > 0 {
+			n := 1000
+			if n > len(pack) {
+				n = len(pack)
+			}
+			writePktLine(body, "\x01"+string(pack[:n]))
+			pack = pack[n:]
+		}
+		body.WriteString("0000")
+		_, _ = w.Write(body.Bytes())
+	})
+	return mux
+}
+
+func TestGitClientFetch(t *testing.T) {
+	g := NewWithT(t)
+
+	repo := &testGitRepository{}
+	deployment := repo.add(gitObjectBlob, []byte("kind: Deployment\n"))
+	namespace := repo.add(gitObjectBlob, []byte(`{"kind": "Namespace"}`))
+	readme := repo.add(gitObjectBlob, []byte("# CNI\n"))
+	crds := repo.tree("100644", "crd.yaml", deployment)
+	cni := repo.tree("40000", "crds", crds, "100644", "README.md", readme, "100644", "namespace.json", namespace)
+	root := repo.tree("40000", "cni", cni)
+	repo.commit = repo.add(gitObjectCommit, []byte(fmt.Sprintf("tree %s\nauthor a <a@example.com> 0 +0000\n\ninit\n", root)))
+
+	uploads := 0
+	server := httptest.NewServer(repo.handler("token", &uploads))
+	defer server.Close()
+	client := newGitClient(server.Client())
+	creds := &gitCredentials{username: "git", password: "token"}
+
+	commit, files, err := client.fetch(context.Background(), server.URL+"/repo.git", "main", "cni", creds)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(commit).To(Equal(repo.commit))
+	g.Expect(files).To(Equal(map[string][]byte{
+		"crds/crd.yaml":  []byte("kind: Deployment\n"),
+		"namespace.json": []byte(`{"kind": "Namespace"}`),
+	}))
+
+	// The manifests are cached by commit, whatever the ref pointing to it.
+	_, _, err = client.fetch(context.Background(), server.URL+"/repo.git", "v1", "cni", creds)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(uploads).To(Equal(1))
+
+	_, files, err = client.fetch(context.Background(), server.URL+"/repo.git", "", "cni/crds/crd.yaml", creds)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(files).To(Equal(map[string][]byte{"crd.yaml": []byte("kind: Deployment\n")}))
+
+	_, _, err = client.fetch(context.Background(), server.URL+"/repo.git", "main", "missing", creds)
+	g.Expect(err).To(HaveOccurred())
+	_, ok := err.(*gitFetchError)
+	g.Expect(ok).To(BeFalse())
+
+	_, _, err = client.fetch(context.Background(), server.URL+"/repo.git", "main", "cni", &gitCredentials{username: "git", password: "wrong"})
+	g.Expect(err).To(HaveOccurred())
+	fetchErr, ok := err.(*gitFetchError)
+	g.Expect(ok).To(BeTrue())
+	g.Expect(fetchErr.auth).To(BeTrue())
+
+	// Commit SHAs are not resolved, but manifests fetched with credentials are not served to fetches without them.
+	_, _, err = client.fetch(context.Background(), server.URL+"/repo.git", repo.commit, "cni", creds)
+	g.Expect(err).NotTo(HaveOccurred())
+	_, _, err = client.fetch(context.Background(), server.URL+"/repo.git", repo.commit, "cni", nil)
+	g.Expect(err).To(HaveOccurred())
+	fetchErr, ok = errors.Cause(err).(*gitFetchError)
+	g.Expect(ok).To(BeTrue())
+	g.Expect(fetchErr.auth).To(BeTrue())
+}
+
+func TestApplyDelta(t *testing.T) {
+	g := NewWithT(t)
+
+	// Copy "hello " from the base, insert "there", and copy " world" from the base.
+	delta := []byte{11, 17, 0x90, 6, 5, 't', 'h', 'e', 'r', 'e', 0x91, 5, 6}
+	target, err := applyDelta([]byte("hello world"), delta)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(string(target)).To(Equal("hello there world"))
+
+	_, err = applyDelta([]byte("hello"), delta)
+	g.Expect(err).To(HaveOccurred())
+	_, err = applyDelta([]byte("hello world"), []byte{11, 17, 0x91, 10, 6})
+	g.Expect(err).To(HaveOccurred())
+}
+
+func TestParsePackLimits(t *testing.T) {
+	defer func(size int) { maxGitObjectsSize = size }(maxGitObjectsSize)
+	maxGitObjectsSize = 1 << 10
+
+	g := NewWithT(t)
+
+	// Blobs compressing well may be much larger once decompressed than the packfile.
+	repo := &testGitRepository{}
+	repo.add(gitObjectBlob, make([]byte, 600))
+	_, err := parsePack(repo.pack())
+	g.Expect(err).NotTo(HaveOccurred())
+	repo.add(gitObjectBlob, make([]byte, 600))
+	_, err = parsePack(repo.pack())
+	g.Expect(err).To(MatchError(ContainSubstring("larger than")))
+
+	// The objects of a packfile are counted before allocating anything for them.
+	pack := repo.pack()
+	binary.BigEndian.PutUint32(pack[8:12], maxGitPackObjects+1)
+	_, err = parsePack(pack)
+	g.Expect(err).To(MatchError(ContainSubstring("more than")))
+}
+
+func TestFetchGitRepositoryChecksSecret(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+
+	repo := &testGitRepository{}
+	manifest := repo.add(gitObjectBlob, []byte("kind: Namespace\n"))
+	root := repo.tree("100644", "namespace.yaml", manifest)
+	repo.commit = repo.add(gitObjectCommit, []byte(fmt.Sprintf("tree %s\nauthor a <a@example.com> 0 +0000\n\ninit\n", root)))
+
+	uploads := 0
+	server := httptest.NewServer(repo.handler("token", &uploads))
+	defer server.Close()
+
+	tests := []struct {
+		name      string
+		secret    *corev1.Secret
+		expectErr error
+	}{
+		{
+			name: "should fetch with a labeled Secret of the accepted type",
+			secret: &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "git-creds", Namespace: "default", Labels: map[string]string{addonsv1.ClusterResourceSetSourceLabel: "true"}},
+				Type:       addonsv1.ClusterResourceSetSecretType,
+				Data:       map[string][]byte{"password": []byte("token")},
+			},
+		},
+		{
+			name: "should refuse a Secret of another type",
+			secret: &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "git-creds", Namespace: "default", Labels: map[string]string{addonsv1.ClusterResourceSetSourceLabel: "true"}},
+				Type:       corev1.SecretTypeOpaque,
+				Data:       map[string][]byte{"password": []byte("token")},
+			},
+			expectErr: ErrSecretTypeNotSupported,
+		},
+		{
+			name: "should refuse a Secret without the source label",
+			secret: &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "git-creds", Namespace: "default"},
+				Type:       addonsv1.ClusterResourceSetSecretType,
+				Data:       map[string][]byte{"password": []byte("token")},
+			},
+			expectErr: ErrSecretSourceLabelMissing,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			r := &ClusterResourceSetReconciler{
+				Client:                   fake.NewFakeClientWithScheme(scheme, tt.secret),
+				Log:                      log.Log,
+				RequireSecretSourceLabel: true,
+				git:                      newGitClient(server.Client()),
+			}
+			resourceRef := addonsv1.ResourceRef{
+				Kind: string(addonsv1.GitRepositoryClusterResourceSetResourceKind),
+				Name: "addons",
+				Git:  &addonsv1.GitRepositorySource{URL: server.URL + "/repo.git", SecretName: "git-creds"},
+			}
+
+			files, err := r.fetchGitRepository(context.Background(), resourceRef, "default")
+			if tt.expectErr != nil {
+				g.Expect(err).To(Equal(tt.expectErr))
+				return
+			}
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(files).To(HaveKey("namespace.yaml"))
+		})
+	}
+}
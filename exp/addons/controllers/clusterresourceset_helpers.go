@@ -21,26 +21,247 @@ import (
 	"bytes"
 	"context"
 	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
 	"encoding/json"
 	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 	"unicode"
 
 	"github.com/pkg/errors"
 	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
 	kerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/util/jsonpath"
+	"k8s.io/client-go/util/retry"
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
 	addonsv1 "sigs.k8s.io/cluster-api/exp/addons/api/v1alpha3"
 	"sigs.k8s.io/cluster-api/util"
 	utilresource "sigs.k8s.io/cluster-api/util/resource"
 	utilyaml "sigs.k8s.io/cluster-api/util/yaml"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
 )
 
-var jsonListPrefix = []byte("[")
+var (
+	jsonListPrefix = []byte("[")
+	crdGroupKind   = schema.GroupKind{Group: "apiextensions.k8s.io", Kind: "CustomResourceDefinition"}
+
+	// kindInstallOrder is the order in which objects are applied with SortByKind, based on the install order of Helm.
+	// Namespaces and CustomResourceDefinitions go first since other objects may depend on them, followed by the RBAC
+	// objects used by workloads. Objects whose kinds are not listed are applied after the listed ones, built-in objects
+	// before custom resources.
+	kindInstallOrder = []string{
+		"Namespace",
+		"CustomResourceDefinition",
+		"ServiceAccount",
+		"ClusterRole",
+		"ClusterRoleBinding",
+		"Role",
+		"RoleBinding",
+		"NetworkPolicy",
+		"ResourceQuota",
+		"LimitRange",
+		"PodSecurityPolicy",
+		"PodDisruptionBudget",
+		"PriorityClass",
+		"Secret",
+		"ConfigMap",
+		"StorageClass",
+		"PersistentVolume",
+		"PersistentVolumeClaim",
+		"Service",
+		"DaemonSet",
+		"Pod",
+		"ReplicationController",
+		"ReplicaSet",
+		"Deployment",
+		"HorizontalPodAutoscaler",
+		"StatefulSet",
+		"Job",
+		"CronJob",
+		"Ingress",
+		"APIService",
+	}
+
+	// neverReplacedKinds are the kinds of the objects that are not deleted and recreated in Replace mode, because
+	// replacing them disrupts running workloads or deletes the objects they contain.
+	neverReplacedKinds = map[schema.GroupKind]bool{
+		{Group: "apps", Kind: "Deployment"}:  true,
+		{Group: "apps", Kind: "StatefulSet"}: true,
+		{Group: "apps", Kind: "DaemonSet"}:   true,
+		{Group: "apps", Kind: "ReplicaSet"}:  true,
+		{Group: "", Kind: "Namespace"}:       true,
+		crdGroupKind:                         true,
+	}
+
+	// noMatchBackoff is the backoff used to retry creating objects whose kind is not known to the remote cluster yet.
+	noMatchBackoff = wait.Backoff{
+		Duration: 250 * time.Millisecond,
+		Factor:   2,
+		Jitter:   0.1,
+		Steps:    6,
+	}
+
+	// retryableStatusBackoff is the backoff used to retry applying an object after the API server responded with one of
+	// the retryable status codes.
+	retryableStatusBackoff = wait.Backoff{
+		Duration: 500 * time.Millisecond,
+		Factor:   2,
+		Jitter:   0.1,
+		Steps:    4,
+	}
+
+	// defaultRetryableStatusCodes are the status codes applying an object is retried for by default.
+	defaultRetryableStatusCodes = []int{http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusServiceUnavailable}
+)
+
+const (
+	crdEstablishedInterval = 250 * time.Millisecond
+	crdEstablishedTimeout  = 10 * time.Second
+
+	// fieldManager is the field manager used when creating objects, and when updating them with server-side apply,
+	// so that the controller owns the fields of the objects it created.
+	fieldManager = "clusterresourceset-controller"
+
+	// conflictRetryInterval is the initial interval between retries of updates failing because of field conflicts.
+	conflictRetryInterval = 100 * time.Millisecond
+
+	// hashPrefix identifies the format of the hashes computed by computeHash. It must be changed, and the previous
+	// format added to previousHashFormats, when the way hashes are computed changes.
+	hashPrefix = "v1:sha256:"
+
+	// maxChangeSummaryLength is the maximum length of the summaries of the changes made by applying a resource.
+	maxChangeSummaryLength = 256
+
+	// maxApplyErrorMessageLength is the maximum length of the apply error messages set in the conditions.
+	maxApplyErrorMessageLength = 1024
+
+	// replaceInterval and replaceTimeout bound the wait for replaced objects to be deleted before they are recreated.
+	replaceInterval = 250 * time.Millisecond
+	replaceTimeout  = 10 * time.Second
+)
+
+// applyOptions configures how the objects of a resource are applied to a cluster.
+type applyOptions struct {
+	// updateExisting updates objects that already exist in the cluster using server-side apply.
+	updateExisting bool
+
+	// conflictRetries is how many times an update failing because fields are owned by another field manager is retried.
+	conflictRetries int
+
+	// forceOwnership takes the ownership of the conflicting fields once the conflict retries are exhausted.
+	forceOwnership bool
+
+	// threeWayMerge updates objects that already exist with a three-way merge patch computed from their
+	// last-applied-configuration annotation rather than with server-side apply.
+	threeWayMerge bool
+
+	// sortByKind applies the objects in the order of kindInstallOrder rather than the default creation order.
+	sortByKind bool
+
+	// replaceImmutable deletes and recreates objects whose update is rejected because it changes immutable fields.
+	replaceImmutable bool
+
+	// deletePropagationPolicy is the propagation policy used when deleting the objects to replace. It defaults to
+	// background deletion.
+	deletePropagationPolicy metav1.DeletionPropagation
+
+	// onReplace, if set, is called for each object that is replaced.
+	onReplace func(obj *unstructured.Unstructured)
+
+	// onChange, if set, is called for each object that is created, updated or replaced.
+	onChange func(change objectChange)
+
+	// retryableStatusCodes are the status codes of the API server responses for which applying an object is retried
+	// with retryableStatusBackoff.
+	retryableStatusCodes []int
+}
+
+// objectChange describes what applying an object changed in a cluster.
+type objectChange struct {
+	// object identifies the object as "kind namespace/name".
+	object string
+
+	// action is either "created", "updated" or "replaced".
+	action string
+
+	// fields are the top-level fields changed by an update.
+	fields []string
+}
+
+func (c objectChange) String() string {
+	if len(c.fields) == 0 {
+		return fmt.Sprintf("%s %s", c.action, c.object)
+	}
+	return fmt.Sprintf("%s %s (%s)", c.action, c.object, strings.Join(c.fields, ", "))
+}
+
+// summarizeChanges returns a compact, human readable summary of the changes, truncated to maxChangeSummaryLength.
+func summarizeChanges(changes []objectChange) string {
+	if len(changes) == 0 {
+		return "no changes"
+	}
+	summary := ""
+	for i, change := range changes {
+		entry := change.String()
+		if i > 0 {
+			entry = "; " + entry
+		}
+		if len(summary)+len(entry) > maxChangeSummaryLength {
+			return fmt.Sprintf("%s; and %d more", summary, len(changes)-i)
+		}
+		summary += entry
+	}
+	return summary
+}
+
+func newObjectChange(obj *unstructured.Unstructured, action string, fields []string) objectChange {
+	return objectChange{
+		object: fmt.Sprintf("%s %s/%s", obj.GetKind(), obj.GetNamespace(), obj.GetName()),
+		action: action,
+		fields: fields,
+	}
+}
+
+// changedFields returns the top-level fields that differ between the object before and after an update, ignoring the
+// metadata managed by the API server and the status. Labels and annotations are reported as metadata.
+func changedFields(before, after *unstructured.Unstructured) []string {
+	beforeFields, afterFields := desiredFields(before), desiredFields(after)
+	keys := map[string]bool{}
+	for key := range beforeFields {
+		keys[key] = true
+	}
+	for key := range afterFields {
+		keys[key] = true
+	}
+
+	fields := []string{}
+	for key := range keys {
+		if !reflect.DeepEqual(beforeFields[key], afterFields[key]) {
+			fields = append(fields, key)
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
 
 // isJSONList returns whether the data is in JSON list format.
 func isJSONList(data []byte) (bool, error) {
@@ -54,11 +275,418 @@ func isJSONList(data []byte) (bool, error) {
 	return bytes.HasPrefix(trim, jsonListPrefix), nil
 }
 
-func apply(ctx context.Context, c client.Client, data []byte) error {
-	isJSONList, err := isJSONList(data)
+// apply creates the objects in data on the cluster. Objects that already exist are left untouched, unless
+// opts.updateExisting is true, in which case they are updated to match data.
+func apply(ctx context.Context, c client.Client, data []byte, opts applyOptions) error {
+	objs, err := parseObjects(data)
 	if err != nil {
 		return err
 	}
+
+	errList := []error{}
+	var sortedObjs []unstructured.Unstructured
+	if opts.sortByKind {
+		sortedObjs = sortObjectsByKind(objs)
+	} else {
+		sortedObjs = utilresource.SortForCreate(objs)
+	}
+	for i := range sortedObjs {
+		obj := &sortedObjs[i]
+		err := retry.OnError(retryableStatusBackoff, func(err error) bool {
+			return hasStatusCode(err, opts.retryableStatusCodes)
+		}, func() error {
+			return applyUnstructured(ctx, c, obj, opts)
+		})
+		if hasStatusCode(err, opts.retryableStatusCodes) {
+			err = &retryableStatusError{err: err}
+		}
+		if err != nil {
+			errList = append(errList, err)
+		}
+	}
+	return kerrors.NewAggregate(errList)
+}
+
+// hasStatusCode returns true if err is an API server response with one of the status codes.
+func hasStatusCode(err error, codes []int) bool {
+	status, ok := errors.Cause(err).(apierrors.APIStatus)
+	if !ok {
+		return false
+	}
+	for _, code := range codes {
+		if int(status.Status().Code) == code {
+			return true
+		}
+	}
+	return false
+}
+
+// retryableStatusError wraps the errors of objects whose apply still failed with a retryable status code after
+// being retried, which are transient whatever the status code.
+type retryableStatusError struct {
+	err error
+}
+
+func (e *retryableStatusError) Error() string {
+	return e.err.Error()
+}
+
+func (e *retryableStatusError) Cause() error {
+	return errors.Cause(e.err)
+}
+
+// patchObjects applies the objects in data as strategic merge patches to the existing objects with the same kind and name.
+// Custom resources do not support strategic merge patches, so they are patched using JSON merge patches instead.
+func patchObjects(ctx context.Context, c client.Client, data []byte) error {
+	objs, err := parseObjects(data)
+	if err != nil {
+		return err
+	}
+
+	errList := []error{}
+	for i := range objs {
+		obj := &objs[i]
+		patchData, err := obj.MarshalJSON()
+		if err != nil {
+			errList = append(errList, errors.Wrapf(err, "failed to marshal patch for %s %s/%s", obj.GroupVersionKind(), obj.GetNamespace(), obj.GetName()))
+			continue
+		}
+
+		target := &unstructured.Unstructured{}
+		target.SetGroupVersionKind(obj.GroupVersionKind())
+		target.SetNamespace(obj.GetNamespace())
+		target.SetName(obj.GetName())
+
+		err = c.Patch(ctx, target, client.RawPatch(types.StrategicMergePatchType, patchData))
+		if apierrors.IsUnsupportedMediaType(err) {
+			err = c.Patch(ctx, target, client.RawPatch(types.MergePatchType, patchData))
+		}
+		if err != nil {
+			errList = append(errList, errors.Wrapf(err, "failed to patch object %s %s/%s", obj.GroupVersionKind(), obj.GetNamespace(), obj.GetName()))
+		}
+	}
+	return kerrors.NewAggregate(errList)
+}
+
+// kindRank returns the position of the object's kind in kindInstallOrder. Objects whose kinds are not listed rank
+// after the listed ones, built-in objects before custom resources.
+func kindRank(obj *unstructured.Unstructured) int {
+	for i, kind := range kindInstallOrder {
+		if obj.GetKind() == kind {
+			return i
+		}
+	}
+	// Built-in API groups are either the core group, have no domain or are in the k8s.io domain.
+	group := obj.GroupVersionKind().Group
+	if !strings.Contains(group, ".") || strings.HasSuffix(group, ".k8s.io") {
+		return len(kindInstallOrder)
+	}
+	return len(kindInstallOrder) + 1
+}
+
+// sortObjectsByKind returns the objects sorted by kindInstallOrder. Objects with the same rank keep their order.
+func sortObjectsByKind(objs []unstructured.Unstructured) []unstructured.Unstructured {
+	sorted := make([]unstructured.Unstructured, len(objs))
+	copy(sorted, objs)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return kindRank(&sorted[i]) < kindRank(&sorted[j])
+	})
+	return sorted
+}
+
+// sortDataByKind merges the objects of all the values of a resource in a single JSON list, sorted by kindInstallOrder,
+// so that objects are applied in that order across all the values.
+func sortDataByKind(dataList [][]byte) ([][]byte, error) {
+	objs := []unstructured.Unstructured{}
+	for _, data := range dataList {
+		dataObjs, err := parseObjects(data)
+		if err != nil {
+			return nil, err
+		}
+		objs = append(objs, dataObjs...)
+	}
+	if len(objs) == 0 {
+		return dataList, nil
+	}
+
+	sorted := sortObjectsByKind(objs)
+	contents := make([]map[string]interface{}, 0, len(sorted))
+	for i := range sorted {
+		contents = append(contents, sorted[i].UnstructuredContent())
+	}
+	data, err := json.Marshal(contents)
+	if err != nil {
+		return nil, err
+	}
+	return [][]byte{data}, nil
+}
+
+// transformObjects runs transform on each object in data and returns the transformed objects in JSON list format.
+func transformObjects(data []byte, cluster *clusterv1.Cluster, transform func(*unstructured.Unstructured, *clusterv1.Cluster) error) ([]byte, error) {
+	objs, err := parseObjects(data)
+	if err != nil {
+		return nil, err
+	}
+
+	contents := make([]map[string]interface{}, 0, len(objs))
+	for i := range objs {
+		obj := &objs[i]
+		if err := transform(obj, cluster); err != nil {
+			return nil, errors.Wrapf(err, "failed to transform object %s %s/%s", obj.GroupVersionKind(), obj.GetNamespace(), obj.GetName())
+		}
+		contents = append(contents, obj.UnstructuredContent())
+	}
+	return json.Marshal(contents)
+}
+
+// objectsNotReady returns the objects in data, of the kind of the readiness check if set, that do not satisfy the
+// readiness check in the cluster. Objects that do not exist are not ready.
+func objectsNotReady(ctx context.Context, c client.Client, dataList [][]byte, check *addonsv1.ReadinessCheck) ([]string, error) {
+	notReady := []string{}
+	for _, data := range dataList {
+		objs, err := parseObjects(data)
+		if err != nil {
+			return nil, err
+		}
+		for i := range objs {
+			if check.Kind != "" && objs[i].GetKind() != check.Kind {
+				continue
+			}
+			name := fmt.Sprintf("%s %s", objs[i].GetKind(), objs[i].GetName())
+
+			current := &unstructured.Unstructured{}
+			current.SetGroupVersionKind(objs[i].GroupVersionKind())
+			if err := c.Get(ctx, util.ObjectKey(&objs[i]), current); err != nil {
+				if apierrors.IsNotFound(err) {
+					notReady = append(notReady, name)
+					continue
+				}
+				return nil, errors.Wrapf(err, "failed to get %s", name)
+			}
+
+			ready, err := evaluateReadiness(current, check.Expression)
+			if err != nil {
+				return nil, err
+			}
+			if !ready {
+				notReady = append(notReady, name)
+			}
+		}
+	}
+	return notReady, nil
+}
+
+// evaluateReadiness evaluates a readiness expression, i.e. a JSONPath optionally compared to a quoted value with == or !=,
+// against the object.
+func evaluateReadiness(obj *unstructured.Unstructured, expression string) (bool, error) {
+	path, operator, expected := expression, "", ""
+	if i := comparisonIndex(expression); i >= 0 {
+		path, operator = expression[:i], expression[i:i+2]
+		expected = strings.TrimSpace(expression[i+2:])
+		if unquoted, err := strconv.Unquote(expected); err == nil {
+			expected = unquoted
+		}
+	}
+	path = strings.TrimSpace(path)
+	if !strings.HasPrefix(path, "{") {
+		path = "{" + path + "}"
+	}
+
+	j := jsonpath.New("readyWhen").AllowMissingKeys(true)
+	if err := j.Parse(path); err != nil {
+		return false, errors.Wrapf(err, "invalid readiness expression %q", expression)
+	}
+	results, err := j.FindResults(obj.UnstructuredContent())
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to evaluate readiness expression %q", expression)
+	}
+	values := []string{}
+	for _, result := range results {
+		for _, v := range result {
+			values = append(values, fmt.Sprint(v.Interface()))
+		}
+	}
+	value := strings.Join(values, " ")
+
+	switch operator {
+	case "==":
+		return value == expected, nil
+	case "!=":
+		return value != expected, nil
+	default:
+		return value != "" && value != "false", nil
+	}
+}
+
+// comparisonIndex returns the index of the == or != operator in a readiness expression, ignoring the operators in
+// JSONPath filters and quoted strings, or -1 if there is none.
+func comparisonIndex(expression string) int {
+	depth, quoted := 0, false
+	for i := 0; i < len(expression)-1; i++ {
+		switch c := expression[i]; {
+		case c == '"':
+			quoted = !quoted
+		case quoted:
+		case c == '[' || c == '(' || c == '{':
+			depth++
+		case c == ']' || c == ')' || c == '}':
+			depth--
+		case depth == 0 && (c == '=' || c == '!') && expression[i+1] == '=':
+			return i
+		}
+	}
+	return -1
+}
+
+// namespacer returns a transform function that moves objects to the cluster's namespace in the management cluster.
+// Cluster-scoped objects are rejected when the RESTMapper is set, as they would affect the whole management cluster.
+func namespacer(mapper meta.RESTMapper) func(*unstructured.Unstructured, *clusterv1.Cluster) error {
+	return func(obj *unstructured.Unstructured, cluster *clusterv1.Cluster) error {
+		if mapper != nil {
+			gvk := obj.GroupVersionKind()
+			mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+			if err != nil {
+				return err
+			}
+			if mapping.Scope.Name() == meta.RESTScopeNameRoot {
+				return errors.New("cluster-scoped objects cannot be applied to the management cluster")
+			}
+		}
+		obj.SetNamespace(cluster.Namespace)
+		return nil
+	}
+}
+
+// provenanceLabeler returns a transform function that labels objects with the name of the ClusterResourceSet.
+// Names that are not valid label values are not added.
+func provenanceLabeler(clusterResourceSet *addonsv1.ClusterResourceSet) func(*unstructured.Unstructured, *clusterv1.Cluster) error {
+	return func(obj *unstructured.Unstructured, _ *clusterv1.Cluster) error {
+		if len(validation.IsValidLabelValue(clusterResourceSet.Name)) > 0 {
+			return nil
+		}
+		labels := obj.GetLabels()
+		if labels == nil {
+			labels = map[string]string{}
+		}
+		labels[addonsv1.ClusterResourceSetNameLabel] = clusterResourceSet.Name
+		obj.SetLabels(labels)
+		return nil
+	}
+}
+
+// endpointHost returns the lowercase host:port of an API server endpoint, given either as a URL or as host:port.
+// The port defaults to 443, so that endpoints written differently can be compared.
+func endpointHost(endpoint string) string {
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "https://" + endpoint
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return strings.ToLower(endpoint)
+	}
+	port := u.Port()
+	if port == "" {
+		port = "443"
+	}
+	return strings.ToLower(net.JoinHostPort(u.Hostname(), port))
+}
+
+// metadataPropagator returns a transform function that copies the labels and annotations of the ClusterResourceSet
+// listed in its PropagateLabels and PropagateAnnotations onto objects. Keys the ClusterResourceSet does not have are ignored.
+func metadataPropagator(clusterResourceSet *addonsv1.ClusterResourceSet) func(*unstructured.Unstructured, *clusterv1.Cluster) error {
+	return func(obj *unstructured.Unstructured, _ *clusterv1.Cluster) error {
+		obj.SetLabels(copyKeys(obj.GetLabels(), clusterResourceSet.GetLabels(), clusterResourceSet.Spec.PropagateLabels))
+		obj.SetAnnotations(copyKeys(obj.GetAnnotations(), clusterResourceSet.GetAnnotations(), clusterResourceSet.Spec.PropagateAnnotations))
+		return nil
+	}
+}
+
+// copyKeys copies the values of keys from src to dst, allocating dst if needed.
+func copyKeys(dst, src map[string]string, keys []string) map[string]string {
+	for _, key := range keys {
+		value, ok := src[key]
+		if !ok {
+			continue
+		}
+		if dst == nil {
+			dst = map[string]string{}
+		}
+		dst[key] = value
+	}
+	return dst
+}
+
+// deleteObjects deletes the objects in data from the cluster using the given propagation policy.
+// Objects are deleted in the reverse order of creation, and objects that do not exist are ignored.
+func deleteObjects(ctx context.Context, c client.Client, data []byte, policy metav1.DeletionPropagation) error {
+	objs, err := parseObjects(data)
+	if err != nil {
+		return err
+	}
+
+	errList := []error{}
+	sortedObjs := utilresource.SortForCreate(objs)
+	for i := len(sortedObjs) - 1; i >= 0; i-- {
+		obj := &sortedObjs[i]
+		if err := c.Delete(ctx, obj, client.PropagationPolicy(policy)); err != nil && !apierrors.IsNotFound(err) && !meta.IsNoMatchError(err) {
+			errList = append(errList, errors.Wrapf(err, "failed to delete object %s %s/%s", obj.GroupVersionKind(), obj.GetNamespace(), obj.GetName()))
+		}
+	}
+	return kerrors.NewAggregate(errList)
+}
+
+// deleteObjectsInReverseOrder deletes the objects of all the values in dataList from the cluster together, in the
+// reverse of the kindInstallOrder, so that objects are deleted before the objects they depend on, e.g. custom resources
+// before their CustomResourceDefinitions. Objects of the same kind are deleted in the reverse order of dataList.
+func deleteObjectsInReverseOrder(ctx context.Context, c client.Client, dataList [][]byte, policy metav1.DeletionPropagation) error {
+	objs := []unstructured.Unstructured{}
+	for _, data := range dataList {
+		dataObjs, err := parseObjects(data)
+		if err != nil {
+			return err
+		}
+		objs = append(objs, dataObjs...)
+	}
+
+	errList := []error{}
+	sortedObjs := sortObjectsByKind(objs)
+	for i := len(sortedObjs) - 1; i >= 0; i-- {
+		obj := &sortedObjs[i]
+		if err := c.Delete(ctx, obj, client.PropagationPolicy(policy)); err != nil && !apierrors.IsNotFound(err) && !meta.IsNoMatchError(err) {
+			errList = append(errList, errors.Wrapf(err, "failed to delete object %s %s/%s", obj.GroupVersionKind(), obj.GetNamespace(), obj.GetName()))
+		}
+	}
+	return kerrors.NewAggregate(errList)
+}
+
+// dataSize returns the total size in bytes of the values in dataList.
+func dataSize(dataList [][]byte) int64 {
+	var size int64
+	for _, data := range dataList {
+		size += int64(len(data))
+	}
+	return size
+}
+
+// objectCount returns the number of objects in dataList.
+func objectCount(dataList [][]byte) (int, error) {
+	count := 0
+	for _, data := range dataList {
+		objs, err := parseObjects(data)
+		if err != nil {
+			return 0, err
+		}
+		count += len(objs)
+	}
+	return count, nil
+}
+
+// parseObjects converts data in JSON list, JSON or YAML format to unstructured objects.
+func parseObjects(data []byte) ([]unstructured.Unstructured, error) {
+	isJSONList, err := isJSONList(data)
+	if err != nil {
+		return nil, err
+	}
 	objs := []unstructured.Unstructured{}
 	// If it is a json list, convert each list element to an unstructured object.
 	if isJSONList {
@@ -75,38 +703,700 @@ func apply(ctx context.Context, c client.Client, data []byte) error {
 		// If it is not a json list, data is either json or yaml format.
 		objs, err = utilyaml.ToUnstructured(data)
 		if err != nil {
-			return errors.Wrapf(err, "failed converting data to unstructured objects")
+			return nil, errors.Wrapf(err, "failed converting data to unstructured objects")
 		}
 	}
+	return expandLists(objs)
+}
 
-	errList := []error{}
-	sortedObjs := utilresource.SortForCreate(objs)
-	for i := range sortedObjs {
-		if err := applyUnstructured(ctx, c, &objs[i]); err != nil {
-			errList = append(errList, err)
+// expandLists replaces the objects of kind List, e.g. the output of "kubectl get -o yaml", with their items.
+func expandLists(objs []unstructured.Unstructured) ([]unstructured.Unstructured, error) {
+	expanded := make([]unstructured.Unstructured, 0, len(objs))
+	for i := range objs {
+		if !objs[i].IsList() {
+			expanded = append(expanded, objs[i])
+			continue
+		}
+		err := objs[i].EachListItem(func(item runtime.Object) error {
+			u, ok := item.(*unstructured.Unstructured)
+			if !ok {
+				return errors.Errorf("unexpected list item of type %T", item)
+			}
+			expanded = append(expanded, *u)
+			return nil
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed expanding %s", objs[i].GetKind())
 		}
 	}
-	return kerrors.NewAggregate(errList)
+	return expanded, nil
+}
+
+// objectsExist returns true if all objects in the data list exist in the cluster.
+func objectsExist(ctx context.Context, c client.Client, dataList [][]byte) (bool, error) {
+	for _, data := range dataList {
+		objs, err := parseObjects(data)
+		if err != nil {
+			return false, err
+		}
+		for i := range objs {
+			obj := &unstructured.Unstructured{}
+			obj.SetGroupVersionKind(objs[i].GroupVersionKind())
+			if err := c.Get(ctx, client.ObjectKey{Namespace: objs[i].GetNamespace(), Name: objs[i].GetName()}, obj); err != nil {
+				if apierrors.IsNotFound(err) || meta.IsNoMatchError(err) {
+					return false, nil
+				}
+				return false, errors.Wrapf(err, "failed to get object %s %s/%s", objs[i].GroupVersionKind(), objs[i].GetNamespace(), objs[i].GetName())
+			}
+		}
+	}
+	return true, nil
+}
+
+// disallowedObjects returns the objects in dataList whose kind is not in allowedKinds, formatted as "kind namespace/name".
+// Allowed kinds either match the kind of the objects in any API group, or their kind qualified by their group.
+func disallowedObjects(allowedKinds []string, dataList [][]byte) ([]string, error) {
+	allowed := sets.NewString(allowedKinds...)
+	disallowed := []string{}
+	for _, data := range dataList {
+		objs, err := parseObjects(data)
+		if err != nil {
+			return nil, err
+		}
+		for i := range objs {
+			gk := objs[i].GroupVersionKind().GroupKind()
+			if allowed.Has(gk.Kind) || (gk.Group != "" && allowed.Has(gk.String())) {
+				continue
+			}
+			disallowed = append(disallowed, fmt.Sprintf("%s %s/%s", gk.Kind, objs[i].GetNamespace(), objs[i].GetName()))
+		}
+	}
+	return disallowed, nil
+}
+
+// objectsWithoutNamespace returns the objects in dataList of namespaced kinds without a namespace, and the objects
+// without a namespace of kinds whose scope is unknown, formatted as "kind name". The scope of a kind is looked up in
+// the CustomResourceDefinitions in dataList first, as their objects are applied along with the definition, then with
+// the mapper of the cluster the objects are applied to.
+func objectsWithoutNamespace(mapper meta.RESTMapper, dataList [][]byte) ([]string, []string, error) {
+	missing, unknown := []string{}, []string{}
+	if mapper == nil {
+		return missing, unknown, nil
+	}
+	objs := []unstructured.Unstructured{}
+	for _, data := range dataList {
+		parsed, err := parseObjects(data)
+		if err != nil {
+			return nil, nil, err
+		}
+		objs = append(objs, parsed...)
+	}
+
+	definedScopes := map[schema.GroupKind]string{}
+	for i := range objs {
+		if objs[i].GroupVersionKind().GroupKind() != crdGroupKind {
+			continue
+		}
+		group, _, _ := unstructured.NestedString(objs[i].Object, "spec", "group")
+		kind, _, _ := unstructured.NestedString(objs[i].Object, "spec", "names", "kind")
+		scope, _, _ := unstructured.NestedString(objs[i].Object, "spec", "scope")
+		definedScopes[schema.GroupKind{Group: group, Kind: kind}] = scope
+	}
+
+	for i := range objs {
+		if objs[i].GetNamespace() != "" {
+			continue
+		}
+		gvk := objs[i].GroupVersionKind()
+		name := fmt.Sprintf("%s %s", gvk.Kind, objs[i].GetName())
+		if scope, ok := definedScopes[gvk.GroupKind()]; ok {
+			if scope == string(apiextensionsv1.NamespaceScoped) {
+				missing = append(missing, name)
+			}
+			continue
+		}
+		mapping, err := mapper.RESTMapping(gvk.GroupKind(), gvk.Version)
+		if meta.IsNoMatchError(err) {
+			unknown = append(unknown, name)
+			continue
+		}
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "failed to get the scope of %s", gvk.Kind)
+		}
+		if mapping.Scope.Name() == meta.RESTScopeNameNamespace {
+			missing = append(missing, name)
+		}
+	}
+	return missing, unknown, nil
+}
+
+// driftedObjects returns the objects of the resource whose fields in the cluster differ from the applied ones, or that
+// were deleted. Fields added to the objects in the cluster, e.g. defaults and status, and the ignored field paths are not
+// considered drift.
+func driftedObjects(ctx context.Context, c client.Client, dataList [][]byte, ignored []string) ([]string, error) {
+	drifted := []string{}
+	for _, data := range dataList {
+		objs, err := parseObjects(data)
+		if err != nil {
+			return nil, err
+		}
+		for i := range objs {
+			desired := &objs[i]
+			name := fmt.Sprintf("%s %s/%s", desired.GetKind(), desired.GetNamespace(), desired.GetName())
+			live := &unstructured.Unstructured{}
+			live.SetGroupVersionKind(desired.GroupVersionKind())
+			if err := c.Get(ctx, client.ObjectKey{Namespace: desired.GetNamespace(), Name: desired.GetName()}, live); err != nil {
+				if apierrors.IsNotFound(err) {
+					drifted = append(drifted, name)
+					continue
+				}
+				return nil, errors.Wrapf(err, "failed to get object %s", name)
+			}
+			fields := desiredFields(desired)
+			for _, path := range ignored {
+				unstructured.RemoveNestedField(fields, strings.Split(path, ".")...)
+			}
+			if !isSubset(fields, live.Object) {
+				drifted = append(drifted, name)
+			}
+		}
+	}
+	return drifted, nil
+}
+
+// desiredFields returns the fields of the object set by the ClusterResourceSet, i.e. all of them except the metadata
+// managed by the API server and the status.
+func desiredFields(obj *unstructured.Unstructured) map[string]interface{} {
+	fields := obj.DeepCopy().Object
+	delete(fields, "status")
+	objMetadata, _ := fields["metadata"].(map[string]interface{})
+	metadata := map[string]interface{}{}
+	for _, key := range []string{"labels", "annotations"} {
+		if value, ok := objMetadata[key]; ok {
+			metadata[key] = value
+		}
+	}
+	fields["metadata"] = metadata
+	return fields
 }
 
-func applyUnstructured(ctx context.Context, c client.Client, obj *unstructured.Unstructured) error {
+// isSubset returns true if all the fields of desired have the same values in actual. Lists must have the same length.
+func isSubset(desired, actual interface{}) bool {
+	switch d := desired.(type) {
+	case map[string]interface{}:
+		a, ok := actual.(map[string]interface{})
+		if !ok {
+			return len(d) == 0 && actual == nil
+		}
+		for key, value := range d {
+			if !isSubset(value, a[key]) {
+				return false
+			}
+		}
+		return true
+	case []interface{}:
+		a, ok := actual.([]interface{})
+		if !ok {
+			return len(d) == 0 && actual == nil
+		}
+		if len(d) != len(a) {
+			return false
+		}
+		for i := range d {
+			if !isSubset(d[i], a[i]) {
+				return false
+			}
+		}
+		return true
+	case nil:
+		return true
+	}
+
+	// Numbers decoded from YAML are float64 while numbers read from the API server are int64.
+	if df, ok := toFloat(desired); ok {
+		af, ok := toFloat(actual)
+		return ok && df == af
+	}
+	return reflect.DeepEqual(desired, actual)
+}
+
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int64:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+// quotaShortages returns the ResourceQuotas, in the namespaces of the objects in the data list, that do not leave room
+// for the objects that do not exist in the cluster yet. This is a best-effort check of object count quotas only.
+func quotaShortages(ctx context.Context, c client.Client, dataList [][]byte) ([]string, error) {
+	// needed is the number of objects to create by namespace and quota resource name.
+	needed := map[string]map[corev1.ResourceName]int64{}
+	for _, data := range dataList {
+		objs, err := parseObjects(data)
+		if err != nil {
+			return nil, err
+		}
+		for i := range objs {
+			namespace := objs[i].GetNamespace()
+			if namespace == "" {
+				continue
+			}
+			obj := &unstructured.Unstructured{}
+			obj.SetGroupVersionKind(objs[i].GroupVersionKind())
+			if err := c.Get(ctx, client.ObjectKey{Namespace: namespace, Name: objs[i].GetName()}, obj); err == nil {
+				continue
+			} else if !apierrors.IsNotFound(err) && !meta.IsNoMatchError(err) {
+				return nil, errors.Wrapf(err, "failed to get object %s %s/%s", objs[i].GroupVersionKind(), namespace, objs[i].GetName())
+			}
+			if needed[namespace] == nil {
+				needed[namespace] = map[corev1.ResourceName]int64{}
+			}
+			for _, name := range quotaResourceNames(objs[i].GroupVersionKind()) {
+				needed[namespace][name]++
+			}
+		}
+	}
+
+	namespaces := make([]string, 0, len(needed))
+	for namespace := range needed {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+
+	shortages := []string{}
+	for _, namespace := range namespaces {
+		quotas := &corev1.ResourceQuotaList{}
+		if err := c.List(ctx, quotas, client.InNamespace(namespace)); err != nil {
+			return nil, errors.Wrapf(err, "failed to list ResourceQuotas in namespace %s", namespace)
+		}
+		for _, quota := range quotas.Items {
+			for name, count := range needed[namespace] {
+				hard, ok := quota.Status.Hard[name]
+				if !ok {
+					continue
+				}
+				used := quota.Status.Used[name]
+				if available := hard.Value() - used.Value(); available < count {
+					shortages = append(shortages, fmt.Sprintf("%s/%s %s (%d needed, %d available)", namespace, quota.Name, name, count, available))
+				}
+			}
+		}
+	}
+	sort.Strings(shortages)
+	return shortages, nil
+}
+
+// quotaResourceNames returns the names of the object count quotas that objects of the given kind consume.
+func quotaResourceNames(gvk schema.GroupVersionKind) []corev1.ResourceName {
+	resource, _ := meta.UnsafeGuessKindToResource(gvk)
+	name := "count/" + resource.Resource
+	if resource.Group != "" {
+		name += "." + resource.Group
+	}
+	names := []corev1.ResourceName{corev1.ResourceName(name)}
+
+	// Core resources can also be limited using their legacy quota names.
+	if resource.Group == "" {
+		switch corev1.ResourceName(resource.Resource) {
+		case corev1.ResourcePods, corev1.ResourceServices, corev1.ResourceConfigMaps, corev1.ResourceSecrets,
+			corev1.ResourcePersistentVolumeClaims, corev1.ResourceReplicationControllers, corev1.ResourceQuotas:
+			names = append(names, corev1.ResourceName(resource.Resource))
+		}
+	}
+	return names
+}
+
+// applyUnstructured creates the object on the remote cluster.
+// Custom resources applied in the same pass as their CRD may hit a NoMatch error until the CRD is served and
+// the client's dynamic RESTMapper has reloaded the API server's resources, so those errors are retried.
+func applyUnstructured(ctx context.Context, c client.Client, obj *unstructured.Unstructured, opts applyOptions) error {
+	var modified []byte
+	if opts.threeWayMerge {
+		var err error
+		if modified, err = setLastAppliedConfiguration(obj); err != nil {
+			return err
+		}
+	}
+
+	var createErr error
 	// Create the object on the API server.
-	// TODO: Errors are only logged. If needed, exponential backoff or requeuing could be used here for remedying connection glitches etc.
-	if err := c.Create(ctx, obj); err != nil {
+	err := wait.ExponentialBackoff(noMatchBackoff, func() (bool, error) {
+		createErr = c.Create(ctx, obj, client.FieldOwner(fieldManager))
+		if createErr == nil && opts.onChange != nil {
+			opts.onChange(newObjectChange(obj, "created", nil))
+		}
+		if apierrors.IsAlreadyExists(createErr) && opts.updateExisting {
+			if opts.threeWayMerge {
+				createErr = mergeUnstructured(ctx, c, obj, modified, opts)
+			} else {
+				createErr = updateUnstructured(ctx, c, obj, opts)
+			}
+		}
 		// The create call is idempotent, so if the object already exists
 		// then do not consider it to be an error.
-		if !apierrors.IsAlreadyExists(err) {
-			return errors.Wrapf(
-				err,
-				"failed to create object %s %s/%s",
-				obj.GroupVersionKind(),
-				obj.GetNamespace(),
-				obj.GetName())
+		if createErr == nil || apierrors.IsAlreadyExists(createErr) {
+			return true, nil
+		}
+		if delay, ok := apiutil.DelayIfRateLimited(createErr); ok {
+			// The delay asked by the API server may exceed the reconcile deadline.
+			select {
+			case <-ctx.Done():
+				return false, ctx.Err()
+			case <-time.After(delay):
+			}
+			return false, nil
+		}
+		return false, ignoreNoMatch(createErr)
+	})
+	if err != nil {
+		return errors.Wrapf(
+			createErr,
+			"failed to create object %s %s/%s",
+			obj.GroupVersionKind(),
+			obj.GetNamespace(),
+			obj.GetName())
+	}
+
+	if obj.GroupVersionKind().GroupKind() == crdGroupKind {
+		return waitForCRDEstablished(ctx, c, obj)
+	}
+	return nil
+}
+
+// updateUnstructured updates an existing object on the API server to match obj using server-side apply.
+// Updates failing because fields are owned by another field manager are retried opts.conflictRetries times,
+// then the ownership of the fields is taken if opts.forceOwnership is true.
+func updateUnstructured(ctx context.Context, c client.Client, obj *unstructured.Unstructured, opts applyOptions) error {
+	// The object is read before updating it to report the changed fields.
+	var before *unstructured.Unstructured
+	if opts.onChange != nil {
+		before = &unstructured.Unstructured{}
+		before.SetGroupVersionKind(obj.GroupVersionKind())
+		if err := c.Get(ctx, client.ObjectKey{Namespace: obj.GetNamespace(), Name: obj.GetName()}, before); err != nil {
+			before = nil
+		}
+	}
+
+	backoff := wait.Backoff{
+		Duration: conflictRetryInterval,
+		Factor:   2,
+		Jitter:   0.1,
+		Steps:    opts.conflictRetries + 1,
+	}
+	err := retry.RetryOnConflict(backoff, func() error {
+		return c.Patch(ctx, obj, client.Apply, client.FieldOwner(fieldManager))
+	})
+	if apierrors.IsConflict(err) && opts.forceOwnership {
+		err = c.Patch(ctx, obj, client.Apply, client.FieldOwner(fieldManager), client.ForceOwnership)
+	}
+	if opts.replaceImmutable && isImmutableFieldError(err) {
+		return replaceUnstructured(ctx, c, obj, err, opts)
+	}
+	if err == nil && opts.onChange != nil {
+		if before == nil {
+			opts.onChange(newObjectChange(obj, "updated", nil))
+		} else if fields := changedFields(before, obj); len(fields) > 0 {
+			opts.onChange(newObjectChange(obj, "updated", fields))
+		}
+	}
+	return err
+}
+
+// replaceUnstructured deletes the existing object and creates obj in its place, after its update failed with updateErr
+// because it changes immutable fields. Objects of kinds whose replacement is disruptive are never replaced.
+func replaceUnstructured(ctx context.Context, c client.Client, obj *unstructured.Unstructured, updateErr error, opts applyOptions) error {
+	if neverReplacedKinds[obj.GroupVersionKind().GroupKind()] {
+		return errors.Wrapf(updateErr, "refusing to replace %s", obj.GetKind())
+	}
+
+	// The new object is validated before deleting the existing one, so that an object failing validation for other
+	// reasons is not deleted without anything to replace it.
+	dryRun := obj.DeepCopy()
+	dryRun.SetResourceVersion("")
+	if err := c.Create(ctx, dryRun, client.DryRunAll, client.FieldOwner(fieldManager)); err != nil && !apierrors.IsAlreadyExists(err) {
+		return errors.Wrap(err, "refusing to replace object failing validation")
+	}
+
+	existing := &unstructured.Unstructured{}
+	existing.SetGroupVersionKind(obj.GroupVersionKind())
+	existing.SetNamespace(obj.GetNamespace())
+	existing.SetName(obj.GetName())
+	propagationPolicy := opts.deletePropagationPolicy
+	if propagationPolicy == "" {
+		propagationPolicy = metav1.DeletePropagationBackground
+	}
+	if err := c.Delete(ctx, existing, client.PropagationPolicy(propagationPolicy)); err != nil && !apierrors.IsNotFound(err) {
+		return errors.Wrap(err, "failed to delete object to replace it")
+	}
+
+	// The object may be kept until its finalizers are removed, in which case creating it fails until it is gone.
+	var createErr error
+	err := wait.PollImmediate(replaceInterval, replaceTimeout, func() (bool, error) {
+		obj.SetResourceVersion("")
+		createErr = c.Create(ctx, obj, client.FieldOwner(fieldManager))
+		if apierrors.IsAlreadyExists(createErr) {
+			return false, nil
 		}
+		return createErr == nil, createErr
+	})
+	if err == wait.ErrWaitTimeout {
+		return errors.Errorf("timed out waiting for the replaced object to be deleted")
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to recreate object")
+	}
+
+	if opts.onReplace != nil {
+		opts.onReplace(obj)
+	}
+	if opts.onChange != nil {
+		opts.onChange(newObjectChange(obj, "replaced", nil))
 	}
 	return nil
 }
 
+// isFieldConflict returns true if err, or any of the errors it aggregates, is caused by a conflict.
+func isFieldConflict(err error) bool {
+	if agg, ok := err.(kerrors.Aggregate); ok {
+		for _, e := range agg.Errors() {
+			if isFieldConflict(e) {
+				return true
+			}
+		}
+		return false
+	}
+	return apierrors.IsConflict(errors.Cause(err))
+}
+
+// applyErrorClass tells whether retrying a failed apply is expected to succeed.
+type applyErrorClass string
+
+const (
+	// unknownApplyError is the class of errors that cannot be classified, which are retried at the next reconcile.
+	unknownApplyError applyErrorClass = ""
+
+	// transientApplyError is the class of errors that are likely to go away, which are retried with a backoff.
+	transientApplyError applyErrorClass = "Transient"
+
+	// permanentApplyError is the class of errors that retrying does not fix.
+	permanentApplyError applyErrorClass = "Permanent"
+)
+
+// classifyApplyError returns the class of an apply error. Aggregated errors are permanent if any of them is,
+// so that resources are not retried over and over because of a single transient error.
+func classifyApplyError(err error) applyErrorClass {
+	if agg, ok := err.(kerrors.Aggregate); ok {
+		class := unknownApplyError
+		for _, e := range agg.Errors() {
+			switch classifyApplyError(e) {
+			case permanentApplyError:
+				return permanentApplyError
+			case transientApplyError:
+				class = transientApplyError
+			}
+		}
+		return class
+	}
+
+	if _, ok := err.(*retryableStatusError); ok {
+		return transientApplyError
+	}
+	cause := errors.Cause(err)
+	switch {
+	case apierrors.IsInvalid(cause), apierrors.IsBadRequest(cause), apierrors.IsForbidden(cause), apierrors.IsMethodNotSupported(cause):
+		return permanentApplyError
+	case apierrors.IsTimeout(cause), apierrors.IsServerTimeout(cause), apierrors.IsTooManyRequests(cause),
+		apierrors.IsInternalError(cause), apierrors.IsServiceUnavailable(cause), apierrors.IsUnexpectedServerError(cause):
+		return transientApplyError
+	}
+	if netErr, ok := cause.(net.Error); ok && netErr.Timeout() {
+		return transientApplyError
+	}
+	return unknownApplyError
+}
+
+// applyErrorMessage returns the message of an apply error, including the field-level causes reported by the API server
+// that are not already part of it, e.g. "spec.template.spec.containers[0].image: Required value" for an object
+// rejected by a webhook. The message is truncated to maxApplyErrorMessageLength to keep the conditions readable.
+func applyErrorMessage(err error) string {
+	errs := []error{err}
+	if agg, ok := err.(kerrors.Aggregate); ok {
+		errs = kerrors.Flatten(agg).Errors()
+	}
+	messages := make([]string, 0, len(errs))
+	for _, e := range errs {
+		messages = append(messages, withStatusCauses(e))
+	}
+	msg := messages[0]
+	if len(messages) > 1 {
+		msg = "[" + strings.Join(messages, ", ") + "]"
+	}
+	if len(msg) > maxApplyErrorMessageLength {
+		msg = msg[:maxApplyErrorMessageLength-3] + "..."
+	}
+	return msg
+}
+
+// isImmutableFieldError returns true if err is an API server validation error caused by changing an immutable field.
+func isImmutableFieldError(err error) bool {
+	if !apierrors.IsInvalid(err) {
+		return false
+	}
+	status, ok := errors.Cause(err).(apierrors.APIStatus)
+	if !ok || status.Status().Details == nil {
+		return false
+	}
+	for _, cause := range status.Status().Details.Causes {
+		if strings.Contains(cause.Message, "field is immutable") {
+			return true
+		}
+	}
+	return false
+}
+
+// withStatusCauses returns the message of err followed by the causes of the API server status it wraps, if any,
+// formatted as "<field>: <message>".
+func withStatusCauses(err error) string {
+	msg := err.Error()
+	status, ok := errors.Cause(err).(apierrors.APIStatus)
+	if !ok || status.Status().Details == nil {
+		return msg
+	}
+	causes := []string{}
+	for _, cause := range status.Status().Details.Causes {
+		c := cause.Message
+		if cause.Field != "" {
+			c = cause.Field + ": " + c
+		}
+		if c == "" || strings.Contains(msg, c) {
+			continue
+		}
+		causes = append(causes, c)
+	}
+	if len(causes) == 0 {
+		return msg
+	}
+	return fmt.Sprintf("%s (%s)", msg, strings.Join(causes, "; "))
+}
+
+// transientError wraps transient apply errors, so that the reconcile is retried with a backoff.
+type transientError struct {
+	err error
+}
+
+func (e *transientError) Error() string {
+	return e.err.Error()
+}
+
+// isTransientError returns true if err, or any of the errors it aggregates, is a transient apply error.
+func isTransientError(err error) bool {
+	if agg, ok := err.(kerrors.Aggregate); ok {
+		for _, e := range agg.Errors() {
+			if isTransientError(e) {
+				return true
+			}
+		}
+		return false
+	}
+	_, ok := errors.Cause(err).(*transientError)
+	return ok
+}
+
+// invalidSelectorError wraps the errors converting the cluster selectors of a ClusterResourceSet, to tell them apart
+// from the errors listing clusters.
+type invalidSelectorError struct {
+	err error
+}
+
+func (e *invalidSelectorError) Error() string {
+	return e.err.Error()
+}
+
+// isInvalidSelectorError returns true if err is caused by an invalid cluster selector.
+func isInvalidSelectorError(err error) bool {
+	_, ok := errors.Cause(err).(*invalidSelectorError)
+	return ok
+}
+
+func ignoreNoMatch(err error) error {
+	if meta.IsNoMatchError(err) {
+		return nil
+	}
+	return err
+}
+
+// waitForCRDEstablished waits until the CustomResourceDefinition is established, so that custom resources
+// applied after it can be served by the API server.
+func waitForCRDEstablished(ctx context.Context, c client.Client, crd *unstructured.Unstructured) error {
+	key := client.ObjectKey{Name: crd.GetName()}
+	err := wait.PollImmediate(crdEstablishedInterval, crdEstablishedTimeout, func() (bool, error) {
+		obj := &unstructured.Unstructured{}
+		obj.SetGroupVersionKind(crd.GroupVersionKind())
+		if err := c.Get(ctx, key, obj); err != nil {
+			// The CustomResourceDefinition is not waited for past the reconcile deadline.
+			if ctx.Err() != nil {
+				return false, ctx.Err()
+			}
+			return false, nil
+		}
+		conditions, _, err := unstructured.NestedSlice(obj.Object, "status", "conditions")
+		if err != nil {
+			return false, nil
+		}
+		for _, c := range conditions {
+			condition, ok := c.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if condition["type"] == "Established" && condition["status"] == "True" {
+				return true, nil
+			}
+		}
+		return false, nil
+	})
+	return errors.Wrapf(err, "failed waiting for CustomResourceDefinition %s to be established", crd.GetName())
+}
+
+// prerequisiteExists returns true if the object referenced by the prerequisite exists in the cluster.
+// An object whose kind is not known to the cluster yet, e.g. because its CRD is not installed, is considered not to exist.
+func prerequisiteExists(ctx context.Context, c client.Client, ref *addonsv1.PrerequisiteRef) (bool, error) {
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion(ref.APIVersion)
+	obj.SetKind(ref.Kind)
+
+	key := client.ObjectKey{Namespace: ref.Namespace, Name: ref.Name}
+	if err := c.Get(ctx, key, obj); err != nil {
+		if apierrors.IsNotFound(err) || meta.IsNoMatchError(err) {
+			return false, nil
+		}
+		return false, errors.Wrapf(err, "failed to get prerequisite %s %s", ref.Kind, key)
+	}
+	return true, nil
+}
+
+// featureFlagValue returns the value of the feature flag in the cluster, and whether the flag was found.
+// A flag whose ConfigMap or key does not exist yet is not found.
+func featureFlagValue(ctx context.Context, c client.Client, ref *addonsv1.FeatureFlagRef) (string, bool, error) {
+	configMap := &corev1.ConfigMap{}
+	key := client.ObjectKey{Namespace: ref.Namespace, Name: ref.Name}
+	if err := c.Get(ctx, key, configMap); err != nil {
+		if apierrors.IsNotFound(err) {
+			return "", false, nil
+		}
+		return "", false, errors.Wrapf(err, "failed to get feature flag ConfigMap %s", key)
+	}
+	value, ok := configMap.Data[ref.Key]
+	return value, ok, nil
+}
+
 // getOrCreateClusterResourceSetBinding retrieves ClusterResourceSetBinding resource owned by the cluster or create a new one if not found.
 func (r *ClusterResourceSetReconciler) getOrCreateClusterResourceSetBinding(ctx context.Context, cluster *clusterv1.Cluster, clusterResourceSet *addonsv1.ClusterResourceSet) (*addonsv1.ClusterResourceSetBinding, error) {
 	clusterResourceSetBinding := &addonsv1.ClusterResourceSetBinding{}
@@ -159,6 +1449,67 @@ func getConfigMap(ctx context.Context, c client.Client, configmapName types.Name
 	return configMap, nil
 }
 
+// getSelectedConfigMaps retrieves the ConfigMaps selected by the resource in the given namespace, and returns them as a
+// single unstructured ConfigMap. Its data holds the values of all the ConfigMaps, with keys that sort in the order of
+// the ConfigMaps, so that they are applied in that order and hashed deterministically.
+func getSelectedConfigMaps(ctx context.Context, c client.Client, resourceRef addonsv1.ResourceRef, namespace string) (*unstructured.Unstructured, error) {
+	selector, err := metav1.LabelSelectorAsSelector(resourceRef.Selector)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid selector of %s %s", resourceRef.Kind, resourceRef.Name)
+	}
+	configMapList := &corev1.ConfigMapList{}
+	if err := c.List(ctx, configMapList, client.InNamespace(namespace), client.MatchingLabelsSelector{Selector: selector}); err != nil {
+		return nil, errors.Wrapf(err, "failed to list ConfigMaps selected by %s %s", resourceRef.Kind, resourceRef.Name)
+	}
+	if len(configMapList.Items) == 0 {
+		return nil, apierrors.NewNotFound(corev1.Resource("configmaps"), resourceRef.Name)
+	}
+
+	configMaps := configMapList.Items
+	sort.SliceStable(configMaps, func(i, j int) bool {
+		return configMapNameLess(configMaps[i].Name, configMaps[j].Name)
+	})
+	data := map[string]interface{}{}
+	for i := range configMaps {
+		for key, value := range configMaps[i].Data {
+			data[fmt.Sprintf("%06d-%s/%s", i, configMaps[i].Name, key)] = value
+		}
+	}
+
+	resource := &unstructured.Unstructured{Object: map[string]interface{}{"data": data}}
+	resource.SetAPIVersion("v1")
+	resource.SetKind("ConfigMap")
+	resource.SetNamespace(namespace)
+	resource.SetName(resourceRef.Name)
+	return resource, nil
+}
+
+// configMapNameLess orders ConfigMap names by their number prefix, e.g. "10-crds" before "20-operator", then by name.
+// Names without a number prefix are ordered after the ones with a prefix.
+func configMapNameLess(a, b string) bool {
+	aNumber, aOK := namePrefixNumber(a)
+	bNumber, bOK := namePrefixNumber(b)
+	switch {
+	case aOK && !bOK:
+		return true
+	case !aOK && bOK:
+		return false
+	case aOK && bOK && aNumber != bNumber:
+		return aNumber < bNumber
+	}
+	return a < b
+}
+
+// namePrefixNumber returns the number the name starts with, if any.
+func namePrefixNumber(name string) (int, bool) {
+	end := strings.IndexFunc(name, func(r rune) bool { return !unicode.IsDigit(r) })
+	if end == -1 {
+		end = len(name)
+	}
+	number, err := strconv.Atoi(name[:end])
+	return number, err == nil
+}
+
 // getSecret retrieves any Secret from the given secret name and namespace.
 func getSecret(ctx context.Context, c client.Client, secretName types.NamespacedName) (*corev1.Secret, error) {
 	secret := &corev1.Secret{}
@@ -173,7 +1524,144 @@ func getSecret(ctx context.Context, c client.Client, secretName types.Namespaced
 	return secret, nil
 }
 
+// normalizeData returns the values in the data field of a Secret or ConfigMap ordered by their keys.
+// If keys are given, only the values of these keys are returned, in the given order.
+// Values of Secrets are base64 decoded.
+func normalizeData(resource *unstructured.Unstructured, kind string, keys []string) ([][]byte, error) {
+	data, ok := resource.UnstructuredContent()["data"]
+	if !ok {
+		return nil, errors.New("failed to get data field from the resource")
+	}
+
+	unstructuredData, ok := data.(map[string]interface{})
+	if !ok {
+		return nil, errors.Errorf("data field of the resource is of type %T, expected a map", data)
+	}
+
+	if len(keys) == 0 {
+		// Since maps are not ordered, we need to order them to get the same hash at each reconcile.
+		keys = make([]string, 0, len(unstructuredData))
+		for key := range unstructuredData {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+	}
+
+	dataList := make([][]byte, 0, len(keys))
+	for _, key := range keys {
+		val, ok, err := unstructured.NestedString(unstructuredData, key)
+		if !ok || err != nil {
+			return nil, errors.Errorf("failed to get value of key %q from the resource", key)
+		}
+
+		byteArr := []byte(val)
+		// If the resource is a Secret, data needs to be decoded.
+		if kind == string(addonsv1.SecretClusterResourceSetResourceKind) {
+			byteArr, err = base64.StdEncoding.DecodeString(val)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to decode value of key %q from the resource", key)
+			}
+		}
+
+		dataList = append(dataList, byteArr)
+	}
+	return dataList, nil
+}
+
+// ignoredFields returns the field paths listed in the ignore-fields annotation of a resource.
+func ignoredFields(resource *unstructured.Unstructured) []string {
+	value, ok := resource.GetAnnotations()[addonsv1.ClusterResourceSetIgnoreFieldsAnnotation]
+	if !ok {
+		return nil
+	}
+
+	paths := []string{}
+	for _, path := range strings.Split(value, ",") {
+		if path = strings.TrimSpace(path); path != "" {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// computeResourceHash computes the hash of a resource's data. The fields listed in the resource's ignore-fields annotation
+// are removed from the objects in the data first, so that changes to them are not considered a change of the resource.
+func computeResourceHash(resource *unstructured.Unstructured, dataList [][]byte) (string, error) {
+	return computeResourceHashWith(resource, dataList, computeHash)
+}
+
+// computeResourceHashWith computes the hash of the resource's data using hashFunc, ignoring the fields listed in the
+// resource's ignore-fields annotation.
+func computeResourceHashWith(resource *unstructured.Unstructured, dataList [][]byte, hashFunc func([][]byte) string) (string, error) {
+	paths := ignoredFields(resource)
+	if len(paths) == 0 {
+		return hashFunc(dataList), nil
+	}
+
+	normalizedList := [][]byte{}
+	for _, data := range dataList {
+		objs, err := parseObjects(data)
+		if err != nil {
+			return "", err
+		}
+		for i := range objs {
+			for _, path := range paths {
+				unstructured.RemoveNestedField(objs[i].Object, strings.Split(path, ".")...)
+			}
+			normalized, err := json.Marshal(objs[i].Object)
+			if err != nil {
+				return "", errors.Wrapf(err, "failed to marshal object %s %s/%s", objs[i].GroupVersionKind(), objs[i].GetNamespace(), objs[i].GetName())
+			}
+			normalizedList = append(normalizedList, normalized)
+		}
+	}
+	return hashFunc(normalizedList), nil
+}
+
+// hashFormat is a format of the hashes recorded in ClusterResourceSetBindings, identified by the prefix of the hashes.
+type hashFormat struct {
+	prefix  string
+	compute func([][]byte) string
+}
+
+// previousHashFormats are the formats of the hashes recorded by previous versions of the controller. Hashes in these
+// formats are recognized and migrated to the current format without applying unchanged resources again.
+var previousHashFormats = []hashFormat{
+	{prefix: "sha256:", compute: computeLegacyHash},
+}
+
+// resourceHashMatches returns true if the hash recorded for the resource matches its current hash. Hashes recorded in
+// one of the previous formats are compared with the hash of the resource in that format.
+func resourceHashMatches(recorded, hash string, resource *unstructured.Unstructured, dataList [][]byte) bool {
+	if recorded == hash {
+		return true
+	}
+	if strings.HasPrefix(recorded, hashPrefix) {
+		return false
+	}
+	for _, format := range previousHashFormats {
+		if !strings.HasPrefix(recorded, format.prefix) {
+			continue
+		}
+		previous, err := computeResourceHashWith(resource, dataList, format.compute)
+		return err == nil && previous == recorded
+	}
+	return false
+}
+
+// computeHash returns the hash of the data in the current format. Each value is prefixed with its length, so that
+// moving data from a value to the next one changes the hash.
 func computeHash(dataArr [][]byte) string {
+	hash := sha256.New()
+	for i := range dataArr {
+		_ = binary.Write(hash, binary.BigEndian, uint64(len(dataArr[i])))
+		_, _ = hash.Write(dataArr[i])
+	}
+	return fmt.Sprintf("%s%x", hashPrefix, hash.Sum(nil))
+}
+
+// computeLegacyHash returns the hash of the data in the format used before hashes were versioned.
+func computeLegacyHash(dataArr [][]byte) string {
 	hash := sha256.New()
 	for i := range dataArr {
 		_, err := hash.Write(dataArr[i])
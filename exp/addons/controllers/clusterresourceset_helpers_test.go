@@ -18,18 +18,45 @@ package controllers
 
 import (
 	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
 	"testing"
 	"time"
 
 	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 
+	appsv1 "k8s.io/api/apps/v1"
 	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/apimachinery/pkg/types"
+	kerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/record"
 	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
+	"sigs.k8s.io/cluster-api/controllers/metrics"
+	capierrors "sigs.k8s.io/cluster-api/errors"
 	addonsv1 "sigs.k8s.io/cluster-api/exp/addons/api/v1alpha3"
+	"sigs.k8s.io/cluster-api/feature"
+	"sigs.k8s.io/cluster-api/util"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/cluster-api/util/kubeconfig"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
 )
 
 func TestGetorCreateClusterResourceSetBinding(t *testing.T) {
@@ -227,3 +254,3678 @@ func TestGetConfigMapFromNamespacedName(t *testing.T) {
 		})
 	}
 }
+
+func TestPrerequisiteExists(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(corev1.AddToScheme(scheme)).To(Succeed())
+
+	existingNamespace := &corev1.Namespace{
+		TypeMeta: metav1.TypeMeta{Kind: "Namespace", APIVersion: "v1"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "calico-system",
+		},
+	}
+
+	tests := []struct {
+		name   string
+		ref    *addonsv1.PrerequisiteRef
+		exists bool
+	}{
+		{
+			name:   "should return true when the object exists",
+			ref:    &addonsv1.PrerequisiteRef{APIVersion: "v1", Kind: "Namespace", Name: "calico-system"},
+			exists: true,
+		},
+		{
+			name:   "should return false when the object does not exist",
+			ref:    &addonsv1.PrerequisiteRef{APIVersion: "v1", Kind: "Namespace", Name: "tigera-operator"},
+			exists: false,
+		},
+		{
+			name:   "should return false when an object of the same name but different kind exists",
+			ref:    &addonsv1.PrerequisiteRef{APIVersion: "v1", Kind: "ConfigMap", Name: "calico-system", Namespace: "default"},
+			exists: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gs := NewWithT(t)
+
+			c := fake.NewFakeClientWithScheme(
+				scheme,
+				existingNamespace,
+			)
+
+			exists, err := prerequisiteExists(context.TODO(), c, tt.ref)
+			gs.Expect(err).NotTo(HaveOccurred())
+			gs.Expect(exists).To(Equal(tt.exists))
+		})
+	}
+}
+
+func TestGetResourceWithSharedNamespace(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(corev1.AddToScheme(scheme)).To(Succeed())
+
+	clusterConfigMap := &corev1.ConfigMap{
+		TypeMeta: metav1.TypeMeta{Kind: "ConfigMap", APIVersion: "v1"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "overridden-configmap",
+			Namespace: "default",
+		},
+	}
+	sharedConfigMaps := []*corev1.ConfigMap{
+		{
+			TypeMeta: metav1.TypeMeta{Kind: "ConfigMap", APIVersion: "v1"},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "overridden-configmap",
+				Namespace: "shared",
+			},
+		},
+		{
+			TypeMeta: metav1.TypeMeta{Kind: "ConfigMap", APIVersion: "v1"},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      "shared-configmap",
+				Namespace: "shared",
+			},
+		},
+	}
+
+	tests := []struct {
+		name            string
+		sharedNamespace string
+		resourceRef     addonsv1.ResourceRef
+		wantNamespace   string
+		wantErr         bool
+	}{
+		{
+			name:            "should prefer the resource in the cluster's namespace",
+			sharedNamespace: "shared",
+			resourceRef:     addonsv1.ResourceRef{Name: "overridden-configmap", Kind: "ConfigMap"},
+			wantNamespace:   "default",
+		},
+		{
+			name:            "should fall back to the shared namespace",
+			sharedNamespace: "shared",
+			resourceRef:     addonsv1.ResourceRef{Name: "shared-configmap", Kind: "ConfigMap"},
+			wantNamespace:   "shared",
+		},
+		{
+			name:            "should return error if no shared namespace is configured",
+			sharedNamespace: "",
+			resourceRef:     addonsv1.ResourceRef{Name: "shared-configmap", Kind: "ConfigMap"},
+			wantErr:         true,
+		},
+		{
+			name:            "should return error if the resource does not exist in either namespace",
+			sharedNamespace: "shared",
+			resourceRef:     addonsv1.ResourceRef{Name: "missing-configmap", Kind: "ConfigMap"},
+			wantErr:         true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gs := NewWithT(t)
+
+			c := fake.NewFakeClientWithScheme(
+				scheme,
+				clusterConfigMap,
+				sharedConfigMaps[0],
+				sharedConfigMaps[1],
+			)
+			r := &ClusterResourceSetReconciler{
+				Client:          c,
+				SharedNamespace: tt.sharedNamespace,
+			}
+
+			got, err := r.getResource(context.Background(), tt.resourceRef, "default")
+			if tt.wantErr {
+				gs.Expect(err).To(HaveOccurred())
+				return
+			}
+			gs.Expect(err).NotTo(HaveOccurred())
+			gs.Expect(got.GetNamespace()).To(Equal(tt.wantNamespace))
+		})
+	}
+}
+
+func TestNormalizeData(t *testing.T) {
+	tests := []struct {
+		name     string
+		resource *unstructured.Unstructured
+		kind     string
+		keys     []string
+		want     [][]byte
+		wantErr  bool
+	}{
+		{
+			name: "should return ConfigMap values ordered by key",
+			resource: &unstructured.Unstructured{Object: map[string]interface{}{
+				"data": map[string]interface{}{"b": "second", "a": "first"},
+			}},
+			kind: "ConfigMap",
+			want: [][]byte{[]byte("first"), []byte("second")},
+		},
+		{
+			name: "should return only the values of the given keys in the given order",
+			resource: &unstructured.Unstructured{Object: map[string]interface{}{
+				"data": map[string]interface{}{"a": "first", "b": "second", "c": "third"},
+			}},
+			kind: "ConfigMap",
+			keys: []string{"c", "a"},
+			want: [][]byte{[]byte("third"), []byte("first")},
+		},
+		{
+			name: "should return error if a given key does not exist",
+			resource: &unstructured.Unstructured{Object: map[string]interface{}{
+				"data": map[string]interface{}{"a": "first"},
+			}},
+			kind:    "ConfigMap",
+			keys:    []string{"missing"},
+			wantErr: true,
+		},
+		{
+			name: "should decode Secret values",
+			resource: &unstructured.Unstructured{Object: map[string]interface{}{
+				"data": map[string]interface{}{"a": base64.StdEncoding.EncodeToString([]byte("decoded"))},
+			}},
+			kind: "Secret",
+			want: [][]byte{[]byte("decoded")},
+		},
+		{
+			name:     "should return error if data field is missing",
+			resource: &unstructured.Unstructured{Object: map[string]interface{}{}},
+			kind:     "ConfigMap",
+			wantErr:  true,
+		},
+		{
+			name: "should return error if data field is not a map",
+			resource: &unstructured.Unstructured{Object: map[string]interface{}{
+				"data": "malformed",
+			}},
+			kind:    "ConfigMap",
+			wantErr: true,
+		},
+		{
+			name: "should return error if a value is not a string",
+			resource: &unstructured.Unstructured{Object: map[string]interface{}{
+				"data": map[string]interface{}{"a": int64(1)},
+			}},
+			kind:    "ConfigMap",
+			wantErr: true,
+		},
+		{
+			name: "should return error if a Secret value is not base64 encoded",
+			resource: &unstructured.Unstructured{Object: map[string]interface{}{
+				"data": map[string]interface{}{"a": "not base64!"},
+			}},
+			kind:    "Secret",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gs := NewWithT(t)
+
+			got, err := normalizeData(tt.resource, tt.kind, tt.keys)
+			if tt.wantErr {
+				gs.Expect(err).To(HaveOccurred())
+				return
+			}
+			gs.Expect(err).NotTo(HaveOccurred())
+			gs.Expect(got).To(Equal(tt.want))
+		})
+	}
+}
+
+func TestGetResourceWithSecretSourceLabel(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(corev1.AddToScheme(scheme)).To(Succeed())
+
+	labeledSecret := &corev1.Secret{
+		TypeMeta: metav1.TypeMeta{Kind: "Secret", APIVersion: "v1"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "labeled-secret",
+			Namespace: "default",
+			Labels:    map[string]string{addonsv1.ClusterResourceSetSourceLabel: "true"},
+		},
+		Type: addonsv1.ClusterResourceSetSecretType,
+	}
+	unlabeledSecret := &corev1.Secret{
+		TypeMeta: metav1.TypeMeta{Kind: "Secret", APIVersion: "v1"},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "unlabeled-secret",
+			Namespace: "default",
+		},
+		Type: addonsv1.ClusterResourceSetSecretType,
+	}
+
+	tests := []struct {
+		name                     string
+		requireSecretSourceLabel bool
+		secretName               string
+		wantErr                  error
+	}{
+		{
+			name:                     "should return an unlabeled secret if the label is not required",
+			requireSecretSourceLabel: false,
+			secretName:               unlabeledSecret.Name,
+		},
+		{
+			name:                     "should return a labeled secret if the label is required",
+			requireSecretSourceLabel: true,
+			secretName:               labeledSecret.Name,
+		},
+		{
+			name:                     "should return error for an unlabeled secret if the label is required",
+			requireSecretSourceLabel: true,
+			secretName:               unlabeledSecret.Name,
+			wantErr:                  ErrSecretSourceLabelMissing,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gs := NewWithT(t)
+
+			c := fake.NewFakeClientWithScheme(
+				scheme,
+				labeledSecret,
+				unlabeledSecret,
+			)
+			r := &ClusterResourceSetReconciler{
+				Client:                   c,
+				RequireSecretSourceLabel: tt.requireSecretSourceLabel,
+			}
+
+			_, err := r.getResource(context.Background(), addonsv1.ResourceRef{Name: tt.secretName, Kind: "Secret"}, "default")
+			if tt.wantErr != nil {
+				gs.Expect(err).To(Equal(tt.wantErr))
+				return
+			}
+			gs.Expect(err).NotTo(HaveOccurred())
+		})
+	}
+}
+
+// staleMapperClient simulates a remote cluster whose RESTMapper does not know custom resource kinds until
+// their CRD has been created, and keeps returning NoMatch errors for a number of calls afterwards.
+type staleMapperClient struct {
+	client.Client
+	staleCalls int
+}
+
+func (c *staleMapperClient) Create(ctx context.Context, obj runtime.Object, opts ...client.CreateOption) error {
+	u := obj.(*unstructured.Unstructured)
+	switch u.GetKind() {
+	case "CustomResourceDefinition":
+		conditions := []interface{}{map[string]interface{}{"type": "Established", "status": "True"}}
+		if err := unstructured.SetNestedSlice(u.Object, conditions, "status", "conditions"); err != nil {
+			return err
+		}
+	case "Foo":
+		crd := &unstructured.Unstructured{}
+		crd.SetGroupVersionKind(crdGroupKind.WithVersion("v1"))
+		if err := c.Client.Get(ctx, client.ObjectKey{Name: "foos.example.com"}, crd); err != nil || c.staleCalls > 0 {
+			c.staleCalls--
+			return &meta.NoKindMatchError{GroupKind: u.GroupVersionKind().GroupKind(), SearchedVersions: []string{"v1"}}
+		}
+	}
+	return c.Client.Create(ctx, obj, opts...)
+}
+
+func TestApplyCRDAndCustomResource(t *testing.T) {
+	g := NewWithT(t)
+
+	// The custom resource is listed before its CRD to verify objects are applied in creation order.
+	data := []byte(`apiVersion: example.com/v1
+kind: Foo
+metadata:
+  name: my-foo
+  namespace: default
+---
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: foos.example.com
+spec:
+  group: example.com
+  names:
+    kind: Foo
+    plural: foos
+  scope: Namespaced
+`)
+
+	c := &staleMapperClient{
+		Client:     fake.NewFakeClientWithScheme(runtime.NewScheme()),
+		staleCalls: 1,
+	}
+	g.Expect(apply(context.Background(), c, data, applyOptions{})).To(Succeed())
+
+	foo := &unstructured.Unstructured{}
+	foo.SetAPIVersion("example.com/v1")
+	foo.SetKind("Foo")
+	g.Expect(c.Client.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: "my-foo"}, foo)).To(Succeed())
+}
+
+// conflictClient simulates a remote cluster where another field manager owns fields of the applied objects,
+// so server-side apply patches fail with a conflict unless the ownership is forced or the conflict went away.
+type conflictClient struct {
+	client.Client
+	conflicts int
+	patches   int
+	forced    bool
+}
+
+func (c *conflictClient) Patch(ctx context.Context, obj runtime.Object, patch client.Patch, opts ...client.PatchOption) error {
+	c.patches++
+	patchOpts := &client.PatchOptions{}
+	patchOpts.ApplyOptions(opts)
+	if patchOpts.Force != nil && *patchOpts.Force {
+		c.forced = true
+		return nil
+	}
+	if c.conflicts > 0 {
+		c.conflicts--
+		return apierrors.NewConflict(schema.GroupResource{Resource: "configmaps"}, "foo", errors.New("field is owned by another manager"))
+	}
+	return nil
+}
+
+// fieldManagerClient simulates the field ownership of a remote cluster, where server-side apply patches conflict
+// with the fields set by the field manager that created the object unless the ownership is forced.
+type fieldManagerClient struct {
+	client.Client
+	managers map[client.ObjectKey]string
+}
+
+func (c *fieldManagerClient) Create(ctx context.Context, obj runtime.Object, opts ...client.CreateOption) error {
+	if err := c.Client.Create(ctx, obj, opts...); err != nil {
+		return err
+	}
+	createOpts := &client.CreateOptions{}
+	createOpts.ApplyOptions(opts)
+	manager := createOpts.FieldManager
+	if manager == "" {
+		// The API server defaults the field manager to the user agent of the client.
+		manager = "manager"
+	}
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return err
+	}
+	c.managers[client.ObjectKey{Namespace: accessor.GetNamespace(), Name: accessor.GetName()}] = manager
+	return nil
+}
+
+func (c *fieldManagerClient) Patch(ctx context.Context, obj runtime.Object, patch client.Patch, opts ...client.PatchOption) error {
+	if patch.Type() != types.ApplyPatchType {
+		return c.Client.Patch(ctx, obj, patch, opts...)
+	}
+	patchOpts := &client.PatchOptions{}
+	patchOpts.ApplyOptions(opts)
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return err
+	}
+	key := client.ObjectKey{Namespace: accessor.GetNamespace(), Name: accessor.GetName()}
+	if c.managers[key] != patchOpts.FieldManager && (patchOpts.Force == nil || !*patchOpts.Force) {
+		return apierrors.NewConflict(schema.GroupResource{Resource: "configmaps"}, key.Name, errors.Errorf("fields are owned by %q", c.managers[key]))
+	}
+	c.managers[key] = patchOpts.FieldManager
+	return c.Client.Patch(ctx, obj, client.Merge, opts...)
+}
+
+func TestApplyUpdatesObjectsCreatedByTheController(t *testing.T) {
+	g := NewWithT(t)
+
+	c := &fieldManagerClient{Client: fake.NewFakeClientWithScheme(runtime.NewScheme()), managers: map[client.ObjectKey]string{}}
+	opts := applyOptions{updateExisting: true}
+	g.Expect(apply(context.Background(), c, []byte("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: foo\n  namespace: default\ndata:\n  key: before\n"), opts)).To(Succeed())
+	g.Expect(apply(context.Background(), c, []byte("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: foo\n  namespace: default\ndata:\n  key: after\n"), opts)).To(Succeed())
+
+	cm := &unstructured.Unstructured{}
+	cm.SetAPIVersion("v1")
+	cm.SetKind("ConfigMap")
+	g.Expect(c.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: "foo"}, cm)).To(Succeed())
+	value, _, err := unstructured.NestedString(cm.Object, "data", "key")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(value).To(Equal("after"))
+	g.Expect(c.managers).To(HaveKeyWithValue(client.ObjectKey{Namespace: "default", Name: "foo"}, fieldManager))
+}
+
+// statusClient simulates a remote cluster behind a flaky load balancer, failing creates with the given status code.
+type statusClient struct {
+	client.Client
+	code     int
+	failures int
+	creates  int
+}
+
+func (c *statusClient) Create(ctx context.Context, obj runtime.Object, opts ...client.CreateOption) error {
+	c.creates++
+	if c.failures > 0 {
+		c.failures--
+		return apierrors.NewGenericServerResponse(int(c.code), "create", schema.GroupResource{}, "", "flaky", 0, false)
+	}
+	return c.Client.Create(ctx, obj, opts...)
+}
+
+// rateLimitedClient simulates a remote cluster asking to retry the creation of objects after retryAfter seconds.
+type rateLimitedClient struct {
+	client.Client
+	retryAfter int
+}
+
+func (c *rateLimitedClient) Create(ctx context.Context, obj runtime.Object, opts ...client.CreateOption) error {
+	return apierrors.NewTooManyRequests("rate limited", c.retryAfter)
+}
+
+func TestApplyStopsWaitingAtDeadline(t *testing.T) {
+	g := NewWithT(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	// The rate limited creation is not retried past the deadline.
+	start := time.Now()
+	c := &rateLimitedClient{Client: fake.NewFakeClientWithScheme(runtime.NewScheme()), retryAfter: 60}
+	g.Expect(apply(ctx, c, []byte("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: foo\n  namespace: default\n"), applyOptions{})).NotTo(Succeed())
+	g.Expect(time.Since(start)).To(BeNumerically("<", 10*time.Second))
+
+	// Neither is the CustomResourceDefinition waited for.
+	crd := &unstructured.Unstructured{}
+	crd.SetAPIVersion("apiextensions.k8s.io/v1")
+	crd.SetKind("CustomResourceDefinition")
+	crd.SetName("foos.example.com")
+	start = time.Now()
+	err := waitForCRDEstablished(ctx, fake.NewFakeClientWithScheme(runtime.NewScheme()), crd)
+	g.Expect(errors.Cause(err)).To(Equal(context.DeadlineExceeded))
+	g.Expect(time.Since(start)).To(BeNumerically("<", crdEstablishedTimeout))
+}
+
+func TestApplyRetryableStatusCodes(t *testing.T) {
+	defer func(backoff wait.Backoff) { retryableStatusBackoff = backoff }(retryableStatusBackoff)
+	retryableStatusBackoff = wait.Backoff{Duration: time.Millisecond, Steps: 3}
+
+	data := []byte("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: foo\n  namespace: default\n")
+	opts := applyOptions{retryableStatusCodes: []int{http.StatusServiceUnavailable, http.StatusGatewayTimeout}}
+	tests := []struct {
+		name            string
+		code            int
+		failures        int
+		expectedClass   applyErrorClass
+		expectedCreates int
+	}{
+		{name: "should succeed when the endpoint recovers within the retries", code: http.StatusGatewayTimeout, failures: 2, expectedCreates: 3},
+		{name: "should report a transient failure once the retries are exhausted", code: http.StatusGatewayTimeout, failures: 5, expectedClass: transientApplyError, expectedCreates: 3},
+		{name: "should not retry other status codes", code: http.StatusBadRequest, failures: 1, expectedClass: permanentApplyError, expectedCreates: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			c := &statusClient{Client: fake.NewFakeClientWithScheme(runtime.NewScheme()), code: tt.code, failures: tt.failures}
+			err := apply(context.Background(), c, data, opts)
+			g.Expect(c.creates).To(Equal(tt.expectedCreates))
+			if tt.expectedClass == unknownApplyError {
+				g.Expect(err).NotTo(HaveOccurred())
+				return
+			}
+			g.Expect(err).To(HaveOccurred())
+			g.Expect(classifyApplyError(err)).To(Equal(tt.expectedClass))
+		})
+	}
+}
+
+func TestUpdateUnstructuredConflicts(t *testing.T) {
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion("v1")
+	obj.SetKind("ConfigMap")
+	obj.SetNamespace("default")
+	obj.SetName("foo")
+
+	tests := []struct {
+		name            string
+		conflicts       int
+		opts            applyOptions
+		expectErr       bool
+		expectForced    bool
+		expectedPatches int
+	}{
+		{
+			name:            "should succeed when the conflict is resolved within the retries",
+			conflicts:       2,
+			opts:            applyOptions{updateExisting: true, conflictRetries: 2},
+			expectedPatches: 3,
+		},
+		{
+			name:            "should fail when the conflict is not resolved within the retries",
+			conflicts:       3,
+			opts:            applyOptions{updateExisting: true, conflictRetries: 1},
+			expectErr:       true,
+			expectedPatches: 2,
+		},
+		{
+			name:            "should force ownership when the conflict is not resolved within the retries",
+			conflicts:       3,
+			opts:            applyOptions{updateExisting: true, conflictRetries: 1, forceOwnership: true},
+			expectForced:    true,
+			expectedPatches: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			c := &conflictClient{Client: fake.NewFakeClientWithScheme(runtime.NewScheme()), conflicts: tt.conflicts}
+			err := updateUnstructured(context.Background(), c, obj.DeepCopy(), tt.opts)
+			if tt.expectErr {
+				g.Expect(err).To(HaveOccurred())
+				g.Expect(isFieldConflict(kerrors.NewAggregate([]error{errors.Wrap(err, "failed to apply")}))).To(BeTrue())
+			} else {
+				g.Expect(err).NotTo(HaveOccurred())
+			}
+			g.Expect(c.forced).To(Equal(tt.expectForced))
+			g.Expect(c.patches).To(Equal(tt.expectedPatches))
+		})
+	}
+}
+
+// immutableClient simulates a remote cluster rejecting updates of the applied objects as invalid, with the given
+// causes, and rejecting the creation of objects with createErr. It records the propagation policy of deletions.
+type immutableClient struct {
+	client.Client
+	causes      []metav1.StatusCause
+	createErr   error
+	propagation metav1.DeletionPropagation
+}
+
+func (c *immutableClient) Delete(ctx context.Context, obj runtime.Object, opts ...client.DeleteOption) error {
+	deleteOpts := &client.DeleteOptions{}
+	deleteOpts.ApplyOptions(opts)
+	if deleteOpts.PropagationPolicy != nil {
+		c.propagation = *deleteOpts.PropagationPolicy
+	}
+	return c.Client.Delete(ctx, obj, opts...)
+}
+
+func (c *immutableClient) Patch(ctx context.Context, obj runtime.Object, patch client.Patch, opts ...client.PatchOption) error {
+	errs := field.ErrorList{}
+	for _, cause := range c.causes {
+		errs = append(errs, field.Invalid(field.NewPath(cause.Field), nil, cause.Message))
+	}
+	return apierrors.NewInvalid(schema.GroupKind{Kind: obj.GetObjectKind().GroupVersionKind().Kind}, "foo", errs)
+}
+
+func (c *immutableClient) Create(ctx context.Context, obj runtime.Object, opts ...client.CreateOption) error {
+	if c.createErr != nil {
+		return c.createErr
+	}
+	return c.Client.Create(ctx, obj, opts...)
+}
+
+func TestUpdateUnstructuredReplacesImmutable(t *testing.T) {
+	newObj := func(apiVersion, kind string, data map[string]interface{}) *unstructured.Unstructured {
+		obj := &unstructured.Unstructured{Object: map[string]interface{}{}}
+		obj.SetAPIVersion(apiVersion)
+		obj.SetKind(kind)
+		obj.SetNamespace("default")
+		obj.SetName("foo")
+		for k, v := range data {
+			obj.Object[k] = v
+		}
+		return obj
+	}
+
+	tests := []struct {
+		name              string
+		existing          *unstructured.Unstructured
+		obj               *unstructured.Unstructured
+		causes            []metav1.StatusCause
+		createErr         error
+		opts              applyOptions
+		expectErr         bool
+		expectPropagation metav1.DeletionPropagation
+	}{
+		{
+			name:      "should fail without replaceImmutable",
+			existing:  newObj("v1", "ConfigMap", map[string]interface{}{"data": map[string]interface{}{"a": "old"}}),
+			obj:       newObj("v1", "ConfigMap", map[string]interface{}{"data": map[string]interface{}{"a": "new"}}),
+			opts:      applyOptions{updateExisting: true},
+			expectErr: true,
+		},
+		{
+			name:              "should delete and recreate the object with replaceImmutable",
+			existing:          newObj("v1", "ConfigMap", map[string]interface{}{"data": map[string]interface{}{"a": "old"}}),
+			obj:               newObj("v1", "ConfigMap", map[string]interface{}{"data": map[string]interface{}{"a": "new"}}),
+			causes:            []metav1.StatusCause{{Field: "data", Message: "field is immutable"}},
+			opts:              applyOptions{updateExisting: true, replaceImmutable: true},
+			expectPropagation: metav1.DeletePropagationBackground,
+		},
+		{
+			name:              "should delete the object to replace with the propagation policy",
+			existing:          newObj("v1", "ConfigMap", map[string]interface{}{"data": map[string]interface{}{"a": "old"}}),
+			obj:               newObj("v1", "ConfigMap", map[string]interface{}{"data": map[string]interface{}{"a": "new"}}),
+			causes:            []metav1.StatusCause{{Field: "data", Message: "field is immutable"}},
+			opts:              applyOptions{updateExisting: true, replaceImmutable: true, deletePropagationPolicy: metav1.DeletePropagationOrphan},
+			expectPropagation: metav1.DeletePropagationOrphan,
+		},
+		{
+			name:      "should not replace objects invalid for other reasons than immutable fields",
+			existing:  newObj("v1", "ConfigMap", map[string]interface{}{"data": map[string]interface{}{"a": "old"}}),
+			obj:       newObj("v1", "ConfigMap", map[string]interface{}{"data": map[string]interface{}{"a": "new"}}),
+			causes:    []metav1.StatusCause{{Field: "data", Message: "must be a valid key"}},
+			opts:      applyOptions{updateExisting: true, replaceImmutable: true},
+			expectErr: true,
+		},
+		{
+			name:      "should not replace objects whose creation fails validation",
+			existing:  newObj("v1", "ConfigMap", map[string]interface{}{"data": map[string]interface{}{"a": "old"}}),
+			obj:       newObj("v1", "ConfigMap", map[string]interface{}{"data": map[string]interface{}{"a": "new"}}),
+			causes:    []metav1.StatusCause{{Field: "data", Message: "field is immutable"}},
+			createErr: apierrors.NewInvalid(schema.GroupKind{Kind: "ConfigMap"}, "foo", nil),
+			opts:      applyOptions{updateExisting: true, replaceImmutable: true},
+			expectErr: true,
+		},
+		{
+			name:      "should not replace Deployments",
+			existing:  newObj("apps/v1", "Deployment", nil),
+			obj:       newObj("apps/v1", "Deployment", map[string]interface{}{"spec": map[string]interface{}{"replicas": int64(2)}}),
+			causes:    []metav1.StatusCause{{Field: "spec.selector", Message: "field is immutable"}},
+			opts:      applyOptions{updateExisting: true, replaceImmutable: true},
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			c := &immutableClient{
+				Client:    fake.NewFakeClientWithScheme(runtime.NewScheme(), tt.existing),
+				causes:    tt.causes,
+				createErr: tt.createErr,
+			}
+			replaced := []string{}
+			tt.opts.onReplace = func(obj *unstructured.Unstructured) {
+				replaced = append(replaced, obj.GetName())
+			}
+
+			err := updateUnstructured(context.Background(), c, tt.obj, tt.opts)
+			if tt.expectErr {
+				g.Expect(err).To(HaveOccurred())
+				g.Expect(replaced).To(BeEmpty())
+
+				// The existing object is kept.
+				got := &unstructured.Unstructured{}
+				got.SetGroupVersionKind(tt.existing.GroupVersionKind())
+				g.Expect(c.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: "foo"}, got)).To(Succeed())
+				return
+			}
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(replaced).To(Equal([]string{"foo"}))
+			g.Expect(c.propagation).To(Equal(tt.expectPropagation))
+
+			got := &unstructured.Unstructured{}
+			got.SetGroupVersionKind(tt.obj.GroupVersionKind())
+			g.Expect(c.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: "foo"}, got)).To(Succeed())
+			g.Expect(got.Object["data"]).To(Equal(tt.obj.Object["data"]))
+		})
+	}
+}
+
+func TestReserveApply(t *testing.T) {
+	g := NewWithT(t)
+
+	cluster := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "test-cluster", Namespace: "default"}}
+	otherCluster := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "other-cluster", Namespace: "default"}}
+
+	r := &ClusterResourceSetReconciler{}
+	g.Expect(r.reserveApply(cluster)).To(BeZero())
+	g.Expect(r.reserveApply(cluster)).To(BeZero())
+
+	r = &ClusterResourceSetReconciler{MinApplyInterval: time.Minute}
+	g.Expect(r.reserveApply(cluster)).To(BeZero())
+	g.Expect(r.reserveApply(cluster)).To(BeNumerically(">", 0))
+	g.Expect(r.reserveApply(otherCluster)).To(BeZero())
+}
+
+func TestDisallowedObjects(t *testing.T) {
+	g := NewWithT(t)
+
+	dataList := [][]byte{[]byte(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+  namespace: addons
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: addon
+  namespace: addons
+---
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRoleBinding
+metadata:
+  name: admin
+`)}
+
+	disallowed, err := disallowedObjects([]string{"ConfigMap", "Deployment.apps"}, dataList)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(disallowed).To(Equal([]string{"ClusterRoleBinding /admin"}))
+
+	disallowed, err = disallowedObjects([]string{"ConfigMap", "Deployment.extensions", "ClusterRoleBinding"}, dataList)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(disallowed).To(Equal([]string{"Deployment addons/addon"}))
+}
+
+func TestObjectsExist(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(corev1.AddToScheme(scheme)).To(Succeed())
+
+	existingConfigMap := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "existing",
+			Namespace: "default",
+		},
+	}
+	c := fake.NewFakeClientWithScheme(scheme, existingConfigMap)
+
+	existingData := []byte(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: existing
+  namespace: default
+`)
+	missingData := []byte(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: missing
+  namespace: default
+`)
+
+	tests := []struct {
+		name     string
+		dataList [][]byte
+		expected bool
+	}{
+		{
+			name:     "should return true if all objects exist",
+			dataList: [][]byte{existingData},
+			expected: true,
+		},
+		{
+			name:     "should return false if any object is missing",
+			dataList: [][]byte{existingData, missingData},
+			expected: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gs := NewWithT(t)
+
+			exist, err := objectsExist(context.Background(), c, tt.dataList)
+			gs.Expect(err).NotTo(HaveOccurred())
+			gs.Expect(exist).To(Equal(tt.expected))
+		})
+	}
+}
+
+func TestDriftedObjects(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(corev1.AddToScheme(scheme)).To(Succeed())
+
+	c := fake.NewFakeClientWithScheme(scheme,
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "unchanged", Namespace: "default", Labels: map[string]string{"foo": "bar", "added": "true"}},
+			Data:       map[string]string{"key": "value"},
+		},
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "changed", Namespace: "default"},
+			Data:       map[string]string{"key": "other-value"},
+		},
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "ignored", Namespace: "default", Labels: map[string]string{"foo": "bar"}},
+			Data:       map[string]string{"key": "other-value"},
+		},
+	)
+
+	newData := func(name string) []byte {
+		return []byte(fmt.Sprintf(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: %s
+  namespace: default
+  labels:
+    foo: bar
+data:
+  key: value
+`, name))
+	}
+
+	drifted, err := driftedObjects(context.Background(), c, [][]byte{newData("unchanged")}, nil)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(drifted).To(BeEmpty())
+
+	drifted, err = driftedObjects(context.Background(), c, [][]byte{newData("unchanged"), newData("changed"), newData("deleted")}, nil)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(drifted).To(Equal([]string{"ConfigMap default/changed", "ConfigMap default/deleted"}))
+
+	// Ignored fields differing in the cluster are not drift.
+	drifted, err = driftedObjects(context.Background(), c, [][]byte{newData("ignored")}, []string{"data.key"})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(drifted).To(BeEmpty())
+}
+
+func TestIsSubset(t *testing.T) {
+	tests := []struct {
+		name     string
+		desired  interface{}
+		actual   interface{}
+		expected bool
+	}{
+		{
+			name:     "should ignore fields added to the actual object",
+			desired:  map[string]interface{}{"spec": map[string]interface{}{"replicas": float64(1)}},
+			actual:   map[string]interface{}{"spec": map[string]interface{}{"replicas": int64(1), "paused": false}},
+			expected: true,
+		},
+		{
+			name:     "should detect changed values",
+			desired:  map[string]interface{}{"spec": map[string]interface{}{"replicas": float64(1)}},
+			actual:   map[string]interface{}{"spec": map[string]interface{}{"replicas": int64(2)}},
+			expected: false,
+		},
+		{
+			name:     "should detect removed fields",
+			desired:  map[string]interface{}{"data": map[string]interface{}{"key": "value"}},
+			actual:   map[string]interface{}{"data": map[string]interface{}{}},
+			expected: false,
+		},
+		{
+			name:     "should detect items added to lists",
+			desired:  map[string]interface{}{"items": []interface{}{"a"}},
+			actual:   map[string]interface{}{"items": []interface{}{"a", "b"}},
+			expected: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			g.Expect(isSubset(tt.desired, tt.actual)).To(Equal(tt.expected))
+		})
+	}
+}
+
+func TestChangedFields(t *testing.T) {
+	g := NewWithT(t)
+
+	before := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "apps/v1",
+		"kind":       "Deployment",
+		"metadata":   map[string]interface{}{"name": "foo", "resourceVersion": "1", "labels": map[string]interface{}{"foo": "bar"}},
+		"spec":       map[string]interface{}{"replicas": int64(1)},
+		"status":     map[string]interface{}{"replicas": int64(1)},
+	}}
+	after := before.DeepCopy()
+	after.SetResourceVersion("2")
+	g.Expect(unstructured.SetNestedField(after.Object, int64(2), "status", "replicas")).To(Succeed())
+	g.Expect(changedFields(before, after)).To(BeEmpty())
+
+	g.Expect(unstructured.SetNestedField(after.Object, int64(2), "spec", "replicas")).To(Succeed())
+	after.SetLabels(map[string]string{"foo": "baz"})
+	g.Expect(changedFields(before, after)).To(Equal([]string{"metadata", "spec"}))
+}
+
+func TestSummarizeChanges(t *testing.T) {
+	g := NewWithT(t)
+
+	g.Expect(summarizeChanges(nil)).To(Equal("no changes"))
+	g.Expect(summarizeChanges([]objectChange{
+		{object: "ConfigMap default/foo", action: "created"},
+		{object: "Deployment default/bar", action: "updated", fields: []string{"metadata", "spec"}},
+	})).To(Equal("created ConfigMap default/foo; updated Deployment default/bar (metadata, spec)"))
+
+	changes := []objectChange{}
+	for i := 0; i < 50; i++ {
+		changes = append(changes, objectChange{object: fmt.Sprintf("ConfigMap default/foo-%d", i), action: "created"})
+	}
+	summary := summarizeChanges(changes)
+	g.Expect(len(summary)).To(BeNumerically("<=", maxChangeSummaryLength+len("; and 50 more")))
+	g.Expect(summary).To(MatchRegexp(`; and \d+ more$`))
+}
+
+func TestMatchesClusterAnnotations(t *testing.T) {
+	tests := []struct {
+		name               string
+		annotationSelector map[string]string
+		clusterAnnotations map[string]string
+		expected           bool
+	}{
+		{
+			name:               "should match any cluster when the selector is empty",
+			annotationSelector: nil,
+			clusterAnnotations: nil,
+			expected:           true,
+		},
+		{
+			name:               "should match a cluster with all annotations",
+			annotationSelector: map[string]string{"provisioner": "foo"},
+			clusterAnnotations: map[string]string{"provisioner": "foo", "other": "bar"},
+			expected:           true,
+		},
+		{
+			name:               "should not match a cluster with a different annotation value",
+			annotationSelector: map[string]string{"provisioner": "foo"},
+			clusterAnnotations: map[string]string{"provisioner": "bar"},
+			expected:           false,
+		},
+		{
+			name:               "should not match a cluster without the annotation",
+			annotationSelector: map[string]string{"provisioner": ""},
+			clusterAnnotations: nil,
+			expected:           false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gs := NewWithT(t)
+
+			clusterResourceSet := &addonsv1.ClusterResourceSet{
+				Spec: addonsv1.ClusterResourceSetSpec{ClusterAnnotationSelector: tt.annotationSelector},
+			}
+			cluster := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Annotations: tt.clusterAnnotations}}
+			gs.Expect(matchesClusterAnnotations(clusterResourceSet, cluster)).To(Equal(tt.expected))
+		})
+	}
+}
+
+func TestClusterNotSelectedReason(t *testing.T) {
+	tests := []struct {
+		name           string
+		matchLabels    map[string]string
+		clusterLabels  map[string]string
+		deleting       bool
+		expectedReason string
+	}{
+		{
+			name:           "should select a cluster matching the selector",
+			matchLabels:    map[string]string{"foo": "bar"},
+			clusterLabels:  map[string]string{"foo": "bar"},
+			expectedReason: "",
+		},
+		{
+			name:           "should report an empty selector",
+			clusterLabels:  map[string]string{"foo": "bar"},
+			expectedReason: "cluster selector is empty",
+		},
+		{
+			name:           "should report a selector mismatch",
+			matchLabels:    map[string]string{"foo": "bar"},
+			clusterLabels:  map[string]string{"foo": "baz"},
+			expectedReason: "cluster labels do not match selector \"foo=bar\"",
+		},
+		{
+			name:           "should report a cluster being deleted",
+			matchLabels:    map[string]string{"foo": "bar"},
+			clusterLabels:  map[string]string{"foo": "bar"},
+			deleting:       true,
+			expectedReason: "cluster is being deleted",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gs := NewWithT(t)
+
+			clusterResourceSet := &addonsv1.ClusterResourceSet{
+				Spec: addonsv1.ClusterResourceSetSpec{ClusterSelector: metav1.LabelSelector{MatchLabels: tt.matchLabels}},
+			}
+			cluster := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Labels: tt.clusterLabels}}
+			if tt.deleting {
+				cluster.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+			}
+			gs.Expect(clusterNotSelectedReason(clusterResourceSet, cluster)).To(Equal(tt.expectedReason))
+		})
+	}
+
+	g := NewWithT(t)
+	clusterResourceSet := &addonsv1.ClusterResourceSet{
+		Spec: addonsv1.ClusterResourceSetSpec{
+			ClusterSelector:  metav1.LabelSelector{MatchLabels: map[string]string{"env": "prod"}},
+			ClusterSelectors: []metav1.LabelSelector{{MatchLabels: map[string]string{"tier": "critical"}}},
+		},
+	}
+	cluster := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"tier": "critical"}}}
+	g.Expect(clusterNotSelectedReason(clusterResourceSet, cluster)).To(BeEmpty())
+	cluster.Labels = map[string]string{"env": "dev"}
+	g.Expect(clusterNotSelectedReason(clusterResourceSet, cluster)).To(Equal(`cluster labels do not match selector "env=prod" or "tier=critical"`))
+}
+
+func TestClusterRegionNotSelectedReason(t *testing.T) {
+	tests := []struct {
+		name           string
+		regionSelector *addonsv1.RegionSelector
+		clusterLabels  map[string]string
+		failureDomains clusterv1.FailureDomains
+		expectedReason string
+	}{
+		{
+			name:           "should select any cluster without a region selector",
+			expectedReason: "",
+		},
+		{
+			name:           "should select a cluster in one of the regions",
+			regionSelector: &addonsv1.RegionSelector{Regions: []string{"us-east-1", "eu-west-1"}},
+			clusterLabels:  map[string]string{addonsv1.ClusterRegionLabel: "eu-west-1"},
+			expectedReason: "",
+		},
+		{
+			name:           "should report a cluster in another region",
+			regionSelector: &addonsv1.RegionSelector{Regions: []string{"us-east-1", "eu-west-1"}},
+			clusterLabels:  map[string]string{addonsv1.ClusterRegionLabel: "ap-south-1"},
+			expectedReason: `cluster region "ap-south-1" is not one of us-east-1, eu-west-1`,
+		},
+		{
+			name:           "should report a cluster without region label",
+			regionSelector: &addonsv1.RegionSelector{Regions: []string{"us-east-1"}},
+			expectedReason: "cluster has no topology.kubernetes.io/region label",
+		},
+		{
+			name:           "should select a cluster with one of the failure domains",
+			regionSelector: &addonsv1.RegionSelector{FailureDomains: []string{"us-east-1a"}},
+			failureDomains: clusterv1.FailureDomains{"us-east-1a": {}, "us-east-1b": {}},
+			expectedReason: "",
+		},
+		{
+			name:           "should report a cluster with none of the failure domains",
+			regionSelector: &addonsv1.RegionSelector{FailureDomains: []string{"us-east-1c"}},
+			failureDomains: clusterv1.FailureDomains{"us-east-1a": {}},
+			expectedReason: "cluster has none of the failure domains us-east-1c",
+		},
+		{
+			name:           "should require both the region and the failure domains to match",
+			regionSelector: &addonsv1.RegionSelector{Regions: []string{"us-east-1"}, FailureDomains: []string{"us-east-1c"}},
+			clusterLabels:  map[string]string{addonsv1.ClusterRegionLabel: "us-east-1"},
+			failureDomains: clusterv1.FailureDomains{"us-east-1a": {}},
+			expectedReason: "cluster has none of the failure domains us-east-1c",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			clusterResourceSet := &addonsv1.ClusterResourceSet{Spec: addonsv1.ClusterResourceSetSpec{RegionSelector: tt.regionSelector}}
+			cluster := &clusterv1.Cluster{
+				ObjectMeta: metav1.ObjectMeta{Labels: tt.clusterLabels},
+				Status:     clusterv1.ClusterStatus{FailureDomains: tt.failureDomains},
+			}
+			g.Expect(clusterRegionNotSelectedReason(clusterResourceSet, cluster)).To(Equal(tt.expectedReason))
+		})
+	}
+}
+
+func TestClusterNotOptedInReason(t *testing.T) {
+	g := NewWithT(t)
+
+	clusterResourceSet := &addonsv1.ClusterResourceSet{
+		Spec: addonsv1.ClusterResourceSetSpec{
+			ClusterSelector:        metav1.LabelSelector{MatchLabels: map[string]string{"foo": "bar"}},
+			RequireOptInAnnotation: "addons.example.com/sensitive",
+		},
+	}
+	cluster := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"foo": "bar"}}}
+	g.Expect(clusterNotSelectedReason(clusterResourceSet, cluster)).To(Equal("cluster does not have the opt-in annotation addons.example.com/sensitive"))
+
+	cluster.Annotations = map[string]string{"addons.example.com/sensitive": ""}
+	g.Expect(clusterNotSelectedReason(clusterResourceSet, cluster)).To(BeEmpty())
+
+	// The selector still has to match.
+	cluster.Labels = nil
+	g.Expect(clusterNotSelectedReason(clusterResourceSet, cluster)).To(Equal(`cluster labels do not match selector "foo=bar"`))
+
+	// The opt-in is required for the Cluster targeted by ClusterName too.
+	clusterResourceSet.Spec = addonsv1.ClusterResourceSetSpec{ClusterName: "cluster", RequireOptInAnnotation: "addons.example.com/sensitive"}
+	cluster = &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "cluster"}}
+	g.Expect(clusterNotSelectedReason(clusterResourceSet, cluster)).NotTo(BeEmpty())
+}
+
+func TestClusterTooOldReason(t *testing.T) {
+	g := NewWithT(t)
+
+	clusterResourceSet := &addonsv1.ClusterResourceSet{
+		Spec: addonsv1.ClusterResourceSetSpec{ClusterSelector: metav1.LabelSelector{MatchLabels: map[string]string{"foo": "bar"}}},
+	}
+	newCluster := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{
+		Labels:            map[string]string{"foo": "bar"},
+		CreationTimestamp: metav1.Time{Time: time.Now().Add(-time.Hour)},
+	}}
+	oldCluster := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{
+		Labels:            map[string]string{"foo": "bar"},
+		CreationTimestamp: metav1.Time{Time: time.Now().Add(-3 * time.Hour)},
+	}}
+
+	// Clusters of any age are selected without a maximum age.
+	g.Expect(clusterTooOldReason(clusterResourceSet, oldCluster)).To(BeEmpty())
+
+	clusterResourceSet.Spec.ClusterMaxAge = &metav1.Duration{Duration: 2 * time.Hour}
+	g.Expect(clusterTooOldReason(clusterResourceSet, newCluster)).To(BeEmpty())
+	g.Expect(clusterTooOldReason(clusterResourceSet, oldCluster)).To(ContainSubstring("more than the maximum age 2h0m0s"))
+	g.Expect(clusterNotSelectedReason(clusterResourceSet, oldCluster)).To(ContainSubstring("more than the maximum age"))
+}
+
+func TestComputeResourceHashWithIgnoredFields(t *testing.T) {
+	g := NewWithT(t)
+
+	deployment := func(replicas int) []byte {
+		return []byte(fmt.Sprintf(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: my-deployment
+  namespace: default
+spec:
+  replicas: %d
+`, replicas))
+	}
+
+	resource := &unstructured.Unstructured{}
+	resource.SetKind("ConfigMap")
+	resource.SetName("my-configmap")
+
+	// Without the annotation, any change of the data changes the hash.
+	hashA, err := computeResourceHash(resource, [][]byte{deployment(1)})
+	g.Expect(err).NotTo(HaveOccurred())
+	hashB, err := computeResourceHash(resource, [][]byte{deployment(3)})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(hashA).To(Equal(computeHash([][]byte{deployment(1)})))
+	g.Expect(hashA).NotTo(Equal(hashB))
+
+	// Changes to ignored fields do not change the hash.
+	resource.SetAnnotations(map[string]string{addonsv1.ClusterResourceSetIgnoreFieldsAnnotation: "spec.replicas, metadata.labels"})
+	hashA, err = computeResourceHash(resource, [][]byte{deployment(1)})
+	g.Expect(err).NotTo(HaveOccurred())
+	hashB, err = computeResourceHash(resource, [][]byte{deployment(3)})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(hashA).To(Equal(hashB))
+}
+
+func TestComputeHash(t *testing.T) {
+	g := NewWithT(t)
+
+	hash := computeHash([][]byte{[]byte("ab"), []byte("c")})
+	g.Expect(hash).To(HavePrefix(hashPrefix))
+	// Moving data between values changes the hash, unlike with the legacy format.
+	g.Expect(hash).NotTo(Equal(computeHash([][]byte{[]byte("a"), []byte("bc")})))
+	g.Expect(computeLegacyHash([][]byte{[]byte("ab"), []byte("c")})).To(Equal(computeLegacyHash([][]byte{[]byte("a"), []byte("bc")})))
+}
+
+func TestResourceHashMatches(t *testing.T) {
+	resource := &unstructured.Unstructured{}
+	resource.SetKind("ConfigMap")
+	resource.SetName("my-configmap")
+	dataList := [][]byte{[]byte("data")}
+	hash := computeHash(dataList)
+
+	tests := []struct {
+		name     string
+		recorded string
+		expected bool
+	}{
+		{
+			name:     "should match the current hash",
+			recorded: hash,
+			expected: true,
+		},
+		{
+			name:     "should not match a different hash in the current format",
+			recorded: computeHash([][]byte{[]byte("other data")}),
+			expected: false,
+		},
+		{
+			name:     "should match the hash in the legacy format of unchanged data",
+			recorded: computeLegacyHash(dataList),
+			expected: true,
+		},
+		{
+			name:     "should not match the hash in the legacy format of changed data",
+			recorded: computeLegacyHash([][]byte{[]byte("other data")}),
+			expected: false,
+		},
+		{
+			name:     "should not match hashes in unknown formats",
+			recorded: "v0:md5:8d777f385d3dfec8815d20f7496026dc",
+			expected: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+			g.Expect(resourceHashMatches(tt.recorded, hash, resource, dataList)).To(Equal(tt.expected))
+		})
+	}
+}
+
+func TestUniqueResources(t *testing.T) {
+	g := NewWithT(t)
+
+	resources := []addonsv1.ResourceRef{
+		{Kind: "Secret", Name: "foo"},
+		{Kind: "ConfigMap", Name: "foo"},
+		{Kind: "Secret", Name: "foo", Mode: string(addonsv1.PatchClusterResourceSetResourceMode)},
+	}
+	g.Expect(uniqueResources(resources)).To(Equal([]addonsv1.ResourceRef{
+		{Kind: "Secret", Name: "foo"},
+		{Kind: "ConfigMap", Name: "foo"},
+	}))
+}
+
+func TestReconcileStrategyEnabled(t *testing.T) {
+	g := NewWithT(t)
+
+	clusterResourceSet := &addonsv1.ClusterResourceSet{}
+	clusterResourceSet.Spec.SetTypedStrategy(addonsv1.ClusterResourceSetStrategyReconcile)
+
+	g.Expect(feature.MutableGates.Set("ClusterResourceSetReconcileStrategy=false")).To(Succeed())
+	g.Expect(reconcileStrategyEnabled(clusterResourceSet)).To(BeFalse())
+
+	g.Expect(feature.MutableGates.Set("ClusterResourceSetReconcileStrategy=true")).To(Succeed())
+	defer func() {
+		g.Expect(feature.MutableGates.Set("ClusterResourceSetReconcileStrategy=false")).To(Succeed())
+	}()
+	g.Expect(reconcileStrategyEnabled(clusterResourceSet)).To(BeTrue())
+
+	clusterResourceSet.Spec.SetTypedStrategy(addonsv1.ClusterResourceSetStrategyApplyOnce)
+	g.Expect(reconcileStrategyEnabled(clusterResourceSet)).To(BeFalse())
+}
+
+func TestReconcileStrategyDisabledEvent(t *testing.T) {
+	g := NewWithT(t)
+
+	g.Expect(feature.MutableGates.Set("ClusterResourceSetReconcileStrategy=false")).To(Succeed())
+
+	scheme := runtime.NewScheme()
+	g.Expect(clusterv1.AddToScheme(scheme)).To(Succeed())
+	g.Expect(addonsv1.AddToScheme(scheme)).To(Succeed())
+
+	clusterResourceSet := &addonsv1.ClusterResourceSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "crs", Namespace: "default", Generation: 1},
+		Spec: addonsv1.ClusterResourceSetSpec{
+			ClusterSelector: metav1.LabelSelector{MatchLabels: map[string]string{"foo": "bar"}},
+			Resources:       []addonsv1.ResourceRef{{Kind: "ConfigMap", Name: "resource"}},
+		},
+	}
+	clusterResourceSet.Spec.SetTypedStrategy(addonsv1.ClusterResourceSetStrategyReconcile)
+	recorder := record.NewFakeRecorder(10)
+	r := &ClusterResourceSetReconciler{
+		Client:   fake.NewFakeClientWithScheme(scheme, clusterResourceSet),
+		Log:      log.Log,
+		scheme:   scheme,
+		recorder: recorder,
+	}
+
+	// strategyDisabledEvents reconciles the ClusterResourceSet and returns the number of ReconcileStrategyDisabled events.
+	strategyDisabledEvents := func() int {
+		_, err := r.Reconcile(ctrl.Request{NamespacedName: util.ObjectKey(clusterResourceSet)})
+		g.Expect(err).NotTo(HaveOccurred())
+		count := 0
+		for len(recorder.Events) > 0 {
+			if strings.Contains(<-recorder.Events, "ReconcileStrategyDisabled") {
+				count++
+			}
+		}
+		return count
+	}
+
+	g.Expect(strategyDisabledEvents()).To(Equal(1))
+	// The event is not emitted again until the ClusterResourceSet changes.
+	g.Expect(strategyDisabledEvents()).To(Equal(0))
+
+	g.Expect(r.Client.Get(context.Background(), util.ObjectKey(clusterResourceSet), clusterResourceSet)).To(Succeed())
+	clusterResourceSet.Generation++
+	g.Expect(r.Client.Update(context.Background(), clusterResourceSet)).To(Succeed())
+	g.Expect(strategyDisabledEvents()).To(Equal(1))
+}
+
+func TestReappliesOnChange(t *testing.T) {
+	g := NewWithT(t)
+
+	g.Expect(feature.MutableGates.Set("ClusterResourceSetReconcileStrategy=false")).To(Succeed())
+
+	clusterResourceSet := &addonsv1.ClusterResourceSet{}
+	clusterResourceSet.Spec.SetTypedStrategy(addonsv1.ClusterResourceSetStrategyApplyOnce)
+	g.Expect(reappliesOnChange(clusterResourceSet)).To(BeFalse())
+
+	// ApplyOnChange does not require the feature gate.
+	clusterResourceSet.Spec.SetTypedStrategy(addonsv1.ClusterResourceSetStrategyApplyOnChange)
+	g.Expect(reappliesOnChange(clusterResourceSet)).To(BeTrue())
+
+	clusterResourceSet.Spec.SetTypedStrategy(addonsv1.ClusterResourceSetStrategyReconcile)
+	g.Expect(reappliesOnChange(clusterResourceSet)).To(BeFalse())
+}
+
+func TestSourceReplaced(t *testing.T) {
+	g := NewWithT(t)
+
+	source := &unstructured.Unstructured{}
+	source.SetUID("new-uid")
+
+	g.Expect(sourceReplaced(&addonsv1.ResourceBinding{SourceUID: "new-uid"}, source)).To(BeFalse())
+	g.Expect(sourceReplaced(&addonsv1.ResourceBinding{SourceUID: "old-uid"}, source)).To(BeTrue())
+	// Bindings recorded before the UID was tracked are not considered replaced.
+	g.Expect(sourceReplaced(&addonsv1.ResourceBinding{}, source)).To(BeFalse())
+	g.Expect(sourceReplaced(&addonsv1.ResourceBinding{SourceUID: "old-uid"}, &unstructured.Unstructured{})).To(BeFalse())
+}
+
+func TestForcesOwnership(t *testing.T) {
+	tests := []struct {
+		name                     string
+		conflictPolicy           addonsv1.ClusterResourceSetConflictPolicy
+		forceOwnershipOnConflict bool
+		expected                 bool
+	}{
+		{name: "should respect other field managers by default", expected: false},
+		{name: "should use the controller configuration without a conflict policy", forceOwnershipOnConflict: true, expected: true},
+		{name: "should force ownership with the Force policy", conflictPolicy: addonsv1.ForceClusterResourceSetConflictPolicy, expected: true},
+		{
+			name:                     "should respect other field managers with the Respect policy",
+			conflictPolicy:           addonsv1.RespectClusterResourceSetConflictPolicy,
+			forceOwnershipOnConflict: true,
+			expected:                 false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			r := &ClusterResourceSetReconciler{ForceOwnershipOnConflict: tt.forceOwnershipOnConflict}
+			resource := addonsv1.ResourceRef{Kind: "ConfigMap", Name: "cm", ConflictPolicy: string(tt.conflictPolicy)}
+			g.Expect(r.forcesOwnership(resource)).To(Equal(tt.expected))
+		})
+	}
+}
+
+func TestApplyResourceToleratesPendingResources(t *testing.T) {
+	scheme := runtime.NewScheme()
+	NewWithT(t).Expect(corev1.AddToScheme(scheme)).To(Succeed())
+
+	tests := []struct {
+		name             string
+		tolerate         bool
+		expectRequeue    bool
+		expectedReason   string
+		expectedSeverity clusterv1.ConditionSeverity
+	}{
+		{
+			name:             "should fail when the resource does not exist",
+			tolerate:         false,
+			expectRequeue:    false,
+			expectedReason:   addonsv1.RetrievingResourceFailedReason,
+			expectedSeverity: clusterv1.ConditionSeverityWarning,
+		},
+		{
+			name:             "should requeue quietly when the resource does not exist and pending resources are tolerated",
+			tolerate:         true,
+			expectRequeue:    true,
+			expectedReason:   addonsv1.ResourcePendingReason,
+			expectedSeverity: clusterv1.ConditionSeverityInfo,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			c := fake.NewFakeClientWithScheme(scheme)
+			r := &ClusterResourceSetReconciler{
+				Client: c,
+				Log:    log.Log,
+			}
+			cluster := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "cluster", Namespace: "default"}}
+			clusterResourceSet := &addonsv1.ClusterResourceSet{
+				ObjectMeta: metav1.ObjectMeta{Name: "crs", Namespace: "default"},
+				Spec:       addonsv1.ClusterResourceSetSpec{ToleratePendingResources: tt.tolerate},
+			}
+			resource := addonsv1.ResourceRef{Kind: "ConfigMap", Name: "missing"}
+
+			err := r.applyResource(context.Background(), c, cluster, clusterResourceSet, &addonsv1.ResourceSetBinding{}, resource)
+			g.Expect(err).To(HaveOccurred())
+			_, requeue := errors.Cause(err).(capierrors.HasRequeueAfterError)
+			g.Expect(requeue).To(Equal(tt.expectRequeue))
+
+			condition := conditions.Get(clusterResourceSet, addonsv1.ResourcesAppliedCondition)
+			g.Expect(condition).NotTo(BeNil())
+			g.Expect(condition.Reason).To(Equal(tt.expectedReason))
+			g.Expect(condition.Severity).To(Equal(tt.expectedSeverity))
+		})
+	}
+}
+
+func TestApplyClusterResourceSetWithRemoteClientGetter(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(corev1.AddToScheme(scheme)).To(Succeed())
+	g.Expect(clusterv1.AddToScheme(scheme)).To(Succeed())
+	g.Expect(addonsv1.AddToScheme(scheme)).To(Succeed())
+
+	cluster := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "cluster", Namespace: "default"}}
+	source := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "resource", Namespace: "default"},
+		Data: map[string]string{"cm": `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: applied
+  namespace: default
+`},
+	}
+	clusterResourceSet := &addonsv1.ClusterResourceSet{
+		TypeMeta:   metav1.TypeMeta{APIVersion: addonsv1.GroupVersion.String(), Kind: "ClusterResourceSet"},
+		ObjectMeta: metav1.ObjectMeta{Name: "crs", Namespace: "default"},
+		Spec: addonsv1.ClusterResourceSetSpec{
+			ClusterSelector: metav1.LabelSelector{MatchLabels: map[string]string{"foo": "bar"}},
+			Resources:       []addonsv1.ResourceRef{{Kind: "ConfigMap", Name: "resource"}},
+		},
+	}
+
+	remoteClient := fake.NewFakeClientWithScheme(scheme)
+	r := &ClusterResourceSetReconciler{
+		Client: fake.NewFakeClientWithScheme(scheme, cluster, source, clusterResourceSet),
+		Log:    log.Log,
+		RemoteClientGetter: func(ctx context.Context, key client.ObjectKey) (client.Client, error) {
+			g.Expect(key).To(Equal(util.ObjectKey(cluster)))
+			return remoteClient, nil
+		},
+		scheme:   scheme,
+		recorder: record.NewFakeRecorder(10),
+	}
+
+	g.Expect(r.ApplyClusterResourceSet(context.Background(), cluster, clusterResourceSet)).To(Succeed())
+	g.Expect(remoteClient.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: "applied"}, &corev1.ConfigMap{})).To(Succeed())
+
+	binding := &addonsv1.ClusterResourceSetBinding{}
+	g.Expect(r.Client.Get(context.Background(), util.ObjectKey(cluster), binding)).To(Succeed())
+	g.Expect(binding.GetOrCreateBinding(clusterResourceSet).IsApplied(clusterResourceSet.Spec.Resources[0])).To(BeTrue())
+}
+
+func TestApplyClusterResourceSetSkipsDeletingClusters(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(corev1.AddToScheme(scheme)).To(Succeed())
+	g.Expect(clusterv1.AddToScheme(scheme)).To(Succeed())
+	g.Expect(addonsv1.AddToScheme(scheme)).To(Succeed())
+
+	// The cluster starts being deleted after it was selected.
+	selectedCluster := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "cluster", Namespace: "default"}}
+	deletingCluster := selectedCluster.DeepCopy()
+	deletingCluster.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+
+	clusterResourceSet := &addonsv1.ClusterResourceSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "crs", Namespace: "default"},
+		Spec: addonsv1.ClusterResourceSetSpec{
+			ClusterSelector: metav1.LabelSelector{MatchLabels: map[string]string{"foo": "bar"}},
+			Resources:       []addonsv1.ResourceRef{{Kind: "ConfigMap", Name: "resource"}},
+		},
+	}
+
+	r := &ClusterResourceSetReconciler{
+		Client: fake.NewFakeClientWithScheme(scheme, deletingCluster, clusterResourceSet),
+		Log:    log.Log,
+		RemoteClientGetter: func(ctx context.Context, key client.ObjectKey) (client.Client, error) {
+			return nil, errors.New("remote client should not be used for deleting clusters")
+		},
+	}
+
+	err := r.ApplyClusterResourceSet(context.Background(), selectedCluster, clusterResourceSet)
+	g.Expect(errors.Cause(err)).To(Equal(errClusterDeleting))
+	g.Expect(conditions.GetReason(clusterResourceSet, addonsv1.ResourcesAppliedCondition)).To(Equal(addonsv1.ClusterDeletingReason))
+
+	// No binding is created for the deleting cluster.
+	err = r.Client.Get(context.Background(), util.ObjectKey(selectedCluster), &addonsv1.ClusterResourceSetBinding{})
+	g.Expect(apierrors.IsNotFound(err)).To(BeTrue())
+}
+
+func TestApplyClusterResourceSetSkipsManagementCluster(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(corev1.AddToScheme(scheme)).To(Succeed())
+	g.Expect(clusterv1.AddToScheme(scheme)).To(Succeed())
+	g.Expect(addonsv1.AddToScheme(scheme)).To(Succeed())
+
+	cluster := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "cluster", Namespace: "default"}}
+	kubeconfigSecret := kubeconfig.GenerateSecret(cluster, []byte(`apiVersion: v1
+kind: Config
+clusters:
+- name: cluster
+  cluster:
+    server: https://Management.example.com
+`))
+	source := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "resource", Namespace: "default"},
+		Data:       map[string]string{"cm": "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: applied\n  namespace: default\n"},
+	}
+	clusterResourceSet := &addonsv1.ClusterResourceSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "crs", Namespace: "default"},
+		Spec: addonsv1.ClusterResourceSetSpec{
+			ClusterSelector: metav1.LabelSelector{MatchLabels: map[string]string{"foo": "bar"}},
+			Resources:       []addonsv1.ResourceRef{{Kind: "ConfigMap", Name: "resource"}},
+		},
+	}
+
+	r := &ClusterResourceSetReconciler{
+		Client:                     fake.NewFakeClientWithScheme(scheme, cluster, kubeconfigSecret, source, clusterResourceSet),
+		Log:                        log.Log,
+		ManagementClusterEndpoints: []string{"https://10.96.0.1:443", "management.example.com:443"},
+		RemoteClientGetter: func(ctx context.Context, key client.ObjectKey) (client.Client, error) {
+			return fake.NewFakeClientWithScheme(scheme), nil
+		},
+		scheme:   scheme,
+		recorder: record.NewFakeRecorder(10),
+	}
+
+	err := r.ApplyClusterResourceSet(context.Background(), cluster, clusterResourceSet)
+	g.Expect(errors.Cause(err)).To(Equal(errManagementCluster))
+	g.Expect(conditions.GetReason(clusterResourceSet, addonsv1.ResourcesAppliedCondition)).To(Equal(addonsv1.ManagementClusterReason))
+
+	// Resources are applied to the management cluster if the ClusterResourceSet explicitly allows it.
+	clusterResourceSet.Spec.AllowManagementCluster = true
+	g.Expect(r.ApplyClusterResourceSet(context.Background(), cluster, clusterResourceSet)).To(Succeed())
+}
+
+func TestApplyClusterResourceSetFreezesNewClusters(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(corev1.AddToScheme(scheme)).To(Succeed())
+	g.Expect(clusterv1.AddToScheme(scheme)).To(Succeed())
+	g.Expect(addonsv1.AddToScheme(scheme)).To(Succeed())
+
+	newCluster := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "new", Namespace: "default"}}
+	existingCluster := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "existing", Namespace: "default"}}
+	existingBinding := &addonsv1.ClusterResourceSetBinding{
+		ObjectMeta: metav1.ObjectMeta{Name: "existing", Namespace: "default"},
+		Spec: addonsv1.ClusterResourceSetBindingSpec{
+			Bindings: []*addonsv1.ResourceSetBinding{{ClusterResourceSetName: "crs"}},
+		},
+	}
+	source := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "resource", Namespace: "default"},
+		Data:       map[string]string{"cm": "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: applied\n  namespace: default\n"},
+	}
+	clusterResourceSet := &addonsv1.ClusterResourceSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "crs", Namespace: "default"},
+		Spec: addonsv1.ClusterResourceSetSpec{
+			ClusterSelector:   metav1.LabelSelector{MatchLabels: map[string]string{"foo": "bar"}},
+			Resources:         []addonsv1.ResourceRef{{Kind: "ConfigMap", Name: "resource"}},
+			FreezeNewClusters: true,
+		},
+	}
+
+	recorder := record.NewFakeRecorder(10)
+	r := &ClusterResourceSetReconciler{
+		Client: fake.NewFakeClientWithScheme(scheme, newCluster, existingCluster, existingBinding, source, clusterResourceSet),
+		Log:    log.Log,
+		RemoteClientGetter: func(ctx context.Context, key client.ObjectKey) (client.Client, error) {
+			return fake.NewFakeClientWithScheme(scheme), nil
+		},
+		scheme:   scheme,
+		recorder: recorder,
+	}
+
+	err := r.ApplyClusterResourceSet(context.Background(), newCluster, clusterResourceSet)
+	g.Expect(errors.Cause(err)).To(Equal(errClusterFrozen))
+	g.Expect(recorder.Events).To(Receive(ContainSubstring("NewClusterFrozen")))
+	err = r.Client.Get(context.Background(), util.ObjectKey(newCluster), &addonsv1.ClusterResourceSetBinding{})
+	g.Expect(apierrors.IsNotFound(err)).To(BeTrue())
+
+	// Clusters the ClusterResourceSet was already applied to are still reconciled.
+	g.Expect(r.ApplyClusterResourceSet(context.Background(), existingCluster, clusterResourceSet)).To(Succeed())
+
+	// New clusters are applied once the freeze is lifted.
+	clusterResourceSet.Spec.FreezeNewClusters = false
+	g.Expect(r.ApplyClusterResourceSet(context.Background(), newCluster, clusterResourceSet)).To(Succeed())
+}
+
+func TestApplyClusterResourceSetRecordsAppliedBytes(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(corev1.AddToScheme(scheme)).To(Succeed())
+	g.Expect(clusterv1.AddToScheme(scheme)).To(Succeed())
+	g.Expect(addonsv1.AddToScheme(scheme)).To(Succeed())
+
+	manifest := "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: applied\n  namespace: default\n"
+	clusters := []*clusterv1.Cluster{
+		{ObjectMeta: metav1.ObjectMeta{Name: "cluster-1", Namespace: "default"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "cluster-2", Namespace: "default"}},
+	}
+	source := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "resource", Namespace: "default"},
+		Data:       map[string]string{"cm": manifest},
+	}
+	clusterResourceSet := &addonsv1.ClusterResourceSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "crs-applied-bytes", Namespace: "default"},
+		Spec: addonsv1.ClusterResourceSetSpec{
+			ClusterSelector: metav1.LabelSelector{MatchLabels: map[string]string{"foo": "bar"}},
+			Resources:       []addonsv1.ResourceRef{{Kind: "ConfigMap", Name: "resource"}},
+		},
+	}
+
+	r := &ClusterResourceSetReconciler{
+		Client: fake.NewFakeClientWithScheme(scheme, clusters[0], clusters[1], source, clusterResourceSet),
+		Log:    log.Log,
+		RemoteClientGetter: func(ctx context.Context, key client.ObjectKey) (client.Client, error) {
+			return fake.NewFakeClientWithScheme(scheme), nil
+		},
+		scheme:   scheme,
+		recorder: record.NewFakeRecorder(10),
+	}
+	for _, cluster := range clusters {
+		g.Expect(r.ApplyClusterResourceSet(context.Background(), cluster, clusterResourceSet)).To(Succeed())
+	}
+
+	binding := &addonsv1.ClusterResourceSetBinding{}
+	g.Expect(r.Client.Get(context.Background(), util.ObjectKey(clusters[0]), binding)).To(Succeed())
+	g.Expect(binding.Spec.Bindings[0].Resources[0].AppliedBytes).To(Equal(int64(len(manifest))))
+
+	g.Expect(r.updateAppliedBytes(context.Background(), clusterResourceSet, clusters)).To(Succeed())
+	g.Expect(clusterResourceSet.Status.AppliedBytes).To(Equal(int64(2 * len(manifest))))
+	g.Expect(testutil.ToFloat64(metrics.ClusterResourceSetAppliedBytes.WithLabelValues("crs-applied-bytes", "default", "cluster-2"))).To(Equal(float64(len(manifest))))
+
+	// The metric of the clusters that no longer match is deleted.
+	g.Expect(r.updateAppliedBytes(context.Background(), clusterResourceSet, clusters[:1])).To(Succeed())
+	g.Expect(clusterResourceSet.Status.AppliedBytes).To(Equal(int64(len(manifest))))
+	g.Expect(r.appliedBytesClusters[util.ObjectKey(clusterResourceSet)]).To(Equal([]string{"cluster-1"}))
+	r.setAppliedBytesMetric(util.ObjectKey(clusterResourceSet), nil)
+	g.Expect(r.appliedBytesClusters).NotTo(HaveKey(util.ObjectKey(clusterResourceSet)))
+}
+
+func TestApplyClusterResourceSetRequiresNamespace(t *testing.T) {
+	scheme := runtime.NewScheme()
+	NewWithT(t).Expect(corev1.AddToScheme(scheme)).To(Succeed())
+	NewWithT(t).Expect(appsv1.AddToScheme(scheme)).To(Succeed())
+	NewWithT(t).Expect(clusterv1.AddToScheme(scheme)).To(Succeed())
+	NewWithT(t).Expect(addonsv1.AddToScheme(scheme)).To(Succeed())
+
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(appsv1.SchemeGroupVersion.WithKind("Deployment"), meta.RESTScopeNamespace)
+	mapper.Add(corev1.SchemeGroupVersion.WithKind("Namespace"), meta.RESTScopeRoot)
+	mapper.Add(crdGroupKind.WithVersion("v1"), meta.RESTScopeRoot)
+
+	tests := []struct {
+		name             string
+		requireNamespace bool
+		manifest         string
+		expectSkipped    string
+	}{
+		{
+			name:             "should skip a Deployment without a namespace",
+			requireNamespace: true,
+			manifest:         "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: coredns\n",
+			expectSkipped:    "namespaced objects without a namespace: Deployment coredns",
+		},
+		{
+			name:             "should skip objects of kinds unknown to the cluster without a namespace",
+			requireNamespace: true,
+			manifest:         "apiVersion: example.com/v1\nkind: Widget\nmetadata:\n  name: foo\n",
+			expectSkipped:    "kinds unknown to the cluster: Widget foo",
+		},
+		{
+			name:             "should skip objects of namespaced kinds defined in the resource without a namespace",
+			requireNamespace: true,
+			manifest: "apiVersion: apiextensions.k8s.io/v1\nkind: CustomResourceDefinition\nmetadata:\n  name: widgets.example.com\n" +
+				"spec:\n  group: example.com\n  scope: Namespaced\n  names:\n    kind: Widget\n" +
+				"---\napiVersion: example.com/v1\nkind: Widget\nmetadata:\n  name: foo\n",
+			expectSkipped: "namespaced objects without a namespace: Widget foo",
+		},
+		{
+			name:             "should apply a Deployment with a namespace",
+			requireNamespace: true,
+			manifest:         "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: coredns\n  namespace: kube-system\n",
+		},
+		{
+			name:             "should apply cluster-scoped objects without a namespace",
+			requireNamespace: true,
+			manifest:         "apiVersion: v1\nkind: Namespace\nmetadata:\n  name: addons\n",
+		},
+		{
+			name:     "should apply a Deployment without a namespace when namespaces are not required",
+			manifest: "apiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: coredns\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			cluster := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "cluster", Namespace: "default"}}
+			source := &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "resource", Namespace: "default"},
+				Data:       map[string]string{"manifest": tt.manifest},
+			}
+			clusterResourceSet := &addonsv1.ClusterResourceSet{
+				ObjectMeta: metav1.ObjectMeta{Name: "crs", Namespace: "default"},
+				Spec: addonsv1.ClusterResourceSetSpec{
+					ClusterSelector:  metav1.LabelSelector{MatchLabels: map[string]string{"foo": "bar"}},
+					Resources:        []addonsv1.ResourceRef{{Kind: "ConfigMap", Name: "resource"}},
+					RequireNamespace: tt.requireNamespace,
+				},
+			}
+
+			r := &ClusterResourceSetReconciler{
+				Client: fake.NewFakeClientWithScheme(scheme, cluster, source, clusterResourceSet),
+				Log:    log.Log,
+				RemoteClientGetter: func(ctx context.Context, key client.ObjectKey) (client.Client, error) {
+					return fake.NewFakeClientWithScheme(scheme), nil
+				},
+				// The kinds are mapped by the workload cluster, not by the management cluster.
+				RemoteRESTMapperGetter: func(ctx context.Context, key client.ObjectKey) (meta.RESTMapper, error) {
+					return mapper, nil
+				},
+				scheme:     scheme,
+				recorder:   record.NewFakeRecorder(10),
+				restMapper: meta.NewDefaultRESTMapper(nil),
+			}
+
+			err := r.ApplyClusterResourceSet(context.Background(), cluster, clusterResourceSet)
+			binding := &addonsv1.ClusterResourceSetBinding{}
+			g.Expect(r.Client.Get(context.Background(), util.ObjectKey(cluster), binding)).To(Succeed())
+			if tt.expectSkipped != "" {
+				g.Expect(err).To(MatchError(ContainSubstring(tt.expectSkipped)))
+				g.Expect(conditions.GetReason(clusterResourceSet, addonsv1.ResourcesAppliedCondition)).To(Equal(addonsv1.MissingNamespaceReason))
+				g.Expect(binding.Spec.Bindings[0].Resources[0].Applied).To(BeFalse())
+				return
+			}
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(binding.Spec.Bindings[0].Resources[0].Applied).To(BeTrue())
+		})
+	}
+}
+
+func TestApplyClusterResourceSetObjectLimit(t *testing.T) {
+	scheme := runtime.NewScheme()
+	NewWithT(t).Expect(corev1.AddToScheme(scheme)).To(Succeed())
+	NewWithT(t).Expect(clusterv1.AddToScheme(scheme)).To(Succeed())
+	NewWithT(t).Expect(addonsv1.AddToScheme(scheme)).To(Succeed())
+
+	cluster := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "cluster", Namespace: "default"}}
+	// Another ClusterResourceSet already applied 2 objects to the cluster.
+	binding := &addonsv1.ClusterResourceSetBinding{
+		ObjectMeta: metav1.ObjectMeta{Name: "cluster", Namespace: "default"},
+		Spec: addonsv1.ClusterResourceSetBindingSpec{
+			Bindings: []*addonsv1.ResourceSetBinding{{
+				ClusterResourceSetName: "other",
+				Resources: []addonsv1.ResourceBinding{{
+					ResourceRef:    addonsv1.ResourceRef{Kind: "ConfigMap", Name: "other"},
+					Applied:        true,
+					AppliedObjects: 2,
+				}},
+			}},
+		},
+	}
+	source := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "resource", Namespace: "default"},
+		Data: map[string]string{"cm": "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: a\n  namespace: default\n" +
+			"---\napiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: b\n  namespace: default\n"},
+	}
+
+	tests := []struct {
+		name              string
+		crsLimit          int32
+		controllerLimit   int
+		expectLimitReason bool
+	}{
+		{
+			name: "should apply resources without a limit",
+		},
+		{
+			name:              "should refuse resources pushing the cluster over the limit of the ClusterResourceSet",
+			crsLimit:          3,
+			expectLimitReason: true,
+		},
+		{
+			name:              "should refuse resources pushing the cluster over the limit of the controller",
+			crsLimit:          10,
+			controllerLimit:   3,
+			expectLimitReason: true,
+		},
+		{
+			name:            "should apply resources within the limit",
+			crsLimit:        4,
+			controllerLimit: 10,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			clusterResourceSet := &addonsv1.ClusterResourceSet{
+				ObjectMeta: metav1.ObjectMeta{Name: "crs", Namespace: "default"},
+				Spec: addonsv1.ClusterResourceSetSpec{
+					ClusterSelector:   metav1.LabelSelector{MatchLabels: map[string]string{"foo": "bar"}},
+					Resources:         []addonsv1.ResourceRef{{Kind: "ConfigMap", Name: "resource"}},
+					MaxClusterObjects: tt.crsLimit,
+				},
+			}
+			r := &ClusterResourceSetReconciler{
+				Client: fake.NewFakeClientWithScheme(scheme, cluster, binding.DeepCopy(), source, clusterResourceSet),
+				Log:    log.Log,
+				RemoteClientGetter: func(ctx context.Context, key client.ObjectKey) (client.Client, error) {
+					return fake.NewFakeClientWithScheme(scheme), nil
+				},
+				MaxClusterObjects: tt.controllerLimit,
+				scheme:            scheme,
+				recorder:          record.NewFakeRecorder(10),
+			}
+
+			err := r.ApplyClusterResourceSet(context.Background(), cluster, clusterResourceSet)
+			updated := &addonsv1.ClusterResourceSetBinding{}
+			g.Expect(r.Client.Get(context.Background(), util.ObjectKey(cluster), updated)).To(Succeed())
+			resourceSetBinding := findResourceSetBinding(updated, "crs")
+			g.Expect(resourceSetBinding).NotTo(BeNil())
+			if tt.expectLimitReason {
+				g.Expect(err).To(MatchError(ContainSubstring("over the limit of 3")))
+				g.Expect(conditions.GetReason(clusterResourceSet, addonsv1.ResourcesAppliedCondition)).To(Equal(addonsv1.ObjectLimitExceededReason))
+				g.Expect(resourceSetBinding.Resources[0].Applied).To(BeFalse())
+				return
+			}
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(resourceSetBinding.Resources[0].Applied).To(BeTrue())
+			g.Expect(resourceSetBinding.Resources[0].AppliedObjects).To(Equal(int32(2)))
+		})
+	}
+}
+
+func TestApplyClusterResourceSetWaitsForClusterConditions(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(corev1.AddToScheme(scheme)).To(Succeed())
+	g.Expect(clusterv1.AddToScheme(scheme)).To(Succeed())
+	g.Expect(addonsv1.AddToScheme(scheme)).To(Succeed())
+
+	cluster := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "cluster", Namespace: "default"}}
+	conditions.MarkTrue(cluster, clusterv1.InfrastructureReadyCondition)
+	source := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "resource", Namespace: "default"},
+		Data:       map[string]string{"cm": "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: applied\n  namespace: default\n"},
+	}
+	clusterResourceSet := &addonsv1.ClusterResourceSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "crs", Namespace: "default"},
+		Spec: addonsv1.ClusterResourceSetSpec{
+			ClusterSelector:        metav1.LabelSelector{MatchLabels: map[string]string{"foo": "bar"}},
+			Resources:              []addonsv1.ResourceRef{{Kind: "ConfigMap", Name: "resource"}},
+			ClusterReadyConditions: []string{string(clusterv1.InfrastructureReadyCondition), string(clusterv1.ControlPlaneReadyCondition)},
+		},
+	}
+
+	r := &ClusterResourceSetReconciler{
+		Client: fake.NewFakeClientWithScheme(scheme, cluster, source, clusterResourceSet),
+		Log:    log.Log,
+		RemoteClientGetter: func(ctx context.Context, key client.ObjectKey) (client.Client, error) {
+			return fake.NewFakeClientWithScheme(scheme), nil
+		},
+		scheme:   scheme,
+		recorder: record.NewFakeRecorder(10),
+	}
+
+	err := r.ApplyClusterResourceSet(context.Background(), cluster, clusterResourceSet)
+	_, ok := errors.Cause(err).(capierrors.HasRequeueAfterError)
+	g.Expect(ok).To(BeTrue())
+	g.Expect(conditions.GetReason(clusterResourceSet, addonsv1.ResourcesAppliedCondition)).To(Equal(addonsv1.WaitingForClusterConditionsReason))
+	g.Expect(conditions.GetMessage(clusterResourceSet, addonsv1.ResourcesAppliedCondition)).To(ContainSubstring(string(clusterv1.ControlPlaneReadyCondition)))
+
+	conditions.MarkTrue(cluster, clusterv1.ControlPlaneReadyCondition)
+	g.Expect(r.ApplyClusterResourceSet(context.Background(), cluster, clusterResourceSet)).To(Succeed())
+}
+
+func TestApplyClusterResourceSetFeatureFlag(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(corev1.AddToScheme(scheme)).To(Succeed())
+	g.Expect(clusterv1.AddToScheme(scheme)).To(Succeed())
+	g.Expect(addonsv1.AddToScheme(scheme)).To(Succeed())
+
+	cluster := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "cluster", Namespace: "default"}}
+	source := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "resource", Namespace: "default"},
+		Data:       map[string]string{"cm": "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: applied\n  namespace: default\n"},
+	}
+	clusterResourceSet := &addonsv1.ClusterResourceSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "crs", Namespace: "default"},
+		Spec: addonsv1.ClusterResourceSetSpec{
+			ClusterSelector: metav1.LabelSelector{MatchLabels: map[string]string{"foo": "bar"}},
+			Resources: []addonsv1.ResourceRef{{
+				Kind:        "ConfigMap",
+				Name:        "resource",
+				EnabledWhen: &addonsv1.FeatureFlagRef{Namespace: "kube-system", Name: "features", Key: "addon", Value: "true"},
+			}},
+		},
+	}
+
+	remoteClient := fake.NewFakeClientWithScheme(scheme)
+	r := &ClusterResourceSetReconciler{
+		Client: fake.NewFakeClientWithScheme(scheme, cluster, source, clusterResourceSet),
+		Log:    log.Log,
+		RemoteClientGetter: func(ctx context.Context, key client.ObjectKey) (client.Client, error) {
+			return remoteClient, nil
+		},
+		scheme:   scheme,
+		recorder: record.NewFakeRecorder(10),
+	}
+	applied := client.ObjectKey{Namespace: "default", Name: "applied"}
+
+	// The flag cannot be read yet.
+	err := r.ApplyClusterResourceSet(context.Background(), cluster, clusterResourceSet)
+	_, ok := errors.Cause(err).(capierrors.HasRequeueAfterError)
+	g.Expect(ok).To(BeTrue())
+	g.Expect(conditions.GetReason(clusterResourceSet, addonsv1.ResourcesAppliedCondition)).To(Equal(addonsv1.FeatureFlagUnavailableReason))
+
+	// The resource is disabled by the flag, and is not pending.
+	flag := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "features", Namespace: "kube-system"},
+		Data:       map[string]string{"addon": "false"},
+	}
+	g.Expect(remoteClient.Create(context.Background(), flag)).To(Succeed())
+	g.Expect(r.ApplyClusterResourceSet(context.Background(), cluster, clusterResourceSet)).To(Succeed())
+	g.Expect(apierrors.IsNotFound(remoteClient.Get(context.Background(), applied, &corev1.ConfigMap{}))).To(BeTrue())
+	binding := &addonsv1.ClusterResourceSetBinding{}
+	g.Expect(r.Client.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: "cluster"}, binding)).To(Succeed())
+	resourceSetBinding := binding.GetOrCreateBinding(clusterResourceSet)
+	g.Expect(resourceSetBinding.GetResourceBinding(clusterResourceSet.Spec.Resources[0]).Disabled).To(BeTrue())
+	g.Expect(hasPendingResources(clusterResourceSet, resourceSetBinding)).To(BeFalse())
+
+	// The resource is applied once the flag is set.
+	flag.Data["addon"] = "true"
+	g.Expect(remoteClient.Update(context.Background(), flag)).To(Succeed())
+	g.Expect(r.ApplyClusterResourceSet(context.Background(), cluster, clusterResourceSet)).To(Succeed())
+	g.Expect(remoteClient.Get(context.Background(), applied, &corev1.ConfigMap{})).To(Succeed())
+	binding = &addonsv1.ClusterResourceSetBinding{}
+	g.Expect(r.Client.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: "cluster"}, binding)).To(Succeed())
+	resourceBinding := binding.GetOrCreateBinding(clusterResourceSet).GetResourceBinding(clusterResourceSet.Spec.Resources[0])
+	g.Expect(resourceBinding.Disabled).To(BeFalse())
+	g.Expect(resourceBinding.Applied).To(BeTrue())
+}
+
+func TestHigherPriorityPending(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(addonsv1.AddToScheme(scheme)).To(Succeed())
+
+	cluster := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "cluster", Namespace: "default", Labels: map[string]string{"foo": "bar"}}}
+	resource := addonsv1.ResourceRef{Kind: "ConfigMap", Name: "resource"}
+	newClusterResourceSet := func(name string, priority int32, matchLabels map[string]string) *addonsv1.ClusterResourceSet {
+		return &addonsv1.ClusterResourceSet{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+			Spec: addonsv1.ClusterResourceSetSpec{
+				ClusterSelector: metav1.LabelSelector{MatchLabels: matchLabels},
+				Resources:       []addonsv1.ResourceRef{resource},
+				Priority:        priority,
+			},
+		}
+	}
+	selected := map[string]string{"foo": "bar"}
+	clusterResourceSet := newClusterResourceSet("crs", 0, selected)
+	binding := &addonsv1.ClusterResourceSetBinding{
+		ObjectMeta: metav1.ObjectMeta{Name: "cluster", Namespace: "default"},
+		Spec: addonsv1.ClusterResourceSetBindingSpec{Bindings: []*addonsv1.ResourceSetBinding{
+			{ClusterResourceSetName: "applied", Resources: []addonsv1.ResourceBinding{{ResourceRef: resource, Applied: true}}},
+			{ClusterResourceSetName: "failed", Resources: []addonsv1.ResourceBinding{{ResourceRef: resource, Applied: false}}},
+		}},
+	}
+
+	c := fake.NewFakeClientWithScheme(scheme,
+		clusterResourceSet,
+		newClusterResourceSet("applied", 10, selected),
+		newClusterResourceSet("failed", 10, selected),
+		newClusterResourceSet("not-applied-yet", 5, selected),
+		newClusterResourceSet("same-priority", 0, selected),
+		newClusterResourceSet("lower-priority", -1, selected),
+		newClusterResourceSet("not-selected", 10, map[string]string{"foo": "baz"}),
+		binding,
+	)
+	r := &ClusterResourceSetReconciler{Client: c, Log: log.Log}
+
+	pending, err := r.higherPriorityPending(context.Background(), cluster, clusterResourceSet)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(pending).To(ConsistOf("failed", "not-applied-yet"))
+
+	// ClusterResourceSets that already applied all their resources do not wait.
+	binding.Spec.Bindings = append(binding.Spec.Bindings, &addonsv1.ResourceSetBinding{
+		ClusterResourceSetName: "crs",
+		Resources:              []addonsv1.ResourceBinding{{ResourceRef: resource, Applied: true}},
+	})
+	g.Expect(c.Update(context.Background(), binding)).To(Succeed())
+	pending, err = r.higherPriorityPending(context.Background(), cluster, clusterResourceSet)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(pending).To(BeEmpty())
+}
+
+func TestApplyResourceBacksOffOnControllerConflict(t *testing.T) {
+	g := NewWithT(t)
+
+	g.Expect(feature.MutableGates.Set("ClusterResourceSetReconcileStrategy=true")).To(Succeed())
+	defer func() {
+		g.Expect(feature.MutableGates.Set("ClusterResourceSetReconcileStrategy=false")).To(Succeed())
+	}()
+
+	scheme := runtime.NewScheme()
+	g.Expect(corev1.AddToScheme(scheme)).To(Succeed())
+	g.Expect(addonsv1.AddToScheme(scheme)).To(Succeed())
+
+	source := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "resource", Namespace: "default"},
+		Data: map[string]string{"cm": `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: applied
+  namespace: default
+data:
+  key: value
+`},
+	}
+	cluster := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "cluster", Namespace: "default"}}
+	clusterResourceSet := &addonsv1.ClusterResourceSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "crs", Namespace: "default"},
+		Spec:       addonsv1.ClusterResourceSetSpec{Resources: []addonsv1.ResourceRef{{Kind: "ConfigMap", Name: "resource"}}},
+	}
+	clusterResourceSet.Spec.SetTypedStrategy(addonsv1.ClusterResourceSetStrategyReconcile)
+	resource := clusterResourceSet.Spec.Resources[0]
+
+	remoteClient := fake.NewFakeClientWithScheme(scheme)
+	r := &ClusterResourceSetReconciler{
+		Client:   fake.NewFakeClientWithScheme(scheme, source, clusterResourceSet),
+		Log:      log.Log,
+		scheme:   scheme,
+		recorder: record.NewFakeRecorder(10),
+	}
+	resourceSetBinding := &addonsv1.ResourceSetBinding{}
+	g.Expect(r.applyResource(context.Background(), remoteClient, cluster, clusterResourceSet, resourceSetBinding, resource)).To(Succeed())
+	g.Expect(resourceSetBinding.IsApplied(resource)).To(BeTrue())
+	g.Expect(resourceSetBinding.GetResourceBinding(resource).LastApplyChanges).To(Equal("created ConfigMap default/applied"))
+
+	// The applied object is changed right after being applied for the last time.
+	applied := &corev1.ConfigMap{}
+	g.Expect(remoteClient.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: "applied"}, applied)).To(Succeed())
+	applied.Data["key"] = "mutated"
+	g.Expect(remoteClient.Update(context.Background(), applied)).To(Succeed())
+	resourceSetBinding.GetResourceBinding(resource).DriftCount = controllerConflictThreshold
+
+	err := r.applyResource(context.Background(), remoteClient, cluster, clusterResourceSet, resourceSetBinding, resource)
+	g.Expect(err).To(HaveOccurred())
+	requeueErr, ok := errors.Cause(err).(capierrors.HasRequeueAfterError)
+	g.Expect(ok).To(BeTrue())
+	g.Expect(requeueErr.GetRequeueAfter()).To(Equal(controllerConflictBackoff))
+	g.Expect(conditions.GetReason(clusterResourceSet, addonsv1.ResourcesAppliedCondition)).To(Equal(addonsv1.PossibleControllerConflictReason))
+	g.Expect(conditions.GetMessage(clusterResourceSet, addonsv1.ResourcesAppliedCondition)).To(ContainSubstring(fmt.Sprintf("%d times", controllerConflictThreshold+1)))
+
+	// The object is not applied again while backing off.
+	g.Expect(remoteClient.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: "applied"}, applied)).To(Succeed())
+	g.Expect(applied.Data["key"]).To(Equal("mutated"))
+	g.Expect(resourceSetBinding.IsApplied(resource)).To(BeTrue())
+}
+
+func TestApplyResourceMigratesLegacyHashes(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(corev1.AddToScheme(scheme)).To(Succeed())
+	g.Expect(addonsv1.AddToScheme(scheme)).To(Succeed())
+
+	data := `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: applied
+  namespace: default
+`
+	source := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "resource", Namespace: "default"},
+		Data:       map[string]string{"cm": data},
+	}
+	cluster := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "cluster", Namespace: "default"}}
+	clusterResourceSet := &addonsv1.ClusterResourceSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "crs", Namespace: "default"},
+		Spec:       addonsv1.ClusterResourceSetSpec{Resources: []addonsv1.ResourceRef{{Kind: "ConfigMap", Name: "resource"}}},
+	}
+	clusterResourceSet.Spec.SetTypedStrategy(addonsv1.ClusterResourceSetStrategyApplyOnChange)
+	resource := clusterResourceSet.Spec.Resources[0]
+
+	r := &ClusterResourceSetReconciler{
+		Client:   fake.NewFakeClientWithScheme(scheme, source, clusterResourceSet),
+		Log:      log.Log,
+		scheme:   scheme,
+		recorder: record.NewFakeRecorder(10),
+	}
+
+	// The resource was applied by a controller recording hashes in the legacy format.
+	lastAppliedTime := metav1.NewTime(time.Now().Add(-time.Hour).UTC())
+	resourceSetBinding := &addonsv1.ResourceSetBinding{Resources: []addonsv1.ResourceBinding{{
+		ResourceRef:     resource,
+		Hash:            computeLegacyHash([][]byte{[]byte(data)}),
+		Applied:         true,
+		LastAppliedTime: &lastAppliedTime,
+	}}}
+
+	remoteClient := fake.NewFakeClientWithScheme(scheme)
+	g.Expect(r.applyResource(context.Background(), remoteClient, cluster, clusterResourceSet, resourceSetBinding, resource)).To(Succeed())
+
+	// The hash is migrated without applying the resource again.
+	resourceBinding := resourceSetBinding.GetResourceBinding(resource)
+	g.Expect(resourceBinding.Hash).To(Equal(computeHash([][]byte{[]byte(data)})))
+	g.Expect(resourceBinding.LastAppliedTime).To(Equal(&lastAppliedTime))
+	err := remoteClient.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: "applied"}, &corev1.ConfigMap{})
+	g.Expect(apierrors.IsNotFound(err)).To(BeTrue())
+}
+
+func TestSetResourceCondition(t *testing.T) {
+	g := NewWithT(t)
+
+	clusterResourceSet := &addonsv1.ClusterResourceSet{}
+	secret := addonsv1.ResourceRef{Kind: "Secret", Name: "secret"}
+	configMap := addonsv1.ResourceRef{Kind: "ConfigMap", Name: "configmap"}
+
+	conditions.MarkFalse(clusterResourceSet, addonsv1.ResourcesAppliedCondition, addonsv1.WrongSecretTypeReason, clusterv1.ConditionSeverityWarning, "wrong type")
+	setResourceCondition(clusterResourceSet, secret, errors.New("cluster cluster-1: wrong type"))
+	setResourceCondition(clusterResourceSet, secret, nil)
+	setResourceCondition(clusterResourceSet, configMap, nil)
+
+	g.Expect(clusterResourceSet.Status.ResourceConditions).To(Equal([]addonsv1.ResourceCondition{
+		{
+			Kind:     "Secret",
+			Name:     "secret",
+			Status:   corev1.ConditionFalse,
+			Reason:   addonsv1.WrongSecretTypeReason,
+			Severity: clusterv1.ConditionSeverityWarning,
+			Message:  "cluster cluster-1: wrong type",
+		},
+		{Kind: "ConfigMap", Name: "configmap", Status: corev1.ConditionTrue},
+	}))
+
+	// The number of conditions is capped.
+	for i := 0; i < maxResourceConditions; i++ {
+		setResourceCondition(clusterResourceSet, addonsv1.ResourceRef{Kind: "ConfigMap", Name: fmt.Sprintf("configmap-%d", i)}, nil)
+	}
+	g.Expect(clusterResourceSet.Status.ResourceConditions).To(HaveLen(maxResourceConditions))
+}
+
+func TestClustersPendingApply(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(addonsv1.AddToScheme(scheme)).To(Succeed())
+
+	resource := addonsv1.ResourceRef{Kind: "Secret", Name: "secret"}
+	clusterResourceSet := &addonsv1.ClusterResourceSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "crs", Namespace: "default"},
+		Spec:       addonsv1.ClusterResourceSetSpec{Resources: []addonsv1.ResourceRef{resource}},
+	}
+	newBinding := func(clusterName string, applied bool) *addonsv1.ClusterResourceSetBinding {
+		return &addonsv1.ClusterResourceSetBinding{
+			ObjectMeta: metav1.ObjectMeta{Name: clusterName, Namespace: "default"},
+			Spec: addonsv1.ClusterResourceSetBindingSpec{
+				Bindings: []*addonsv1.ResourceSetBinding{
+					{
+						ClusterResourceSetName: "crs",
+						Resources:              []addonsv1.ResourceBinding{{ResourceRef: resource, Applied: applied}},
+					},
+				},
+			},
+		}
+	}
+	c := fake.NewFakeClientWithScheme(scheme, newBinding("applied", true), newBinding("failed", false))
+	r := &ClusterResourceSetReconciler{
+		Client: c,
+		Log:    log.Log,
+	}
+
+	clusters := []*clusterv1.Cluster{}
+	for _, name := range []string{"applied", "failed", "new"} {
+		clusters = append(clusters, &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"}})
+	}
+	pending, err := r.clustersPendingApply(context.Background(), clusterResourceSet, clusters)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(pending).To(Equal([]string{"failed", "new"}))
+}
+
+func TestCheckMatchingClusters(t *testing.T) {
+	g := NewWithT(t)
+
+	recorder := record.NewFakeRecorder(10)
+	r := &ClusterResourceSetReconciler{NoMatchingClustersThreshold: time.Hour, recorder: recorder}
+	clusterResourceSet := &addonsv1.ClusterResourceSet{ObjectMeta: metav1.ObjectMeta{Name: "crs", Namespace: "default"}}
+
+	// Not matching any cluster is first reported with an Info severity.
+	g.Expect(r.checkMatchingClusters(clusterResourceSet, nil)).To(Equal(time.Hour))
+	g.Expect(conditions.IsFalse(clusterResourceSet, addonsv1.ClustersMatchedCondition)).To(BeTrue())
+	g.Expect(*conditions.GetSeverity(clusterResourceSet, addonsv1.ClustersMatchedCondition)).To(Equal(clusterv1.ConditionSeverityInfo))
+
+	delay := r.checkMatchingClusters(clusterResourceSet, nil)
+	g.Expect(delay).To(BeNumerically(">", 59*time.Minute))
+	g.Expect(delay).To(BeNumerically("<=", time.Hour))
+	g.Expect(recorder.Events).To(BeEmpty())
+
+	// It is escalated to Warning once the threshold elapsed.
+	clusterResourceSet.Status.Conditions[0].LastTransitionTime = metav1.NewTime(time.Now().Add(-2 * time.Hour))
+	g.Expect(r.checkMatchingClusters(clusterResourceSet, nil)).To(BeZero())
+	g.Expect(*conditions.GetSeverity(clusterResourceSet, addonsv1.ClustersMatchedCondition)).To(Equal(clusterv1.ConditionSeverityWarning))
+	g.Expect(recorder.Events).To(Receive(ContainSubstring(addonsv1.NoMatchingClustersReason)))
+	g.Expect(r.checkMatchingClusters(clusterResourceSet, nil)).To(BeZero())
+	g.Expect(*conditions.GetSeverity(clusterResourceSet, addonsv1.ClustersMatchedCondition)).To(Equal(clusterv1.ConditionSeverityWarning))
+	g.Expect(recorder.Events).To(BeEmpty())
+
+	// The condition clears when a cluster matches.
+	cluster := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "cluster", Namespace: "default"}}
+	g.Expect(r.checkMatchingClusters(clusterResourceSet, []*clusterv1.Cluster{cluster})).To(BeZero())
+	g.Expect(conditions.IsTrue(clusterResourceSet, addonsv1.ClustersMatchedCondition)).To(BeTrue())
+}
+
+func TestCheckBindingsLimit(t *testing.T) {
+	scheme := runtime.NewScheme()
+	NewWithT(t).Expect(addonsv1.AddToScheme(scheme)).To(Succeed())
+
+	newBinding := func(clusterName string, entries int) *addonsv1.ClusterResourceSetBinding {
+		binding := &addonsv1.ClusterResourceSetBinding{
+			ObjectMeta: metav1.ObjectMeta{Name: clusterName, Namespace: "default"},
+		}
+		for i := 0; i < entries; i++ {
+			binding.Spec.Bindings = append(binding.Spec.Bindings, &addonsv1.ResourceSetBinding{ClusterResourceSetName: fmt.Sprintf("crs-%d", i)})
+		}
+		return binding
+	}
+	clusters := []*clusterv1.Cluster{}
+	for _, name := range []string{"small", "large", "new"} {
+		clusters = append(clusters, &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"}})
+	}
+
+	tests := []struct {
+		name            string
+		maxBindings     int
+		expectCondition *clusterv1.Condition
+		expectEvents    int
+	}{
+		{
+			name:        "should not check bindings when disabled",
+			maxBindings: 0,
+		},
+		{
+			name:            "should be true when all bindings are within the limit",
+			maxBindings:     3,
+			expectCondition: &clusterv1.Condition{Type: addonsv1.BindingsWithinLimitCondition, Status: corev1.ConditionTrue},
+		},
+		{
+			name:        "should warn about bindings exceeding the limit",
+			maxBindings: 2,
+			expectCondition: &clusterv1.Condition{
+				Type:     addonsv1.BindingsWithinLimitCondition,
+				Status:   corev1.ConditionFalse,
+				Reason:   addonsv1.TooManyBindingsReason,
+				Severity: clusterv1.ConditionSeverityWarning,
+				Message:  "ClusterResourceSetBindings have more than 2 entries: large (3)",
+			},
+			expectEvents: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			recorder := record.NewFakeRecorder(10)
+			r := &ClusterResourceSetReconciler{
+				Client:                fake.NewFakeClientWithScheme(scheme, newBinding("small", 1), newBinding("large", 3)),
+				Log:                   log.Log,
+				MaxBindingsPerCluster: tt.maxBindings,
+				recorder:              recorder,
+			}
+			clusterResourceSet := &addonsv1.ClusterResourceSet{ObjectMeta: metav1.ObjectMeta{Name: "crs", Namespace: "default"}}
+
+			g.Expect(r.checkBindingsLimit(context.Background(), clusterResourceSet, clusters)).To(Succeed())
+
+			condition := conditions.Get(clusterResourceSet, addonsv1.BindingsWithinLimitCondition)
+			if tt.expectCondition == nil {
+				g.Expect(condition).To(BeNil())
+			} else {
+				g.Expect(condition).NotTo(BeNil())
+				condition.LastTransitionTime = metav1.Time{}
+				g.Expect(*condition).To(Equal(*tt.expectCondition))
+			}
+			g.Expect(recorder.Events).To(HaveLen(tt.expectEvents))
+		})
+	}
+}
+
+func TestRecordRolloutEvent(t *testing.T) {
+	applied := &clusterv1.Condition{Type: addonsv1.ResourcesAppliedCondition, Status: corev1.ConditionTrue}
+	failed := &clusterv1.Condition{Type: addonsv1.ResourcesAppliedCondition, Status: corev1.ConditionFalse, Reason: addonsv1.ApplyFailedReason}
+
+	tests := []struct {
+		name            string
+		previousApplied *clusterv1.Condition
+		pendingClusters int
+		failedClusters  []string
+		expectEvent     string
+	}{
+		{
+			name:        "should emit RolloutComplete the first time resources are applied to all clusters",
+			expectEvent: "RolloutComplete Applied 1 resources to 2 clusters",
+		},
+		{
+			name:            "should emit RolloutComplete when the rollout recovers",
+			previousApplied: failed,
+			expectEvent:     "RolloutComplete Applied 1 resources to 2 clusters",
+		},
+		{
+			name:            "should not emit RolloutComplete when the rollout was already complete",
+			previousApplied: applied,
+		},
+		{
+			name:            "should not emit RolloutComplete while clusters are pending",
+			pendingClusters: 1,
+		},
+		{
+			name:            "should emit RolloutDegraded when applying resources starts failing",
+			previousApplied: applied,
+			failedClusters:  []string{"cluster-3"},
+			expectEvent:     "RolloutDegraded Failed to apply resources to 1 of 3 clusters: cluster-3",
+		},
+		{
+			name:            "should not emit RolloutDegraded when applying resources was already failing",
+			previousApplied: failed,
+			failedClusters:  []string{"cluster-3"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			recorder := record.NewFakeRecorder(10)
+			r := &ClusterResourceSetReconciler{recorder: recorder}
+			// Of the two resources, only one is applied to all the clusters.
+			clusterResourceSet := &addonsv1.ClusterResourceSet{
+				ObjectMeta: metav1.ObjectMeta{Name: "crs", Namespace: "default"},
+				Spec: addonsv1.ClusterResourceSetSpec{
+					Resources: []addonsv1.ResourceRef{{Kind: "ConfigMap", Name: "applied"}, {Kind: "ConfigMap", Name: "excluded"}},
+				},
+				Status: addonsv1.ClusterResourceSetStatus{
+					ResourceConditions: []addonsv1.ResourceCondition{
+						{Kind: "ConfigMap", Name: "applied", Status: corev1.ConditionTrue},
+						{Kind: "ConfigMap", Name: "excluded", Status: corev1.ConditionFalse},
+					},
+				},
+			}
+
+			r.recordRolloutEvent(clusterResourceSet, tt.previousApplied, 2, tt.pendingClusters, tt.failedClusters)
+
+			if tt.expectEvent == "" {
+				g.Expect(recorder.Events).To(BeEmpty())
+				return
+			}
+			g.Expect(recorder.Events).To(Receive(HaveSuffix(tt.expectEvent)))
+		})
+	}
+}
+
+func TestGetClustersByClusterResourceSetSelector(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(clusterv1.AddToScheme(scheme)).To(Succeed())
+
+	newCluster := func(name, namespace string, labels map[string]string) *clusterv1.Cluster {
+		return &clusterv1.Cluster{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: namespace,
+				Labels:    labels,
+			},
+		}
+	}
+	deletingCluster := newCluster("deleting", "default", map[string]string{"foo": "bar"})
+	deletingCluster.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+
+	c := fake.NewFakeClientWithScheme(scheme,
+		newCluster("matching-1", "default", map[string]string{"foo": "bar"}),
+		newCluster("matching-2", "default", map[string]string{"foo": "bar", "other": "label"}),
+		newCluster("not-matching", "default", map[string]string{"foo": "baz"}),
+		newCluster("other-namespace", "other", map[string]string{"foo": "bar"}),
+		deletingCluster,
+	)
+	r := &ClusterResourceSetReconciler{
+		Client: c,
+		Log:    log.Log,
+	}
+
+	clusterResourceSet := &addonsv1.ClusterResourceSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-clusterresourceset",
+			Namespace: "default",
+		},
+		Spec: addonsv1.ClusterResourceSetSpec{
+			ClusterSelector: metav1.LabelSelector{MatchLabels: map[string]string{"foo": "bar"}},
+		},
+	}
+
+	clusters, err := r.getClustersByClusterResourceSetSelector(context.Background(), clusterResourceSet)
+	g.Expect(err).NotTo(HaveOccurred())
+
+	names := []string{}
+	for _, cluster := range clusters {
+		names = append(names, cluster.Name)
+	}
+	g.Expect(names).To(ConsistOf("matching-1", "matching-2"))
+
+	// A ClusterResourceSet with a cluster name targets exactly that cluster, regardless of its labels.
+	clusterResourceSet.Spec = addonsv1.ClusterResourceSetSpec{ClusterName: "not-matching"}
+	clusters, err = r.getClustersByClusterResourceSetSelector(context.Background(), clusterResourceSet)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(clusters).To(HaveLen(1))
+	g.Expect(clusters[0].Name).To(Equal("not-matching"))
+
+	clusterResourceSet.Spec = addonsv1.ClusterResourceSetSpec{ClusterName: "other-namespace"}
+	clusters, err = r.getClustersByClusterResourceSetSelector(context.Background(), clusterResourceSet)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(clusters).To(BeEmpty())
+
+	// Clusters matching any of the selectors are selected once.
+	clusterResourceSet.Spec = addonsv1.ClusterResourceSetSpec{
+		ClusterSelectors: []metav1.LabelSelector{
+			{MatchLabels: map[string]string{"foo": "baz"}},
+			{MatchLabels: map[string]string{"other": "label"}},
+			{MatchLabels: map[string]string{"foo": "bar"}},
+		},
+	}
+	clusters, err = r.getClustersByClusterResourceSetSelector(context.Background(), clusterResourceSet)
+	g.Expect(err).NotTo(HaveOccurred())
+	names = []string{}
+	for _, cluster := range clusters {
+		names = append(names, cluster.Name)
+	}
+	g.Expect(names).To(ConsistOf("matching-1", "matching-2", "not-matching"))
+}
+
+func TestPatchObjects(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(corev1.AddToScheme(scheme)).To(Succeed())
+
+	serviceAccount := &corev1.ServiceAccount{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "default",
+			Namespace: "default",
+			Labels:    map[string]string{"existing": "label"},
+		},
+	}
+	c := fake.NewFakeClientWithScheme(scheme, serviceAccount)
+
+	data := []byte(`apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: default
+  namespace: default
+  labels:
+    added: label
+`)
+	g.Expect(patchObjects(context.Background(), c, data)).To(Succeed())
+
+	patched := &corev1.ServiceAccount{}
+	g.Expect(c.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: "default"}, patched)).To(Succeed())
+	g.Expect(patched.Labels).To(Equal(map[string]string{"existing": "label", "added": "label"}))
+
+	// Patching an object that does not exist fails.
+	missing := []byte(`apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: missing
+  namespace: default
+`)
+	g.Expect(patchObjects(context.Background(), c, missing)).NotTo(Succeed())
+}
+
+func TestApplyList(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(corev1.AddToScheme(scheme)).To(Succeed())
+	c := fake.NewFakeClientWithScheme(scheme)
+
+	data := []byte(`apiVersion: v1
+kind: List
+items:
+- apiVersion: v1
+  kind: ConfigMap
+  metadata:
+    name: first
+    namespace: default
+- apiVersion: v1
+  kind: ConfigMap
+  metadata:
+    name: second
+    namespace: default
+- apiVersion: v1
+  kind: ServiceAccount
+  metadata:
+    name: third
+    namespace: default
+`)
+	g.Expect(apply(context.Background(), c, data, applyOptions{})).To(Succeed())
+
+	g.Expect(c.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: "first"}, &corev1.ConfigMap{})).To(Succeed())
+	g.Expect(c.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: "second"}, &corev1.ConfigMap{})).To(Succeed())
+	g.Expect(c.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: "third"}, &corev1.ServiceAccount{})).To(Succeed())
+}
+
+func TestSortObjectsByKind(t *testing.T) {
+	g := NewWithT(t)
+
+	newObj := func(apiVersion, kind, name string) unstructured.Unstructured {
+		obj := unstructured.Unstructured{}
+		obj.SetAPIVersion(apiVersion)
+		obj.SetKind(kind)
+		obj.SetName(name)
+		return obj
+	}
+	objs := []unstructured.Unstructured{
+		newObj("example.com/v1", "Widget", "widget"),
+		newObj("apps/v1", "Deployment", "deployment"),
+		newObj("admissionregistration.k8s.io/v1", "ValidatingWebhookConfiguration", "webhook"),
+		newObj("v1", "ConfigMap", "config-1"),
+		newObj("apiextensions.k8s.io/v1", "CustomResourceDefinition", "widgets.example.com"),
+		newObj("rbac.authorization.k8s.io/v1", "ClusterRole", "role"),
+		newObj("v1", "ConfigMap", "config-2"),
+		newObj("v1", "Namespace", "namespace"),
+	}
+
+	names := []string{}
+	for _, obj := range sortObjectsByKind(objs) {
+		names = append(names, obj.GetName())
+	}
+	g.Expect(names).To(Equal([]string{
+		"namespace",
+		"widgets.example.com",
+		"role",
+		"config-1",
+		"config-2",
+		"deployment",
+		"webhook",
+		"widget",
+	}))
+	// The objects are not sorted in place.
+	g.Expect(objs[0].GetName()).To(Equal("widget"))
+}
+
+func TestSortDataByKind(t *testing.T) {
+	g := NewWithT(t)
+
+	dataList := [][]byte{
+		[]byte(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: deployment
+`),
+		[]byte(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+---
+apiVersion: v1
+kind: Namespace
+metadata:
+  name: namespace
+`),
+	}
+
+	sorted, err := sortDataByKind(dataList)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(sorted).To(HaveLen(1))
+
+	objs, err := parseObjects(sorted[0])
+	g.Expect(err).NotTo(HaveOccurred())
+	names := []string{}
+	for _, obj := range objs {
+		names = append(names, obj.GetName())
+	}
+	g.Expect(names).To(Equal([]string{"namespace", "config", "deployment"}))
+}
+
+func TestTransformObjects(t *testing.T) {
+	g := NewWithT(t)
+
+	data := []byte(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: first
+  namespace: default
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: second
+  namespace: default
+`)
+	cluster := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "cluster"}}
+	transformed, err := transformObjects(data, cluster, func(obj *unstructured.Unstructured, c *clusterv1.Cluster) error {
+		obj.SetLabels(map[string]string{"cluster": c.Name})
+		return nil
+	})
+	g.Expect(err).NotTo(HaveOccurred())
+
+	objs, err := parseObjects(transformed)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(objs).To(HaveLen(2))
+	for _, obj := range objs {
+		g.Expect(obj.GetLabels()).To(Equal(map[string]string{"cluster": "cluster"}))
+	}
+
+	_, err = transformObjects(data, cluster, func(*unstructured.Unstructured, *clusterv1.Cluster) error {
+		return errors.New("transform failed")
+	})
+	g.Expect(err).To(HaveOccurred())
+}
+
+func TestQuotaShortages(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(corev1.AddToScheme(scheme)).To(Succeed())
+
+	newQuota := func(name, namespace string, resourceName corev1.ResourceName, hard, used int64) *corev1.ResourceQuota {
+		return &corev1.ResourceQuota{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Status: corev1.ResourceQuotaStatus{
+				Hard: corev1.ResourceList{resourceName: *resource.NewQuantity(hard, resource.DecimalSI)},
+				Used: corev1.ResourceList{resourceName: *resource.NewQuantity(used, resource.DecimalSI)},
+			},
+		}
+	}
+	c := fake.NewFakeClientWithScheme(scheme,
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "existing", Namespace: "full"}},
+		newQuota("count", "full", "count/configmaps", 2, 1),
+		newQuota("legacy", "full", corev1.ResourceConfigMaps, 3, 1),
+		newQuota("roomy", "empty", "count/configmaps", 10, 0),
+	)
+
+	data := []byte(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: existing
+  namespace: full
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: first
+  namespace: full
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: second
+  namespace: full
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: other
+  namespace: empty
+`)
+	shortages, err := quotaShortages(context.Background(), c, [][]byte{data})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(shortages).To(Equal([]string{"full/count count/configmaps (2 needed, 1 available)"}))
+}
+
+func TestClassifyApplyError(t *testing.T) {
+	gr := schema.GroupResource{Resource: "configmaps"}
+	tests := []struct {
+		name     string
+		err      error
+		expected applyErrorClass
+	}{
+		{name: "should classify invalid objects as permanent", err: apierrors.NewInvalid(schema.GroupKind{Kind: "ConfigMap"}, "cm", nil), expected: permanentApplyError},
+		{name: "should classify forbidden errors as permanent", err: apierrors.NewForbidden(gr, "cm", errors.New("rbac")), expected: permanentApplyError},
+		{name: "should classify timeouts as transient", err: apierrors.NewTimeoutError("timeout", 1), expected: transientApplyError},
+		{name: "should classify unavailable servers as transient", err: apierrors.NewServiceUnavailable("unavailable"), expected: transientApplyError},
+		{name: "should classify wrapped errors", err: errors.Wrap(apierrors.NewTooManyRequestsError("slow down"), "failed"), expected: transientApplyError},
+		{name: "should not classify other errors", err: errors.New("failed"), expected: unknownApplyError},
+		{
+			name:     "should classify aggregates with a permanent error as permanent",
+			err:      kerrors.NewAggregate([]error{apierrors.NewTimeoutError("timeout", 1), apierrors.NewBadRequest("bad")}),
+			expected: permanentApplyError,
+		},
+		{
+			name:     "should classify aggregates with transient errors as transient",
+			err:      kerrors.NewAggregate([]error{errors.New("failed"), apierrors.NewInternalError(errors.New("internal"))}),
+			expected: transientApplyError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			g.Expect(classifyApplyError(tt.err)).To(Equal(tt.expected))
+		})
+	}
+}
+
+func TestApplyErrorMessage(t *testing.T) {
+	g := NewWithT(t)
+
+	invalid := apierrors.NewInvalid(schema.GroupKind{Group: "apps", Kind: "Deployment"}, "addon", field.ErrorList{
+		field.Required(field.NewPath("spec", "template", "spec", "containers").Index(0).Child("image"), ""),
+	})
+	g.Expect(applyErrorMessage(errors.Wrap(invalid, "failed to create"))).To(Equal(
+		`failed to create: Deployment.apps "addon" is invalid: spec.template.spec.containers[0].image: Required value`))
+
+	// Causes not already part of the message are appended.
+	rejected := apierrors.NewBadRequest("admission webhook denied the request")
+	rejected.ErrStatus.Details = &metav1.StatusDetails{Causes: []metav1.StatusCause{
+		{Field: "spec.replicas", Message: "must be at most 3"},
+		{Message: "policy violated"},
+	}}
+	g.Expect(applyErrorMessage(kerrors.NewAggregate([]error{rejected, errors.New("failed")}))).To(Equal(
+		"[admission webhook denied the request (spec.replicas: must be at most 3; policy violated), failed]"))
+
+	// Long messages are truncated.
+	msg := applyErrorMessage(errors.New(strings.Repeat("a", 2*maxApplyErrorMessageLength)))
+	g.Expect(msg).To(HaveLen(maxApplyErrorMessageLength))
+	g.Expect(msg).To(HaveSuffix("..."))
+}
+
+func TestIsTransientError(t *testing.T) {
+	g := NewWithT(t)
+
+	err := &transientError{err: errors.New("timeout")}
+	g.Expect(isTransientError(err)).To(BeTrue())
+	g.Expect(isTransientError(kerrors.NewAggregate([]error{errors.New("failed"), kerrors.NewAggregate([]error{err})}))).To(BeTrue())
+	g.Expect(isTransientError(errors.New("failed"))).To(BeFalse())
+}
+
+func TestReconcileReportsInvalidSelector(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(clusterv1.AddToScheme(scheme)).To(Succeed())
+	g.Expect(addonsv1.AddToScheme(scheme)).To(Succeed())
+
+	clusterResourceSet := &addonsv1.ClusterResourceSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "crs", Namespace: "default"},
+		Spec: addonsv1.ClusterResourceSetSpec{
+			ClusterSelector: metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{
+				{Key: "foo", Operator: metav1.LabelSelectorOpIn},
+			}},
+			Resources: []addonsv1.ResourceRef{{Kind: "ConfigMap", Name: "resource"}},
+		},
+	}
+	r := &ClusterResourceSetReconciler{
+		Client:   fake.NewFakeClientWithScheme(scheme, clusterResourceSet),
+		Log:      log.Log,
+		scheme:   scheme,
+		recorder: record.NewFakeRecorder(10),
+	}
+
+	// A malformed selector is reported without requeueing, as retrying does not fix it.
+	_, err := r.Reconcile(ctrl.Request{NamespacedName: util.ObjectKey(clusterResourceSet)})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(r.Client.Get(context.Background(), util.ObjectKey(clusterResourceSet), clusterResourceSet)).To(Succeed())
+	g.Expect(conditions.GetReason(clusterResourceSet, addonsv1.ResourcesAppliedCondition)).To(Equal(addonsv1.InvalidSelectorReason))
+	g.Expect(*conditions.GetSeverity(clusterResourceSet, addonsv1.ResourcesAppliedCondition)).To(Equal(clusterv1.ConditionSeverityError))
+
+	g.Expect(isInvalidSelectorError(errors.Wrap(&invalidSelectorError{err: errors.New("invalid")}, "failed"))).To(BeTrue())
+	g.Expect(isInvalidSelectorError(errors.New("failed to list clusters"))).To(BeFalse())
+}
+
+func TestPruneRemovedResources(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(corev1.AddToScheme(scheme)).To(Succeed())
+	g.Expect(clusterv1.AddToScheme(scheme)).To(Succeed())
+	g.Expect(addonsv1.AddToScheme(scheme)).To(Succeed())
+
+	cluster := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "cluster", Namespace: "default"}}
+	removed := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "removed", Namespace: "default"},
+		Data: map[string]string{"cm": `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: applied
+  namespace: default
+`},
+	}
+	clusterResourceSet := &addonsv1.ClusterResourceSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "crs", Namespace: "default"},
+		Spec: addonsv1.ClusterResourceSetSpec{
+			Resources:        []addonsv1.ResourceRef{{Kind: "ConfigMap", Name: "kept"}},
+			PruneGracePeriod: &metav1.Duration{Duration: time.Hour},
+		},
+	}
+	requested := metav1.NewTime(time.Now().Add(-time.Minute))
+	resourceSetBinding := &addonsv1.ResourceSetBinding{
+		ClusterResourceSetName: "crs",
+		Resources: []addonsv1.ResourceBinding{
+			{ResourceRef: addonsv1.ResourceRef{Kind: "ConfigMap", Name: "kept"}, Applied: true, PruneRequestedTime: &requested},
+			{ResourceRef: addonsv1.ResourceRef{Kind: "ConfigMap", Name: "removed"}, Applied: true},
+		},
+	}
+
+	applied := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "applied", Namespace: "default"}}
+	remoteClient := fake.NewFakeClientWithScheme(scheme, applied)
+	recorder := record.NewFakeRecorder(10)
+	r := &ClusterResourceSetReconciler{
+		Client:   fake.NewFakeClientWithScheme(scheme, cluster, removed, clusterResourceSet),
+		Log:      log.Log,
+		scheme:   scheme,
+		recorder: recorder,
+	}
+
+	// The removed resource is marked for pruning, and the resource added back is unmarked.
+	requeueAfter, err := r.pruneRemovedResources(context.Background(), remoteClient, cluster, clusterResourceSet, resourceSetBinding)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(requeueAfter).To(BeNumerically("~", time.Hour, time.Minute))
+	g.Expect(resourceSetBinding.Resources[0].PruneRequestedTime).To(BeNil())
+	g.Expect(resourceSetBinding.Resources[1].PruneRequestedTime).NotTo(BeNil())
+	g.Expect(<-recorder.Events).To(ContainSubstring("PruningPending"))
+	g.Expect(remoteClient.Get(context.Background(), util.ObjectKey(applied), &corev1.ConfigMap{})).To(Succeed())
+
+	// Its objects are deleted once the grace period elapsed.
+	expired := metav1.NewTime(time.Now().Add(-2 * time.Hour))
+	resourceSetBinding.Resources[1].PruneRequestedTime = &expired
+	requeueAfter, err = r.pruneRemovedResources(context.Background(), remoteClient, cluster, clusterResourceSet, resourceSetBinding)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(requeueAfter).To(BeZero())
+	g.Expect(resourceSetBinding.Resources).To(HaveLen(1))
+	g.Expect(resourceSetBinding.Resources[0].Name).To(Equal("kept"))
+	err = remoteClient.Get(context.Background(), util.ObjectKey(applied), &corev1.ConfigMap{})
+	g.Expect(apierrors.IsNotFound(err)).To(BeTrue())
+}
+
+func TestReconcilePrunesTheLastRemovedResource(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(corev1.AddToScheme(scheme)).To(Succeed())
+	g.Expect(clusterv1.AddToScheme(scheme)).To(Succeed())
+	g.Expect(addonsv1.AddToScheme(scheme)).To(Succeed())
+
+	cluster := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "cluster", Namespace: "default", Labels: map[string]string{"foo": "bar"}}}
+	removed := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "removed", Namespace: "default"},
+		Data: map[string]string{"cm": `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: applied
+  namespace: default
+`},
+	}
+	// All the resources were removed from the ClusterResourceSet.
+	clusterResourceSet := &addonsv1.ClusterResourceSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "crs", Namespace: "default"},
+		Spec: addonsv1.ClusterResourceSetSpec{
+			ClusterSelector:  metav1.LabelSelector{MatchLabels: map[string]string{"foo": "bar"}},
+			PruneGracePeriod: &metav1.Duration{},
+		},
+	}
+	binding := &addonsv1.ClusterResourceSetBinding{
+		ObjectMeta: metav1.ObjectMeta{Name: "cluster", Namespace: "default"},
+		Spec: addonsv1.ClusterResourceSetBindingSpec{
+			Bindings: []*addonsv1.ResourceSetBinding{{
+				ClusterResourceSetName: "crs",
+				Resources: []addonsv1.ResourceBinding{
+					{ResourceRef: addonsv1.ResourceRef{Kind: "ConfigMap", Name: "removed"}, Applied: true},
+				},
+			}},
+		},
+	}
+
+	applied := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "applied", Namespace: "default"}}
+	remoteClient := fake.NewFakeClientWithScheme(scheme, applied)
+	r := &ClusterResourceSetReconciler{
+		Client: fake.NewFakeClientWithScheme(scheme, cluster, removed, clusterResourceSet, binding),
+		Log:    log.Log,
+		RemoteClientGetter: func(ctx context.Context, key client.ObjectKey) (client.Client, error) {
+			return remoteClient, nil
+		},
+		scheme:     scheme,
+		recorder:   record.NewFakeRecorder(10),
+		restMapper: meta.NewDefaultRESTMapper(nil),
+	}
+
+	// The objects of the removed resources are pruned, and their records removed.
+	_, err := r.Reconcile(ctrl.Request{NamespacedName: util.ObjectKey(clusterResourceSet)})
+	g.Expect(err).NotTo(HaveOccurred())
+	err = remoteClient.Get(context.Background(), util.ObjectKey(applied), &corev1.ConfigMap{})
+	g.Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	updated := &addonsv1.ClusterResourceSetBinding{}
+	g.Expect(r.Client.Get(context.Background(), util.ObjectKey(binding), updated)).To(Succeed())
+	g.Expect(updated.Spec.Bindings[0].Resources).To(BeEmpty())
+	g.Expect(r.Client.Get(context.Background(), util.ObjectKey(clusterResourceSet), clusterResourceSet)).To(Succeed())
+	g.Expect(conditions.IsTrue(clusterResourceSet, addonsv1.EmptyCondition)).To(BeTrue())
+
+	// Without resources left to prune, the ClusterResourceSet is skipped.
+	hasRecorded, err := r.hasRecordedResources(context.Background(), clusterResourceSet)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(hasRecorded).To(BeFalse())
+}
+
+func TestGetSelectedConfigMaps(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(corev1.AddToScheme(scheme)).To(Succeed())
+
+	configMap := func(name string, data map[string]string) *corev1.ConfigMap {
+		return &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Labels: map[string]string{"addon": "cni"}},
+			Data:       data,
+		}
+	}
+	unselected := configMap("00-other", map[string]string{"a": "other"})
+	unselected.Labels = nil
+	c := fake.NewFakeClientWithScheme(scheme,
+		configMap("crds", map[string]string{"a": "crds"}),
+		configMap("100-webhooks", map[string]string{"a": "webhooks"}),
+		configMap("20-operator", map[string]string{"b": "operator-b", "a": "operator-a"}),
+		configMap("3-namespace", map[string]string{"a": "namespace"}),
+		unselected,
+	)
+
+	resourceRef := addonsv1.ResourceRef{
+		Kind:     "ConfigMap",
+		Name:     "cni",
+		Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"addon": "cni"}},
+	}
+	resource, err := getSelectedConfigMaps(context.Background(), c, resourceRef, "default")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(resource.GetName()).To(Equal("cni"))
+	g.Expect(resource.GetNamespace()).To(Equal("default"))
+
+	dataList, err := normalizeData(resource, resourceRef.Kind, nil)
+	g.Expect(err).NotTo(HaveOccurred())
+	values := []string{}
+	for _, data := range dataList {
+		values = append(values, string(data))
+	}
+	g.Expect(values).To(Equal([]string{"namespace", "operator-a", "operator-b", "webhooks", "crds"}))
+
+	resourceRef.Selector = &metav1.LabelSelector{MatchLabels: map[string]string{"addon": "csi"}}
+	_, err = getSelectedConfigMaps(context.Background(), c, resourceRef, "default")
+	g.Expect(apierrors.IsNotFound(err)).To(BeTrue())
+}
+
+func TestReconcileTimeout(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(corev1.AddToScheme(scheme)).To(Succeed())
+	g.Expect(clusterv1.AddToScheme(scheme)).To(Succeed())
+	g.Expect(addonsv1.AddToScheme(scheme)).To(Succeed())
+
+	cluster := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "cluster", Namespace: "default", Labels: map[string]string{"foo": "bar"}}}
+	source := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "resource", Namespace: "default"},
+		Data:       map[string]string{"cm": "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: applied\n  namespace: default\n"},
+	}
+	clusterResourceSet := &addonsv1.ClusterResourceSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "crs", Namespace: "default"},
+		Spec: addonsv1.ClusterResourceSetSpec{
+			ClusterSelector: metav1.LabelSelector{MatchLabels: map[string]string{"foo": "bar"}},
+			Resources:       []addonsv1.ResourceRef{{Kind: "ConfigMap", Name: "resource"}},
+		},
+	}
+
+	// The workload cluster hangs until the reconcile deadline.
+	r := &ClusterResourceSetReconciler{
+		Client: fake.NewFakeClientWithScheme(scheme, cluster, source, clusterResourceSet),
+		Log:    log.Log,
+		RemoteClientGetter: func(ctx context.Context, key client.ObjectKey) (client.Client, error) {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		},
+		ReconcileTimeout: 10 * time.Millisecond,
+		scheme:           scheme,
+		recorder:         record.NewFakeRecorder(10),
+	}
+
+	res, err := r.Reconcile(ctrl.Request{NamespacedName: util.ObjectKey(clusterResourceSet)})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(res.Requeue).To(BeTrue())
+	clusterResourceSet = &addonsv1.ClusterResourceSet{}
+	g.Expect(r.Client.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: "crs"}, clusterResourceSet)).To(Succeed())
+	g.Expect(conditions.GetReason(clusterResourceSet, addonsv1.ResourcesAppliedCondition)).To(Equal(addonsv1.ReconcileTimeoutReason))
+	g.Expect(conditions.GetMessage(clusterResourceSet, addonsv1.ResourcesAppliedCondition)).To(ContainSubstring("cluster"))
+}
+
+func TestEvaluateReadiness(t *testing.T) {
+	obj := &unstructured.Unstructured{Object: map[string]interface{}{
+		"status": map[string]interface{}{
+			"state": "Running",
+			"conditions": []interface{}{
+				map[string]interface{}{"type": "Ready", "status": "True"},
+			},
+		},
+	}}
+
+	tests := []struct {
+		name       string
+		expression string
+		expected   bool
+		expectErr  bool
+	}{
+		{name: "should match equal values", expression: `.status.state == "Running"`, expected: true},
+		{name: "should not match different values", expression: `.status.state == "Pending"`, expected: false},
+		{name: "should support !=", expression: `.status.state != "Pending"`, expected: true},
+		{name: "should support braces and filters", expression: `{.status.conditions[?(@.type=="Ready")].status} == "True"`, expected: true},
+		{name: "should be ready if the path has a value", expression: `.status.state`, expected: true},
+		{name: "should not be ready if the path is missing", expression: `.status.phase`, expected: false},
+		{name: "should fail on invalid expressions", expression: `.status[`, expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			ready, err := evaluateReadiness(obj, tt.expression)
+			if tt.expectErr {
+				g.Expect(err).To(HaveOccurred())
+				return
+			}
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(ready).To(Equal(tt.expected))
+		})
+	}
+}
+
+func TestObjectsNotReady(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(corev1.AddToScheme(scheme)).To(Succeed())
+
+	c := fake.NewFakeClientWithScheme(scheme,
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "running", Namespace: "default"}, Status: corev1.PodStatus{Phase: corev1.PodRunning}},
+		&corev1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "pending", Namespace: "default"}, Status: corev1.PodStatus{Phase: corev1.PodPending}},
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "config", Namespace: "default"}},
+	)
+
+	data := []byte(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+  namespace: default
+---
+apiVersion: v1
+kind: Pod
+metadata:
+  name: running
+  namespace: default
+---
+apiVersion: v1
+kind: Pod
+metadata:
+  name: pending
+  namespace: default
+---
+apiVersion: v1
+kind: Pod
+metadata:
+  name: missing
+  namespace: default
+`)
+	notReady, err := objectsNotReady(context.Background(), c, [][]byte{data}, &addonsv1.ReadinessCheck{Kind: "Pod", Expression: `.status.phase == "Running"`})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(notReady).To(Equal([]string{"Pod pending", "Pod missing"}))
+}
+
+func TestNamespacer(t *testing.T) {
+	g := NewWithT(t)
+
+	mapper := meta.NewDefaultRESTMapper(nil)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}, meta.RESTScopeNamespace)
+	mapper.Add(schema.GroupVersionKind{Version: "v1", Kind: "Namespace"}, meta.RESTScopeRoot)
+
+	cluster := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "cluster", Namespace: "cluster-ns"}}
+
+	configMap := &unstructured.Unstructured{}
+	configMap.SetAPIVersion("v1")
+	configMap.SetKind("ConfigMap")
+	configMap.SetNamespace("kube-system")
+	g.Expect(namespacer(mapper)(configMap, cluster)).To(Succeed())
+	g.Expect(configMap.GetNamespace()).To(Equal("cluster-ns"))
+
+	namespace := &unstructured.Unstructured{}
+	namespace.SetAPIVersion("v1")
+	namespace.SetKind("Namespace")
+	g.Expect(namespacer(mapper)(namespace, cluster)).NotTo(Succeed())
+}
+
+func TestProvenanceLabeler(t *testing.T) {
+	g := NewWithT(t)
+
+	obj := &unstructured.Unstructured{}
+	obj.SetLabels(map[string]string{"app": "addon"})
+
+	clusterResourceSet := &addonsv1.ClusterResourceSet{ObjectMeta: metav1.ObjectMeta{Name: "crs"}}
+	g.Expect(provenanceLabeler(clusterResourceSet)(obj, nil)).To(Succeed())
+	g.Expect(obj.GetLabels()).To(Equal(map[string]string{"app": "addon", addonsv1.ClusterResourceSetNameLabel: "crs"}))
+
+	// Names longer than the maximum length of label values are not added.
+	obj = &unstructured.Unstructured{}
+	clusterResourceSet.Name = strings.Repeat("a", 64)
+	g.Expect(provenanceLabeler(clusterResourceSet)(obj, nil)).To(Succeed())
+	g.Expect(obj.GetLabels()).To(BeEmpty())
+
+	g.Expect((&addonsv1.ClusterResourceSetSpec{}).ShouldAddProvenanceLabels()).To(BeTrue())
+	disabled := false
+	g.Expect((&addonsv1.ClusterResourceSetSpec{AddProvenanceLabels: &disabled}).ShouldAddProvenanceLabels()).To(BeFalse())
+}
+
+func TestEndpointHost(t *testing.T) {
+	g := NewWithT(t)
+
+	g.Expect(endpointHost("https://Example.com")).To(Equal("example.com:443"))
+	g.Expect(endpointHost("https://example.com:443/")).To(Equal("example.com:443"))
+	g.Expect(endpointHost("example.com:6443")).To(Equal("example.com:6443"))
+	g.Expect(endpointHost("10.0.0.1")).To(Equal("10.0.0.1:443"))
+	g.Expect(endpointHost("https://[fd00::1]:6443")).To(Equal("[fd00::1]:6443"))
+}
+
+func TestMetadataPropagator(t *testing.T) {
+	g := NewWithT(t)
+
+	clusterResourceSet := &addonsv1.ClusterResourceSet{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "crs",
+			Labels:      map[string]string{"team": "platform", "cost-center": "42", "other": "ignored"},
+			Annotations: map[string]string{"owner": "platform@example.com"},
+		},
+		Spec: addonsv1.ClusterResourceSetSpec{
+			PropagateLabels:      []string{"team", "cost-center", "missing"},
+			PropagateAnnotations: []string{"owner"},
+		},
+	}
+
+	obj := &unstructured.Unstructured{}
+	obj.SetLabels(map[string]string{"app": "addon", "team": "addon"})
+	g.Expect(metadataPropagator(clusterResourceSet)(obj, nil)).To(Succeed())
+	g.Expect(obj.GetLabels()).To(Equal(map[string]string{"app": "addon", "team": "platform", "cost-center": "42"}))
+	g.Expect(obj.GetAnnotations()).To(Equal(map[string]string{"owner": "platform@example.com"}))
+
+	// Objects are not changed if the ClusterResourceSet has none of the keys.
+	obj = &unstructured.Unstructured{}
+	clusterResourceSet.Labels, clusterResourceSet.Annotations = nil, nil
+	g.Expect(metadataPropagator(clusterResourceSet)(obj, nil)).To(Succeed())
+	g.Expect(obj.GetLabels()).To(BeEmpty())
+	g.Expect(obj.GetAnnotations()).To(BeEmpty())
+}
+
+func TestDeleteObjects(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(corev1.AddToScheme(scheme)).To(Succeed())
+	c := fake.NewFakeClientWithScheme(scheme,
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "applied", Namespace: "default"}},
+		&corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "default"}},
+	)
+
+	data := []byte(`apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: applied
+  namespace: default
+---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: missing
+  namespace: default
+`)
+	g.Expect(deleteObjects(context.Background(), c, data, metav1.DeletePropagationBackground)).To(Succeed())
+
+	err := c.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: "applied"}, &corev1.ConfigMap{})
+	g.Expect(apierrors.IsNotFound(err)).To(BeTrue())
+	g.Expect(c.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: "other"}, &corev1.ConfigMap{})).To(Succeed())
+}
+
+// deleteOrderClient records the objects deleted from the cluster, in order.
+type deleteOrderClient struct {
+	client.Client
+	deleted []string
+}
+
+func (c *deleteOrderClient) Delete(ctx context.Context, obj runtime.Object, opts ...client.DeleteOption) error {
+	u := obj.(*unstructured.Unstructured)
+	c.deleted = append(c.deleted, u.GetKind()+"/"+u.GetName())
+	return nil
+}
+
+func TestDeleteObjectsInReverseOrder(t *testing.T) {
+	g := NewWithT(t)
+
+	crds := []byte(`apiVersion: v1
+kind: Namespace
+metadata:
+  name: widgets
+---
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: widgets.example.com
+`)
+	workloads := []byte(`apiVersion: example.com/v1
+kind: Widget
+metadata:
+  name: first
+  namespace: widgets
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: widget-controller
+  namespace: widgets
+---
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: widget-controller
+  namespace: widgets
+`)
+	more := []byte(`apiVersion: example.com/v1
+kind: Widget
+metadata:
+  name: second
+  namespace: widgets
+`)
+
+	c := &deleteOrderClient{}
+	g.Expect(deleteObjectsInReverseOrder(context.Background(), c, [][]byte{crds, workloads, more}, metav1.DeletePropagationBackground)).To(Succeed())
+	g.Expect(c.deleted).To(Equal([]string{
+		"Widget/second",
+		"Widget/first",
+		"Deployment/widget-controller",
+		"ServiceAccount/widget-controller",
+		"CustomResourceDefinition/widgets.example.com",
+		"Namespace/widgets",
+	}))
+}
+
+func TestPatchOwnerRefToResource(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(corev1.AddToScheme(scheme)).To(Succeed())
+	g.Expect(addonsv1.AddToScheme(scheme)).To(Succeed())
+
+	clusterResourceSet := &addonsv1.ClusterResourceSet{
+		TypeMeta: metav1.TypeMeta{
+			APIVersion: addonsv1.GroupVersion.String(),
+			Kind:       "ClusterResourceSet",
+		},
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "test-clusterresourceset",
+			Namespace: "default",
+			UID:       "test-uid",
+		},
+	}
+	provenanceLabel := addonsv1.ClusterResourceSetProvenanceLabelPrefix + "test-uid"
+
+	tests := []struct {
+		name            string
+		object          runtime.Object
+		key             client.ObjectKey
+		gvk             schema.GroupVersionKind
+		expectOwnerRef  bool
+		expectProvLabel bool
+	}{
+		{
+			name:           "should add an owner reference to resources in the ClusterResourceSet's namespace",
+			object:         &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "local", Namespace: "default"}},
+			key:            client.ObjectKey{Namespace: "default", Name: "local"},
+			gvk:            corev1.SchemeGroupVersion.WithKind("ConfigMap"),
+			expectOwnerRef: true,
+		},
+		{
+			name:            "should add a provenance label to resources in another namespace",
+			object:          &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "shared", Namespace: "shared"}},
+			key:             client.ObjectKey{Namespace: "shared", Name: "shared"},
+			gvk:             corev1.SchemeGroupVersion.WithKind("ConfigMap"),
+			expectProvLabel: true,
+		},
+		{
+			name:            "should add a provenance label to cluster-scoped resources",
+			object:          &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "cluster-scoped"}},
+			key:             client.ObjectKey{Name: "cluster-scoped"},
+			gvk:             corev1.SchemeGroupVersion.WithKind("Namespace"),
+			expectProvLabel: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gs := NewWithT(t)
+
+			r := &ClusterResourceSetReconciler{
+				Client: fake.NewFakeClientWithScheme(scheme, tt.object),
+			}
+
+			resource := &unstructured.Unstructured{}
+			resource.SetGroupVersionKind(tt.gvk)
+			gs.Expect(r.Client.Get(context.Background(), tt.key, resource)).To(Succeed())
+			gs.Expect(r.patchOwnerRefToResource(context.Background(), clusterResourceSet, resource)).To(Succeed())
+
+			patched := &unstructured.Unstructured{}
+			patched.SetGroupVersionKind(tt.gvk)
+			gs.Expect(r.Client.Get(context.Background(), tt.key, patched)).To(Succeed())
+			gs.Expect(len(patched.GetOwnerReferences()) > 0).To(Equal(tt.expectOwnerRef))
+			_, hasLabel := patched.GetLabels()[provenanceLabel]
+			gs.Expect(hasLabel).To(Equal(tt.expectProvLabel))
+			if tt.expectProvLabel {
+				gs.Expect(patched.GetLabels()[provenanceLabel]).To(Equal(clusterResourceSet.Name))
+			}
+		})
+	}
+}
+
+func TestIsAcceptedSecretType(t *testing.T) {
+	tests := []struct {
+		name                string
+		acceptedSecretTypes []string
+		secretType          corev1.SecretType
+		expected            bool
+	}{
+		{
+			name:       "should accept the default secret type if no types are configured",
+			secretType: addonsv1.ClusterResourceSetSecretType,
+			expected:   true,
+		},
+		{
+			name:       "should not accept other secret types if no types are configured",
+			secretType: corev1.SecretTypeOpaque,
+			expected:   false,
+		},
+		{
+			name:                "should accept configured secret types",
+			acceptedSecretTypes: []string{"example.com/addon"},
+			secretType:          "example.com/addon",
+			expected:            true,
+		},
+		{
+			name:                "should not accept the default secret type if it is not configured",
+			acceptedSecretTypes: []string{"example.com/addon"},
+			secretType:          addonsv1.ClusterResourceSetSecretType,
+			expected:            false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gs := NewWithT(t)
+
+			r := &ClusterResourceSetReconciler{AcceptedSecretTypes: tt.acceptedSecretTypes}
+			gs.Expect(r.isAcceptedSecretType(tt.secretType)).To(Equal(tt.expected))
+		})
+	}
+}
+
+func TestSecretToClusterResourceSet(t *testing.T) {
+	scheme := runtime.NewScheme()
+	NewWithT(t).Expect(addonsv1.AddToScheme(scheme)).To(Succeed())
+
+	newCRS := func(name, namespace string, resources ...addonsv1.ResourceRef) *addonsv1.ClusterResourceSet {
+		return &addonsv1.ClusterResourceSet{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Spec:       addonsv1.ClusterResourceSetSpec{Resources: resources},
+		}
+	}
+	secretRef := addonsv1.ResourceRef{Kind: "Secret", Name: "addon"}
+	configMapRef := addonsv1.ResourceRef{Kind: "ConfigMap", Name: "addon"}
+	c := fake.NewFakeClientWithScheme(scheme,
+		newCRS("using-secret", "default", configMapRef, secretRef),
+		newCRS("using-configmap", "default", configMapRef),
+		newCRS("other-namespace", "other", secretRef),
+		newCRS("using-overrides", "default", addonsv1.ResourceRef{Kind: "Secret", Name: "cni", ClusterOverrides: true}),
+	)
+
+	tests := []struct {
+		name            string
+		secretName      string
+		secretNamespace string
+		sharedNamespace string
+		expected        []ctrl.Request
+	}{
+		{
+			name:            "should map Secrets to the ClusterResourceSets in their namespace using them",
+			secretNamespace: "default",
+			expected:        []ctrl.Request{{NamespacedName: types.NamespacedName{Namespace: "default", Name: "using-secret"}}},
+		},
+		{
+			name:            "should map Secrets in the shared namespace to the ClusterResourceSets in all namespaces using them",
+			secretNamespace: "shared",
+			sharedNamespace: "shared",
+			expected: []ctrl.Request{
+				{NamespacedName: types.NamespacedName{Namespace: "default", Name: "using-secret"}},
+				{NamespacedName: types.NamespacedName{Namespace: "other", Name: "other-namespace"}},
+			},
+		},
+		{
+			name:            "should map override Secrets to the ClusterResourceSets with cluster overrides of the resource",
+			secretName:      "cni-override-cluster1",
+			secretNamespace: "default",
+			expected:        []ctrl.Request{{NamespacedName: types.NamespacedName{Namespace: "default", Name: "using-overrides"}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			r := &ClusterResourceSetReconciler{
+				Client:          c,
+				Log:             log.Log,
+				SharedNamespace: tt.sharedNamespace,
+			}
+			secretName := tt.secretName
+			if secretName == "" {
+				secretName = "addon"
+			}
+			secret := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: secretName, Namespace: tt.secretNamespace}}
+			g.Expect(r.secretToClusterResourceSet(handler.MapObject{Meta: secret, Object: secret})).To(ConsistOf(tt.expected))
+		})
+	}
+}
+
+func TestSecretRecreatedWithSupportedType(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(corev1.AddToScheme(scheme)).To(Succeed())
+	g.Expect(clusterv1.AddToScheme(scheme)).To(Succeed())
+	g.Expect(addonsv1.AddToScheme(scheme)).To(Succeed())
+
+	cluster := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "cluster", Namespace: "default"}}
+	newSecret := func(secretType corev1.SecretType) *corev1.Secret {
+		return &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: "addon", Namespace: "default"},
+			Type:       secretType,
+			Data:       map[string][]byte{"cm": []byte("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: applied\n  namespace: default\n")},
+		}
+	}
+	wrongType := newSecret(corev1.SecretTypeOpaque)
+	clusterResourceSet := &addonsv1.ClusterResourceSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "crs", Namespace: "default"},
+		Spec: addonsv1.ClusterResourceSetSpec{
+			ClusterSelector: metav1.LabelSelector{MatchLabels: map[string]string{"foo": "bar"}},
+			Resources:       []addonsv1.ResourceRef{{Kind: "Secret", Name: "addon"}},
+		},
+	}
+	r := &ClusterResourceSetReconciler{
+		Client: fake.NewFakeClientWithScheme(scheme, cluster, wrongType, clusterResourceSet),
+		Log:    log.Log,
+		RemoteClientGetter: func(ctx context.Context, key client.ObjectKey) (client.Client, error) {
+			return fake.NewFakeClientWithScheme(scheme), nil
+		},
+		scheme:   scheme,
+		recorder: record.NewFakeRecorder(10),
+	}
+
+	g.Expect(r.ApplyClusterResourceSet(context.Background(), cluster, clusterResourceSet)).NotTo(Succeed())
+	g.Expect(conditions.GetReason(clusterResourceSet, addonsv1.ResourcesAppliedCondition)).To(Equal(addonsv1.WrongSecretTypeReason))
+
+	// The type of a Secret is immutable, hence it is fixed by deleting the Secret and creating it again. Updates of
+	// the Secret are not watched.
+	g.Expect(secretCreated.Update(event.UpdateEvent{MetaOld: wrongType, ObjectOld: wrongType, MetaNew: wrongType, ObjectNew: wrongType})).To(BeFalse())
+	g.Expect(r.Client.Delete(context.Background(), wrongType)).To(Succeed())
+	fixed := newSecret(addonsv1.ClusterResourceSetSecretType)
+	g.Expect(r.Client.Create(context.Background(), fixed)).To(Succeed())
+
+	// The creation of the Secret reconciles the ClusterResourceSet using it, which then applies it.
+	g.Expect(secretCreated.Create(event.CreateEvent{Meta: fixed, Object: fixed})).To(BeTrue())
+	g.Expect(r.secretToClusterResourceSet(handler.MapObject{Meta: fixed, Object: fixed})).To(ConsistOf(
+		ctrl.Request{NamespacedName: util.ObjectKey(clusterResourceSet)},
+	))
+	g.Expect(r.ApplyClusterResourceSet(context.Background(), cluster, clusterResourceSet)).To(Succeed())
+}
+
+func TestClusterResourceSetToLowerPriority(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(addonsv1.AddToScheme(scheme)).To(Succeed())
+
+	newCRS := func(name, namespace string, priority int32) *addonsv1.ClusterResourceSet {
+		return &addonsv1.ClusterResourceSet{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Spec: addonsv1.ClusterResourceSetSpec{
+				Priority:  priority,
+				Resources: []addonsv1.ResourceRef{{Kind: "ConfigMap", Name: "addon"}},
+			},
+		}
+	}
+	prerequisites := newCRS("prerequisites", "default", 10)
+	r := &ClusterResourceSetReconciler{
+		Client: fake.NewFakeClientWithScheme(scheme,
+			prerequisites,
+			newCRS("addon", "default", 0),
+			newCRS("same-priority", "default", 10),
+			newCRS("other-namespace", "other", 0),
+		),
+		Log: log.Log,
+	}
+	g.Expect(r.clusterResourceSetToLowerPriority(handler.MapObject{Meta: prerequisites, Object: prerequisites})).To(ConsistOf(
+		ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "addon"}},
+	))
+}
+
+func TestResourcesAppliedBecameTrue(t *testing.T) {
+	g := NewWithT(t)
+
+	pending := &addonsv1.ClusterResourceSet{}
+	conditions.MarkFalse(pending, addonsv1.ResourcesAppliedCondition, addonsv1.ClustersPendingReason, clusterv1.ConditionSeverityInfo, "")
+	applied := &addonsv1.ClusterResourceSet{}
+	conditions.MarkTrue(applied, addonsv1.ResourcesAppliedCondition)
+
+	g.Expect(resourcesAppliedBecameTrue(event.UpdateEvent{ObjectOld: pending, ObjectNew: applied})).To(BeTrue())
+	g.Expect(resourcesAppliedBecameTrue(event.UpdateEvent{ObjectOld: &addonsv1.ClusterResourceSet{}, ObjectNew: applied})).To(BeTrue())
+	g.Expect(resourcesAppliedBecameTrue(event.UpdateEvent{ObjectOld: applied, ObjectNew: applied.DeepCopy()})).To(BeFalse())
+	g.Expect(resourcesAppliedBecameTrue(event.UpdateEvent{ObjectOld: applied, ObjectNew: pending})).To(BeFalse())
+}
+
+func TestLimitConcurrency(t *testing.T) {
+	g := NewWithT(t)
+
+	g.Expect(limitConcurrency(log.Log, 10, 0)).To(Equal(10))
+	g.Expect(limitConcurrency(log.Log, 10, 20)).To(Equal(10))
+	g.Expect(limitConcurrency(log.Log, 10, 4)).To(Equal(4))
+}
+
+func TestForceReapplyResource(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(corev1.AddToScheme(scheme)).To(Succeed())
+	g.Expect(clusterv1.AddToScheme(scheme)).To(Succeed())
+	g.Expect(addonsv1.AddToScheme(scheme)).To(Succeed())
+
+	cluster := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "cluster", Namespace: "default"}}
+	sources := []runtime.Object{cluster}
+	for _, name := range []string{"a", "b"} {
+		sources = append(sources, &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+			Data:       map[string]string{"cm": fmt.Sprintf("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: applied-%s\n  namespace: default\n", name)},
+		})
+	}
+	clusterResourceSet := &addonsv1.ClusterResourceSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "crs", Namespace: "default"},
+		Spec: addonsv1.ClusterResourceSetSpec{
+			ClusterSelector: metav1.LabelSelector{MatchLabels: map[string]string{"foo": "bar"}},
+			Resources:       []addonsv1.ResourceRef{{Kind: "ConfigMap", Name: "a"}, {Kind: "ConfigMap", Name: "b"}},
+		},
+	}
+	sources = append(sources, clusterResourceSet)
+
+	remoteClient := fake.NewFakeClientWithScheme(scheme)
+	r := &ClusterResourceSetReconciler{
+		Client: fake.NewFakeClientWithScheme(scheme, sources...),
+		Log:    log.Log,
+		RemoteClientGetter: func(ctx context.Context, key client.ObjectKey) (client.Client, error) {
+			return remoteClient, nil
+		},
+		scheme:   scheme,
+		recorder: record.NewFakeRecorder(10),
+	}
+	g.Expect(r.ApplyClusterResourceSet(context.Background(), cluster, clusterResourceSet)).To(Succeed())
+
+	// Delete the applied objects, so that applying a resource again shows in the cluster.
+	for _, name := range []string{"applied-a", "applied-b"} {
+		g.Expect(remoteClient.Delete(context.Background(), &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"}})).To(Succeed())
+	}
+
+	_, err := r.forceReapplyResource(context.Background(), clusterResourceSet, "ConfigMap/c")
+	g.Expect(isInvalidResourceKeyError(err)).To(BeTrue())
+	_, err = r.forceReapplyResource(context.Background(), clusterResourceSet, "a")
+	g.Expect(isInvalidResourceKeyError(err)).To(BeTrue())
+
+	count, err := r.forceReapplyResource(context.Background(), clusterResourceSet, "ConfigMap/a")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(count).To(Equal(1))
+	binding := &addonsv1.ClusterResourceSetBinding{}
+	g.Expect(r.Client.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: "cluster"}, binding)).To(Succeed())
+	resourceSetBinding := binding.GetOrCreateBinding(clusterResourceSet)
+	g.Expect(resourceSetBinding.IsApplied(clusterResourceSet.Spec.Resources[0])).To(BeFalse())
+	g.Expect(resourceSetBinding.IsApplied(clusterResourceSet.Spec.Resources[1])).To(BeTrue())
+
+	// Only the marked resource is applied again.
+	g.Expect(r.ApplyClusterResourceSet(context.Background(), cluster, clusterResourceSet)).To(Succeed())
+	g.Expect(remoteClient.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: "applied-a"}, &corev1.ConfigMap{})).To(Succeed())
+	err = remoteClient.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: "applied-b"}, &corev1.ConfigMap{})
+	g.Expect(apierrors.IsNotFound(err)).To(BeTrue())
+}
@@ -0,0 +1,116 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	addonsv1 "sigs.k8s.io/cluster-api/exp/addons/api/v1alpha3"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+const (
+	// inventoryNamespace is the namespace of the workload clusters the inventory ConfigMaps are written to.
+	inventoryNamespace = metav1.NamespaceSystem
+
+	// inventoryKey is the key of the inventory ConfigMaps holding the list of the applied resources.
+	inventoryKey = "inventory.json"
+)
+
+// inventoryEntry lists the objects applied for a resource of a ClusterResourceSet.
+type inventoryEntry struct {
+	Resource        string       `json:"resource"`
+	Hash            string       `json:"hash,omitempty"`
+	LastAppliedTime *metav1.Time `json:"lastAppliedTime,omitempty"`
+	Objects         []string     `json:"objects"`
+}
+
+// inventoryName returns the name of the inventory ConfigMap of the ClusterResourceSet.
+func inventoryName(clusterResourceSet *addonsv1.ClusterResourceSet) string {
+	return "clusterresourceset-" + clusterResourceSet.Name
+}
+
+// inventoryObjects returns the objects in dataList formatted as "<apiVersion> <kind> [<namespace>/]<name>".
+func inventoryObjects(dataList [][]byte) ([]string, error) {
+	objects := []string{}
+	for _, data := range dataList {
+		objs, err := parseObjects(data)
+		if err != nil {
+			return nil, err
+		}
+		for i := range objs {
+			name := objs[i].GetName()
+			if objs[i].GetNamespace() != "" {
+				name = objs[i].GetNamespace() + "/" + name
+			}
+			objects = append(objects, fmt.Sprintf("%s %s %s", objs[i].GetAPIVersion(), objs[i].GetKind(), name))
+		}
+	}
+	return objects, nil
+}
+
+// writeInventory creates or updates the inventory ConfigMap of the ClusterResourceSet in the cluster. The ConfigMap is
+// only updated if the inventory changed.
+func writeInventory(ctx context.Context, c client.Client, clusterResourceSet *addonsv1.ClusterResourceSet, entries []inventoryEntry) error {
+	inventory, err := json.Marshal(entries)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal inventory")
+	}
+	data := map[string]string{
+		"clusterResourceSet": clusterResourceSet.Namespace + "/" + clusterResourceSet.Name,
+		inventoryKey:         string(inventory),
+	}
+
+	configMap := &corev1.ConfigMap{}
+	key := client.ObjectKey{Namespace: inventoryNamespace, Name: inventoryName(clusterResourceSet)}
+	if err := c.Get(ctx, key, configMap); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return errors.Wrapf(err, "failed to get inventory ConfigMap %s", key)
+		}
+		configMap = &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      key.Name,
+				Namespace: key.Namespace,
+				Labels:    map[string]string{addonsv1.ClusterResourceSetNameLabel: clusterResourceSet.Name},
+			},
+			Data: data,
+		}
+		return errors.Wrapf(c.Create(ctx, configMap), "failed to create inventory ConfigMap %s", key)
+	}
+
+	if reflect.DeepEqual(configMap.Data, data) {
+		return nil
+	}
+	configMap.Data = data
+	return errors.Wrapf(c.Update(ctx, configMap), "failed to update inventory ConfigMap %s", key)
+}
+
+// deleteInventory deletes the inventory ConfigMap of the ClusterResourceSet from the cluster, if any.
+func deleteInventory(ctx context.Context, c client.Client, clusterResourceSet *addonsv1.ClusterResourceSet) error {
+	configMap := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: inventoryNamespace, Name: inventoryName(clusterResourceSet)}}
+	if err := c.Delete(ctx, configMap); err != nil && !apierrors.IsNotFound(err) {
+		return errors.Wrapf(err, "failed to delete inventory ConfigMap %s/%s", configMap.Namespace, configMap.Name)
+	}
+	return nil
+}
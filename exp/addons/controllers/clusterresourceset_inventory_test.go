@@ -0,0 +1,119 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
+	addonsv1 "sigs.k8s.io/cluster-api/exp/addons/api/v1alpha3"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+func TestInventoryObjects(t *testing.T) {
+	g := NewWithT(t)
+
+	objects, err := inventoryObjects([][]byte{
+		[]byte(`apiVersion: v1
+kind: Namespace
+metadata:
+  name: addons
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: addon
+  namespace: addons
+`),
+		[]byte(`[{"apiVersion": "v1", "kind": "ServiceAccount", "metadata": {"name": "addon", "namespace": "addons"}}]`),
+	})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(objects).To(Equal([]string{
+		"v1 Namespace addons",
+		"apps/v1 Deployment addons/addon",
+		"v1 ServiceAccount addons/addon",
+	}))
+}
+
+func TestApplyClusterResourceSetWritesInventory(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(corev1.AddToScheme(scheme)).To(Succeed())
+	g.Expect(clusterv1.AddToScheme(scheme)).To(Succeed())
+	g.Expect(addonsv1.AddToScheme(scheme)).To(Succeed())
+
+	cluster := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "cluster", Namespace: "default"}}
+	source := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "resource", Namespace: "default"},
+		Data: map[string]string{"cm": `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: applied
+  namespace: default
+`},
+	}
+	clusterResourceSet := &addonsv1.ClusterResourceSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "crs", Namespace: "default"},
+		Spec: addonsv1.ClusterResourceSetSpec{
+			ClusterSelector: metav1.LabelSelector{MatchLabels: map[string]string{"foo": "bar"}},
+			Resources:       []addonsv1.ResourceRef{{Kind: "ConfigMap", Name: "resource"}},
+			WriteInventory:  true,
+		},
+	}
+
+	remoteClient := fake.NewFakeClientWithScheme(scheme)
+	r := &ClusterResourceSetReconciler{
+		Client: fake.NewFakeClientWithScheme(scheme, cluster, source, clusterResourceSet),
+		Log:    log.Log,
+		RemoteClientGetter: func(ctx context.Context, key client.ObjectKey) (client.Client, error) {
+			return remoteClient, nil
+		},
+		scheme:   scheme,
+		recorder: record.NewFakeRecorder(10),
+	}
+
+	g.Expect(r.ApplyClusterResourceSet(context.Background(), cluster, clusterResourceSet)).To(Succeed())
+
+	inventory := &corev1.ConfigMap{}
+	key := client.ObjectKey{Namespace: metav1.NamespaceSystem, Name: "clusterresourceset-crs"}
+	g.Expect(remoteClient.Get(context.Background(), key, inventory)).To(Succeed())
+	g.Expect(inventory.Labels).To(HaveKeyWithValue(addonsv1.ClusterResourceSetNameLabel, "crs"))
+	g.Expect(inventory.Data).To(HaveKeyWithValue("clusterResourceSet", "default/crs"))
+	entries := []inventoryEntry{}
+	g.Expect(json.Unmarshal([]byte(inventory.Data[inventoryKey]), &entries)).To(Succeed())
+	g.Expect(entries).To(HaveLen(1))
+	g.Expect(entries[0].Resource).To(Equal("ConfigMap/resource"))
+	g.Expect(entries[0].Hash).NotTo(BeEmpty())
+	g.Expect(entries[0].Objects).To(Equal([]string{"v1 ConfigMap default/applied"}))
+
+	// The inventory is deleted along with the objects.
+	g.Expect(r.removeFromCluster(context.Background(), clusterResourceSet, cluster.Name)).To(Succeed())
+	err := remoteClient.Get(context.Background(), key, &corev1.ConfigMap{})
+	g.Expect(apierrors.IsNotFound(err)).To(BeTrue())
+}
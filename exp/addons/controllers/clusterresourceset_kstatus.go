@@ -0,0 +1,61 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
+	addonsv1 "sigs.k8s.io/cluster-api/exp/addons/api/v1alpha3"
+	"sigs.k8s.io/cluster-api/util/conditions"
+)
+
+// readyConditions are the conditions summarized by the Ready condition of ClusterResourceSets. ClustersMatched is
+// not part of them, as a ClusterResourceSet matching no cluster has nothing left to apply.
+var readyConditions = []clusterv1.ConditionType{
+	addonsv1.ResourcesAppliedCondition,
+	addonsv1.AllClustersAppliedCondition,
+	addonsv1.ClusterReachableCondition,
+	addonsv1.BindingsWithinLimitCondition,
+	addonsv1.PostApplyJobSucceededCondition,
+}
+
+// setKStatusConditions sets the Ready, Reconciling and Stalled conditions of the ClusterResourceSet from its other
+// conditions, so that tools computing the status of objects with kstatus, e.g. GitOps tools, can wait for it to be
+// applied. Stalled is set for failures with the Error severity, which need the ClusterResourceSet or its resources to
+// be changed, and Reconciling for all the other reasons the ClusterResourceSet is not ready.
+func setKStatusConditions(clusterResourceSet *addonsv1.ClusterResourceSet) {
+	conditions.SetSummary(clusterResourceSet, conditions.WithConditions(readyConditions...))
+
+	ready := conditions.Get(clusterResourceSet, clusterv1.ReadyCondition)
+	if ready == nil || conditions.IsTrue(clusterResourceSet, clusterv1.ReadyCondition) {
+		conditions.Delete(clusterResourceSet, addonsv1.ReconcilingCondition)
+		conditions.Delete(clusterResourceSet, addonsv1.StalledCondition)
+		return
+	}
+
+	if ready.Severity == clusterv1.ConditionSeverityError {
+		conditions.Delete(clusterResourceSet, addonsv1.ReconcilingCondition)
+		conditions.Set(clusterResourceSet, &clusterv1.Condition{
+			Type: addonsv1.StalledCondition, Status: corev1.ConditionTrue, Reason: ready.Reason, Message: ready.Message,
+		})
+		return
+	}
+	conditions.Delete(clusterResourceSet, addonsv1.StalledCondition)
+	conditions.Set(clusterResourceSet, &clusterv1.Condition{
+		Type: addonsv1.ReconcilingCondition, Status: corev1.ConditionTrue, Reason: ready.Reason, Message: ready.Message,
+	})
+}
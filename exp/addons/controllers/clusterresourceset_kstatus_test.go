@@ -0,0 +1,59 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
+	addonsv1 "sigs.k8s.io/cluster-api/exp/addons/api/v1alpha3"
+	"sigs.k8s.io/cluster-api/util/conditions"
+)
+
+func TestSetKStatusConditions(t *testing.T) {
+	g := NewWithT(t)
+
+	clusterResourceSet := &addonsv1.ClusterResourceSet{}
+	conditions.MarkTrue(clusterResourceSet, addonsv1.ResourcesAppliedCondition)
+	conditions.MarkFalse(clusterResourceSet, addonsv1.AllClustersAppliedCondition, addonsv1.ClustersPendingReason, clusterv1.ConditionSeverityInfo, "Resources are not applied to 1 of 2 clusters")
+	conditions.MarkFalse(clusterResourceSet, addonsv1.ClustersMatchedCondition, addonsv1.NoMatchingClustersReason, clusterv1.ConditionSeverityWarning, "")
+
+	// Resources being applied are reconciling.
+	setKStatusConditions(clusterResourceSet)
+	g.Expect(conditions.IsFalse(clusterResourceSet, clusterv1.ReadyCondition)).To(BeTrue())
+	g.Expect(conditions.IsTrue(clusterResourceSet, addonsv1.ReconcilingCondition)).To(BeTrue())
+	g.Expect(conditions.GetReason(clusterResourceSet, addonsv1.ReconcilingCondition)).To(Equal(addonsv1.ClustersPendingReason))
+	g.Expect(conditions.GetMessage(clusterResourceSet, addonsv1.ReconcilingCondition)).To(Equal("Resources are not applied to 1 of 2 clusters"))
+	g.Expect(conditions.Has(clusterResourceSet, addonsv1.StalledCondition)).To(BeFalse())
+
+	// Errors that retrying does not fix stall the ClusterResourceSet.
+	conditions.MarkFalse(clusterResourceSet, addonsv1.ResourcesAppliedCondition, addonsv1.PermanentApplyFailedReason, clusterv1.ConditionSeverityError, "invalid object")
+	setKStatusConditions(clusterResourceSet)
+	g.Expect(conditions.IsTrue(clusterResourceSet, addonsv1.StalledCondition)).To(BeTrue())
+	g.Expect(conditions.GetReason(clusterResourceSet, addonsv1.StalledCondition)).To(Equal(addonsv1.PermanentApplyFailedReason))
+	g.Expect(conditions.Has(clusterResourceSet, addonsv1.ReconcilingCondition)).To(BeFalse())
+
+	// Once applied to all the clusters, the ClusterResourceSet is ready, whether or not it matches clusters.
+	conditions.MarkTrue(clusterResourceSet, addonsv1.ResourcesAppliedCondition)
+	conditions.MarkTrue(clusterResourceSet, addonsv1.AllClustersAppliedCondition)
+	setKStatusConditions(clusterResourceSet)
+	g.Expect(conditions.IsTrue(clusterResourceSet, clusterv1.ReadyCondition)).To(BeTrue())
+	g.Expect(conditions.Has(clusterResourceSet, addonsv1.ReconcilingCondition)).To(BeFalse())
+	g.Expect(conditions.Has(clusterResourceSet, addonsv1.StalledCondition)).To(BeFalse())
+}
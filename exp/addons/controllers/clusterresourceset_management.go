@@ -0,0 +1,160 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"net"
+	"strconv"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/clientcmd"
+	bootstrapapi "k8s.io/cluster-bootstrap/token/api"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
+	"sigs.k8s.io/cluster-api/util"
+	"sigs.k8s.io/cluster-api/util/kubeconfig"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// managementClusterCheck is whether a Cluster is the management cluster, as checked for a generation of the Cluster.
+type managementClusterCheck struct {
+	uid        types.UID
+	generation int64
+	management bool
+}
+
+// isManagementCluster returns true if the API server endpoint of the Cluster, according to its kubeconfig or its
+// control plane endpoint, is one of the endpoints of the management cluster. The result is cached per generation of
+// the Cluster, so that its kubeconfig is not read at every reconcile.
+func (r *ClusterResourceSetReconciler) isManagementCluster(ctx context.Context, cluster *clusterv1.Cluster) (bool, error) {
+	key := util.ObjectKey(cluster)
+	r.managementChecksLock.Lock()
+	check, ok := r.managementChecks[key]
+	r.managementChecksLock.Unlock()
+	if ok && check.uid == cluster.UID && check.generation == cluster.Generation {
+		return check.management, nil
+	}
+
+	managementEndpoints, err := r.managementEndpoints(ctx)
+	if err != nil {
+		return false, err
+	}
+	management, err := r.pointsAtEndpoints(ctx, cluster, managementEndpoints)
+	if err != nil {
+		return false, err
+	}
+
+	r.managementChecksLock.Lock()
+	defer r.managementChecksLock.Unlock()
+	if r.managementChecks == nil {
+		r.managementChecks = map[types.NamespacedName]managementClusterCheck{}
+	}
+	r.managementChecks[key] = managementClusterCheck{uid: cluster.UID, generation: cluster.Generation, management: management}
+	return management, nil
+}
+
+// pointsAtEndpoints returns true if the API server endpoint of the Cluster, according to its kubeconfig or its control
+// plane endpoint, is one of the endpoints.
+func (r *ClusterResourceSetReconciler) pointsAtEndpoints(ctx context.Context, cluster *clusterv1.Cluster, endpoints []string) (bool, error) {
+	if len(endpoints) == 0 {
+		return false, nil
+	}
+
+	clusterEndpoints := []string{}
+	if !cluster.Spec.ControlPlaneEndpoint.IsZero() {
+		clusterEndpoints = append(clusterEndpoints, cluster.Spec.ControlPlaneEndpoint.String())
+	}
+	data, err := kubeconfig.FromSecret(ctx, r.Client, util.ObjectKey(cluster))
+	if err != nil && !apierrors.IsNotFound(errors.Cause(err)) {
+		return false, errors.Wrapf(err, "failed to get kubeconfig of cluster %s", cluster.Name)
+	}
+	if err == nil {
+		config, err := clientcmd.Load(data)
+		if err != nil {
+			return false, errors.Wrapf(err, "failed to parse kubeconfig of cluster %s", cluster.Name)
+		}
+		for _, c := range config.Clusters {
+			clusterEndpoints = append(clusterEndpoints, c.Server)
+		}
+	}
+
+	for _, clusterEndpoint := range clusterEndpoints {
+		for _, endpoint := range endpoints {
+			if endpointHost(clusterEndpoint) == endpointHost(endpoint) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// managementEndpoints returns the ManagementClusterEndpoints and the endpoints advertised by the API server of the
+// management cluster. In-cluster, the controller connects to the API server through the IP of the kubernetes service,
+// which kubeconfigs of the management cluster rarely point at. The advertised endpoints are only discovered once.
+func (r *ClusterResourceSetReconciler) managementEndpoints(ctx context.Context) ([]string, error) {
+	r.advertisedEndpointsLock.Lock()
+	defer r.advertisedEndpointsLock.Unlock()
+
+	if r.advertisedEndpoints == nil && r.apiReader != nil {
+		endpoints, err := advertisedEndpoints(ctx, r.apiReader)
+		if err != nil {
+			return nil, err
+		}
+		r.advertisedEndpoints = endpoints
+	}
+	return append(append([]string{}, r.ManagementClusterEndpoints...), r.advertisedEndpoints...), nil
+}
+
+// advertisedEndpoints returns the endpoints of the API server of the cluster: the addresses of the kubernetes
+// service's Endpoints, and the server of the kubeconfig in the cluster-info ConfigMap published by kubeadm.
+func advertisedEndpoints(ctx context.Context, c client.Reader) ([]string, error) {
+	endpoints := []string{}
+
+	kubernetes := &corev1.Endpoints{}
+	if err := c.Get(ctx, client.ObjectKey{Namespace: metav1.NamespaceDefault, Name: "kubernetes"}, kubernetes); err != nil && !apierrors.IsNotFound(err) {
+		return nil, errors.Wrap(err, "failed to get the endpoints of the kubernetes service")
+	}
+	for _, subset := range kubernetes.Subsets {
+		for _, port := range subset.Ports {
+			if port.Name != "https" {
+				continue
+			}
+			for _, address := range subset.Addresses {
+				endpoints = append(endpoints, net.JoinHostPort(address.IP, strconv.Itoa(int(port.Port))))
+			}
+		}
+	}
+
+	clusterInfo := &corev1.ConfigMap{}
+	if err := c.Get(ctx, client.ObjectKey{Namespace: metav1.NamespacePublic, Name: bootstrapapi.ConfigMapClusterInfo}, clusterInfo); err != nil && !apierrors.IsNotFound(err) {
+		return nil, errors.Wrap(err, "failed to get the cluster-info ConfigMap")
+	}
+	if data, ok := clusterInfo.Data[bootstrapapi.KubeConfigKey]; ok {
+		config, err := clientcmd.Load([]byte(data))
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to parse the cluster-info kubeconfig")
+		}
+		for _, cluster := range config.Clusters {
+			endpoints = append(endpoints, cluster.Server)
+		}
+	}
+	return endpoints, nil
+}
@@ -0,0 +1,164 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
+	addonsv1 "sigs.k8s.io/cluster-api/exp/addons/api/v1alpha3"
+	"sigs.k8s.io/cluster-api/util"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/cluster-api/util/kubeconfig"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// managementClusterObjects returns the objects advertising the endpoints of a management cluster whose API server is
+// reachable at 172.18.0.2:6443 and management.example.com.
+func managementClusterObjects() []runtime.Object {
+	return []runtime.Object{
+		&corev1.Endpoints{
+			ObjectMeta: metav1.ObjectMeta{Name: "kubernetes", Namespace: metav1.NamespaceDefault},
+			Subsets: []corev1.EndpointSubset{{
+				Addresses: []corev1.EndpointAddress{{IP: "172.18.0.2"}},
+				Ports:     []corev1.EndpointPort{{Name: "https", Port: 6443}},
+			}},
+		},
+		&corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: "cluster-info", Namespace: metav1.NamespacePublic},
+			Data: map[string]string{"kubeconfig": `apiVersion: v1
+kind: Config
+clusters:
+- name: ""
+  cluster:
+    server: https://management.example.com
+`},
+		},
+	}
+}
+
+func TestAdvertisedEndpoints(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(corev1.AddToScheme(scheme)).To(Succeed())
+
+	endpoints, err := advertisedEndpoints(context.Background(), fake.NewFakeClientWithScheme(scheme, managementClusterObjects()...))
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(endpoints).To(Equal([]string{"172.18.0.2:6443", "https://management.example.com"}))
+
+	// Clusters not publishing their endpoints have none.
+	endpoints, err = advertisedEndpoints(context.Background(), fake.NewFakeClientWithScheme(scheme))
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(endpoints).To(BeEmpty())
+}
+
+func TestIsManagementCluster(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(corev1.AddToScheme(scheme)).To(Succeed())
+	g.Expect(clusterv1.AddToScheme(scheme)).To(Succeed())
+
+	cluster := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "cluster", Namespace: "default", UID: "uid", Generation: 1}}
+	kubeconfigSecret := kubeconfig.GenerateSecret(cluster, []byte(`apiVersion: v1
+kind: Config
+clusters:
+- name: cluster
+  cluster:
+    server: https://172.18.0.2:6443
+`))
+
+	// The controller connects to the management cluster through the IP of the kubernetes service, which the
+	// kubeconfig of the Cluster does not use.
+	r := &ClusterResourceSetReconciler{
+		Client:                     fake.NewFakeClientWithScheme(scheme, cluster, kubeconfigSecret),
+		ManagementClusterEndpoints: []string{"https://10.96.0.1:443"},
+		apiReader:                  fake.NewFakeClientWithScheme(scheme, managementClusterObjects()...),
+	}
+	management, err := r.isManagementCluster(context.Background(), cluster)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(management).To(BeTrue())
+
+	// The result is reused for the same generation of the Cluster, without reading its kubeconfig again.
+	g.Expect(r.Client.Delete(context.Background(), kubeconfigSecret)).To(Succeed())
+	management, err = r.isManagementCluster(context.Background(), cluster)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(management).To(BeTrue())
+
+	// A new generation of the Cluster is checked again.
+	cluster.Generation = 2
+	management, err = r.isManagementCluster(context.Background(), cluster)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(management).To(BeFalse())
+}
+
+func TestReconcileSkipsManagementClusterWithoutFailing(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(corev1.AddToScheme(scheme)).To(Succeed())
+	g.Expect(clusterv1.AddToScheme(scheme)).To(Succeed())
+	g.Expect(addonsv1.AddToScheme(scheme)).To(Succeed())
+
+	cluster := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "management", Namespace: "default", Labels: map[string]string{"foo": "bar"}}}
+	cluster.Spec.ControlPlaneEndpoint = clusterv1.APIEndpoint{Host: "management.example.com", Port: 443}
+	source := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "resource", Namespace: "default"},
+		Data:       map[string]string{"cm": "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: applied\n  namespace: default\n"},
+	}
+	clusterResourceSet := &addonsv1.ClusterResourceSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "crs", Namespace: "default"},
+		Spec: addonsv1.ClusterResourceSetSpec{
+			ClusterSelector: metav1.LabelSelector{MatchLabels: map[string]string{"foo": "bar"}},
+			Resources:       []addonsv1.ResourceRef{{Kind: "ConfigMap", Name: "resource"}},
+		},
+	}
+
+	recorder := record.NewFakeRecorder(10)
+	r := &ClusterResourceSetReconciler{
+		Client: fake.NewFakeClientWithScheme(scheme, cluster, source, clusterResourceSet),
+		Log:    log.Log,
+		RemoteClientGetter: func(ctx context.Context, key client.ObjectKey) (client.Client, error) {
+			return fake.NewFakeClientWithScheme(scheme), nil
+		},
+		ManagementClusterEndpoints: []string{"management.example.com:443"},
+		scheme:                     scheme,
+		recorder:                   recorder,
+	}
+
+	// Skipping the management cluster is not a failure, hence it is neither retried nor reported as degraded.
+	res, err := r.Reconcile(ctrl.Request{NamespacedName: util.ObjectKey(clusterResourceSet)})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(res.Requeue).To(BeFalse())
+	g.Expect(r.Client.Get(context.Background(), util.ObjectKey(clusterResourceSet), clusterResourceSet)).To(Succeed())
+	g.Expect(conditions.GetReason(clusterResourceSet, addonsv1.ResourcesAppliedCondition)).To(Equal(addonsv1.ManagementClusterReason))
+	close(recorder.Events)
+	for event := range recorder.Events {
+		g.Expect(event).NotTo(ContainSubstring("RolloutDegraded"))
+	}
+}
@@ -0,0 +1,113 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/jsonmergepatch"
+	"k8s.io/apimachinery/pkg/util/mergepatch"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// setLastAppliedConfiguration records obj, without the annotation itself, in its last-applied-configuration annotation
+// like "kubectl apply" does, and returns obj serialized with the annotation.
+func setLastAppliedConfiguration(obj *unstructured.Unstructured) ([]byte, error) {
+	annotations := obj.GetAnnotations()
+	delete(annotations, corev1.LastAppliedConfigAnnotation)
+	if len(annotations) == 0 {
+		annotations = nil
+	}
+	obj.SetAnnotations(annotations)
+
+	original, err := obj.MarshalJSON()
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to marshal object %s %s/%s", obj.GroupVersionKind(), obj.GetNamespace(), obj.GetName())
+	}
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[corev1.LastAppliedConfigAnnotation] = string(original)
+	obj.SetAnnotations(annotations)
+	return obj.MarshalJSON()
+}
+
+// threeWayMergePatch returns the patch updating current to modified while removing the fields of original that are no
+// longer in modified. Built-in kinds use a strategic merge patch, other kinds a JSON merge patch.
+func threeWayMergePatch(obj *unstructured.Unstructured, original, modified, current []byte) ([]byte, types.PatchType, error) {
+	if versioned, err := scheme.Scheme.New(obj.GroupVersionKind()); err == nil {
+		lookupPatchMeta, err := strategicpatch.NewPatchMetaFromStruct(versioned)
+		if err != nil {
+			return nil, "", err
+		}
+		patch, err := strategicpatch.CreateThreeWayMergePatch(original, modified, current, lookupPatchMeta, true)
+		return patch, types.StrategicMergePatchType, err
+	}
+
+	preconditions := []mergepatch.PreconditionFunc{
+		mergepatch.RequireKeyUnchanged("apiVersion"),
+		mergepatch.RequireKeyUnchanged("kind"),
+		mergepatch.RequireMetadataKeyUnchanged("name"),
+	}
+	patch, err := jsonmergepatch.CreateThreeWayJSONMergePatch(original, modified, current, preconditions...)
+	return patch, types.MergePatchType, err
+}
+
+// mergeUnstructured updates an existing object on the API server to match obj, serialized as modified with its
+// last-applied-configuration annotation, using a three-way merge patch like "kubectl apply" does.
+func mergeUnstructured(ctx context.Context, c client.Client, obj *unstructured.Unstructured, modified []byte, opts applyOptions) error {
+	current := &unstructured.Unstructured{}
+	current.SetGroupVersionKind(obj.GroupVersionKind())
+	if err := c.Get(ctx, client.ObjectKey{Namespace: obj.GetNamespace(), Name: obj.GetName()}, current); err != nil {
+		return err
+	}
+	currentData, err := current.MarshalJSON()
+	if err != nil {
+		return errors.Wrapf(err, "failed to marshal object %s %s/%s", obj.GroupVersionKind(), obj.GetNamespace(), obj.GetName())
+	}
+	// Objects without the annotation, e.g. created before the ThreeWayMerge mode was set, are merged two-way.
+	var original []byte
+	if lastApplied, ok := current.GetAnnotations()[corev1.LastAppliedConfigAnnotation]; ok {
+		original = []byte(lastApplied)
+	}
+
+	patch, patchType, err := threeWayMergePatch(obj, original, modified, currentData)
+	if err != nil {
+		return errors.Wrapf(err, "failed to compute patch for %s %s/%s", obj.GroupVersionKind(), obj.GetNamespace(), obj.GetName())
+	}
+	if string(patch) == "{}" {
+		return nil
+	}
+
+	desired := obj.DeepCopy()
+	err = c.Patch(ctx, obj, client.RawPatch(patchType, patch), client.FieldOwner(fieldManager))
+	if opts.replaceImmutable && isImmutableFieldError(err) {
+		return replaceUnstructured(ctx, c, desired, err, opts)
+	}
+	if err == nil && opts.onChange != nil {
+		if fields := changedFields(current, desired); len(fields) > 0 {
+			opts.onChange(newObjectChange(desired, "updated", fields))
+		}
+	}
+	return err
+}
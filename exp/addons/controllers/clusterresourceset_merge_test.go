@@ -0,0 +1,81 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestApplyThreeWayMerge(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(corev1.AddToScheme(scheme)).To(Succeed())
+
+	// The object was applied with data a and b, then c was added by someone else.
+	existing := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "cm",
+			Namespace: "default",
+			Annotations: map[string]string{
+				corev1.LastAppliedConfigAnnotation: `{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"cm","namespace":"default"},"data":{"a":"1","b":"2"}}`,
+			},
+		},
+		Data: map[string]string{"a": "1", "b": "2", "c": "3"},
+	}
+	c := fake.NewFakeClientWithScheme(scheme, existing)
+
+	// b is removed from the resource and d is added.
+	data := []byte(`{"apiVersion":"v1","kind":"ConfigMap","metadata":{"name":"cm","namespace":"default"},"data":{"a":"1","d":"4"}}`)
+	g.Expect(apply(context.Background(), c, data, applyOptions{updateExisting: true, threeWayMerge: true})).To(Succeed())
+
+	cm := &corev1.ConfigMap{}
+	g.Expect(c.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: "cm"}, cm)).To(Succeed())
+	g.Expect(cm.Data).To(Equal(map[string]string{"a": "1", "c": "3", "d": "4"}))
+
+	lastApplied := map[string]interface{}{}
+	g.Expect(json.Unmarshal([]byte(cm.Annotations[corev1.LastAppliedConfigAnnotation]), &lastApplied)).To(Succeed())
+	g.Expect(lastApplied["data"]).To(Equal(map[string]interface{}{"a": "1", "d": "4"}))
+}
+
+func TestThreeWayMergePatchCustomResource(t *testing.T) {
+	g := NewWithT(t)
+
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion("example.com/v1")
+	obj.SetKind("Widget")
+	original := []byte(`{"apiVersion":"example.com/v1","kind":"Widget","metadata":{"name":"w"},"spec":{"a":1,"b":2}}`)
+	modified := []byte(`{"apiVersion":"example.com/v1","kind":"Widget","metadata":{"name":"w"},"spec":{"a":1}}`)
+	current := []byte(`{"apiVersion":"example.com/v1","kind":"Widget","metadata":{"name":"w"},"spec":{"a":1,"b":2,"c":3}}`)
+
+	patch, patchType, err := threeWayMergePatch(obj, original, modified, current)
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(patchType).To(Equal(types.MergePatchType))
+	g.Expect(string(patch)).To(Equal(`{"spec":{"b":null}}`))
+}
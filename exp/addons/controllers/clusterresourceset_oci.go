@@ -0,0 +1,316 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	corev1 "k8s.io/api/core/v1"
+)
+
+const (
+	ociManifestMediaType = "application/vnd.oci.image.manifest.v1+json"
+
+	// maxOCIContentSize is the maximum size of the manifests and layers pulled from registries.
+	maxOCIContentSize = 10 << 20
+
+	// maxCachedOCIBlobs is the maximum number of layers kept in memory. The cache is reset when it is exceeded.
+	maxCachedOCIBlobs = 100
+)
+
+var authChallengeParam = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+// ociPullError is returned when an OCI artifact cannot be pulled from its registry.
+type ociPullError struct {
+	err error
+}
+
+func (e *ociPullError) Error() string {
+	return e.err.Error()
+}
+
+// ociReference identifies an artifact in an OCI registry.
+type ociReference struct {
+	registry   string
+	repository string
+	// reference is either a tag or a digest.
+	reference string
+}
+
+// parseOCIReference parses references in the registry/repository[:tag|@digest] format. The tag defaults to latest.
+func parseOCIReference(ref string) (*ociReference, error) {
+	i := strings.Index(ref, "/")
+	if i <= 0 {
+		return nil, errors.Errorf("OCI reference %q must include a registry", ref)
+	}
+	r := &ociReference{registry: ref[:i]}
+	rest := ref[i+1:]
+
+	switch {
+	case strings.Contains(rest, "@"):
+		j := strings.LastIndex(rest, "@")
+		r.repository, r.reference = rest[:j], rest[j+1:]
+	case strings.LastIndex(rest, ":") > strings.LastIndex(rest, "/"):
+		j := strings.LastIndex(rest, ":")
+		r.repository, r.reference = rest[:j], rest[j+1:]
+	default:
+		r.repository, r.reference = rest, "latest"
+	}
+	if r.repository == "" || r.reference == "" {
+		return nil, errors.Errorf("invalid OCI reference %q", ref)
+	}
+	return r, nil
+}
+
+// ociCredentials are the credentials used to authenticate to a registry.
+type ociCredentials struct {
+	username string
+	password string
+}
+
+// ociCredentialsFromSecret returns the credentials for the registry from a Secret of type kubernetes.io/dockerconfigjson.
+func ociCredentialsFromSecret(secret *corev1.Secret, registry string) (*ociCredentials, error) {
+	if secret.Type != corev1.SecretTypeDockerConfigJson {
+		return nil, errors.Errorf("pull secret %s has type %s, expected %s", secret.Name, secret.Type, corev1.SecretTypeDockerConfigJson)
+	}
+
+	config := struct {
+		Auths map[string]struct {
+			Username string `json:"username"`
+			Password string `json:"password"`
+			Auth     string `json:"auth"`
+		} `json:"auths"`
+	}{}
+	if err := json.Unmarshal(secret.Data[corev1.DockerConfigJsonKey], &config); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse pull secret %s", secret.Name)
+	}
+
+	auth, ok := config.Auths[registry]
+	if !ok {
+		return nil, errors.Errorf("pull secret %s has no credentials for registry %s", secret.Name, registry)
+	}
+	if auth.Username == "" && auth.Auth != "" {
+		decoded, err := base64.StdEncoding.DecodeString(auth.Auth)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to decode credentials for registry %s in pull secret %s", registry, secret.Name)
+		}
+		parts := strings.SplitN(string(decoded), ":", 2)
+		if len(parts) != 2 {
+			return nil, errors.Errorf("invalid credentials for registry %s in pull secret %s", registry, secret.Name)
+		}
+		auth.Username, auth.Password = parts[0], parts[1]
+	}
+	return &ociCredentials{username: auth.Username, password: auth.Password}, nil
+}
+
+// ociClient pulls manifest bundles stored in the layers of OCI artifacts using the OCI distribution API.
+// Layers are cached by repository and digest, so unchanged artifacts are not downloaded again. Manifests are never
+// cached, hence access to the repository is checked by the registry on every pull.
+type ociClient struct {
+	httpClient *http.Client
+
+	lock  sync.Mutex
+	blobs map[string][]byte
+}
+
+func newOCIClient(httpClient *http.Client) *ociClient {
+	return &ociClient{
+		httpClient: httpClient,
+		blobs:      map[string][]byte{},
+	}
+}
+
+// pull returns the content of the artifact's layers as a multi-document YAML.
+func (o *ociClient) pull(ctx context.Context, ref string, creds *ociCredentials) ([]byte, error) {
+	r, err := parseOCIReference(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := o.get(ctx, r, fmt.Sprintf("/v2/%s/manifests/%s", r.repository, r.reference), ociManifestMediaType, creds)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get manifest of %s", ref)
+	}
+	manifest := struct {
+		Layers []struct {
+			Digest string `json:"digest"`
+		} `json:"layers"`
+	}{}
+	if err := json.Unmarshal(body, &manifest); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse manifest of %s", ref)
+	}
+	if len(manifest.Layers) == 0 {
+		return nil, errors.Errorf("manifest of %s has no layers", ref)
+	}
+
+	docs := make([][]byte, 0, len(manifest.Layers))
+	for _, layer := range manifest.Layers {
+		blob, err := o.blob(ctx, r, layer.Digest, creds)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to get layer %s of %s", layer.Digest, ref)
+		}
+		docs = append(docs, blob)
+	}
+	return bytes.Join(docs, []byte("\n---\n")), nil
+}
+
+// blob returns the content of a layer, from the cache if it was pulled from the same repository before.
+func (o *ociClient) blob(ctx context.Context, r *ociReference, digest string, creds *ociCredentials) ([]byte, error) {
+	// Layers are cached per repository, so a manifest of another repository referencing the digest of a private layer
+	// does not give access to its content.
+	key := r.registry + "/" + r.repository + "@" + digest
+	o.lock.Lock()
+	cached, ok := o.blobs[key]
+	o.lock.Unlock()
+	if ok {
+		return cached, nil
+	}
+
+	if !strings.HasPrefix(digest, "sha256:") {
+		return nil, errors.Errorf("unsupported digest %q", digest)
+	}
+	body, err := o.get(ctx, r, fmt.Sprintf("/v2/%s/blobs/%s", r.repository, digest), "", creds)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(body)
+	if actual := "sha256:" + hex.EncodeToString(sum[:]); actual != digest {
+		return nil, errors.Errorf("digest mismatch, got %s", actual)
+	}
+
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	if len(o.blobs) >= maxCachedOCIBlobs {
+		o.blobs = map[string][]byte{}
+	}
+	o.blobs[key] = body
+	return body, nil
+}
+
+// get fetches path from the registry, authenticating if the registry asks for it.
+func (o *ociClient) get(ctx context.Context, r *ociReference, path, accept string, creds *ociCredentials) ([]byte, error) {
+	target := "https://" + r.registry + path
+	resp, err := o.do(ctx, target, accept, "")
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		challenge := resp.Header.Get("WWW-Authenticate")
+		resp.Body.Close()
+		authorization, err := o.authorize(ctx, challenge, creds)
+		if err != nil {
+			return nil, err
+		}
+		if resp, err = o.do(ctx, target, accept, authorization); err != nil {
+			return nil, err
+		}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("unexpected status %q fetching %s", resp.Status, target)
+	}
+	return ioutil.ReadAll(io.LimitReader(resp.Body, maxOCIContentSize))
+}
+
+func (o *ociClient) do(ctx context.Context, target, accept, authorization string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	return o.httpClient.Do(req.WithContext(ctx))
+}
+
+// authorize returns the Authorization header answering the registry's authentication challenge.
+// Both basic authentication and bearer tokens, obtained anonymously or with the credentials, are supported.
+func (o *ociClient) authorize(ctx context.Context, challenge string, creds *ociCredentials) (string, error) {
+	switch {
+	case strings.HasPrefix(challenge, "Basic"):
+		if creds == nil {
+			return "", errors.New("registry requires credentials")
+		}
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(creds.username+":"+creds.password)), nil
+	case strings.HasPrefix(challenge, "Bearer"):
+		params := map[string]string{}
+		for _, m := range authChallengeParam.FindAllStringSubmatch(challenge, -1) {
+			params[m[1]] = m[2]
+		}
+		realm, err := url.Parse(params["realm"])
+		if err != nil || params["realm"] == "" {
+			return "", errors.Errorf("invalid authentication realm in challenge %q", challenge)
+		}
+		// The realm is chosen by the registry, hence the credentials are only sent to it over a secure connection.
+		if creds != nil && realm.Scheme != "https" {
+			return "", errors.Errorf("refusing to send credentials to authentication realm %q without https", params["realm"])
+		}
+		query := realm.Query()
+		for _, key := range []string{"service", "scope"} {
+			if params[key] != "" {
+				query.Set(key, params[key])
+			}
+		}
+		realm.RawQuery = query.Encode()
+
+		req, err := http.NewRequest(http.MethodGet, realm.String(), nil)
+		if err != nil {
+			return "", err
+		}
+		if creds != nil {
+			req.SetBasicAuth(creds.username, creds.password)
+		}
+		resp, err := o.httpClient.Do(req.WithContext(ctx))
+		if err != nil {
+			return "", errors.Wrap(err, "failed to get registry token")
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return "", errors.Errorf("unexpected status %q getting registry token", resp.Status)
+		}
+		token := struct {
+			Token       string `json:"token"`
+			AccessToken string `json:"access_token"`
+		}{}
+		if err := json.NewDecoder(io.LimitReader(resp.Body, maxOCIContentSize)).Decode(&token); err != nil {
+			return "", errors.Wrap(err, "failed to parse registry token")
+		}
+		if token.Token == "" {
+			token.Token = token.AccessToken
+		}
+		return "Bearer " + token.Token, nil
+	}
+	return "", errors.Errorf("unsupported authentication challenge %q", challenge)
+}
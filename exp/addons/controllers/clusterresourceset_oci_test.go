@@ -0,0 +1,237 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	addonsv1 "sigs.k8s.io/cluster-api/exp/addons/api/v1alpha3"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestParseOCIReference(t *testing.T) {
+	tests := []struct {
+		name      string
+		ref       string
+		expected  *ociReference
+		expectErr bool
+	}{
+		{
+			name:     "should default the tag to latest",
+			ref:      "registry.example.com/org/addons",
+			expected: &ociReference{registry: "registry.example.com", repository: "org/addons", reference: "latest"},
+		},
+		{
+			name:     "should parse tags",
+			ref:      "registry.example.com:5000/org/addons:v1",
+			expected: &ociReference{registry: "registry.example.com:5000", repository: "org/addons", reference: "v1"},
+		},
+		{
+			name:     "should parse digests",
+			ref:      "registry.example.com/addons@sha256:abc",
+			expected: &ociReference{registry: "registry.example.com", repository: "addons", reference: "sha256:abc"},
+		},
+		{
+			name:      "should fail without a registry",
+			ref:       "addons:v1",
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			ref, err := parseOCIReference(tt.ref)
+			if tt.expectErr {
+				g.Expect(err).To(HaveOccurred())
+				return
+			}
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(ref).To(Equal(tt.expected))
+		})
+	}
+}
+
+func TestOCICredentialsFromSecret(t *testing.T) {
+	g := NewWithT(t)
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "pull-secret"},
+		Type:       corev1.SecretTypeDockerConfigJson,
+		Data: map[string][]byte{
+			// "dXNlcjpwYXNz" is the base64 encoding of "user:pass".
+			corev1.DockerConfigJsonKey: []byte(`{"auths":{"registry.example.com":{"auth":"dXNlcjpwYXNz"}}}`),
+		},
+	}
+
+	creds, err := ociCredentialsFromSecret(secret, "registry.example.com")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(creds).To(Equal(&ociCredentials{username: "user", password: "pass"}))
+
+	_, err = ociCredentialsFromSecret(secret, "other.example.com")
+	g.Expect(err).To(HaveOccurred())
+}
+
+func TestOCIClientPull(t *testing.T) {
+	g := NewWithT(t)
+
+	layer := []byte("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: addon\n  namespace: default\n")
+	sum := sha256.Sum256(layer)
+	digest := "sha256:" + hex.EncodeToString(sum[:])
+
+	blobRequests := 0
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		// A public repository referencing the layer of the private one.
+		if req.URL.Path == "/v2/org/public/manifests/v1" {
+			fmt.Fprintf(w, `{"schemaVersion":2,"layers":[{"digest":%q}]}`, digest)
+			return
+		}
+		if user, pass, ok := req.BasicAuth(); !ok || user != "user" || pass != "pass" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="registry"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch req.URL.Path {
+		case "/v2/org/addons/manifests/v1":
+			fmt.Fprintf(w, `{"schemaVersion":2,"layers":[{"digest":%q}]}`, digest)
+		case "/v2/org/addons/blobs/" + digest:
+			blobRequests++
+			_, _ = w.Write(layer)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	o := newOCIClient(server.Client())
+	ref := strings.TrimPrefix(server.URL, "https://") + "/org/addons:v1"
+	creds := &ociCredentials{username: "user", password: "pass"}
+
+	for i := 0; i < 2; i++ {
+		bundle, err := o.pull(context.Background(), ref, creds)
+		g.Expect(err).NotTo(HaveOccurred())
+		g.Expect(bundle).To(Equal(layer))
+	}
+	// The layer is cached by repository and digest after the first pull.
+	g.Expect(blobRequests).To(Equal(1))
+
+	// The cached layer is not served for other repositories.
+	_, err := o.pull(context.Background(), strings.TrimPrefix(server.URL, "https://")+"/org/public:v1", nil)
+	g.Expect(err).To(HaveOccurred())
+
+	_, err = o.pull(context.Background(), ref, nil)
+	g.Expect(err).To(HaveOccurred())
+
+	_, err = o.pull(context.Background(), strings.TrimPrefix(server.URL, "https://")+"/org/missing:v1", creds)
+	g.Expect(err).To(HaveOccurred())
+}
+
+func TestPullOCIArtifactRequiresSourceLabel(t *testing.T) {
+	scheme := runtime.NewScheme()
+	_ = corev1.AddToScheme(scheme)
+
+	layer := []byte("apiVersion: v1\nkind: Namespace\nmetadata:\n  name: addon\n")
+	sum := sha256.Sum256(layer)
+	digest := "sha256:" + hex.EncodeToString(sum[:])
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if user, pass, ok := req.BasicAuth(); !ok || user != "user" || pass != "pass" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="registry"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch req.URL.Path {
+		case "/v2/org/addons/manifests/v1":
+			fmt.Fprintf(w, `{"schemaVersion":2,"layers":[{"digest":%q}]}`, digest)
+		case "/v2/org/addons/blobs/" + digest:
+			_, _ = w.Write(layer)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	registry := strings.TrimPrefix(server.URL, "https://")
+
+	tests := []struct {
+		name      string
+		labels    map[string]string
+		expectErr error
+	}{
+		{
+			name:   "should pull with a labeled pull secret",
+			labels: map[string]string{addonsv1.ClusterResourceSetSourceLabel: "true"},
+		},
+		{
+			name:      "should refuse a pull secret without the source label, even if not required for Secret resources",
+			expectErr: ErrSecretSourceLabelMissing,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			secret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "pull-secret", Namespace: "default", Labels: tt.labels},
+				Type:       corev1.SecretTypeDockerConfigJson,
+				Data: map[string][]byte{
+					corev1.DockerConfigJsonKey: []byte(fmt.Sprintf(`{"auths":{%q:{"username":"user","password":"pass"}}}`, registry)),
+				},
+			}
+			r := &ClusterResourceSetReconciler{
+				Client: fake.NewFakeClientWithScheme(scheme, secret),
+				oci:    newOCIClient(server.Client()),
+			}
+			resourceRef := addonsv1.ResourceRef{
+				Kind:           string(addonsv1.OCIArtifactClusterResourceSetResourceKind),
+				Name:           registry + "/org/addons:v1",
+				PullSecretName: "pull-secret",
+			}
+
+			bundle, err := r.pullOCIArtifact(context.Background(), resourceRef, "default")
+			if tt.expectErr != nil {
+				g.Expect(err).To(Equal(tt.expectErr))
+				return
+			}
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(bundle).To(Equal(layer))
+		})
+	}
+}
+
+func TestOCIClientAuthorizeRefusesInsecureRealms(t *testing.T) {
+	g := NewWithT(t)
+
+	o := newOCIClient(http.DefaultClient)
+	creds := &ociCredentials{username: "user", password: "pass"}
+
+	_, err := o.authorize(context.Background(), `Bearer realm="http://auth.example.com/token",service="registry"`, creds)
+	g.Expect(err).To(MatchError(ContainSubstring("without https")))
+}
@@ -0,0 +1,179 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+
+	jsonpatch "github.com/evanphx/json-patch"
+	"github.com/pkg/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"k8s.io/client-go/kubernetes/scheme"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
+	addonsv1 "sigs.k8s.io/cluster-api/exp/addons/api/v1alpha3"
+)
+
+// clusterOverrideName returns the name of the Secret or ConfigMap overriding the resource for the cluster.
+func clusterOverrideName(resourceRef addonsv1.ResourceRef, cluster *clusterv1.Cluster) string {
+	return resourceRef.Name + "-override-" + cluster.Name
+}
+
+// clusterOverrideData returns the values of the Secret or ConfigMap overriding the resource for the cluster, ordered by
+// their keys, or nil if the resource has no override for the cluster.
+func (r *ClusterResourceSetReconciler) clusterOverrideData(ctx context.Context, resource *unstructured.Unstructured, cluster *clusterv1.Cluster, resourceRef addonsv1.ResourceRef) ([][]byte, error) {
+	if !resourceRef.ClusterOverrides {
+		return nil, nil
+	}
+	namespace := resource.GetNamespace()
+	if namespace == "" {
+		namespace = cluster.Namespace
+	}
+
+	overrideRef := addonsv1.ResourceRef{Kind: resourceRef.Kind, Name: clusterOverrideName(resourceRef, cluster)}
+	override, err := r.getResourceFromNamespace(ctx, overrideRef, namespace)
+	if apierrors.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get override %s %s/%s", overrideRef.Kind, namespace, overrideRef.Name)
+	}
+	return normalizeData(override, resourceRef.Kind, nil)
+}
+
+// objectIdentity identifies the objects an override object is merged over. The version is ignored, so that overrides
+// do not need to be changed when the resource moves to another version of a kind.
+type objectIdentity struct {
+	group     string
+	kind      string
+	namespace string
+	name      string
+}
+
+func identityOf(obj *unstructured.Unstructured) objectIdentity {
+	gvk := obj.GroupVersionKind()
+	return objectIdentity{group: gvk.Group, kind: gvk.Kind, namespace: obj.GetNamespace(), name: obj.GetName()}
+}
+
+// mergeOverrides merges the objects of the override values over the objects of the resource values with the same
+// identity. Values with merged objects are returned in JSON list format, other values are returned unchanged, and the
+// override objects that do not match any object of the resource are returned as an additional value.
+func mergeOverrides(dataList, overrideList [][]byte) ([][]byte, error) {
+	overrides := map[objectIdentity]*unstructured.Unstructured{}
+	order := []objectIdentity{}
+	for _, data := range overrideList {
+		objs, err := parseObjects(data)
+		if err != nil {
+			return nil, err
+		}
+		for i := range objs {
+			id := identityOf(&objs[i])
+			if _, ok := overrides[id]; !ok {
+				order = append(order, id)
+			}
+			overrides[id] = &objs[i]
+		}
+	}
+
+	merged := make([][]byte, 0, len(dataList)+1)
+	used := map[objectIdentity]bool{}
+	for _, data := range dataList {
+		objs, err := parseObjects(data)
+		if err != nil {
+			return nil, err
+		}
+		changed := false
+		for i := range objs {
+			id := identityOf(&objs[i])
+			override, ok := overrides[id]
+			if !ok {
+				continue
+			}
+			if err := mergeObject(&objs[i], override); err != nil {
+				return nil, err
+			}
+			used[id] = true
+			changed = true
+		}
+		if !changed {
+			merged = append(merged, data)
+			continue
+		}
+		list, err := marshalObjects(objs)
+		if err != nil {
+			return nil, err
+		}
+		merged = append(merged, list)
+	}
+
+	added := []unstructured.Unstructured{}
+	for _, id := range order {
+		if !used[id] {
+			added = append(added, *overrides[id])
+		}
+	}
+	if len(added) > 0 {
+		list, err := marshalObjects(added)
+		if err != nil {
+			return nil, err
+		}
+		merged = append(merged, list)
+	}
+	return merged, nil
+}
+
+// mergeObject merges override over obj, with a strategic merge patch for built-in kinds and a JSON merge patch for
+// other kinds.
+func mergeObject(obj, override *unstructured.Unstructured) error {
+	original, err := obj.MarshalJSON()
+	if err != nil {
+		return errors.Wrapf(err, "failed to marshal object %s %s/%s", obj.GroupVersionKind(), obj.GetNamespace(), obj.GetName())
+	}
+	patch, err := override.MarshalJSON()
+	if err != nil {
+		return errors.Wrapf(err, "failed to marshal override of %s %s/%s", obj.GroupVersionKind(), obj.GetNamespace(), obj.GetName())
+	}
+
+	var result []byte
+	if versioned, err := scheme.Scheme.New(obj.GroupVersionKind()); err == nil {
+		result, err = strategicpatch.StrategicMergePatch(original, patch, versioned)
+		if err != nil {
+			return errors.Wrapf(err, "failed to merge override of %s %s/%s", obj.GroupVersionKind(), obj.GetNamespace(), obj.GetName())
+		}
+	} else {
+		result, err = jsonpatch.MergePatch(original, patch)
+		if err != nil {
+			return errors.Wrapf(err, "failed to merge override of %s %s/%s", obj.GroupVersionKind(), obj.GetNamespace(), obj.GetName())
+		}
+	}
+	return obj.UnmarshalJSON(result)
+}
+
+// marshalObjects returns the objects in JSON list format.
+func marshalObjects(objs []unstructured.Unstructured) ([]byte, error) {
+	list := make([]map[string]interface{}, 0, len(objs))
+	for i := range objs {
+		list = append(list, objs[i].Object)
+	}
+	data, err := json.Marshal(list)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal objects")
+	}
+	return data, nil
+}
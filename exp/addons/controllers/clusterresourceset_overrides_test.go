@@ -0,0 +1,185 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
+	addonsv1 "sigs.k8s.io/cluster-api/exp/addons/api/v1alpha3"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+const overrideBase = `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: coredns
+  namespace: kube-system
+spec:
+  replicas: 2
+  template:
+    spec:
+      containers:
+      - name: coredns
+        image: coredns:1.6.7
+      - name: sidecar
+        image: sidecar:1.0
+---
+apiVersion: example.com/v1
+kind: Widget
+metadata:
+  name: widget
+spec:
+  size: small
+  color: blue
+`
+
+func TestMergeOverrides(t *testing.T) {
+	tests := []struct {
+		name     string
+		override string
+		check    func(g *WithT, objs []unstructured.Unstructured)
+	}{
+		{
+			name: "should strategic merge overrides of built-in kinds",
+			override: `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: coredns
+  namespace: kube-system
+spec:
+  replicas: 3
+  template:
+    spec:
+      containers:
+      - name: coredns
+        image: coredns:1.7.0
+`,
+			check: func(g *WithT, objs []unstructured.Unstructured) {
+				g.Expect(objs).To(HaveLen(2))
+				replicas, _, _ := unstructured.NestedFieldNoCopy(objs[0].Object, "spec", "replicas")
+				g.Expect(replicas).To(BeNumerically("==", 3))
+				containers, _, _ := unstructured.NestedSlice(objs[0].Object, "spec", "template", "spec", "containers")
+				g.Expect(containers).To(ConsistOf(
+					map[string]interface{}{"name": "coredns", "image": "coredns:1.7.0"},
+					map[string]interface{}{"name": "sidecar", "image": "sidecar:1.0"},
+				))
+			},
+		},
+		{
+			name: "should JSON merge overrides of other kinds",
+			override: `apiVersion: example.com/v1
+kind: Widget
+metadata:
+  name: widget
+spec:
+  size: large
+  color: null
+`,
+			check: func(g *WithT, objs []unstructured.Unstructured) {
+				g.Expect(objs).To(HaveLen(2))
+				spec, _, _ := unstructured.NestedMap(objs[1].Object, "spec")
+				g.Expect(spec).To(Equal(map[string]interface{}{"size": "large"}))
+			},
+		},
+		{
+			name: "should add override objects that do not match any object of the resource",
+			override: `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: coredns-custom
+  namespace: kube-system
+data:
+  zone: example.com
+`,
+			check: func(g *WithT, objs []unstructured.Unstructured) {
+				g.Expect(objs).To(HaveLen(3))
+				g.Expect(objs[2].GetName()).To(Equal("coredns-custom"))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			merged, err := mergeOverrides([][]byte{[]byte(overrideBase)}, [][]byte{[]byte(tt.override)})
+			g.Expect(err).NotTo(HaveOccurred())
+
+			objs := []unstructured.Unstructured{}
+			for _, data := range merged {
+				dataObjs, err := parseObjects(data)
+				g.Expect(err).NotTo(HaveOccurred())
+				objs = append(objs, dataObjs...)
+			}
+			tt.check(g, objs)
+		})
+	}
+}
+
+func TestTargetDataClusterOverrides(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(corev1.AddToScheme(scheme)).To(Succeed())
+
+	base := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "dns", Namespace: "default"},
+		Data:       map[string]string{"dns": overrideBase},
+	}
+	override := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "dns-override-cluster1", Namespace: "default"},
+		Data: map[string]string{"dns": `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: coredns
+  namespace: kube-system
+spec:
+  replicas: 3
+`},
+	}
+	r := &ClusterResourceSetReconciler{Client: fake.NewFakeClientWithScheme(scheme, base, override)}
+	clusterResourceSet := &addonsv1.ClusterResourceSet{ObjectMeta: metav1.ObjectMeta{Name: "crs", Namespace: "default"}}
+	resourceRef := addonsv1.ResourceRef{Kind: "ConfigMap", Name: "dns", ClusterOverrides: true}
+	resource, err := r.getResource(context.Background(), resourceRef, "default")
+	g.Expect(err).NotTo(HaveOccurred())
+
+	hashes := map[string]string{}
+	for _, name := range []string{"cluster1", "cluster2"} {
+		cluster := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"}}
+		dataList, err := r.targetData(context.Background(), resource, cluster, clusterResourceSet, resourceRef)
+		g.Expect(err).NotTo(HaveOccurred())
+		objs, err := parseObjects(dataList[0])
+		g.Expect(err).NotTo(HaveOccurred())
+		replicas, _, _ := unstructured.NestedFieldNoCopy(objs[0].Object, "spec", "replicas")
+		if name == "cluster1" {
+			g.Expect(replicas).To(BeNumerically("==", 3))
+		} else {
+			g.Expect(replicas).To(BeNumerically("==", 2))
+		}
+		hashes[name], err = computeResourceHash(resource, dataList)
+		g.Expect(err).NotTo(HaveOccurred())
+	}
+	g.Expect(hashes["cluster1"]).NotTo(Equal(hashes["cluster2"]))
+}
@@ -0,0 +1,168 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
+	capierrors "sigs.k8s.io/cluster-api/errors"
+	addonsv1 "sigs.k8s.io/cluster-api/exp/addons/api/v1alpha3"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// postApplyJobPollInterval is how often the status of a running post-apply Job is checked.
+const postApplyJobPollInterval = 10 * time.Second
+
+// runPostApplyJob creates the post-apply Job of the ClusterResourceSet in the cluster and checks its status. It returns
+// a RequeueAfterError while the Job runs, and an error if the Job failed. A Job that succeeded is recorded in the
+// ResourceSetBinding, so that it only runs again when the Job or the resources change.
+func (r *ClusterResourceSetReconciler) runPostApplyJob(ctx context.Context, remoteClient client.Client, cluster *clusterv1.Cluster, clusterResourceSet *addonsv1.ClusterResourceSet, resourceSetBinding *addonsv1.ResourceSetBinding) error {
+	logger := r.Log.WithValues(logKeyCRSName, clusterResourceSet.Name, logKeyCRSNamespace, clusterResourceSet.Namespace, logKeyClusterName, cluster.Name)
+
+	job, hash, err := r.postApplyJob(ctx, cluster, clusterResourceSet, resourceSetBinding)
+	if err != nil {
+		conditions.MarkFalse(clusterResourceSet, addonsv1.PostApplyJobSucceededCondition, addonsv1.PostApplyJobFailedReason, clusterv1.ConditionSeverityError, err.Error())
+		return err
+	}
+	if resourceSetBinding.PostApplyJobHash == hash {
+		conditions.MarkTrue(clusterResourceSet, addonsv1.PostApplyJobSucceededCondition)
+		return nil
+	}
+
+	name := job.GetNamespace() + "/" + job.GetName()
+	running := func() error {
+		conditions.MarkFalse(clusterResourceSet, addonsv1.PostApplyJobSucceededCondition, addonsv1.PostApplyJobRunningReason, clusterv1.ConditionSeverityInfo,
+			"Post-apply Job %s is running in cluster %s", name, cluster.Name)
+		return errors.Wrapf(&capierrors.RequeueAfterError{RequeueAfter: postApplyJobPollInterval}, "post-apply Job %s is running", name)
+	}
+
+	existing := &unstructured.Unstructured{}
+	existing.SetGroupVersionKind(job.GroupVersionKind())
+	if err := remoteClient.Get(ctx, client.ObjectKey{Namespace: job.GetNamespace(), Name: job.GetName()}, existing); err != nil {
+		if !apierrors.IsNotFound(err) {
+			return errors.Wrapf(err, "failed to get post-apply Job %s", name)
+		}
+		logger.Info("Creating post-apply Job in cluster", "job", name)
+		if err := remoteClient.Create(ctx, job); err != nil {
+			err = errors.Wrapf(err, "failed to create post-apply Job %s", name)
+			conditions.MarkFalse(clusterResourceSet, addonsv1.PostApplyJobSucceededCondition, addonsv1.PostApplyJobFailedReason, clusterv1.ConditionSeverityError, err.Error())
+			return err
+		}
+		return running()
+	}
+
+	// Jobs cannot be updated, a Job created for other resources or from another manifest is run again from scratch.
+	if existing.GetAnnotations()[addonsv1.ClusterResourceSetPostApplyHashAnnotation] != hash {
+		logger.Info("Deleting outdated post-apply Job from cluster", "job", name)
+		if err := remoteClient.Delete(ctx, existing, client.PropagationPolicy(metav1.DeletePropagationBackground)); err != nil && !apierrors.IsNotFound(err) {
+			return errors.Wrapf(err, "failed to delete outdated post-apply Job %s", name)
+		}
+		return running()
+	}
+
+	switch status, message := jobStatus(existing); status {
+	case batchv1.JobComplete:
+		logger.Info("Post-apply Job succeeded in cluster", "job", name)
+		resourceSetBinding.PostApplyJobHash = hash
+		conditions.MarkTrue(clusterResourceSet, addonsv1.PostApplyJobSucceededCondition)
+		return nil
+	case batchv1.JobFailed:
+		err := errors.Errorf("post-apply Job %s failed in cluster %s: %s", name, cluster.Name, message)
+		conditions.MarkFalse(clusterResourceSet, addonsv1.PostApplyJobSucceededCondition, addonsv1.PostApplyJobFailedReason, clusterv1.ConditionSeverityError, err.Error())
+		r.recorder.Eventf(clusterResourceSet, corev1.EventTypeWarning, addonsv1.PostApplyJobFailedReason, "Post-apply Job %s failed in cluster %s: %s", name, cluster.Name, message)
+		return err
+	default:
+		return running()
+	}
+}
+
+// postApplyJob returns the post-apply Job of the ClusterResourceSet as created in the cluster, annotated with its hash.
+// The hash covers the Job and the hashes of the resources recorded in the ResourceSetBinding.
+func (r *ClusterResourceSetReconciler) postApplyJob(ctx context.Context, cluster *clusterv1.Cluster, clusterResourceSet *addonsv1.ClusterResourceSet, resourceSetBinding *addonsv1.ResourceSetBinding) (*unstructured.Unstructured, string, error) {
+	ref := *clusterResourceSet.Spec.PostApplyJob
+	source, err := r.getResource(ctx, ref, cluster.Namespace)
+	if err != nil {
+		return nil, "", errors.Wrapf(err, "failed to get post-apply Job %s %s", ref.Kind, ref.Name)
+	}
+	dataList, err := r.targetData(ctx, source, cluster, clusterResourceSet, ref)
+	if err != nil {
+		return nil, "", err
+	}
+
+	objs := []unstructured.Unstructured{}
+	for _, data := range dataList {
+		rendered, err := r.renderObjects(data, cluster, clusterResourceSet, ref)
+		if err != nil {
+			return nil, "", err
+		}
+		parsed, err := parseObjects(rendered)
+		if err != nil {
+			return nil, "", err
+		}
+		objs = append(objs, parsed...)
+	}
+	if len(objs) != 1 || objs[0].GroupVersionKind().GroupKind() != batchv1.SchemeGroupVersion.WithKind("Job").GroupKind() {
+		return nil, "", errors.Errorf("post-apply %s %s must contain a single Job", ref.Kind, ref.Name)
+	}
+	job := &objs[0]
+	if job.GetNamespace() == "" {
+		job.SetNamespace(metav1.NamespaceDefault)
+	}
+
+	hashed := append([][]byte{}, dataList...)
+	for _, resource := range clusterResourceSet.Spec.Resources {
+		if resourceBinding := resourceSetBinding.GetResourceBinding(resource); resourceBinding != nil {
+			hashed = append(hashed, []byte(resourceBinding.Hash))
+		}
+	}
+	hash := computeHash(hashed)
+
+	annotations := job.GetAnnotations()
+	if annotations == nil {
+		annotations = map[string]string{}
+	}
+	annotations[addonsv1.ClusterResourceSetPostApplyHashAnnotation] = hash
+	job.SetAnnotations(annotations)
+	return job, hash, nil
+}
+
+// jobStatus returns JobComplete or JobFailed, with the message of the condition, once the Job finished.
+func jobStatus(job *unstructured.Unstructured) (batchv1.JobConditionType, string) {
+	jobConditions, _, _ := unstructured.NestedSlice(job.Object, "status", "conditions")
+	for _, c := range jobConditions {
+		condition, ok := c.(map[string]interface{})
+		if !ok || condition["status"] != string(corev1.ConditionTrue) {
+			continue
+		}
+		conditionType, _ := condition["type"].(string)
+		switch t := batchv1.JobConditionType(conditionType); t {
+		case batchv1.JobComplete, batchv1.JobFailed:
+			message, _ := condition["message"].(string)
+			return t, message
+		}
+	}
+	return "", ""
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
+	capierrors "sigs.k8s.io/cluster-api/errors"
+	addonsv1 "sigs.k8s.io/cluster-api/exp/addons/api/v1alpha3"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+func TestApplyClusterResourceSetRunsPostApplyJob(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(corev1.AddToScheme(scheme)).To(Succeed())
+	g.Expect(batchv1.AddToScheme(scheme)).To(Succeed())
+	g.Expect(clusterv1.AddToScheme(scheme)).To(Succeed())
+	g.Expect(addonsv1.AddToScheme(scheme)).To(Succeed())
+
+	cluster := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "cluster", Namespace: "default"}}
+	resource := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "resource", Namespace: "default"},
+		Data:       map[string]string{"cm": "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: applied\n  namespace: default\n"},
+	}
+	smokeTest := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "smoke-test", Namespace: "default"},
+		Data:       map[string]string{"job": "apiVersion: batch/v1\nkind: Job\nmetadata:\n  name: smoke-test\n"},
+	}
+	clusterResourceSet := &addonsv1.ClusterResourceSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "crs", Namespace: "default"},
+		Spec: addonsv1.ClusterResourceSetSpec{
+			ClusterSelector: metav1.LabelSelector{MatchLabels: map[string]string{"foo": "bar"}},
+			Resources:       []addonsv1.ResourceRef{{Kind: "ConfigMap", Name: "resource"}},
+			PostApplyJob:    &addonsv1.ResourceRef{Kind: "ConfigMap", Name: "smoke-test"},
+		},
+	}
+
+	remoteClient := fake.NewFakeClientWithScheme(scheme)
+	r := &ClusterResourceSetReconciler{
+		Client: fake.NewFakeClientWithScheme(scheme, cluster, resource, smokeTest, clusterResourceSet),
+		Log:    log.Log,
+		RemoteClientGetter: func(ctx context.Context, key client.ObjectKey) (client.Client, error) {
+			return remoteClient, nil
+		},
+		scheme:   scheme,
+		recorder: record.NewFakeRecorder(10),
+	}
+	jobKey := client.ObjectKey{Namespace: metav1.NamespaceDefault, Name: "smoke-test"}
+	setJobCondition := func(conditionType batchv1.JobConditionType) {
+		job := &batchv1.Job{}
+		g.Expect(remoteClient.Get(context.Background(), jobKey, job)).To(Succeed())
+		job.Status.Conditions = []batchv1.JobCondition{{Type: conditionType, Status: corev1.ConditionTrue, Message: "smoke test " + string(conditionType)}}
+		g.Expect(remoteClient.Update(context.Background(), job)).To(Succeed())
+	}
+
+	// The Job is created once the resources are applied, and the rollout waits for it.
+	err := r.ApplyClusterResourceSet(context.Background(), cluster, clusterResourceSet)
+	_, ok := errors.Cause(err).(capierrors.HasRequeueAfterError)
+	g.Expect(ok).To(BeTrue())
+	g.Expect(conditions.GetReason(clusterResourceSet, addonsv1.PostApplyJobSucceededCondition)).To(Equal(addonsv1.PostApplyJobRunningReason))
+	job := &batchv1.Job{}
+	g.Expect(remoteClient.Get(context.Background(), jobKey, job)).To(Succeed())
+	g.Expect(job.Annotations).To(HaveKey(addonsv1.ClusterResourceSetPostApplyHashAnnotation))
+
+	// A failed Job fails the rollout.
+	setJobCondition(batchv1.JobFailed)
+	err = r.ApplyClusterResourceSet(context.Background(), cluster, clusterResourceSet)
+	g.Expect(err).To(MatchError(ContainSubstring("smoke test Failed")))
+	g.Expect(conditions.GetReason(clusterResourceSet, addonsv1.PostApplyJobSucceededCondition)).To(Equal(addonsv1.PostApplyJobFailedReason))
+
+	// A Job that succeeded is recorded, and not run again.
+	setJobCondition(batchv1.JobComplete)
+	g.Expect(r.ApplyClusterResourceSet(context.Background(), cluster, clusterResourceSet)).To(Succeed())
+	g.Expect(conditions.IsTrue(clusterResourceSet, addonsv1.PostApplyJobSucceededCondition)).To(BeTrue())
+	g.Expect(remoteClient.Delete(context.Background(), job)).To(Succeed())
+	g.Expect(r.ApplyClusterResourceSet(context.Background(), cluster, clusterResourceSet)).To(Succeed())
+	g.Expect(apierrors.IsNotFound(remoteClient.Get(context.Background(), jobKey, &batchv1.Job{}))).To(BeTrue())
+}
@@ -0,0 +1,167 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/discovery"
+	"k8s.io/kube-openapi/pkg/util/proto"
+	"k8s.io/kube-openapi/pkg/util/proto/validation"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
+	"sigs.k8s.io/cluster-api/controllers/remote"
+	"sigs.k8s.io/cluster-api/util"
+)
+
+const (
+	// schemaCacheTTL is how long the OpenAPI schemas of a cluster are reused before being fetched again.
+	schemaCacheTTL = 10 * time.Minute
+
+	// gvkExtension is the OpenAPI extension listing the group, version and kind of the objects described by a model.
+	gvkExtension = "x-kubernetes-group-version-kind"
+)
+
+// clusterSchemas are the OpenAPI models of the kinds served by a cluster.
+type clusterSchemas struct {
+	models    map[schema.GroupVersionKind]proto.Schema
+	fetchedAt time.Time
+}
+
+// indexModels returns the OpenAPI models by the group, version and kind of the objects they describe.
+func indexModels(models proto.Models) map[schema.GroupVersionKind]proto.Schema {
+	index := map[schema.GroupVersionKind]proto.Schema{}
+	for _, name := range models.ListModels() {
+		model := models.LookupModel(name)
+		if model == nil {
+			continue
+		}
+		gvks, ok := model.GetExtensions()[gvkExtension].([]interface{})
+		if !ok {
+			continue
+		}
+		for _, gvk := range gvks {
+			var group, version, kind interface{}
+			switch m := gvk.(type) {
+			case map[interface{}]interface{}:
+				group, version, kind = m["group"], m["version"], m["kind"]
+			case map[string]interface{}:
+				group, version, kind = m["group"], m["version"], m["kind"]
+			default:
+				continue
+			}
+			g, _ := group.(string)
+			v, _ := version.(string)
+			k, _ := kind.(string)
+			if v == "" || k == "" {
+				continue
+			}
+			index[schema.GroupVersionKind{Group: g, Version: v, Kind: k}] = model
+		}
+	}
+	return index
+}
+
+// isBuiltInGroup returns true if the API group is one of the Kubernetes API groups rather than a custom resource group.
+func isBuiltInGroup(group string) bool {
+	return !strings.Contains(group, ".") || strings.HasSuffix(group, ".k8s.io")
+}
+
+// schemaViolations validates the objects in dataList against the OpenAPI models of the cluster, and returns a
+// description of each violation. Objects of custom resources without a model are not validated, as the cluster may
+// not publish the schemas of all its CustomResourceDefinitions; objects of built-in kinds without a model are
+// violations, as the cluster does not serve them, e.g. because their API version was removed.
+func schemaViolations(models map[schema.GroupVersionKind]proto.Schema, dataList [][]byte) ([]string, error) {
+	violations := []string{}
+	for _, data := range dataList {
+		objs, err := parseObjects(data)
+		if err != nil {
+			return nil, err
+		}
+		for i := range objs {
+			obj := &objs[i]
+			name := fmt.Sprintf("%s %s/%s", obj.GetKind(), obj.GetNamespace(), obj.GetName())
+			gvk := obj.GroupVersionKind()
+			model, ok := models[gvk]
+			if !ok {
+				if isBuiltInGroup(gvk.Group) {
+					violations = append(violations, fmt.Sprintf("%s: %s is not served by the cluster", name, obj.GetAPIVersion()))
+				}
+				continue
+			}
+			for _, err := range validation.ValidateModel(obj.Object, model, gvk.Kind) {
+				violations = append(violations, fmt.Sprintf("%s: %v", name, err))
+			}
+		}
+	}
+	return violations, nil
+}
+
+// clusterSchemas returns the OpenAPI models of the kinds served by the cluster. They are cached for schemaCacheTTL
+// to limit the number of discovery calls.
+func (r *ClusterResourceSetReconciler) clusterSchemas(ctx context.Context, cluster *clusterv1.Cluster) (map[schema.GroupVersionKind]proto.Schema, error) {
+	key := types.NamespacedName{Namespace: cluster.Namespace, Name: cluster.Name}
+
+	r.schemasLock.Lock()
+	cached, ok := r.schemas[key]
+	r.schemasLock.Unlock()
+	if ok && time.Since(cached.fetchedAt) < schemaCacheTTL {
+		return cached.models, nil
+	}
+
+	var models proto.Models
+	var err error
+	if r.OpenAPIModelsGetter != nil {
+		models, err = r.OpenAPIModelsGetter(ctx, util.ObjectKey(cluster))
+	} else {
+		models, err = r.fetchOpenAPIModels(ctx, cluster)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get OpenAPI schemas of cluster %s", cluster.Name)
+	}
+	index := indexModels(models)
+
+	r.schemasLock.Lock()
+	defer r.schemasLock.Unlock()
+	if r.schemas == nil {
+		r.schemas = map[types.NamespacedName]clusterSchemas{}
+	}
+	r.schemas[key] = clusterSchemas{models: index, fetchedAt: time.Now()}
+	return index, nil
+}
+
+// fetchOpenAPIModels gets the OpenAPI models of the workload cluster using its discovery API.
+func (r *ClusterResourceSetReconciler) fetchOpenAPIModels(ctx context.Context, cluster *clusterv1.Cluster) (proto.Models, error) {
+	config, err := remote.RESTConfig(ctx, r.Client, util.ObjectKey(cluster))
+	if err != nil {
+		return nil, err
+	}
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := discoveryClient.OpenAPISchema()
+	if err != nil {
+		return nil, err
+	}
+	return proto.NewOpenAPIData(doc)
+}
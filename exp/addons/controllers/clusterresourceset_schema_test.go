@@ -0,0 +1,200 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"sort"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/kube-openapi/pkg/util/proto"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
+	addonsv1 "sigs.k8s.io/cluster-api/exp/addons/api/v1alpha3"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// fakeModels are OpenAPI models looked up by name.
+type fakeModels map[string]proto.Schema
+
+func (m fakeModels) LookupModel(name string) proto.Schema {
+	return m[name]
+}
+
+func (m fakeModels) ListModels() []string {
+	names := []string{}
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// newFakeKind returns the model of a kind with the given top level fields, besides apiVersion, kind and metadata.
+func newFakeKind(group, version, kind string, fields map[string]proto.Schema) *proto.Kind {
+	fields["apiVersion"] = &proto.Primitive{Type: "string"}
+	fields["kind"] = &proto.Primitive{Type: "string"}
+	fields["metadata"] = &proto.Arbitrary{}
+	return &proto.Kind{
+		BaseSchema: proto.BaseSchema{Extensions: map[string]interface{}{
+			gvkExtension: []interface{}{map[interface{}]interface{}{"group": group, "version": version, "kind": kind}},
+		}},
+		Fields: fields,
+	}
+}
+
+var fakeClusterModels = fakeModels{
+	"io.k8s.api.core.v1.ConfigMap": newFakeKind("", "v1", "ConfigMap", map[string]proto.Schema{
+		"data": &proto.Map{SubType: &proto.Primitive{Type: "string"}},
+	}),
+	"io.k8s.api.apps.v1.Deployment": newFakeKind("apps", "v1", "Deployment", map[string]proto.Schema{
+		"spec": &proto.Kind{
+			BaseSchema: proto.BaseSchema{Path: proto.NewPath("io.k8s.api.apps.v1.DeploymentSpec")},
+			Fields:     map[string]proto.Schema{"replicas": &proto.Primitive{Type: "integer"}},
+		},
+	}),
+	"io.k8s.apimachinery.pkg.apis.meta.v1.Status": &proto.Kind{},
+}
+
+func TestIndexModels(t *testing.T) {
+	g := NewWithT(t)
+
+	index := indexModels(fakeClusterModels)
+	g.Expect(index).To(HaveLen(2))
+	g.Expect(index).To(HaveKey(schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}))
+	g.Expect(index).To(HaveKey(schema.GroupVersionKind{Group: "apps", Version: "v1", Kind: "Deployment"}))
+}
+
+func TestSchemaViolations(t *testing.T) {
+	tests := []struct {
+		name               string
+		data               string
+		expectedViolations []string
+	}{
+		{
+			name: "should accept valid objects",
+			data: `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: addon
+  namespace: default
+spec:
+  replicas: 2`,
+			expectedViolations: []string{},
+		},
+		{
+			name: "should report unknown fields",
+			data: `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: addon
+  namespace: default
+spec:
+  replica: 2`,
+			expectedViolations: []string{`Deployment default/addon: ValidationError(Deployment.spec): unknown field "replica" in io.k8s.api.apps.v1.DeploymentSpec`},
+		},
+		{
+			name: "should report built-in kinds not served by the cluster",
+			data: `apiVersion: extensions/v1beta1
+kind: Deployment
+metadata:
+  name: addon
+  namespace: default`,
+			expectedViolations: []string{"Deployment default/addon: extensions/v1beta1 is not served by the cluster"},
+		},
+		{
+			name: "should not validate custom resources without a schema",
+			data: `apiVersion: example.com/v1
+kind: Addon
+metadata:
+  name: addon
+  namespace: default
+spec:
+  anything: true`,
+			expectedViolations: []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			violations, err := schemaViolations(indexModels(fakeClusterModels), [][]byte{[]byte(tt.data)})
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(violations).To(Equal(tt.expectedViolations))
+		})
+	}
+}
+
+func TestApplyResourceValidatesSchema(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(corev1.AddToScheme(scheme)).To(Succeed())
+	g.Expect(addonsv1.AddToScheme(scheme)).To(Succeed())
+
+	source := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "resource", Namespace: "default"},
+		Data: map[string]string{"cm": `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: applied
+  namespace: default
+immutable: true
+`},
+	}
+	cluster := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "cluster", Namespace: "default"}}
+	clusterResourceSet := &addonsv1.ClusterResourceSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "crs", Namespace: "default"},
+		Spec: addonsv1.ClusterResourceSetSpec{
+			Resources:      []addonsv1.ResourceRef{{Kind: "ConfigMap", Name: "resource"}},
+			ValidateSchema: true,
+		},
+	}
+
+	getterCalls := 0
+	r := &ClusterResourceSetReconciler{
+		Client: fake.NewFakeClientWithScheme(scheme, source, clusterResourceSet),
+		Log:    log.Log,
+		OpenAPIModelsGetter: func(ctx context.Context, key client.ObjectKey) (proto.Models, error) {
+			getterCalls++
+			return fakeClusterModels, nil
+		},
+		scheme:   scheme,
+		recorder: record.NewFakeRecorder(10),
+	}
+
+	remoteClient := fake.NewFakeClientWithScheme(scheme)
+	resourceSetBinding := &addonsv1.ResourceSetBinding{}
+	err := r.applyResource(context.Background(), remoteClient, cluster, clusterResourceSet, resourceSetBinding, clusterResourceSet.Spec.Resources[0])
+	g.Expect(err).To(MatchError(ContainSubstring(`unknown field "immutable"`)))
+	g.Expect(conditions.GetReason(clusterResourceSet, addonsv1.ResourcesAppliedCondition)).To(Equal(addonsv1.SchemaValidationFailedReason))
+	g.Expect(resourceSetBinding.IsApplied(clusterResourceSet.Spec.Resources[0])).To(BeFalse())
+
+	// The schemas of the cluster are cached.
+	_ = r.applyResource(context.Background(), remoteClient, cluster, clusterResourceSet, resourceSetBinding, clusterResourceSet.Spec.Resources[0])
+	g.Expect(getterCalls).To(Equal(1))
+}
@@ -0,0 +1,102 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"bytes"
+	"encoding/base64"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
+)
+
+// templateFuncs are the functions available to the templates of the resources, on top of the built-in ones.
+// They have no side effects, e.g. no file or network access, and are deterministic, so that rendering a resource for a
+// cluster always gives the same result and the resource is not applied again because of it.
+var templateFuncs = template.FuncMap{
+	"b64enc": func(s string) string {
+		return base64.StdEncoding.EncodeToString([]byte(s))
+	},
+	"b64dec": func(s string) (string, error) {
+		decoded, err := base64.StdEncoding.DecodeString(s)
+		return string(decoded), err
+	},
+	"indent":  indent,
+	"nindent": func(spaces int, s string) string { return "\n" + indent(spaces, s) },
+	"default": defaultValue,
+	"quote":   func(s string) string { return strconv.Quote(s) },
+	"lower":   strings.ToLower,
+	"upper":   strings.ToUpper,
+	"trim":    strings.TrimSpace,
+}
+
+// templateData is the data the templates of the resources are rendered with.
+type templateData struct {
+	Cluster *clusterv1.Cluster
+}
+
+// indent prefixes each line of s with the given number of spaces.
+func indent(spaces int, s string) string {
+	pad := strings.Repeat(" ", spaces)
+	return pad + strings.Replace(s, "\n", "\n"+pad, -1)
+}
+
+// defaultValue returns the value, usually piped to the function, or def if the value is missing or empty,
+// e.g. `{{ .Cluster.Labels.region | default "eu" }}`.
+func defaultValue(def interface{}, value ...interface{}) interface{} {
+	if len(value) == 0 || value[0] == nil {
+		return def
+	}
+	v := reflect.ValueOf(value[0])
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		if v.Len() == 0 {
+			return def
+		}
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return def
+		}
+	default:
+		if v.IsZero() {
+			return def
+		}
+	}
+	return value[0]
+}
+
+// renderTemplate renders data as a Go template for the cluster. Missing keys of maps, e.g. labels the cluster does not
+// have, are an error unless emptyMissingKeys is true, in which case they render as the zero value of the map's values.
+func renderTemplate(data []byte, cluster *clusterv1.Cluster, emptyMissingKeys bool) ([]byte, error) {
+	missingKey := "missingkey=error"
+	if emptyMissingKeys {
+		missingKey = "missingkey=zero"
+	}
+	tmpl, err := template.New("resource").Option(missingKey).Funcs(templateFuncs).Parse(string(data))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse template")
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, templateData{Cluster: cluster}); err != nil {
+		return nil, errors.Wrap(err, "failed to execute template")
+	}
+	return buf.Bytes(), nil
+}
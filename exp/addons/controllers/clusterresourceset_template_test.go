@@ -0,0 +1,67 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
+)
+
+func TestRenderTemplate(t *testing.T) {
+	cluster := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{
+		Name:      "Cluster-1",
+		Namespace: "default",
+		Labels:    map[string]string{"region": "us"},
+	}}
+
+	tests := []struct {
+		name             string
+		template         string
+		emptyMissingKeys bool
+		expected         string
+		wantErr          bool
+	}{
+		{name: "should render cluster fields", template: "name: {{ .Cluster.Name }}", expected: "name: Cluster-1"},
+		{name: "should encode and decode base64", template: `{{ "token" | b64enc }} {{ "dG9rZW4=" | b64dec }}`, expected: "dG9rZW4= token"},
+		{name: "should indent", template: "data:{{ \"a: 1\\nb: 2\" | nindent 2 }}", expected: "data:\n  a: 1\n  b: 2"},
+		{name: "should default empty values", template: `{{ "" | default "eu" }} {{ .Cluster.Labels.region | default "eu" }}`, expected: "eu us"},
+		{name: "should quote", template: `{{ .Cluster.Name | lower | quote }} {{ " x " | trim | upper }}`, expected: `"cluster-1" X`},
+		{name: "should render cluster labels", template: "region: {{ .Cluster.Labels.region }}", expected: "region: us"},
+		{name: "should fail on missing keys", template: "{{ .Cluster.Labels.zone }}", wantErr: true},
+		{name: "should render missing keys as empty values", template: "zone: '{{ .Cluster.Labels.zone }}'", emptyMissingKeys: true, expected: "zone: ''"},
+		{name: "should default missing keys", template: `{{ .Cluster.Labels.zone | default "a" }}`, emptyMissingKeys: true, expected: "a"},
+		{name: "should fail on invalid templates", template: "{{ .Cluster.Name", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			rendered, err := renderTemplate([]byte(tt.template), cluster, tt.emptyMissingKeys)
+			if tt.wantErr {
+				g.Expect(err).To(HaveOccurred())
+				return
+			}
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(string(rendered)).To(Equal(tt.expected))
+		})
+	}
+}
@@ -0,0 +1,46 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	addonsv1 "sigs.k8s.io/cluster-api/exp/addons/api/v1alpha3"
+	"sigs.k8s.io/cluster-api/util/cron"
+)
+
+// applyWindowWait returns how long until the next apply window starts, or 0 if now is within an apply window.
+func applyWindowWait(window *addonsv1.ApplyWindow, now time.Time) (time.Duration, error) {
+	schedule, err := cron.Parse(window.Schedule)
+	if err != nil {
+		return 0, errors.Wrapf(err, "invalid apply window schedule %q", window.Schedule)
+	}
+	now = now.UTC()
+
+	// Now is within a window if one started during the last Duration.
+	start := schedule.Next(now.Add(-window.Duration.Duration).Add(time.Nanosecond))
+	if !start.IsZero() && !start.After(now) {
+		return 0, nil
+	}
+
+	next := schedule.Next(now)
+	if next.IsZero() {
+		return 0, errors.Errorf("apply window schedule %q never matches", window.Schedule)
+	}
+	return next.Sub(now), nil
+}
@@ -0,0 +1,143 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
+	capierrors "sigs.k8s.io/cluster-api/errors"
+	addonsv1 "sigs.k8s.io/cluster-api/exp/addons/api/v1alpha3"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+func TestApplyWindowWait(t *testing.T) {
+	// Thursday.
+	now := time.Date(2020, time.October, 15, 10, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name      string
+		window    addonsv1.ApplyWindow
+		expected  time.Duration
+		expectErr bool
+	}{
+		{
+			name:     "should not wait within a window",
+			window:   addonsv1.ApplyWindow{Schedule: "0 10 * * *", Duration: metav1.Duration{Duration: time.Hour}},
+			expected: 0,
+		},
+		{
+			name:     "should not wait at the start of a window",
+			window:   addonsv1.ApplyWindow{Schedule: "30 10 * * *", Duration: metav1.Duration{Duration: time.Minute}},
+			expected: 0,
+		},
+		{
+			name:     "should wait for the next window after the end of a window",
+			window:   addonsv1.ApplyWindow{Schedule: "0 10 * * *", Duration: metav1.Duration{Duration: 30 * time.Minute}},
+			expected: 23*time.Hour + 30*time.Minute,
+		},
+		{
+			name:     "should wait for the next window on another day",
+			window:   addonsv1.ApplyWindow{Schedule: "0 2 * * 6", Duration: metav1.Duration{Duration: 4 * time.Hour}},
+			expected: 39*time.Hour + 30*time.Minute,
+		},
+		{
+			name:      "should fail with an invalid schedule",
+			window:    addonsv1.ApplyWindow{Schedule: "0 2 * *", Duration: metav1.Duration{Duration: 4 * time.Hour}},
+			expectErr: true,
+		},
+		{
+			name:      "should fail with a schedule that never matches",
+			window:    addonsv1.ApplyWindow{Schedule: "0 0 30 2 *", Duration: metav1.Duration{Duration: 4 * time.Hour}},
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			wait, err := applyWindowWait(&tt.window, now)
+			if tt.expectErr {
+				g.Expect(err).To(HaveOccurred())
+				return
+			}
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(wait).To(Equal(tt.expected))
+		})
+	}
+}
+
+func TestApplyClusterResourceSetOutsideApplyWindow(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(corev1.AddToScheme(scheme)).To(Succeed())
+	g.Expect(clusterv1.AddToScheme(scheme)).To(Succeed())
+	g.Expect(addonsv1.AddToScheme(scheme)).To(Succeed())
+
+	cluster := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "cluster", Namespace: "default"}}
+	source := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "resource", Namespace: "default"},
+		Data:       map[string]string{"cm": "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: applied\n  namespace: default\n"},
+	}
+	// The next window starts in about two hours.
+	start := time.Now().UTC().Add(2 * time.Hour)
+	clusterResourceSet := &addonsv1.ClusterResourceSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "crs", Namespace: "default"},
+		Spec: addonsv1.ClusterResourceSetSpec{
+			ClusterSelector: metav1.LabelSelector{MatchLabels: map[string]string{"foo": "bar"}},
+			Resources:       []addonsv1.ResourceRef{{Kind: "ConfigMap", Name: "resource"}},
+			ApplyWindow: &addonsv1.ApplyWindow{
+				Schedule: fmt.Sprintf("%d %d * * *", start.Minute(), start.Hour()),
+				Duration: metav1.Duration{Duration: time.Hour},
+			},
+		},
+	}
+	r := &ClusterResourceSetReconciler{
+		Client: fake.NewFakeClientWithScheme(scheme, cluster, source, clusterResourceSet),
+		Log:    log.Log,
+		RemoteClientGetter: func(ctx context.Context, key client.ObjectKey) (client.Client, error) {
+			return fake.NewFakeClientWithScheme(scheme), nil
+		},
+		scheme:   scheme,
+		recorder: record.NewFakeRecorder(10),
+	}
+
+	err := r.ApplyClusterResourceSet(context.Background(), cluster, clusterResourceSet)
+	requeueErr, ok := errors.Cause(err).(*capierrors.RequeueAfterError)
+	g.Expect(ok).To(BeTrue())
+	g.Expect(requeueErr.RequeueAfter).To(BeNumerically("~", 2*time.Hour, time.Minute))
+	g.Expect(conditions.GetReason(clusterResourceSet, addonsv1.ResourcesAppliedCondition)).To(Equal(addonsv1.OutsideApplyWindowReason))
+
+	// Resources are applied within the window.
+	clusterResourceSet.Spec.ApplyWindow.Duration = metav1.Duration{Duration: 23 * time.Hour}
+	g.Expect(r.ApplyClusterResourceSet(context.Background(), cluster, clusterResourceSet)).To(Succeed())
+}
@@ -0,0 +1,191 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"reflect"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/types"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
+	addonsv1 "sigs.k8s.io/cluster-api/exp/addons/api/v1alpha3"
+	"sigs.k8s.io/cluster-api/util"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// applyStages splits the resources in stages that are applied one after the other, the resources of a stage being
+// applied concurrently. A resource declaring an ordering dependency, i.e. requiring an object to exist in the cluster,
+// is a stage of its own, so that it is applied after the resources before it, and before the resources after it.
+func applyStages(resources []addonsv1.ResourceRef) [][]addonsv1.ResourceRef {
+	stages := [][]addonsv1.ResourceRef{}
+	independent := false
+	for _, resource := range resources {
+		dependent := resource.RequiresExisting != nil
+		if dependent || !independent {
+			stages = append(stages, []addonsv1.ResourceRef{})
+		}
+		stages[len(stages)-1] = append(stages[len(stages)-1], resource)
+		independent = !dependent
+	}
+	return stages
+}
+
+// failedFirst returns the resources of a stage with the resources that failed to be applied at the previous reconcile,
+// i.e. recorded as not applied in the ResourceSetBinding, moved first, so that fixing a broken resource converges
+// without waiting for the other resources to be evaluated again. Resources otherwise keep their order.
+func failedFirst(resources []addonsv1.ResourceRef, resourceSetBinding *addonsv1.ResourceSetBinding) []addonsv1.ResourceRef {
+	ordered := make([]addonsv1.ResourceRef, 0, len(resources))
+	rest := []addonsv1.ResourceRef{}
+	for _, resource := range resources {
+		if resourceBinding := resourceSetBinding.GetResourceBinding(resource); resourceBinding != nil && !resourceBinding.Applied {
+			ordered = append(ordered, resource)
+			continue
+		}
+		rest = append(rest, resource)
+	}
+	return append(ordered, rest...)
+}
+
+// retryOrder returns the resources in the order they are applied one at a time: the failed resources are retried
+// first within each stage, so that ordering dependencies between the stages are still honored.
+func retryOrder(resources []addonsv1.ResourceRef, resourceSetBinding *addonsv1.ResourceSetBinding) []addonsv1.ResourceRef {
+	ordered := make([]addonsv1.ResourceRef, 0, len(resources))
+	for _, stage := range applyStages(resources) {
+		ordered = append(ordered, failedFirst(stage, resourceSetBinding)...)
+	}
+	return ordered
+}
+
+// objectReservationKey identifies the resources of a ClusterResourceSet being applied concurrently to a cluster.
+type objectReservationKey struct {
+	cluster            types.NamespacedName
+	clusterResourceSet string
+}
+
+// startObjectReservations records the numbers of objects of the resources of the ClusterResourceSet applied to the
+// cluster until stopObjectReservations is called, so that the object limit of the cluster accounts for the resources
+// applied concurrently by other workers, which are not in the copy of the ResourceSetBinding of a worker.
+func (r *ClusterResourceSetReconciler) startObjectReservations(cluster *clusterv1.Cluster, clusterResourceSet *addonsv1.ClusterResourceSet) {
+	r.objectReservationsLock.Lock()
+	defer r.objectReservationsLock.Unlock()
+	if r.objectReservations == nil {
+		r.objectReservations = map[objectReservationKey]map[string]int{}
+	}
+	r.objectReservations[objectReservationKey{cluster: util.ObjectKey(cluster), clusterResourceSet: clusterResourceSet.Name}] = map[string]int{}
+}
+
+// stopObjectReservations releases the objects reserved by startObjectReservations.
+func (r *ClusterResourceSetReconciler) stopObjectReservations(cluster *clusterv1.Cluster, clusterResourceSet *addonsv1.ClusterResourceSet) {
+	r.objectReservationsLock.Lock()
+	defer r.objectReservationsLock.Unlock()
+	delete(r.objectReservations, objectReservationKey{cluster: util.ObjectKey(cluster), clusterResourceSet: clusterResourceSet.Name})
+}
+
+// reserveClusterObjects returns the number of objects applied to the cluster once the count objects of the resource
+// are applied, given the count of the other objects recorded in the ResourceSetBinding. If the objects of the resources
+// applied concurrently to the cluster are reserved, they are accounted for instead of the ones recorded, and the objects
+// of the resource are reserved too if they are within the limit. Reservations are not released when applying a
+// resource fails, hence the limit errs on the side of refusing resources until the concurrent apply completes.
+func (r *ClusterResourceSetReconciler) reserveClusterObjects(cluster *clusterv1.Cluster, clusterResourceSet *addonsv1.ClusterResourceSet, resourceSetBinding *addonsv1.ResourceSetBinding, resource addonsv1.ResourceRef, otherCount, count, limit int) int {
+	r.objectReservationsLock.Lock()
+	defer r.objectReservationsLock.Unlock()
+
+	reservations, ok := r.objectReservations[objectReservationKey{cluster: util.ObjectKey(cluster), clusterResourceSet: clusterResourceSet.Name}]
+	if !ok {
+		return otherCount + count
+	}
+	total := otherCount + count
+	for key, reserved := range reservations {
+		if key == resourceKey(resource) {
+			continue
+		}
+		total += reserved
+		for _, resourceBinding := range resourceSetBinding.Resources {
+			if resourceKey(resourceBinding.ResourceRef) == key {
+				total -= int(resourceBinding.AppliedObjects)
+			}
+		}
+	}
+	if total <= limit {
+		reservations[resourceKey(resource)] = count
+	}
+	return total
+}
+
+// resourceKey identifies a resource of a ClusterResourceSet, like ResourceRef.refersTo.
+func resourceKey(resource addonsv1.ResourceRef) string {
+	return resource.Kind + "/" + resource.Name
+}
+
+// applyResourcesConcurrently applies the resources to the cluster with up to ApplyWorkers resources applied at the same
+// time, and calls done with the result of each resource. Each resource is applied with copies of the
+// ClusterResourceSet and of the ResourceSetBinding, whose changes are merged back once it is applied, so that the
+// workers do not modify them concurrently. Resources that do not need to be applied are skipped.
+func (r *ClusterResourceSetReconciler) applyResourcesConcurrently(ctx context.Context, remoteClient client.Client, cluster *clusterv1.Cluster, clusterResourceSet *addonsv1.ClusterResourceSet, resourceSetBinding *addonsv1.ResourceSetBinding, resources []addonsv1.ResourceRef, done func(addonsv1.ResourceRef, error)) {
+	r.startObjectReservations(cluster, clusterResourceSet)
+	defer r.stopObjectReservations(cluster, clusterResourceSet)
+
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+	work := make(chan addonsv1.ResourceRef)
+
+	workers := r.ApplyWorkers
+	if len(resources) < workers {
+		workers = len(resources)
+	}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for resource := range work {
+				lock.Lock()
+				workerClusterResourceSet := clusterResourceSet.DeepCopy()
+				workerResourceSetBinding := resourceSetBinding.DeepCopy()
+				lock.Unlock()
+				before := conditions.Get(workerClusterResourceSet, addonsv1.ResourcesAppliedCondition).DeepCopy()
+
+				err := r.applyResource(ctx, remoteClient, cluster, workerClusterResourceSet, workerResourceSetBinding, resource)
+
+				lock.Lock()
+				if resourceBinding := workerResourceSetBinding.GetResourceBinding(resource); resourceBinding != nil {
+					resourceSetBinding.SetBinding(*resourceBinding)
+				}
+				if after := conditions.Get(workerClusterResourceSet, addonsv1.ResourcesAppliedCondition); after != nil && !reflect.DeepEqual(before, after) {
+					conditions.Set(clusterResourceSet, after)
+				}
+				done(resource, err)
+				lock.Unlock()
+			}
+		}()
+	}
+
+	for _, resource := range resources {
+		lock.Lock()
+		skip := !reappliesOnChange(clusterResourceSet) && resourceSetBinding.IsApplied(resource)
+		if skip {
+			setResourceCondition(clusterResourceSet, resource, nil)
+		}
+		lock.Unlock()
+		if !skip {
+			work <- resource
+		}
+	}
+	close(work)
+	wg.Wait()
+}
@@ -0,0 +1,203 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/record"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
+	addonsv1 "sigs.k8s.io/cluster-api/exp/addons/api/v1alpha3"
+	"sigs.k8s.io/cluster-api/util/conditions"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+func TestApplyStages(t *testing.T) {
+	g := NewWithT(t)
+
+	prerequisite := &addonsv1.PrerequisiteRef{APIVersion: "v1", Kind: "Namespace", Name: "addons"}
+	a := addonsv1.ResourceRef{Kind: "ConfigMap", Name: "a"}
+	b := addonsv1.ResourceRef{Kind: "ConfigMap", Name: "b"}
+	c := addonsv1.ResourceRef{Kind: "ConfigMap", Name: "c", RequiresExisting: prerequisite}
+	d := addonsv1.ResourceRef{Kind: "ConfigMap", Name: "d", RequiresExisting: prerequisite}
+	e := addonsv1.ResourceRef{Kind: "ConfigMap", Name: "e"}
+
+	g.Expect(applyStages(nil)).To(BeEmpty())
+	g.Expect(applyStages([]addonsv1.ResourceRef{a, b, c, d, e})).To(Equal([][]addonsv1.ResourceRef{{a, b}, {c}, {d}, {e}}))
+	g.Expect(applyStages([]addonsv1.ResourceRef{c, a, b})).To(Equal([][]addonsv1.ResourceRef{{c}, {a, b}}))
+}
+
+func TestRetryOrder(t *testing.T) {
+	g := NewWithT(t)
+
+	prerequisite := &addonsv1.PrerequisiteRef{APIVersion: "v1", Kind: "Namespace", Name: "addons"}
+	a := addonsv1.ResourceRef{Kind: "ConfigMap", Name: "a"}
+	b := addonsv1.ResourceRef{Kind: "ConfigMap", Name: "b"}
+	c := addonsv1.ResourceRef{Kind: "ConfigMap", Name: "c"}
+	d := addonsv1.ResourceRef{Kind: "ConfigMap", Name: "d", RequiresExisting: prerequisite}
+	e := addonsv1.ResourceRef{Kind: "ConfigMap", Name: "e"}
+	f := addonsv1.ResourceRef{Kind: "ConfigMap", Name: "f"}
+
+	resourceSetBinding := &addonsv1.ResourceSetBinding{
+		ClusterResourceSetName: "crs",
+		Resources: []addonsv1.ResourceBinding{
+			{ResourceRef: a, Applied: true},
+			{ResourceRef: b, Applied: true},
+			{ResourceRef: c, Applied: false},
+			{ResourceRef: d, Applied: true},
+			{ResourceRef: f, Applied: false},
+		},
+	}
+
+	// Failed resources are retried first, without crossing the resources with an ordering dependency. Resources never
+	// applied keep their order.
+	g.Expect(retryOrder([]addonsv1.ResourceRef{a, b, c, d, e, f}, resourceSetBinding)).To(Equal([]addonsv1.ResourceRef{c, a, b, d, f, e}))
+	g.Expect(failedFirst([]addonsv1.ResourceRef{e, f}, resourceSetBinding)).To(Equal([]addonsv1.ResourceRef{f, e}))
+	g.Expect(retryOrder([]addonsv1.ResourceRef{a, b}, &addonsv1.ResourceSetBinding{})).To(Equal([]addonsv1.ResourceRef{a, b}))
+}
+
+func TestApplyClusterResourceSetConcurrently(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(corev1.AddToScheme(scheme)).To(Succeed())
+	g.Expect(clusterv1.AddToScheme(scheme)).To(Succeed())
+	g.Expect(addonsv1.AddToScheme(scheme)).To(Succeed())
+
+	cluster := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "cluster", Namespace: "default"}}
+	clusterResourceSet := &addonsv1.ClusterResourceSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "crs", Namespace: "default"},
+		Spec: addonsv1.ClusterResourceSetSpec{
+			ClusterSelector: metav1.LabelSelector{MatchLabels: map[string]string{"foo": "bar"}},
+		},
+	}
+	objs := []runtime.Object{cluster}
+	for i := 0; i < 8; i++ {
+		name := fmt.Sprintf("resource-%d", i)
+		objs = append(objs, &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+			Data:       map[string]string{"cm": fmt.Sprintf("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: applied-%d\n  namespace: default\n", i)},
+		})
+		clusterResourceSet.Spec.Resources = append(clusterResourceSet.Spec.Resources, addonsv1.ResourceRef{Kind: "ConfigMap", Name: name})
+	}
+	// A missing resource fails without affecting the others.
+	clusterResourceSet.Spec.Resources = append(clusterResourceSet.Spec.Resources, addonsv1.ResourceRef{Kind: "ConfigMap", Name: "missing"})
+	objs = append(objs, clusterResourceSet)
+
+	remoteClient := fake.NewFakeClientWithScheme(scheme)
+	r := &ClusterResourceSetReconciler{
+		Client: fake.NewFakeClientWithScheme(scheme, objs...),
+		Log:    log.Log,
+		RemoteClientGetter: func(ctx context.Context, key client.ObjectKey) (client.Client, error) {
+			return remoteClient, nil
+		},
+		ApplyWorkers: 3,
+		scheme:       scheme,
+		recorder:     record.NewFakeRecorder(100),
+	}
+
+	g.Expect(r.ApplyClusterResourceSet(context.Background(), cluster, clusterResourceSet)).NotTo(Succeed())
+	g.Expect(conditions.GetReason(clusterResourceSet, addonsv1.ResourcesAppliedCondition)).To(Equal(addonsv1.RetrievingResourceFailedReason))
+
+	binding := &addonsv1.ClusterResourceSetBinding{}
+	g.Expect(r.Client.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: "cluster"}, binding)).To(Succeed())
+	resourceSetBinding := binding.GetOrCreateBinding(clusterResourceSet)
+	for i := 0; i < 8; i++ {
+		g.Expect(remoteClient.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: fmt.Sprintf("applied-%d", i)}, &corev1.ConfigMap{})).To(Succeed())
+		g.Expect(resourceSetBinding.IsApplied(clusterResourceSet.Spec.Resources[i])).To(BeTrue())
+	}
+	g.Expect(resourceSetBinding.IsApplied(addonsv1.ResourceRef{Kind: "ConfigMap", Name: "missing"})).To(BeFalse())
+}
+
+// slowClient delays creates, so that the workers applying resources concurrently all start before any of them is done.
+type slowClient struct {
+	client.Client
+}
+
+func (c *slowClient) Create(ctx context.Context, obj runtime.Object, opts ...client.CreateOption) error {
+	time.Sleep(50 * time.Millisecond)
+	return c.Client.Create(ctx, obj, opts...)
+}
+
+func TestApplyClusterResourceSetConcurrentlyObjectLimit(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(corev1.AddToScheme(scheme)).To(Succeed())
+	g.Expect(clusterv1.AddToScheme(scheme)).To(Succeed())
+	g.Expect(addonsv1.AddToScheme(scheme)).To(Succeed())
+
+	cluster := &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "cluster", Namespace: "default"}}
+	// Each resource has 2 objects, within the limit of 3 on its own but not when combined with another resource.
+	clusterResourceSet := &addonsv1.ClusterResourceSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "crs", Namespace: "default"},
+		Spec: addonsv1.ClusterResourceSetSpec{
+			ClusterSelector:   metav1.LabelSelector{MatchLabels: map[string]string{"foo": "bar"}},
+			MaxClusterObjects: 3,
+		},
+	}
+	objs := []runtime.Object{cluster}
+	for i := 0; i < 4; i++ {
+		name := fmt.Sprintf("resource-%d", i)
+		objs = append(objs, &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+			Data: map[string]string{"cm": fmt.Sprintf("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: applied-%d-a\n  namespace: default\n"+
+				"---\napiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: applied-%d-b\n  namespace: default\n", i, i)},
+		})
+		clusterResourceSet.Spec.Resources = append(clusterResourceSet.Spec.Resources, addonsv1.ResourceRef{Kind: "ConfigMap", Name: name})
+	}
+	objs = append(objs, clusterResourceSet)
+
+	remoteClient := &slowClient{Client: fake.NewFakeClientWithScheme(scheme)}
+	r := &ClusterResourceSetReconciler{
+		Client: fake.NewFakeClientWithScheme(scheme, objs...),
+		Log:    log.Log,
+		RemoteClientGetter: func(ctx context.Context, key client.ObjectKey) (client.Client, error) {
+			return remoteClient, nil
+		},
+		ApplyWorkers: 4,
+		scheme:       scheme,
+		recorder:     record.NewFakeRecorder(100),
+	}
+
+	g.Expect(r.ApplyClusterResourceSet(context.Background(), cluster, clusterResourceSet)).NotTo(Succeed())
+	g.Expect(conditions.GetReason(clusterResourceSet, addonsv1.ResourcesAppliedCondition)).To(Equal(addonsv1.ObjectLimitExceededReason))
+
+	binding := &addonsv1.ClusterResourceSetBinding{}
+	g.Expect(r.Client.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: "cluster"}, binding)).To(Succeed())
+	resourceSetBinding := binding.GetOrCreateBinding(clusterResourceSet)
+	applied := 0
+	for i, resource := range clusterResourceSet.Spec.Resources {
+		exists := remoteClient.Get(context.Background(), client.ObjectKey{Namespace: "default", Name: fmt.Sprintf("applied-%d-a", i)}, &corev1.ConfigMap{}) == nil
+		g.Expect(exists).To(Equal(resourceSetBinding.IsApplied(resource)))
+		if exists {
+			applied++
+		}
+	}
+	g.Expect(applied).To(Equal(1))
+	g.Expect(r.objectReservations).To(BeEmpty())
+}
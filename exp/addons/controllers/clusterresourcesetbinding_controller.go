@@ -0,0 +1,213 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/pkg/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	addonsv1 "sigs.k8s.io/cluster-api/exp/addons/api/v1alpha3"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+// +kubebuilder:rbac:groups=addons.cluster.x-k8s.io,resources=clusterresourcesetbindings,verbs=get;list;watch;update;patch;delete
+
+// ClusterResourceSetBindingReconciler reconciles a ClusterResourceSetBinding object.
+// It removes the entries of ClusterResourceSets that no longer exist, compacts duplicated entries and resource records,
+// and deletes the bindings left without entries, independently of the ClusterResourceSet reconciles.
+type ClusterResourceSetBindingReconciler struct {
+	Client client.Client
+	Log    logr.Logger
+
+	// CompactionInterval is how often the bindings are compacted again, in addition to when they or their
+	// ClusterResourceSets change. Bindings are only compacted on changes when it is 0.
+	CompactionInterval time.Duration
+}
+
+func (r *ClusterResourceSetBindingReconciler) SetupWithManager(mgr ctrl.Manager, options controller.Options) error {
+	_, err := ctrl.NewControllerManagedBy(mgr).
+		For(&addonsv1.ClusterResourceSetBinding{}).
+		Watches(
+			&source.Kind{Type: &addonsv1.ClusterResourceSet{}},
+			&handler.EnqueueRequestsFromMapFunc{ToRequests: handler.ToRequestsFunc(r.clusterResourceSetToClusterResourceSetBinding)},
+		).
+		WithOptions(options).
+		Build(r)
+	if err != nil {
+		return errors.Wrap(err, "failed setting up with a controller manager")
+	}
+	return nil
+}
+
+func (r *ClusterResourceSetBindingReconciler) Reconcile(req ctrl.Request) (ctrl.Result, error) {
+	ctx := context.Background()
+	logger := r.Log.WithValues("clusterresourcesetbinding", req.Name, "namespace", req.Namespace)
+
+	// Fetch the ClusterResourceSetBinding instance.
+	binding := &addonsv1.ClusterResourceSetBinding{}
+	if err := r.Client.Get(ctx, req.NamespacedName, binding); err != nil {
+		if apierrors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+
+	compacted, changed := compactBindings(binding.Spec.Bindings)
+	if changed {
+		logger.Info("Compacting duplicated entries of ClusterResourceSetBinding")
+	}
+
+	bindings := []*addonsv1.ResourceSetBinding{}
+	for _, b := range compacted {
+		crs := &addonsv1.ClusterResourceSet{}
+		key := client.ObjectKey{Namespace: binding.Namespace, Name: b.ClusterResourceSetName}
+		if err := r.Client.Get(ctx, key, crs); err != nil {
+			if apierrors.IsNotFound(err) {
+				logger.Info("Removing entry of deleted ClusterResourceSet", logKeyCRSName, b.ClusterResourceSetName)
+				continue
+			}
+			return ctrl.Result{}, err
+		}
+		bindings = append(bindings, b)
+	}
+
+	// The ClusterResourceSetReconciler records the resources it applies in the same list concurrently, hence the
+	// binding is only changed if it was not changed since it was read, so that the records written since are not lost.
+	// A binding without any entry may have just been created by the ClusterResourceSetReconciler, which records its
+	// first entry after applying the resources, hence it is only deleted if this removed its last entries, or on request.
+	_, cleanup := binding.Annotations[addonsv1.ClusterResourceSetBindingCleanupAnnotation]
+	if len(bindings) == 0 && (len(compacted) > 0 || cleanup) {
+		logger.Info("Deleting ClusterResourceSetBinding without entries")
+		resourceVersion := binding.ResourceVersion
+		err := r.Client.Delete(ctx, binding, client.Preconditions{ResourceVersion: &resourceVersion})
+		if apierrors.IsConflict(err) {
+			logger.V(4).Info("ClusterResourceSetBinding changed since it was read, retrying")
+			return ctrl.Result{Requeue: true}, nil
+		}
+		if err != nil && !apierrors.IsNotFound(err) {
+			return ctrl.Result{}, errors.Wrapf(err, "failed to delete ClusterResourceSetBinding %s/%s", binding.Namespace, binding.Name)
+		}
+		return ctrl.Result{}, nil
+	}
+
+	result := ctrl.Result{RequeueAfter: r.CompactionInterval}
+	if !cleanup && !changed && len(bindings) == len(compacted) {
+		return result, nil
+	}
+
+	original := binding.DeepCopy()
+	binding.Spec.Bindings = bindings
+	delete(binding.Annotations, addonsv1.ClusterResourceSetBindingCleanupAnnotation)
+	err := r.Client.Patch(ctx, binding, client.MergeFromWithOptions(original, client.MergeFromWithOptimisticLock{}))
+	if apierrors.IsConflict(err) {
+		logger.V(4).Info("ClusterResourceSetBinding changed since it was read, retrying")
+		return ctrl.Result{Requeue: true}, nil
+	}
+	if err != nil {
+		return ctrl.Result{}, errors.Wrapf(err, "failed to patch ClusterResourceSetBinding %s/%s", binding.Namespace, binding.Name)
+	}
+	return result, nil
+}
+
+// compactBindings merges the entries recorded more than once for the same ClusterResourceSet, and removes the
+// duplicated records of the same resource in each entry, keeping the most recently applied one. It returns true
+// if anything was removed. The records of resources no longer in their ClusterResourceSet are kept, as pruning
+// their objects relies on them.
+func compactBindings(bindings []*addonsv1.ResourceSetBinding) ([]*addonsv1.ResourceSetBinding, bool) {
+	changed := false
+	compacted := []*addonsv1.ResourceSetBinding{}
+	byName := map[string]*addonsv1.ResourceSetBinding{}
+	for _, b := range bindings {
+		if b == nil {
+			changed = true
+			continue
+		}
+		existing, ok := byName[b.ClusterResourceSetName]
+		if !ok {
+			existing = b.DeepCopy()
+			existing.Resources = nil
+			byName[b.ClusterResourceSetName] = existing
+			compacted = append(compacted, existing)
+		} else {
+			changed = true
+			if existing.PostApplyJobHash == "" {
+				existing.PostApplyJobHash = b.PostApplyJobHash
+			}
+		}
+		for _, resource := range b.Resources {
+			current := existing.GetResourceBinding(resource.ResourceRef)
+			if current == nil {
+				existing.Resources = append(existing.Resources, *resource.DeepCopy())
+				continue
+			}
+			changed = true
+			if appliedAfter(resource, *current) {
+				*current = *resource.DeepCopy()
+			}
+		}
+	}
+	return compacted, changed
+}
+
+// appliedAfter returns true if resource a was applied more recently than resource b. Records without a
+// LastAppliedTime are older than any other, and the later record wins ties as it was written last.
+func appliedAfter(a, b addonsv1.ResourceBinding) bool {
+	if a.LastAppliedTime == nil {
+		return b.LastAppliedTime == nil
+	}
+	if b.LastAppliedTime == nil {
+		return true
+	}
+	return !a.LastAppliedTime.Before(b.LastAppliedTime)
+}
+
+// clusterResourceSetToClusterResourceSetBinding is mapper function that maps a ClusterResourceSet to the
+// ClusterResourceSetBindings with an entry for it, so that the entry is removed once the ClusterResourceSet is deleted.
+func (r *ClusterResourceSetBindingReconciler) clusterResourceSetToClusterResourceSetBinding(o handler.MapObject) []ctrl.Request {
+	result := []ctrl.Request{}
+
+	crs, ok := o.Object.(*addonsv1.ClusterResourceSet)
+	if !ok {
+		r.Log.Error(nil, fmt.Sprintf("Expected a ClusterResourceSet but got a %T", o.Object))
+		return nil
+	}
+
+	bindingList := &addonsv1.ClusterResourceSetBindingList{}
+	if err := r.Client.List(context.Background(), bindingList, client.InNamespace(crs.Namespace)); err != nil {
+		r.Log.Error(err, "failed to list ClusterResourceSetBindings")
+		return nil
+	}
+
+	for i := range bindingList.Items {
+		binding := &bindingList.Items[i]
+		for _, b := range binding.Spec.Bindings {
+			if b.ClusterResourceSetName == crs.Name {
+				result = append(result, ctrl.Request{NamespacedName: client.ObjectKey{Namespace: binding.Namespace, Name: binding.Name}})
+				break
+			}
+		}
+	}
+	return result
+}
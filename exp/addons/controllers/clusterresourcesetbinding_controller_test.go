@@ -0,0 +1,337 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	addonsv1 "sigs.k8s.io/cluster-api/exp/addons/api/v1alpha3"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+func TestClusterResourceSetBindingReconciler(t *testing.T) {
+	scheme := runtime.NewScheme()
+	NewWithT(t).Expect(addonsv1.AddToScheme(scheme)).To(Succeed())
+
+	existingCRS := &addonsv1.ClusterResourceSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "existing", Namespace: "default"},
+	}
+	newBinding := func(annotations map[string]string, crsNames ...string) *addonsv1.ClusterResourceSetBinding {
+		binding := &addonsv1.ClusterResourceSetBinding{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            "cluster",
+				Namespace:       "default",
+				Annotations:     annotations,
+				ResourceVersion: "1",
+			},
+		}
+		for _, name := range crsNames {
+			binding.Spec.Bindings = append(binding.Spec.Bindings, &addonsv1.ResourceSetBinding{ClusterResourceSetName: name})
+		}
+		return binding
+	}
+	cleanup := map[string]string{addonsv1.ClusterResourceSetBindingCleanupAnnotation: ""}
+
+	tests := []struct {
+		name          string
+		binding       *addonsv1.ClusterResourceSetBinding
+		expectDeleted bool
+		expectCRSs    []string
+	}{
+		{
+			name:       "should remove entries of deleted ClusterResourceSets",
+			binding:    newBinding(nil, "existing", "deleted"),
+			expectCRSs: []string{"existing"},
+		},
+		{
+			name:       "should remove the annotation after the cleanup",
+			binding:    newBinding(cleanup, "existing", "deleted"),
+			expectCRSs: []string{"existing"},
+		},
+		{
+			name:       "should not change bindings without orphaned entries",
+			binding:    newBinding(nil, "existing"),
+			expectCRSs: []string{"existing"},
+		},
+		{
+			name:          "should delete the binding if no entries are left",
+			binding:       newBinding(nil, "deleted"),
+			expectDeleted: true,
+		},
+		{
+			name:       "should not delete a binding created without entries yet",
+			binding:    newBinding(nil),
+			expectCRSs: []string{},
+		},
+		{
+			name:          "should delete a binding without entries on cleanup",
+			binding:       newBinding(cleanup),
+			expectDeleted: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			c := fake.NewFakeClientWithScheme(scheme, existingCRS.DeepCopy(), tt.binding)
+			r := &ClusterResourceSetBindingReconciler{
+				Client: c,
+				Log:    log.Log,
+			}
+
+			key := types.NamespacedName{Namespace: tt.binding.Namespace, Name: tt.binding.Name}
+			_, err := r.Reconcile(ctrl.Request{NamespacedName: key})
+			g.Expect(err).NotTo(HaveOccurred())
+
+			binding := &addonsv1.ClusterResourceSetBinding{}
+			err = c.Get(context.Background(), key, binding)
+			if tt.expectDeleted {
+				g.Expect(apierrors.IsNotFound(err)).To(BeTrue())
+				return
+			}
+			g.Expect(err).NotTo(HaveOccurred())
+
+			crsNames := []string{}
+			for _, b := range binding.Spec.Bindings {
+				crsNames = append(crsNames, b.ClusterResourceSetName)
+			}
+			g.Expect(crsNames).To(Equal(tt.expectCRSs))
+			if tt.binding.Annotations != nil {
+				g.Expect(binding.Annotations).NotTo(HaveKey(addonsv1.ClusterResourceSetBindingCleanupAnnotation))
+			}
+		})
+	}
+}
+
+func TestCompactBindings(t *testing.T) {
+	g := NewWithT(t)
+
+	now := time.Now()
+	resource := func(name string, appliedAgo time.Duration, hash string) addonsv1.ResourceBinding {
+		applied := metav1.NewTime(now.Add(-appliedAgo))
+		return addonsv1.ResourceBinding{
+			ResourceRef:     addonsv1.ResourceRef{Kind: "ConfigMap", Name: name},
+			Hash:            hash,
+			LastAppliedTime: &applied,
+			Applied:         true,
+		}
+	}
+
+	// A long-lived cluster whose binding recorded the same ClusterResourceSets and resources many times.
+	bindings := []*addonsv1.ResourceSetBinding{}
+	for i := 0; i < 50; i++ {
+		bindings = append(bindings, &addonsv1.ResourceSetBinding{
+			ClusterResourceSetName: fmt.Sprintf("crs-%d", i%5),
+			Resources: []addonsv1.ResourceBinding{
+				resource("shared", time.Duration(50-i)*time.Minute, fmt.Sprintf("hash-%d", i)),
+				resource(fmt.Sprintf("resource-%d", i%3), time.Duration(i)*time.Minute, fmt.Sprintf("hash-%d", i)),
+			},
+		})
+	}
+	bindings = append(bindings, nil)
+
+	compacted, changed := compactBindings(bindings)
+	g.Expect(changed).To(BeTrue())
+	g.Expect(compacted).To(HaveLen(5))
+	for i, b := range compacted {
+		g.Expect(b.ClusterResourceSetName).To(Equal(fmt.Sprintf("crs-%d", i)))
+		g.Expect(b.Resources).To(HaveLen(4))
+		// The most recently applied record of each resource is kept.
+		g.Expect(b.GetResourceBinding(addonsv1.ResourceRef{Kind: "ConfigMap", Name: "shared"}).Hash).To(Equal(fmt.Sprintf("hash-%d", 45+i)))
+	}
+	g.Expect(compacted[0].GetResourceBinding(addonsv1.ResourceRef{Kind: "ConfigMap", Name: "resource-0"}).Hash).To(Equal("hash-0"))
+	// The input is not modified.
+	g.Expect(bindings[0].Resources[0].Hash).To(Equal("hash-0"))
+
+	// Compacting again does not change anything.
+	again, changed := compactBindings(compacted)
+	g.Expect(changed).To(BeFalse())
+	g.Expect(again).To(Equal(compacted))
+}
+
+func TestClusterResourceSetBindingReconcilerCompaction(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(addonsv1.AddToScheme(scheme)).To(Succeed())
+
+	binding := &addonsv1.ClusterResourceSetBinding{
+		ObjectMeta: metav1.ObjectMeta{Name: "cluster", Namespace: "default", ResourceVersion: "1"},
+	}
+	for i := 0; i < 20; i++ {
+		binding.Spec.Bindings = append(binding.Spec.Bindings, &addonsv1.ResourceSetBinding{
+			ClusterResourceSetName: fmt.Sprintf("crs-%d", i%4),
+			Resources:              []addonsv1.ResourceBinding{{ResourceRef: addonsv1.ResourceRef{Kind: "Secret", Name: "resource"}, Applied: true}},
+		})
+	}
+	c := fake.NewFakeClientWithScheme(scheme,
+		binding,
+		&addonsv1.ClusterResourceSet{ObjectMeta: metav1.ObjectMeta{Name: "crs-0", Namespace: "default"}},
+		&addonsv1.ClusterResourceSet{ObjectMeta: metav1.ObjectMeta{Name: "crs-2", Namespace: "default"}},
+	)
+	r := &ClusterResourceSetBindingReconciler{
+		Client:             c,
+		Log:                log.Log,
+		CompactionInterval: time.Hour,
+	}
+
+	key := types.NamespacedName{Namespace: binding.Namespace, Name: binding.Name}
+	result, err := r.Reconcile(ctrl.Request{NamespacedName: key})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(result.RequeueAfter).To(Equal(time.Hour))
+
+	g.Expect(c.Get(context.Background(), key, binding)).To(Succeed())
+	g.Expect(binding.Spec.Bindings).To(HaveLen(2))
+	for _, b := range binding.Spec.Bindings {
+		g.Expect(b.ClusterResourceSetName).To(BeElementOf("crs-0", "crs-2"))
+		g.Expect(b.Resources).To(HaveLen(1))
+	}
+}
+
+// concurrentWriteClient simulates the API server's optimistic concurrency with a write made before the first patch,
+// e.g. by the ClusterResourceSetReconciler recording a resource it applied.
+type concurrentWriteClient struct {
+	client.Client
+	write func()
+}
+
+func (c *concurrentWriteClient) Patch(ctx context.Context, obj runtime.Object, patch client.Patch, opts ...client.PatchOption) error {
+	if c.write != nil {
+		c.write()
+		c.write = nil
+	}
+	data, err := patch.Data(obj)
+	if err != nil {
+		return err
+	}
+	patched := &unstructured.Unstructured{}
+	if err := json.Unmarshal(data, &patched.Object); err != nil {
+		return err
+	}
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return err
+	}
+	current := obj.DeepCopyObject()
+	if err := c.Client.Get(ctx, client.ObjectKey{Namespace: accessor.GetNamespace(), Name: accessor.GetName()}, current); err != nil {
+		return err
+	}
+	currentAccessor, err := meta.Accessor(current)
+	if err != nil {
+		return err
+	}
+	if rv := patched.GetResourceVersion(); rv != "" && rv != currentAccessor.GetResourceVersion() {
+		return apierrors.NewConflict(schema.GroupResource{Resource: "clusterresourcesetbindings"}, accessor.GetName(), errors.New("the object has been modified"))
+	}
+	return c.Client.Patch(ctx, obj, patch, opts...)
+}
+
+func TestClusterResourceSetBindingReconcilerCompactionConflict(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(addonsv1.AddToScheme(scheme)).To(Succeed())
+
+	resource := func(name string) addonsv1.ResourceBinding {
+		return addonsv1.ResourceBinding{ResourceRef: addonsv1.ResourceRef{Kind: "Secret", Name: name}, Applied: true}
+	}
+	binding := &addonsv1.ClusterResourceSetBinding{
+		ObjectMeta: metav1.ObjectMeta{Name: "cluster", Namespace: "default", ResourceVersion: "1"},
+		Spec: addonsv1.ClusterResourceSetBindingSpec{
+			Bindings: []*addonsv1.ResourceSetBinding{
+				{ClusterResourceSetName: "crs", Resources: []addonsv1.ResourceBinding{resource("first")}},
+				{ClusterResourceSetName: "crs", Resources: []addonsv1.ResourceBinding{resource("first")}},
+			},
+		},
+	}
+	key := types.NamespacedName{Namespace: binding.Namespace, Name: binding.Name}
+	c := &concurrentWriteClient{Client: fake.NewFakeClientWithScheme(scheme,
+		binding,
+		&addonsv1.ClusterResourceSet{ObjectMeta: metav1.ObjectMeta{Name: "crs", Namespace: "default"}},
+	)}
+	c.write = func() {
+		latest := &addonsv1.ClusterResourceSetBinding{}
+		g.Expect(c.Get(context.Background(), key, latest)).To(Succeed())
+		latest.Spec.Bindings[0].Resources = append(latest.Spec.Bindings[0].Resources, resource("second"))
+		g.Expect(c.Update(context.Background(), latest)).To(Succeed())
+	}
+	r := &ClusterResourceSetBindingReconciler{
+		Client:             c,
+		Log:                log.Log,
+		CompactionInterval: time.Hour,
+	}
+
+	// The binding changed since it was read, hence it is compacted again rather than overwritten.
+	result, err := r.Reconcile(ctrl.Request{NamespacedName: key})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(result.Requeue).To(BeTrue())
+
+	result, err = r.Reconcile(ctrl.Request{NamespacedName: key})
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(result.RequeueAfter).To(Equal(time.Hour))
+	g.Expect(c.Get(context.Background(), key, binding)).To(Succeed())
+	g.Expect(binding.Spec.Bindings).To(HaveLen(1))
+	g.Expect(binding.Spec.Bindings[0].GetResourceBinding(addonsv1.ResourceRef{Kind: "Secret", Name: "second"})).NotTo(BeNil())
+}
+
+func TestClusterResourceSetToClusterResourceSetBinding(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(addonsv1.AddToScheme(scheme)).To(Succeed())
+
+	newBinding := func(name, namespace, crsName string) *addonsv1.ClusterResourceSetBinding {
+		return &addonsv1.ClusterResourceSetBinding{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Spec: addonsv1.ClusterResourceSetBindingSpec{
+				Bindings: []*addonsv1.ResourceSetBinding{{ClusterResourceSetName: crsName}},
+			},
+		}
+	}
+	crs := &addonsv1.ClusterResourceSet{ObjectMeta: metav1.ObjectMeta{Name: "crs", Namespace: "default"}}
+
+	r := &ClusterResourceSetBindingReconciler{
+		Client: fake.NewFakeClientWithScheme(scheme,
+			newBinding("bound", "default", "crs"),
+			newBinding("other-crs", "default", "other"),
+			newBinding("other-namespace", "other", "crs"),
+		),
+		Log: log.Log,
+	}
+
+	requests := r.clusterResourceSetToClusterResourceSetBinding(handler.MapObject{Meta: crs, Object: crs})
+	g.Expect(requests).To(ConsistOf(ctrl.Request{NamespacedName: types.NamespacedName{Namespace: "default", Name: "bound"}}))
+}
@@ -0,0 +1,155 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"sort"
+
+	"github.com/pkg/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	addonsv1 "sigs.k8s.io/cluster-api/exp/addons/api/v1alpha3"
+	"sigs.k8s.io/cluster-api/util"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+// ResourceBindingReport describes a resource of a ClusterResourceSet and whether it is applied to a Cluster.
+type ResourceBindingReport struct {
+	ClusterName            string
+	ClusterResourceSetName string
+	Kind                   string
+	Name                   string
+	Applied                bool
+	LastAppliedTime        *metav1.Time
+}
+
+// ReportResourceBindings lists the ClusterResourceSetBindings in a namespace and flattens them into a report with an
+// entry per cluster, ClusterResourceSet and resource, sorted in this order.
+func ReportResourceBindings(ctx context.Context, c client.Reader, namespace string) ([]ResourceBindingReport, error) {
+	bindingList := &addonsv1.ClusterResourceSetBindingList{}
+	if err := c.List(ctx, bindingList, client.InNamespace(namespace)); err != nil {
+		return nil, errors.Wrapf(err, "failed to list ClusterResourceSetBindings in namespace %s", namespace)
+	}
+
+	report := []ResourceBindingReport{}
+	for _, binding := range bindingList.Items {
+		// ClusterResourceSetBindings are named after the cluster they belong to.
+		for _, resourceSetBinding := range binding.Spec.Bindings {
+			for _, resource := range resourceSetBinding.Resources {
+				report = append(report, ResourceBindingReport{
+					ClusterName:            binding.Name,
+					ClusterResourceSetName: resourceSetBinding.ClusterResourceSetName,
+					Kind:                   resource.Kind,
+					Name:                   resource.Name,
+					Applied:                resource.Applied,
+					LastAppliedTime:        resource.LastAppliedTime,
+				})
+			}
+		}
+	}
+
+	sort.Slice(report, func(i, j int) bool {
+		if report[i].ClusterName != report[j].ClusterName {
+			return report[i].ClusterName < report[j].ClusterName
+		}
+		if report[i].ClusterResourceSetName != report[j].ClusterResourceSetName {
+			return report[i].ClusterResourceSetName < report[j].ClusterResourceSetName
+		}
+		if report[i].Kind != report[j].Kind {
+			return report[i].Kind < report[j].Kind
+		}
+		return report[i].Name < report[j].Name
+	})
+	return report, nil
+}
+
+// ClusterResourceSetSummary describes how far the resources of a ClusterResourceSet are applied to the clusters it
+// currently selects.
+type ClusterResourceSetSummary struct {
+	Name string
+	// MatchedClusters is the number of clusters selected by the ClusterResourceSet.
+	MatchedClusters int
+	// AppliedClusters is the number of matched clusters all the resources are applied to.
+	AppliedClusters int
+	// FailedClusters are the names of the matched clusters at least one of the resources failed to be applied to.
+	FailedClusters []string
+	// PendingClusters is the number of matched clusters that are neither applied nor failed, e.g. because the resources
+	// were not applied to them yet.
+	PendingClusters int
+}
+
+// SummarizeClusterResourceSets returns a summary for each ClusterResourceSet in a namespace, sorted by name. It selects
+// clusters and reads their ClusterResourceSetBindings like the controller does, so that it can be used to report the
+// status of addons next to the rest of the clusters.
+func SummarizeClusterResourceSets(ctx context.Context, c client.Reader, namespace string) ([]ClusterResourceSetSummary, error) {
+	clusterResourceSetList := &addonsv1.ClusterResourceSetList{}
+	if err := c.List(ctx, clusterResourceSetList, client.InNamespace(namespace)); err != nil {
+		return nil, errors.Wrapf(err, "failed to list ClusterResourceSets in namespace %s", namespace)
+	}
+
+	bindings := map[string]*addonsv1.ClusterResourceSetBinding{}
+	summaries := []ClusterResourceSetSummary{}
+	for i := range clusterResourceSetList.Items {
+		clusterResourceSet := &clusterResourceSetList.Items[i]
+		clusters, err := selectClusters(ctx, c, log.NullLogger{}, clusterResourceSet)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to select clusters of ClusterResourceSet %s", clusterResourceSet.Name)
+		}
+
+		summary := ClusterResourceSetSummary{Name: clusterResourceSet.Name, MatchedClusters: len(clusters), FailedClusters: []string{}}
+		for _, cluster := range clusters {
+			// ClusterResourceSetBindings are shared by all the ClusterResourceSets selecting a cluster.
+			binding, ok := bindings[cluster.Name]
+			if !ok {
+				binding = &addonsv1.ClusterResourceSetBinding{}
+				if err := c.Get(ctx, util.ObjectKey(cluster), binding); err != nil && !apierrors.IsNotFound(err) {
+					return nil, errors.Wrapf(err, "failed to get ClusterResourceSetBinding for cluster %s", cluster.Name)
+				}
+				bindings[cluster.Name] = binding
+			}
+
+			resourceSetBinding := findResourceSetBinding(binding, clusterResourceSet.Name)
+			switch {
+			case resourceSetBinding != nil && hasFailedResources(clusterResourceSet, resourceSetBinding):
+				summary.FailedClusters = append(summary.FailedClusters, cluster.Name)
+			case resourceSetBinding != nil && !hasPendingResources(clusterResourceSet, resourceSetBinding):
+				summary.AppliedClusters++
+			default:
+				summary.PendingClusters++
+			}
+		}
+		sort.Strings(summary.FailedClusters)
+		summaries = append(summaries, summary)
+	}
+
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].Name < summaries[j].Name
+	})
+	return summaries, nil
+}
+
+// hasFailedResources returns true if any of the ClusterResourceSet's resources is recorded as not applied successfully.
+func hasFailedResources(clusterResourceSet *addonsv1.ClusterResourceSet, resourceSetBinding *addonsv1.ResourceSetBinding) bool {
+	for _, resource := range clusterResourceSet.Spec.Resources {
+		if resourceBinding := resourceSetBinding.GetResourceBinding(resource); resourceBinding != nil && !resourceBinding.Applied {
+			return true
+		}
+	}
+	return false
+}
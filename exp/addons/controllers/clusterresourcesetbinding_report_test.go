@@ -0,0 +1,135 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controllers
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/onsi/gomega"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	clusterv1 "sigs.k8s.io/cluster-api/api/v1alpha3"
+	addonsv1 "sigs.k8s.io/cluster-api/exp/addons/api/v1alpha3"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestReportResourceBindings(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(addonsv1.AddToScheme(scheme)).To(Succeed())
+
+	newBinding := func(clusterName, namespace string, bindings ...*addonsv1.ResourceSetBinding) *addonsv1.ClusterResourceSetBinding {
+		return &addonsv1.ClusterResourceSetBinding{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      clusterName,
+				Namespace: namespace,
+			},
+			Spec: addonsv1.ClusterResourceSetBindingSpec{
+				Bindings: bindings,
+			},
+		}
+	}
+
+	c := fake.NewFakeClientWithScheme(scheme,
+		newBinding("cluster-b", "default", &addonsv1.ResourceSetBinding{
+			ClusterResourceSetName: "crs",
+			Resources: []addonsv1.ResourceBinding{
+				{ResourceRef: addonsv1.ResourceRef{Kind: "Secret", Name: "secret"}, Applied: false},
+			},
+		}),
+		newBinding("cluster-a", "default", &addonsv1.ResourceSetBinding{
+			ClusterResourceSetName: "crs",
+			Resources: []addonsv1.ResourceBinding{
+				{ResourceRef: addonsv1.ResourceRef{Kind: "Secret", Name: "secret"}, Applied: true},
+				{ResourceRef: addonsv1.ResourceRef{Kind: "ConfigMap", Name: "configmap"}, Applied: true},
+			},
+		}),
+		newBinding("cluster-c", "other", &addonsv1.ResourceSetBinding{
+			ClusterResourceSetName: "crs",
+			Resources: []addonsv1.ResourceBinding{
+				{ResourceRef: addonsv1.ResourceRef{Kind: "Secret", Name: "secret"}, Applied: true},
+			},
+		}),
+	)
+
+	report, err := ReportResourceBindings(context.Background(), c, "default")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(report).To(Equal([]ResourceBindingReport{
+		{ClusterName: "cluster-a", ClusterResourceSetName: "crs", Kind: "ConfigMap", Name: "configmap", Applied: true},
+		{ClusterName: "cluster-a", ClusterResourceSetName: "crs", Kind: "Secret", Name: "secret", Applied: true},
+		{ClusterName: "cluster-b", ClusterResourceSetName: "crs", Kind: "Secret", Name: "secret", Applied: false},
+	}))
+}
+
+func TestSummarizeClusterResourceSets(t *testing.T) {
+	g := NewWithT(t)
+
+	scheme := runtime.NewScheme()
+	g.Expect(clusterv1.AddToScheme(scheme)).To(Succeed())
+	g.Expect(addonsv1.AddToScheme(scheme)).To(Succeed())
+
+	newCluster := func(name string) *clusterv1.Cluster {
+		return &clusterv1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Labels: map[string]string{"foo": "bar"}}}
+	}
+	newClusterResourceSet := func(name string, resources ...addonsv1.ResourceRef) *addonsv1.ClusterResourceSet {
+		return &addonsv1.ClusterResourceSet{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+			Spec: addonsv1.ClusterResourceSetSpec{
+				ClusterSelector: metav1.LabelSelector{MatchLabels: map[string]string{"foo": "bar"}},
+				Resources:       resources,
+			},
+		}
+	}
+	secret := addonsv1.ResourceRef{Kind: "Secret", Name: "secret"}
+	configMap := addonsv1.ResourceRef{Kind: "ConfigMap", Name: "configmap"}
+
+	c := fake.NewFakeClientWithScheme(scheme,
+		newCluster("applied"), newCluster("failed"), newCluster("partial"), newCluster("unbound"),
+		newClusterResourceSet("crs-b", secret, configMap),
+		newClusterResourceSet("crs-a", secret),
+		&addonsv1.ClusterResourceSetBinding{
+			ObjectMeta: metav1.ObjectMeta{Name: "applied", Namespace: "default"},
+			Spec: addonsv1.ClusterResourceSetBindingSpec{Bindings: []*addonsv1.ResourceSetBinding{
+				{ClusterResourceSetName: "crs-a", Resources: []addonsv1.ResourceBinding{{ResourceRef: secret, Applied: true}}},
+				{ClusterResourceSetName: "crs-b", Resources: []addonsv1.ResourceBinding{{ResourceRef: secret, Applied: true}, {ResourceRef: configMap, Applied: true}}},
+			}},
+		},
+		&addonsv1.ClusterResourceSetBinding{
+			ObjectMeta: metav1.ObjectMeta{Name: "failed", Namespace: "default"},
+			Spec: addonsv1.ClusterResourceSetBindingSpec{Bindings: []*addonsv1.ResourceSetBinding{
+				{ClusterResourceSetName: "crs-b", Resources: []addonsv1.ResourceBinding{{ResourceRef: secret, Applied: false}}},
+			}},
+		},
+		&addonsv1.ClusterResourceSetBinding{
+			ObjectMeta: metav1.ObjectMeta{Name: "partial", Namespace: "default"},
+			Spec: addonsv1.ClusterResourceSetBindingSpec{Bindings: []*addonsv1.ResourceSetBinding{
+				{ClusterResourceSetName: "crs-a", Resources: []addonsv1.ResourceBinding{{ResourceRef: secret, Applied: true}}},
+				{ClusterResourceSetName: "crs-b", Resources: []addonsv1.ResourceBinding{{ResourceRef: secret, Applied: true}}},
+			}},
+		},
+	)
+
+	summaries, err := SummarizeClusterResourceSets(context.Background(), c, "default")
+	g.Expect(err).NotTo(HaveOccurred())
+	g.Expect(summaries).To(Equal([]ClusterResourceSetSummary{
+		{Name: "crs-a", MatchedClusters: 4, AppliedClusters: 2, FailedClusters: []string{}, PendingClusters: 2},
+		{Name: "crs-b", MatchedClusters: 4, AppliedClusters: 1, FailedClusters: []string{"failed"}, PendingClusters: 2},
+	}))
+}
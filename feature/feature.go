@@ -33,6 +33,9 @@ const (
 
 	// alpha: v0.3
 	ClusterResourceSet featuregate.Feature = "ClusterResourceSet"
+
+	// alpha: v0.3
+	ClusterResourceSetReconcileStrategy featuregate.Feature = "ClusterResourceSetReconcileStrategy"
 )
 
 func init() {
@@ -43,6 +46,7 @@ func init() {
 // To add a new feature, define a key for it above and add it here.
 var defaultClusterAPIFeatureGates = map[featuregate.Feature]featuregate.FeatureSpec{
 	// Every feature should be initiated here:
-	MachinePool:        {Default: false, PreRelease: featuregate.Alpha},
-	ClusterResourceSet: {Default: false, PreRelease: featuregate.Alpha},
+	MachinePool:                         {Default: false, PreRelease: featuregate.Alpha},
+	ClusterResourceSet:                  {Default: false, PreRelease: featuregate.Alpha},
+	ClusterResourceSetReconcileStrategy: {Default: false, PreRelease: featuregate.Alpha},
 }
@@ -37,6 +37,7 @@ require (
 	k8s.io/cluster-bootstrap v0.17.8
 	k8s.io/component-base v0.17.8
 	k8s.io/klog v1.0.0
+	k8s.io/kube-openapi v0.0.0-20200410145947-bcb3869e6f29
 	k8s.io/utils v0.0.0-20200619165400-6e3d28b6ed19
 	sigs.k8s.io/controller-runtime v0.5.8
 	sigs.k8s.io/kind v0.7.1-0.20200303021537-981bd80d3802
@@ -59,11 +59,29 @@ var (
 	watchNamespace                string
 	profilerAddress               string
 	clusterConcurrency            int
+	clusterCacheCapacity          int
+	clusterProxyURL               string
 	machineConcurrency            int
 	machineSetConcurrency         int
 	machineDeploymentConcurrency  int
 	machinePoolConcurrency        int
 	clusterResourceSetConcurrency int
+	clusterResourceSetSharedNS    string
+	clusterResourceSetLabeledOnly bool
+	clusterResourceSetMinInterval time.Duration
+	clusterResourceSetSecretTypes []string
+	clusterResourceSetConflicts   int
+	clusterResourceSetForceOwner  bool
+	clusterResourceSetMaxBindings int
+	clusterResourceSetMgmtHosts   []string
+	clusterResourceSetTimeout     time.Duration
+	clusterResourceSetWorkers     int
+	clusterResourceSetNoMatchWarn time.Duration
+	clusterResourceSetExistCheck  time.Duration
+	clusterResourceSetRetryCodes  []int
+	clusterResourceSetCompaction  time.Duration
+	clusterResourceSetMaxEvents   int
+	clusterResourceSetMaxObjects  int
 	machineHealthCheckConcurrency int
 	syncPeriod                    time.Duration
 	webhookPort                   int
@@ -108,6 +126,12 @@ func InitFlags(fs *pflag.FlagSet) {
 	fs.IntVar(&clusterConcurrency, "cluster-concurrency", 10,
 		"Number of clusters to process simultaneously")
 
+	fs.IntVar(&clusterCacheCapacity, "cluster-cache-capacity", 0,
+		"Maximum number of workload clusters a client and a cache are kept for, the least recently used being removed first. Unlimited if 0.")
+
+	fs.StringVar(&clusterProxyURL, "cluster-proxy-url", "",
+		"URL of the HTTP proxy to reach the API server of workload clusters through, unless a Cluster sets another one in the cluster.x-k8s.io/proxy-url annotation. Workload clusters are connected to directly if empty.")
+
 	fs.IntVar(&machineConcurrency, "machine-concurrency", 10,
 		"Number of machines to process simultaneously")
 
@@ -123,6 +147,54 @@ func InitFlags(fs *pflag.FlagSet) {
 	fs.IntVar(&clusterResourceSetConcurrency, "clusterresourceset-concurrency", 10,
 		"Number of cluster resource sets to process simultaneously")
 
+	fs.StringVar(&clusterResourceSetSharedNS, "clusterresourceset-shared-namespace", "",
+		"Namespace that ClusterResourceSet resources are looked up in when they are not found in the cluster's namespace. Resources in this namespace can be used by ClusterResourceSets in every namespace.")
+
+	fs.BoolVar(&clusterResourceSetLabeledOnly, "clusterresourceset-require-secret-source-label", false,
+		"Only allow ClusterResourceSets to use Secrets labeled with addons.cluster.x-k8s.io/source=true as resources.")
+
+	fs.DurationVar(&clusterResourceSetMinInterval, "clusterresourceset-min-apply-interval", 0,
+		"The minimum interval between applying ClusterResourceSet resources to the same cluster (e.g. 10s). This is a best-effort throttle and disabled when 0.")
+
+	fs.StringSliceVar(&clusterResourceSetSecretTypes, "clusterresourceset-accepted-secret-types", []string{string(addonsv1alpha3.ClusterResourceSetSecretType)},
+		"Types of the Secrets that can be used as ClusterResourceSet resources.")
+
+	fs.IntVar(&clusterResourceSetConflicts, "clusterresourceset-apply-conflict-retries", 3,
+		"Number of times updating a ClusterResourceSet resource is retried when fields are owned by another field manager.")
+
+	fs.BoolVar(&clusterResourceSetForceOwner, "clusterresourceset-force-ownership-on-conflict", false,
+		"Take the ownership of fields owned by other field managers when updating a ClusterResourceSet resource still conflicts after all retries.")
+
+	fs.IntVar(&clusterResourceSetMaxBindings, "clusterresourceset-max-bindings-per-cluster", 0,
+		"Number of ClusterResourceSets bound to a single cluster above which a warning is reported. Disabled when 0.")
+
+	fs.StringSliceVar(&clusterResourceSetMgmtHosts, "clusterresourceset-management-cluster-endpoints", []string{},
+		"Additional API server endpoints of the management cluster, e.g. its external address. ClusterResourceSets do not apply resources to Clusters with these endpoints unless they allow it.")
+
+	fs.DurationVar(&clusterResourceSetTimeout, "clusterresourceset-reconcile-timeout", 0,
+		"Maximum time a ClusterResourceSet reconcile spends applying resources before the remaining clusters are retried later. Disabled when 0.")
+
+	fs.IntVar(&clusterResourceSetWorkers, "clusterresourceset-apply-workers", 1,
+		"Number of resources of a ClusterResourceSet applied concurrently to a cluster. Resources requiring existing objects are still applied in order.")
+
+	fs.DurationVar(&clusterResourceSetNoMatchWarn, "clusterresourceset-no-matching-clusters-threshold", time.Hour,
+		"How long a ClusterResourceSet can match no cluster before a warning is reported, as it is likely misconfigured. Disabled when 0.")
+
+	fs.DurationVar(&clusterResourceSetExistCheck, "clusterresourceset-existence-check-interval", 0,
+		"How often the objects applied by ClusterResourceSets are checked for existence in the workload clusters, so that deleted objects are applied again (e.g. 30m). Disabled when 0.")
+
+	fs.IntSliceVar(&clusterResourceSetRetryCodes, "clusterresourceset-retryable-status-codes", []int{http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusServiceUnavailable},
+		"HTTP status codes of workload API server responses for which applying an object of a ClusterResourceSet is retried with a backoff before giving up (e.g. 429,500,503,504).")
+
+	fs.IntVar(&clusterResourceSetMaxEvents, "clusterresourceset-max-workload-events", 50,
+		"Maximum number of Events read from each workload cluster for the ClusterResourceSets reporting the Warning Events of their objects.")
+
+	fs.IntVar(&clusterResourceSetMaxObjects, "clusterresourceset-max-cluster-objects", 0,
+		"Maximum number of objects applied by all ClusterResourceSets to each workload cluster, as recorded in its ClusterResourceSetBinding. Unlimited when 0.")
+
+	fs.DurationVar(&clusterResourceSetCompaction, "clusterresourcesetbinding-compaction-interval", time.Hour,
+		"How often ClusterResourceSetBindings are compacted by removing the entries of deleted ClusterResourceSets and duplicated resource records, in addition to when they change (e.g. 1h). Disabled when 0.")
+
 	fs.IntVar(&machineHealthCheckConcurrency, "machinehealthcheck-concurrency", 10,
 		"Number of machine health checks to process simultaneously")
 
@@ -207,6 +279,8 @@ func setupReconcilers(mgr ctrl.Manager) {
 	tracker, err := remote.NewClusterCacheTracker(
 		ctrl.Log.WithName("remote").WithName("ClusterCacheTracker"),
 		mgr,
+		remote.WithCapacity(clusterCacheCapacity),
+		remote.WithDefaultProxyURL(clusterProxyURL),
 	)
 	if err != nil {
 		setupLog.Error(err, "unable to create cluster cache tracker")
@@ -264,13 +338,36 @@ func setupReconcilers(mgr ctrl.Manager) {
 
 	if feature.Gates.Enabled(feature.ClusterResourceSet) {
 		if err := (&addonscontrollers.ClusterResourceSetReconciler{
-			Client:  mgr.GetClient(),
-			Log:     ctrl.Log.WithName("controllers").WithName("ClusterResourceSet"),
-			Tracker: tracker,
+			Client:                      mgr.GetClient(),
+			Log:                         ctrl.Log.WithName("controllers").WithName("ClusterResourceSet"),
+			Tracker:                     tracker,
+			SharedNamespace:             clusterResourceSetSharedNS,
+			RequireSecretSourceLabel:    clusterResourceSetLabeledOnly,
+			MinApplyInterval:            clusterResourceSetMinInterval,
+			AcceptedSecretTypes:         clusterResourceSetSecretTypes,
+			ApplyConflictRetries:        clusterResourceSetConflicts,
+			ForceOwnershipOnConflict:    clusterResourceSetForceOwner,
+			MaxBindingsPerCluster:       clusterResourceSetMaxBindings,
+			ManagementClusterEndpoints:  clusterResourceSetMgmtHosts,
+			ReconcileTimeout:            clusterResourceSetTimeout,
+			ApplyWorkers:                clusterResourceSetWorkers,
+			NoMatchingClustersThreshold: clusterResourceSetNoMatchWarn,
+			ExistenceCheckInterval:      clusterResourceSetExistCheck,
+			RetryableStatusCodes:        clusterResourceSetRetryCodes,
+			MaxWorkloadEvents:           clusterResourceSetMaxEvents,
+			MaxClusterObjects:           clusterResourceSetMaxObjects,
 		}).SetupWithManager(mgr, concurrency(clusterResourceSetConcurrency)); err != nil {
 			setupLog.Error(err, "unable to create controller", "controller", "ClusterResourceSet")
 			os.Exit(1)
 		}
+		if err := (&addonscontrollers.ClusterResourceSetBindingReconciler{
+			Client:             mgr.GetClient(),
+			Log:                ctrl.Log.WithName("controllers").WithName("ClusterResourceSetBinding"),
+			CompactionInterval: clusterResourceSetCompaction,
+		}).SetupWithManager(mgr, concurrency(clusterResourceSetConcurrency)); err != nil {
+			setupLog.Error(err, "unable to create controller", "controller", "ClusterResourceSetBinding")
+			os.Exit(1)
+		}
 	}
 
 	if err := (&controllers.MachineHealthCheckReconciler{
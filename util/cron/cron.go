@@ -0,0 +1,157 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package cron implements the standard cron schedule expressions.
+package cron
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// searchLimit bounds the search for the next time matching a schedule, e.g. for "0 0 30 2 *" which never matches.
+const searchLimit = 5 * 365 * 24 * time.Hour
+
+// Schedule is a parsed cron expression with the minute, hour, day of month, month and day of week fields.
+type Schedule struct {
+	minute, hour, dayOfMonth, month, dayOfWeek uint64
+
+	// A day matches when both the day of month and the day of week match if either of them is a wildcard, otherwise
+	// when either of them matches, like in the standard cron.
+	dayOfMonthWildcard, dayOfWeekWildcard bool
+}
+
+// Parse parses a cron expression with five fields separated by spaces: minute (0-59), hour (0-23), day of month
+// (1-31), month (1-12) and day of week (0-7, where both 0 and 7 are Sunday). Each field is a wildcard "*", a value,
+// a range "a-b" or a comma-separated list of them, and wildcards and ranges can have a step, e.g. "*/15" or "1-5/2".
+func Parse(expression string) (*Schedule, error) {
+	fields := strings.Fields(expression)
+	if len(fields) != 5 {
+		return nil, errors.Errorf("expected 5 fields in cron expression %q, got %d", expression, len(fields))
+	}
+
+	var err error
+	s := &Schedule{
+		dayOfMonthWildcard: strings.HasPrefix(fields[2], "*"),
+		dayOfWeekWildcard:  strings.HasPrefix(fields[4], "*"),
+	}
+	if s.minute, err = parseField(fields[0], 0, 59); err != nil {
+		return nil, errors.Wrap(err, "invalid minute field")
+	}
+	if s.hour, err = parseField(fields[1], 0, 23); err != nil {
+		return nil, errors.Wrap(err, "invalid hour field")
+	}
+	if s.dayOfMonth, err = parseField(fields[2], 1, 31); err != nil {
+		return nil, errors.Wrap(err, "invalid day of month field")
+	}
+	if s.month, err = parseField(fields[3], 1, 12); err != nil {
+		return nil, errors.Wrap(err, "invalid month field")
+	}
+	if s.dayOfWeek, err = parseField(fields[4], 0, 7); err != nil {
+		return nil, errors.Wrap(err, "invalid day of week field")
+	}
+	// Sunday is both 0 and 7.
+	if s.dayOfWeek&(1<<7) != 0 {
+		s.dayOfWeek |= 1
+	}
+	return s, nil
+}
+
+// parseField returns the bit set of the values of a field between min and max.
+func parseField(field string, min, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rangePart, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step <= 0 {
+				return 0, errors.Errorf("invalid step in %q", part)
+			}
+			rangePart = part[:i]
+		}
+
+		low, high := min, max
+		switch {
+		case rangePart == "*":
+		case strings.Contains(rangePart, "-"):
+			bounds := strings.SplitN(rangePart, "-", 2)
+			var err error
+			if low, err = strconv.Atoi(bounds[0]); err != nil {
+				return 0, errors.Errorf("invalid range %q", rangePart)
+			}
+			if high, err = strconv.Atoi(bounds[1]); err != nil {
+				return 0, errors.Errorf("invalid range %q", rangePart)
+			}
+		default:
+			value, err := strconv.Atoi(rangePart)
+			if err != nil {
+				return 0, errors.Errorf("invalid value %q", rangePart)
+			}
+			low = value
+			// A value with a step starts a range, e.g. "5/15" is "5-59/15" for minutes.
+			if step == 1 {
+				high = value
+			}
+		}
+		if low < min || high > max || low > high {
+			return 0, errors.Errorf("%q is out of the range %d-%d", rangePart, min, max)
+		}
+		for value := low; value <= high; value += step {
+			bits |= 1 << uint(value)
+		}
+	}
+	return bits, nil
+}
+
+// Next returns the earliest time at or after t, rounded up to the minute, matching the schedule in the location of t.
+// It returns the zero time if the schedule does not match within five years.
+func (s *Schedule) Next(t time.Time) time.Time {
+	next := t.Truncate(time.Minute)
+	if next.Before(t) {
+		next = next.Add(time.Minute)
+	}
+
+	limit := next.Add(searchLimit)
+	for next.Before(limit) {
+		year, month, day := next.Date()
+		switch {
+		case s.month&(1<<uint(month)) == 0:
+			next = time.Date(year, month+1, 1, 0, 0, 0, 0, next.Location())
+		case !s.matchesDay(next):
+			next = time.Date(year, month, day+1, 0, 0, 0, 0, next.Location())
+		case s.hour&(1<<uint(next.Hour())) == 0:
+			next = time.Date(year, month, day, next.Hour()+1, 0, 0, 0, next.Location())
+		case s.minute&(1<<uint(next.Minute())) == 0:
+			next = next.Add(time.Minute)
+		default:
+			return next
+		}
+	}
+	return time.Time{}
+}
+
+// matchesDay returns true if the day of t matches the day of month and day of week fields of the schedule.
+func (s *Schedule) matchesDay(t time.Time) bool {
+	dayOfMonth := s.dayOfMonth&(1<<uint(t.Day())) != 0
+	dayOfWeek := s.dayOfWeek&(1<<uint(t.Weekday())) != 0
+	if s.dayOfMonthWildcard || s.dayOfWeekWildcard {
+		return dayOfMonth && dayOfWeek
+	}
+	return dayOfMonth || dayOfWeek
+}
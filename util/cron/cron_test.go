@@ -0,0 +1,110 @@
+/*
+Copyright 2020 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cron
+
+import (
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name       string
+		expression string
+		expectErr  bool
+	}{
+		{name: "should parse wildcards", expression: "* * * * *"},
+		{name: "should parse values, ranges, lists and steps", expression: "*/15 1-5/2 1,15 1-12 0-7"},
+		{name: "should reject too few fields", expression: "0 2 * *", expectErr: true},
+		{name: "should reject values out of range", expression: "60 * * * *", expectErr: true},
+		{name: "should reject reversed ranges", expression: "* 5-1 * * *", expectErr: true},
+		{name: "should reject invalid steps", expression: "*/0 * * * *", expectErr: true},
+		{name: "should reject names", expression: "0 2 * * SAT", expectErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			_, err := Parse(tt.expression)
+			if tt.expectErr {
+				g.Expect(err).To(HaveOccurred())
+				return
+			}
+			g.Expect(err).NotTo(HaveOccurred())
+		})
+	}
+}
+
+func TestScheduleNext(t *testing.T) {
+	// Thursday.
+	now := time.Date(2020, time.October, 15, 10, 30, 20, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		expression string
+		expected   time.Time
+	}{
+		{
+			name:       "should round up to the next minute",
+			expression: "* * * * *",
+			expected:   time.Date(2020, time.October, 15, 10, 31, 0, 0, time.UTC),
+		},
+		{
+			name:       "should find the next matching hour",
+			expression: "0 2 * * *",
+			expected:   time.Date(2020, time.October, 16, 2, 0, 0, 0, time.UTC),
+		},
+		{
+			name:       "should find the next matching day of week",
+			expression: "0 2 * * 6",
+			expected:   time.Date(2020, time.October, 17, 2, 0, 0, 0, time.UTC),
+		},
+		{
+			name:       "should treat 7 as Sunday",
+			expression: "0 2 * * 7",
+			expected:   time.Date(2020, time.October, 18, 2, 0, 0, 0, time.UTC),
+		},
+		{
+			name:       "should match either the day of month or the day of week when both are set",
+			expression: "0 0 1 * 6",
+			expected:   time.Date(2020, time.October, 17, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:       "should find the next matching month",
+			expression: "0 0 1 1 *",
+			expected:   time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:       "should return the zero time for schedules that never match",
+			expression: "0 0 30 2 *",
+			expected:   time.Time{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewWithT(t)
+
+			schedule, err := Parse(tt.expression)
+			g.Expect(err).NotTo(HaveOccurred())
+			g.Expect(schedule.Next(now)).To(Equal(tt.expected))
+		})
+	}
+}